@@ -113,6 +113,41 @@ func BenchmarkPipe_Reduce_WithInitial(b *testing.B) {
 	runPipeBenchmark(b, `arr |reduce: ($acc || initial) + $item`, params)
 }
 
+// ============================================================================
+// AGGREGATION PIPE BENCHMARKS
+// ============================================================================
+
+// Compare with BenchmarkPipe_Reduce_Sum: a bare $item projection never runs the VM.
+func BenchmarkPipe_Sum_Identity(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |sum: $item`, params)
+}
+
+func BenchmarkPipe_Sum_Projection(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |sum: $item.value`, params)
+}
+
+func BenchmarkPipe_Avg_Projection(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |avg: $item.value`, params)
+}
+
+func BenchmarkPipe_Max_Identity(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |max: $item`, params)
+}
+
+func BenchmarkPipe_MaxBy_Projection(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |maxBy: $item.value`, params)
+}
+
+func BenchmarkPipe_Count_Predicate(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |count: $item > 50.0`, params)
+}
+
 // ============================================================================
 // FIND PIPE BENCHMARKS
 // ============================================================================
@@ -216,6 +251,70 @@ func BenchmarkPipe_GroupBy_Expression(b *testing.B) {
 	runPipeBenchmark(b, `arr |groupBy: $item % 10.0`, params)
 }
 
+// ============================================================================
+// SHAPING PIPE BENCHMARKS
+// ============================================================================
+
+func BenchmarkPipe_Zip_TwoArrays(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100), "objs": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `[arr, objs] |zip: $item`, params)
+}
+
+func BenchmarkPipe_Partition(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |partition: $item > 50.0`, params)
+}
+
+// Compare with BenchmarkPipe_Unique_ManyDuplicates: keys are not stringified.
+func BenchmarkPipe_DistinctBy_Identity(b *testing.B) {
+	arr := make([]any, 100)
+	for i := 0; i < 100; i++ {
+		arr[i] = float64((i % 10) + 1)
+	}
+	params := map[string]any{"arr": arr}
+	runPipeBenchmark(b, `arr |distinctBy: $item`, params)
+}
+
+func BenchmarkPipe_DistinctBy_Field(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |distinctBy: $item.value`, params)
+}
+
+func BenchmarkPipe_IndexBy(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |indexBy: $item.id`, params)
+}
+
+func BenchmarkPipe_CountBy(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestObjects(100)}
+	runPipeBenchmark(b, `arr |countBy: $item.value`, params)
+}
+
+func BenchmarkPipe_Take_Identity(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |take(10): $item`, params)
+}
+
+// Only the taken elements of the range are ever produced.
+func BenchmarkPipe_Take_Range(b *testing.B) {
+	runPipeBenchmark(b, `0..<1000000 |take(10): $item * 2`, nil)
+}
+
+func BenchmarkPipe_Skip_Identity(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |skip(90): $item`, params)
+}
+
+func BenchmarkPipe_TakeWhile_EarlyExit(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |takeWhile: $item < 10.0`, params)
+}
+
+func BenchmarkPipe_SkipWhile_EarlyExit(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(100)}
+	runPipeBenchmark(b, `arr |skipWhile: $item < 10.0`, params)
+}
+
 // ============================================================================
 // WINDOW PIPE BENCHMARKS
 // ============================================================================
@@ -262,3 +361,32 @@ func BenchmarkPipe_Chain_Complex(b *testing.B) {
 	params := map[string]any{"arr": createPipeTestArray(100)}
 	runPipeBenchmark(b, `arr |filter: $item > 25.0 |map: $item * 2.0 |filter: $item < 150.0 |reduce: ($acc || 0) + $item`, params)
 }
+
+// Fused chains: no intermediate arrays, and find/take stop the upstream stages.
+func BenchmarkPipe_Chain_FilterMapFind_EarlyExit(b *testing.B) {
+	params := map[string]any{"arr": createPipeTestArray(1000)}
+	runPipeBenchmark(b, `arr |filter: $item > 10.0 |map: $item * 2.0 |find: $item > 40.0`, params)
+}
+
+func BenchmarkPipe_Chain_MapTake_Range(b *testing.B) {
+	runPipeBenchmark(b, `0..<1000000 |map: $item * 2.0 |take(10): $item`, nil)
+}
+
+// ============================================================================
+// PARALLEL PIPE BENCHMARKS
+// ============================================================================
+
+// Compare with BenchmarkPipe_Map_Objects_100k: same work across GOMAXPROCS goroutines.
+func BenchmarkPipe_PMap_Objects_100k(b *testing.B) {
+	params := map[string]any{"objs": createPipeTestObjects(100000)}
+	runPipeBenchmark(b, `objs |pmap: $item.value * 2.0 + $item.id`, params)
+}
+
+func BenchmarkPipe_Map_Objects_100k(b *testing.B) {
+	params := map[string]any{"objs": createPipeTestObjects(100000)}
+	runPipeBenchmark(b, `objs |map: $item.value * 2.0 + $item.id`, params)
+}
+
+func BenchmarkPipe_PFilter_Range_100k(b *testing.B) {
+	runPipeBenchmark(b, `0..<100000 |pfilter: $item % 7.0 == 0.0`, nil)
+}
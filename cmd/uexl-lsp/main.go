@@ -0,0 +1,59 @@
+// Command uexl-lsp is a Language Server Protocol server for UExL expressions.
+// Editors start it and talk to it over standard input and output.
+//
+// Usage:
+//
+//	uexl-lsp [-symbols FILE]
+//
+// The symbols file, JSON or YAML, describes the variables, functions and
+// pipes the host application makes available to expressions (see
+// lsp.Symbols). Without it, expressions are checked against the built-in
+// functions and pipes only.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/lsp"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run serves one client and returns the process exit code: 0 after a clean
+// shutdown, 1 otherwise.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("uexl-lsp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	symbolsPath := fs.String("symbols", "", "read the host's variables, functions and pipes from the JSON or YAML `FILE`")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl-lsp [-symbols FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 1
+	}
+
+	var symbols *lsp.Symbols
+	if *symbolsPath != "" {
+		var err error
+		if symbols, err = lsp.LoadSymbols(*symbolsPath); err != nil {
+			fmt.Fprintf(stderr, "uexl-lsp: %v\n", err)
+			return 1
+		}
+	}
+	if err := lsp.NewServer(uexl.Default(), symbols).Serve(stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "uexl-lsp: %v\n", err)
+		return 1
+	}
+	return 0
+}
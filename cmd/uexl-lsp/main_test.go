@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// messages frames JSON-RPC bodies as a client sends them.
+func messages(bodies ...string) string {
+	var b strings.Builder
+	for _, body := range bodies {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return b.String()
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	symbols := filepath.Join(dir, "symbols.json")
+	if err := os.WriteFile(symbols, []byte(`{"functions": {"discount": {"params": ["price"]}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"funcs": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	session := messages(
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.uexl","text":"discount(1)"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		code  int
+		out   string // substring of stdout
+	}{
+		{"session", []string{"-symbols", symbols}, session, 0, `"diagnostics":[]`},
+		{"unknown function without symbols", nil, session, 0, `unknown function \"discount\"`},
+		{"end of input", nil, "", 1, ""},
+		{"bad flag", []string{"-nope"}, "", 1, ""},
+		{"extra argument", []string{"x"}, "", 1, ""},
+		{"missing symbols file", []string{"-symbols", filepath.Join(dir, "none.json")}, "", 1, ""},
+		{"invalid symbols file", []string{"-symbols", bad}, "", 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr: %s)", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.out) {
+				t.Errorf("stdout = %s, want it to contain %s", stdout.String(), tt.out)
+			}
+		})
+	}
+}
@@ -5,15 +5,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"strings"
 	"syscall/js"
 	"time"
 
-	"github.com/maniartech/uexl/code"
 	"github.com/maniartech/uexl/compiler"
 	"github.com/maniartech/uexl/parser"
 	"github.com/maniartech/uexl/parser/errors"
-	"github.com/maniartech/uexl/types"
 	"github.com/maniartech/uexl/vm"
 )
 
@@ -123,7 +120,7 @@ func jsEvalUExL(_ js.Value, args []js.Value) any {
 		ContextTime:      contextTime,
 		CompilationTime:  compilationTime,
 		ExecutionTime:    executionTime,
-		Bytecode:         disassemble(comp.ByteCode()),
+		Bytecode:         compiler.Disassemble(comp.ByteCode()),
 		CompiledBytecode: string(compiledBytecode),
 	})
 }
@@ -154,7 +151,7 @@ func jsCompile(_ js.Value, args []js.Value) any {
 	return respond(evalResponse{
 		Ok:               true,
 		CompilationTime:  compilationTime,
-		Bytecode:         disassemble(comp.ByteCode()),
+		Bytecode:         compiler.Disassemble(comp.ByteCode()),
 		CompiledBytecode: string(compiledBytecode),
 	})
 }
@@ -267,72 +264,6 @@ func jsBenchmarkBytecode(_ js.Value, args []js.Value) any {
 	})
 }
 
-// disassemble formats the bytecode as a human-readable string,
-// with pipe predicate blocks inlined (indented) under their OpPipe line.
-func disassemble(bc *compiler.ByteCode) string {
-	var sb strings.Builder
-
-	// Context variables
-	if len(bc.ContextVars) > 0 {
-		sb.WriteString("=== Context Vars ===\n")
-		for i, v := range bc.ContextVars {
-			sb.WriteString(fmt.Sprintf("%04d  %s\n", i, v))
-		}
-		sb.WriteString("\n")
-	}
-
-	// Instructions, with pipe blocks inlined
-	sb.WriteString("=== Instructions ===\n")
-	writeInstructions(&sb, bc.Instructions, bc.Constants, "")
-
-	return sb.String()
-}
-
-// writeInstructions writes a disassembled instruction stream to sb.
-// prefix is prepended to every line (used for indenting pipe blocks).
-func writeInstructions(sb *strings.Builder, ins code.Instructions, constants []types.Value, prefix string) {
-	i := 0
-	for i < len(ins) {
-		op := code.Opcode(ins[i])
-		def, err := code.Lookup(ins[i])
-		if err != nil {
-			sb.WriteString(fmt.Sprintf("%sERROR: %s\n", prefix, err))
-			i++
-			continue
-		}
-		operands, read := code.ReadOperands(def, ins[i+1:])
-
-		line := fmt.Sprintf("%s%04d %s %v\n", prefix, i, op.String(), operands)
-		sb.WriteString(line)
-
-		// For OpPipe, inline the predicate block indented beneath
-		if op == code.OpPipe && len(operands) == 3 {
-			pipeTypeIdx := operands[0]
-			blockIdx := operands[2]
-
-			// Resolve pipe name from constants
-			pipeName := "pipe"
-			if pipeTypeIdx >= 0 && pipeTypeIdx < len(constants) {
-				if s, ok := constants[pipeTypeIdx].AnyVal.(string); ok {
-					pipeName = s
-				} else if constants[pipeTypeIdx].IsString() {
-					pipeName = constants[pipeTypeIdx].StrVal
-				}
-			}
-
-			// Resolve the InstructionBlock
-			if blockIdx >= 0 && blockIdx < len(constants) {
-				if blk, ok := constants[blockIdx].AnyVal.(*compiler.InstructionBlock); ok && blk != nil && len(blk.Instructions) > 0 {
-					sb.WriteString(fmt.Sprintf("%s  ; %s predicate:\n", prefix, pipeName))
-					writeInstructions(sb, blk.Instructions, constants, prefix+"  ")
-				}
-			}
-		}
-
-		i += 1 + read
-	}
-}
-
 // parseErrResp converts parser ErrorList or a single ParserError into a response.
 func parseErrResp(err error) evalResponse {
 	switch e := err.(type) {
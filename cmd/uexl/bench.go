@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/maniartech/uexl"
+)
+
+func runBench(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	varsPath := fs.String("vars", "", "load variables from a JSON or YAML `FILE` (\"-\" for stdin)")
+	n := fs.Int("n", 0, "run exactly `N` evaluations instead of timing by -duration")
+	duration := fs.Duration("duration", time.Second, "evaluate repeatedly for this long")
+	warmup := fs.Int("warmup", 100, "untimed evaluations to run first")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl bench [-vars FILE] [-n N | -duration D] [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *n < 0 || *warmup < 0 || (*n == 0 && *duration <= 0) {
+		fmt.Fprintln(stderr, "uexl bench: -n, -warmup and -duration must be positive")
+		return exitUsage
+	}
+	if *file == "-" && *varsPath == "-" {
+		fmt.Fprintln(stderr, "uexl bench: -f and -vars cannot both read stdin")
+		return exitUsage
+	}
+
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl bench: %v\n", err)
+		return exitUsage
+	}
+	vars, err := loadVars(*varsPath, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl bench: %v\n", err)
+		return exitUsage
+	}
+
+	compileStart := time.Now()
+	compiled, code, err := compile(uexl.Default(), expr)
+	if err != nil {
+		reportError(stderr, code, err)
+		return code
+	}
+	compileTime := time.Since(compileStart)
+
+	ctx := context.Background()
+	for i := 0; i < *warmup; i++ {
+		if _, err := compiled.Eval(ctx, vars); err != nil {
+			reportError(stderr, exitRuntime, err)
+			return exitRuntime
+		}
+	}
+
+	// Check the clock every batch evaluations so time.Now stays off the hot path.
+	const batch = 64
+	iterations := 0
+	start := time.Now()
+	for {
+		for i := 0; i < batch && (*n == 0 || iterations < *n); i++ {
+			if _, err := compiled.Eval(ctx, vars); err != nil {
+				reportError(stderr, exitRuntime, err)
+				return exitRuntime
+			}
+			iterations++
+		}
+		if *n > 0 && iterations >= *n || *n == 0 && time.Since(start) >= *duration {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	nsPerOp := float64(elapsed.Nanoseconds()) / float64(iterations)
+	fmt.Fprintf(stdout, "compile     %v\n", compileTime)
+	fmt.Fprintf(stdout, "iterations  %d\n", iterations)
+	fmt.Fprintf(stdout, "elapsed     %v\n", elapsed)
+	fmt.Fprintf(stdout, "ns/op       %.1f\n", nsPerOp)
+	fmt.Fprintf(stdout, "ops/sec     %.0f\n", 1e9/nsPerOp)
+	return exitOK
+}
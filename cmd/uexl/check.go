@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/lint"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+)
+
+// checkResult is the JSON report for one checked expression.
+type checkResult struct {
+	Source string            `json:"source"`
+	OK     bool              `json:"ok"`
+	Stage  string            `json:"stage,omitempty"` // "parse", "compile" or "lint" when !OK
+	Errors []checkError      `json:"errors,omitempty"`
+	Lint   []lint.Diagnostic `json:"lint,omitempty"`
+}
+
+// checkError is a parse or compile error of a checkResult. It has the fields
+// of parsererrors.ParserError, but leaves out line and column when the
+// position is unknown.
+type checkError struct {
+	Code     parsererrors.ErrorCode `json:"code"`
+	Message  string                 `json:"message"`
+	Line     int                    `json:"line,omitempty"`
+	Column   int                    `json:"column,omitempty"`
+	Token    string                 `json:"token,omitempty"`
+	Expected string                 `json:"expected,omitempty"`
+	Context  string                 `json:"context,omitempty"`
+}
+
+// linting configures the -lint pass of check.
+type linting struct {
+	linter *lint.Linter // nil without -lint
+	failOn lint.Severity
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ", ") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var exprs stringList
+	fs.Var(&exprs, "e", "check the inline `EXPR` (repeatable)")
+	funcs := fs.String("funcs", "", "comma-separated host `NAMES` to accept as registered functions")
+	lintOn := fs.Bool("lint", false, "also report suspicious code (see package lint)")
+	types := fs.String("types", "", "JSON or YAML `FILE` mapping variables to types for -lint, e.g. {order: object, note: string?}")
+	var severities stringList
+	fs.Var(&severities, "severity", "set the severity of a lint rule as `RULE=LEVEL` (off, info, warning, error; repeatable)")
+	failOn := fs.String("fail-on", "error", "fail on lint diagnostics of at least this `LEVEL`")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl check [-funcs a,b] [-lint [-types FILE] [-severity RULE=LEVEL]... [-fail-on LEVEL]] [-e EXPR]... [FILE...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if len(exprs) == 0 && fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "uexl check: no expressions or files to check")
+		return exitUsage
+	}
+	var lc linting
+	if *lintOn {
+		var err error
+		if lc, err = newLinting(*types, severities, *failOn, stdin); err != nil {
+			fmt.Fprintf(stderr, "uexl check: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	env := uexl.Default()
+	if *funcs != "" {
+		env = env.Extend(uexl.WithFunctions(stubFunctions(*funcs)))
+	}
+
+	results := make([]checkResult, 0, len(exprs)+fs.NArg())
+	worst := exitOK
+	for _, expr := range exprs {
+		res, code := checkOne(env, lc, expr, expr)
+		results = append(results, res)
+		worst = max(worst, code)
+	}
+	for _, path := range fs.Args() {
+		data, err := readFile(path, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "uexl check: %v\n", err)
+			return exitUsage
+		}
+		res, code := checkOne(env, lc, path, string(data))
+		results = append(results, res)
+		worst = max(worst, code)
+	}
+
+	if err := writeJSON(stdout, results, true); err != nil {
+		fmt.Fprintf(stderr, "uexl check: %v\n", err)
+		return exitUsage
+	}
+	return worst
+}
+
+// checkOne parses, compiles and, with -lint, lints expr, reporting it under
+// the name source.
+func checkOne(env *uexl.Env, lc linting, source, expr string) (checkResult, int) {
+	_, code, err := compile(env, expr)
+	res := checkResult{Source: source, OK: err == nil}
+	switch code {
+	case exitParse:
+		res.Stage = stageNames[code]
+		for _, pe := range parserErrors(err) {
+			res.Errors = append(res.Errors, checkError(pe))
+		}
+		return res, code // nothing to lint
+	case exitCompile:
+		ce := checkError{Code: "compile-error", Message: stageMessage(code, err)}
+		var at *uexl.CompileError
+		if errors.As(err, &at) {
+			ce.Line, ce.Column = at.Line, at.Column
+		}
+		res.Stage, res.Errors = stageNames[code], []checkError{ce}
+	}
+	if lc.linter == nil {
+		return res, code
+	}
+	res.Lint, _ = lc.linter.Lint(expr) // expr parsed above
+	for _, d := range res.Lint {
+		if res.OK && d.Severity >= lc.failOn {
+			res.OK, res.Stage, code = false, stageNames[exitLint], exitLint
+		}
+	}
+	return res, code
+}
+
+// newLinting builds the linter of check -lint from its flags.
+func newLinting(typesFile string, severities []string, failOn string, stdin io.Reader) (linting, error) {
+	l := lint.New()
+	known := map[string]bool{}
+	for _, r := range l.Rules {
+		known[r.Name()] = true
+	}
+	l.Severity = map[string]lint.Severity{}
+	for _, s := range severities {
+		name, level, ok := strings.Cut(s, "=")
+		if !ok || !known[name] {
+			return linting{}, fmt.Errorf("invalid -severity %q: want RULE=LEVEL with a rule of package lint", s)
+		}
+		sev, err := lint.ParseSeverity(level)
+		if err != nil {
+			return linting{}, fmt.Errorf("invalid -severity %q: %w", s, err)
+		}
+		l.Severity[name] = sev
+	}
+	threshold, err := lint.ParseSeverity(failOn)
+	if err != nil || threshold == lint.Off {
+		return linting{}, fmt.Errorf("invalid -fail-on %q: want info, warning or error", failOn)
+	}
+	types, err := loadVars(typesFile, stdin)
+	if err != nil {
+		return linting{}, err
+	}
+	l.Variables = map[string]string{}
+	for name, v := range types {
+		typ, ok := v.(string)
+		if !ok {
+			return linting{}, fmt.Errorf("invalid types file %s: the type of %q must be a string", typesFile, name)
+		}
+		l.Variables[name] = typ
+	}
+	return linting{linter: l, failOn: threshold}, nil
+}
+
+// stubFunctions registers names as functions so that expressions calling host
+// functions pass the compile-time function check. The stubs are never run.
+func stubFunctions(names string) uexl.Functions {
+	fns := uexl.Functions{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			fns[name] = func(args ...any) (any, error) {
+				return nil, fmt.Errorf("%s: stub function cannot be called", name)
+			}
+		}
+	}
+	return fns
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maniartech/uexl"
+)
+
+func runCover(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cover", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	var vectors stringList
+	fs.Var(&vectors, "vars", "evaluate with the variables of a JSON or YAML `FILE` (repeatable; one test vector each)")
+	format := fs.String("format", "text", "report `FORMAT`: text, json, lcov or html")
+	out := fs.String("o", "", "write the report to `FILE` instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl cover [-vars FILE]... [-format text|json|lcov|html] [-o FILE] [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	switch *format {
+	case "text", "json", "lcov", "html":
+	default:
+		fmt.Fprintf(stderr, "uexl cover: unknown format %q\n", *format)
+		return exitUsage
+	}
+	stdins := 0
+	for _, path := range append([]string{*file}, vectors...) {
+		if path == "-" {
+			stdins++
+		}
+	}
+	if stdins > 1 {
+		fmt.Fprintln(stderr, "uexl cover: only one of -f and -vars can read stdin")
+		return exitUsage
+	}
+
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl cover: %v\n", err)
+		return exitUsage
+	}
+	suite := make([]map[string]any, 0, len(vectors))
+	for _, path := range vectors {
+		vars, err := loadVars(path, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "uexl cover: %v\n", err)
+			return exitUsage
+		}
+		suite = append(suite, vars)
+	}
+	if len(suite) == 0 {
+		suite = append(suite, nil)
+	}
+
+	compiled, code, err := compile(uexl.Default(), expr)
+	if err != nil {
+		reportError(stderr, code, err)
+		return code
+	}
+	// A vector that fails still covers the branches it ran; report the
+	// failure and go on.
+	cov := uexl.NewCoverage(compiled)
+	status := exitOK
+	for i, vars := range suite {
+		if _, err := cov.Eval(context.Background(), vars); err != nil {
+			if len(vectors) > 0 {
+				fmt.Fprintf(stderr, "%s: ", vectors[i])
+			}
+			reportError(stderr, exitRuntime, err)
+			status = exitRuntime
+		}
+	}
+
+	w := stdout
+	var f *os.File
+	if *out != "" {
+		if f, err = os.Create(*out); err != nil {
+			fmt.Fprintf(stderr, "uexl cover: %v\n", err)
+			return exitUsage
+		}
+		w = f
+	}
+	name := *file
+	if name == "" || name == "-" {
+		name = "expr.uexl"
+	}
+	report := cov.Report()
+	switch *format {
+	case "text":
+		_, err = io.WriteString(w, report.String())
+	case "json":
+		err = writeJSON(w, report, true)
+	case "lcov":
+		err = report.WriteLCOV(w, name)
+	case "html":
+		err = report.WriteHTML(w, name)
+	}
+	if f != nil {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl cover: %v\n", err)
+		return exitUsage
+	}
+	return status
+}
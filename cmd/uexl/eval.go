@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/maniartech/uexl"
+)
+
+func runEval(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	varsPath := fs.String("vars", "", "load variables from a JSON or YAML `FILE` (\"-\" for stdin)")
+	pretty := fs.Bool("pretty", false, "indent the JSON result")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl eval [-vars FILE] [-pretty] [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *file == "-" && *varsPath == "-" {
+		fmt.Fprintln(stderr, "uexl eval: -f and -vars cannot both read stdin")
+		return exitUsage
+	}
+
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl eval: %v\n", err)
+		return exitUsage
+	}
+	vars, err := loadVars(*varsPath, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl eval: %v\n", err)
+		return exitUsage
+	}
+
+	compiled, code, err := compile(uexl.Default(), expr)
+	if err != nil {
+		reportError(stderr, code, err)
+		return code
+	}
+	result, err := compiled.Eval(context.Background(), vars)
+	if err != nil {
+		reportError(stderr, exitRuntime, err)
+		return exitRuntime
+	}
+
+	writeResult(stdout, result, *pretty)
+	return exitOK
+}
+
+// writeResult prints v as JSON. Values JSON cannot represent (NaN, Inf) fall
+// back to Go formatting.
+func writeResult(w io.Writer, v any, pretty bool) {
+	if err := writeJSON(w, v, pretty); err != nil {
+		fmt.Fprintf(w, "%v\n", v)
+	}
+}
+
+// writeJSON encodes v to w followed by a newline, leaving <, > and & as is.
+// Nothing is written when v cannot be encoded.
+func writeJSON(w io.Writer, v any, pretty bool) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/maniartech/uexl/format"
+)
+
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	write := fs.Bool("w", false, "write the result back to the -f file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl fmt [-w] [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *write && (*file == "" || *file == "-") {
+		fmt.Fprintln(stderr, "uexl fmt: -w needs a file given with -f")
+		return exitUsage
+	}
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl fmt: %v\n", err)
+		return exitUsage
+	}
+
+	out, err := format.Source(expr)
+	if err != nil {
+		reportError(stderr, exitParse, err)
+		return exitParse
+	}
+	out += "\n"
+	if *write {
+		if out == expr {
+			return exitOK
+		}
+		if err := os.WriteFile(*file, []byte(out), 0o644); err != nil {
+			fmt.Fprintf(stderr, "uexl fmt: %v\n", err)
+			return exitUsage
+		}
+		return exitOK
+	}
+	fmt.Fprint(stdout, out)
+	return exitOK
+}
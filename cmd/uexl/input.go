@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/internal/varsfile"
+	"github.com/maniartech/uexl/parser"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+)
+
+// readFile returns the contents of path, or of stdin when path is "-".
+func readFile(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readExpr returns the expression named by -f (file) or, failing that, the
+// single positional argument.
+func readExpr(file string, args []string, stdin io.Reader) (string, error) {
+	switch {
+	case file != "" && len(args) > 0:
+		return "", fmt.Errorf("give either -f or an expression, not both")
+	case file != "":
+		data, err := readFile(file, stdin)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case len(args) == 1:
+		return args[0], nil
+	case len(args) == 0:
+		return "", fmt.Errorf("missing expression")
+	default:
+		return "", fmt.Errorf("expected one expression, got %d arguments (quote the expression)", len(args))
+	}
+}
+
+// loadVars reads a variables object from a JSON or YAML file (see
+// varsfile.Decode), or from stdin when path is "-". An empty path means no
+// variables.
+func loadVars(path string, stdin io.Reader) (map[string]any, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := readFile(path, stdin)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := varsfile.Decode(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid vars file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// compile parses and compiles expr against env. On failure it also returns
+// the exit code of the stage that failed (exitParse or exitCompile).
+func compile(env *uexl.Env, expr string) (*uexl.CompiledExpr, int, error) {
+	if _, err := parser.ParseString(expr); err != nil {
+		return nil, exitParse, err
+	}
+	compiled, err := env.Compile(expr)
+	if err != nil {
+		return nil, exitCompile, err
+	}
+	return compiled, exitOK, nil
+}
+
+// parseAST parses expr and reports a failure on stderr, returning the exit code.
+func parseAST(expr string, stderr io.Writer) (parser.Node, int) {
+	node, err := parser.ParseString(expr)
+	if err != nil {
+		reportError(stderr, exitParse, err)
+		return nil, exitParse
+	}
+	return node, exitOK
+}
+
+// stageNames labels the failing stage in messages and in check's JSON output.
+var stageNames = map[int]string{
+	exitParse:   "parse",
+	exitCompile: "compile",
+	exitRuntime: "runtime",
+	exitLint:    "lint",
+}
+
+// reportError writes err to stderr, one line per parser error.
+func reportError(stderr io.Writer, code int, err error) {
+	if code == exitParse {
+		for _, pe := range parserErrors(err) {
+			fmt.Fprintf(stderr, "parse error: %s\n", pe.Error())
+		}
+		return
+	}
+	fmt.Fprintf(stderr, "%s error: %s\n", stageNames[code], stageMessage(code, err))
+}
+
+// stageMessage returns err's message without the "compile error: " prefix the
+// Env already adds, so it is not repeated.
+func stageMessage(code int, err error) string {
+	return strings.TrimPrefix(err.Error(), stageNames[code]+" error: ")
+}
+
+// parserErrors flattens the error shapes the parser returns into a list.
+// Errors of any other type become a single ParserError carrying the message.
+func parserErrors(err error) []parsererrors.ParserError {
+	if list, ok := parsererrors.AsList(err); ok {
+		return list
+	}
+	return []parsererrors.ParserError{{Code: parsererrors.ErrUnknown, Message: err.Error()}}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/parser"
+)
+
+func runDisasm(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl disasm [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl disasm: %v\n", err)
+		return exitUsage
+	}
+
+	node, code := parseAST(expr, stderr)
+	if code != exitOK {
+		return code
+	}
+	comp := compiler.New()
+	if err := comp.Compile(node); err != nil {
+		reportError(stderr, exitCompile, err)
+		return exitCompile
+	}
+	fmt.Fprint(stdout, compiler.Disassemble(comp.ByteCode()))
+	return exitOK
+}
+
+func runAST(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ast", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("f", "", "read the expression from `FILE` (\"-\" for stdin)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl ast [-f FILE | EXPR]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	expr, err := readExpr(*file, fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl ast: %v\n", err)
+		return exitUsage
+	}
+
+	node, code := parseAST(expr, stderr)
+	if code != exitOK {
+		return code
+	}
+	fmt.Fprint(stdout, parser.Dump(node))
+	return exitOK
+}
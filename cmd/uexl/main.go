@@ -0,0 +1,93 @@
+// Command uexl evaluates, validates and inspects UExL expressions from the
+// command line.
+//
+// Usage:
+//
+//	uexl eval   [-vars FILE] [-pretty] [-f FILE | EXPR]
+//	uexl check  [-funcs a,b] [-lint [-types FILE] [-severity RULE=LEVEL]... [-fail-on LEVEL]] [-e EXPR]... [FILE...]
+//	uexl disasm [-f FILE | EXPR]
+//	uexl ast    [-f FILE | EXPR]
+//	uexl fmt    [-w] [-f FILE | EXPR]
+//	uexl bench  [-vars FILE] [-n N | -duration D] [-f FILE | EXPR]
+//	uexl cover  [-vars FILE]... [-format text|json|lcov|html] [-o FILE] [-f FILE | EXPR]
+//	uexl repl   [-vars FILE]
+//
+// A FILE of "-" reads standard input. The exit status tells CI scripts which
+// stage failed:
+//
+//	0  success
+//	1  usage or I/O error
+//	2  parse error
+//	3  compile error (e.g. unknown function, invalid pipe arguments)
+//	4  runtime error
+//	5  lint diagnostics at or above the -fail-on level (check -lint)
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes, ordered by pipeline stage so that check can report the worst
+// failure across several inputs with max().
+const (
+	exitOK      = 0
+	exitUsage   = 1
+	exitParse   = 2
+	exitCompile = 3
+	exitRuntime = 4
+	exitLint    = 5
+)
+
+const usage = `usage: uexl <command> [flags] [args]
+
+Commands:
+  eval     evaluate an expression and print the result as JSON
+  check    parse, compile and lint expressions, reporting errors as JSON
+  disasm   print the compiled bytecode of an expression
+  ast      print the parse tree of an expression
+  fmt      print an expression in canonical form
+  bench    measure evaluation speed of an expression
+  cover    report which branches of an expression test vectors exercise
+  repl     evaluate expressions interactively
+
+Run 'uexl <command> -h' for the flags of a command.
+`
+
+// command runs one subcommand with its own arguments.
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"eval":   runEval,
+	"check":  runCheck,
+	"disasm": runDisasm,
+	"ast":    runAST,
+	"fmt":    runFmt,
+	"bench":  runBench,
+	"cover":  runCover,
+	"repl":   runREPL,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches args to a subcommand and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "uexl: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
+	return cmd(args[1:], stdin, stdout, stderr)
+}
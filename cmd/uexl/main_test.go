@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs the CLI in-process and returns its exit code and output.
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr strings.Builder
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"ok", []string{"eval", "1 + 2"}, exitOK},
+		{"no command", nil, exitUsage},
+		{"unknown command", []string{"nope"}, exitUsage},
+		{"missing expression", []string{"eval"}, exitUsage},
+		{"unquoted expression", []string{"eval", "1", "+", "2"}, exitUsage},
+		{"missing vars file", []string{"eval", "-vars", "does-not-exist.json", "1"}, exitUsage},
+		{"parse", []string{"eval", "1 +"}, exitParse},
+		{"compile: unknown function", []string{"eval", "foo(1)"}, exitCompile},
+		{"compile: pipe arguments", []string{"eval", `[1] |take("x"): $item`}, exitCompile},
+		{"runtime", []string{"eval", "x.y.z"}, exitRuntime},
+		{"disasm parse", []string{"disasm", "(1"}, exitParse},
+		{"ast parse", []string{"ast", "[1,"}, exitParse},
+		{"fmt parse", []string{"fmt", "a +"}, exitParse},
+		{"fmt -w without file", []string{"fmt", "-w", "a"}, exitUsage},
+		{"bench runtime", []string{"bench", "-n", "1", "x.y"}, exitRuntime},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLI(t, "", tt.args...)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr: %s)", code, tt.code, stderr)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	dir := t.TempDir()
+	yamlVars := filepath.Join(dir, "vars.yaml")
+	if err := os.WriteFile(yamlVars, []byte("rate: 2\nitems:\n  - {price: 10}\n  - {price: 5}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jsonVars := filepath.Join(dir, "vars.json")
+	if err := os.WriteFile(jsonVars, []byte(`{"name": "uexl"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exprFile := filepath.Join(dir, "rule.uexl")
+	if err := os.WriteFile(exprFile, []byte("// total\nitems |sum: $item.price * rate\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  string
+	}{
+		{"literal", "", []string{"eval", "[1, 2] |map: $item * 2"}, "[2,4]\n"},
+		{"yaml vars", "", []string{"eval", "-vars", yamlVars, "items |map: $item.price * rate"}, "[20,10]\n"},
+		{"json vars", "", []string{"eval", "-vars", jsonVars, "name + '!'"}, "\"uexl!\"\n"},
+		{"vars from stdin", `{"x": 4}`, []string{"eval", "-vars", "-", "x * x"}, "16\n"},
+		{"yaml vars from stdin", "x: 4", []string{"eval", "-vars", "-", "x + 1"}, "5\n"},
+		{"expression file", "", []string{"eval", "-vars", yamlVars, "-f", exprFile}, "30\n"},
+		{"expression from stdin", "1 + 1", []string{"eval", "-f", "-"}, "2\n"},
+		{"pretty", "", []string{"eval", "-pretty", "[1]"}, "[\n  1\n]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+			if code != exitOK {
+				t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("stdout = %q, want %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	_, _, stderr := runCLI(t, "", "eval", "1 +")
+	if !strings.HasPrefix(stderr, "parse error: [unexpected-token] Line 1, Column 4") {
+		t.Errorf("parse stderr = %q", stderr)
+	}
+	_, _, stderr = runCLI(t, "", "eval", "foo(1)")
+	if stderr != "compile error: unknown function \"foo\" — not registered in this environment\n" {
+		t.Errorf("compile stderr = %q", stderr)
+	}
+	_, _, stderr = runCLI(t, "", "eval", "x.y")
+	if !strings.HasPrefix(stderr, "runtime error: ") {
+		t.Errorf("runtime stderr = %q", stderr)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.uexl")
+	bad := filepath.Join(dir, "bad.uexl")
+	if err := os.WriteFile(good, []byte("a && b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad, []byte("a &&\n  (b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := runCLI(t, "", "check", "-e", "score(x)", good, bad)
+	if code != exitCompile {
+		t.Fatalf("exit code = %d, want the highest failing stage %d", code, exitCompile)
+	}
+	var results []struct {
+		Source string `json:"source"`
+		OK     bool   `json:"ok"`
+		Stage  string `json:"stage"`
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Line    int    `json:"line"`
+			Column  int    `json:"column"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if r := results[0]; r.Source != "score(x)" || r.OK || r.Stage != "compile" || len(r.Errors) != 1 || r.Errors[0].Code != "compile-error" || r.Errors[0].Line != 1 || r.Errors[0].Column != 1 {
+		t.Errorf("inline result = %+v", r)
+	}
+	if r := results[1]; r.Source != good || !r.OK || r.Stage != "" || len(r.Errors) != 0 {
+		t.Errorf("good result = %+v", r)
+	}
+	if r := results[2]; r.Source != bad || r.OK || r.Stage != "parse" || len(r.Errors) == 0 || r.Errors[0].Line != 2 || r.Errors[0].Code == "" {
+		t.Errorf("bad result = %+v", r)
+	}
+
+	code, _, _ = runCLI(t, "", "check", "-e", "score(x)")
+	if code != exitCompile {
+		t.Errorf("exit code = %d, want %d", code, exitCompile)
+	}
+	code, stdout, _ = runCLI(t, "", "check", "-funcs", "score, rank", "-e", "score(x) + rank(y)")
+	if code != exitOK || !strings.Contains(stdout, `"ok": true`) {
+		t.Errorf("-funcs: exit code = %d, stdout = %s", code, stdout)
+	}
+	if code, _, _ = runCLI(t, "", "check"); code != exitUsage {
+		t.Errorf("no inputs: exit code = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestCheck_Lint(t *testing.T) {
+	dir := t.TempDir()
+	types := filepath.Join(dir, "types.yaml")
+	if err := os.WriteFile(types, []byte("name: string\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	badTypes := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(badTypes, []byte(`{"name": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, _ := runCLI(t, "", "check", "-lint", "-types", types, "-e", "items |reduce: ($acc || 0) + len(name)")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d: warnings do not fail by default", code, exitOK)
+	}
+	var results []struct {
+		OK    bool   `json:"ok"`
+		Stage string `json:"stage"`
+		Lint  []struct {
+			Rule     string `json:"rule"`
+			Severity string `json:"severity"`
+			Column   int    `json:"column"`
+			Fix      *struct {
+				Edits []struct {
+					NewText string `json:"newText"`
+				} `json:"edits"`
+			} `json:"fix"`
+		} `json:"lint"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &results); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, stdout)
+	}
+	if lint := results[0].Lint; len(lint) != 2 || lint[0].Rule != "reduce-acc-or" || lint[0].Severity != "warning" ||
+		lint[0].Fix == nil || lint[0].Fix.Edits[0].NewText != "??" || lint[1].Rule != "len-on-string" {
+		t.Errorf("lint = %+v", lint)
+	}
+
+	code, stdout, _ = runCLI(t, "", "check", "-lint", "-fail-on", "warning", "-e", "1 > 2 ? a : b")
+	if code != exitLint || !strings.Contains(stdout, `"stage": "lint"`) {
+		t.Errorf("-fail-on warning: exit code = %d, stdout = %s", code, stdout)
+	}
+	code, stdout, _ = runCLI(t, "", "check", "-lint", "-fail-on", "warning", "-severity", "constant-condition=off", "-e", "1 > 2 ? a : b")
+	if code != exitOK || strings.Contains(stdout, `"lint"`) {
+		t.Errorf("-severity off: exit code = %d, stdout = %s", code, stdout)
+	}
+	code, stdout, _ = runCLI(t, "", "check", "-lint", "-e", "nope(1 > 2 ? a : b)")
+	if code != exitCompile || !strings.Contains(stdout, `"stage": "compile"`) || !strings.Contains(stdout, "constant-condition") {
+		t.Errorf("compile error: exit code = %d, stdout = %s", code, stdout)
+	}
+	code, stdout, _ = runCLI(t, "", "check", "-e", "1 > 2 ? a : b")
+	if code != exitOK || strings.Contains(stdout, `"lint"`) {
+		t.Errorf("without -lint: exit code = %d, stdout = %s", code, stdout)
+	}
+
+	for _, args := range [][]string{
+		{"-severity", "nope=off"},
+		{"-severity", "constant-condition"},
+		{"-severity", "constant-condition=loud"},
+		{"-fail-on", "off"},
+		{"-types", badTypes},
+		{"-types", filepath.Join(dir, "missing.json")},
+	} {
+		args = append(append([]string{"check", "-lint"}, args...), "-e", "a")
+		if code, _, _ := runCLI(t, "", args...); code != exitUsage {
+			t.Errorf("%v: exit code = %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func TestDisasm(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "disasm", "[1, 2] |filter: $item > x")
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	for _, want := range []string{"=== Context Vars ===\n0000  x\n", "OpPipe", "  ; filter predicate:\n", "  0006 OpGreaterThan []\n"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("disasm output missing %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestAST(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "ast", "a.b[0] ?? f(1, 'x')")
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	want := `BinaryExpression Operator="??" @1:8
+  Left: IndexAccess @1:4
+    Target: MemberAccess Property="b" @1:2
+      Target: Identifier Name="a" @1:1
+    Index: NumberLiteral Value=0 @1:5
+  Right: FunctionCall @1:12
+    Function: Identifier Name="f" @1:11
+    Arguments[0]: NumberLiteral Value=1 @1:13
+    Arguments[1]: StringLiteral Value="x" Token="'x'" IsSingleQuoted=true @1:16
+`
+	if stdout != want {
+		t.Errorf("ast output:\n%s\nwant:\n%s", stdout, want)
+	}
+
+	_, stdout, _ = runCLI(t, "", "ast", "xs |map as $x: {'k': $x}")
+	for _, want := range []string{"Program @", `PipeExpression PipeType="map" Alias="$x" Index=1`, `Properties["k"]: Identifier Name="$x"`} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("pipe ast output missing %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	code, stdout, _ := runCLI(t, "", "fmt", "xs|filter:$item>1|map:{'b':$item,'a':(1+2)*3}")
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	if want := "xs |filter: $item > 1 |map: {\"a\": (1 + 2) * 3, \"b\": $item}\n"; stdout != want {
+		t.Errorf("fmt output = %q, want %q", stdout, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "rule.uexl")
+	if err := os.WriteFile(path, []byte("a+b // sum"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := runCLI(t, "", "fmt", "-w", "-f", path); code != exitOK {
+		t.Fatalf("fmt -w exit code = %d (stderr: %s)", code, stderr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "a + b // sum\n" {
+		t.Errorf("fmt -w wrote %q", got)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	dir := t.TempDir()
+	vars := filepath.Join(dir, "vars.json")
+	if err := os.WriteFile(vars, []byte(`{"rate": 3}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, _ := runCLI(t, ":set x = 2\nx * rate\n", "repl", "-vars", vars)
+	if code != exitOK {
+		t.Fatalf("exit code = %d", code)
+	}
+	if want := "uexl> 2\nuexl> 6\nuexl> \n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+}
+
+func TestBench(t *testing.T) {
+	code, stdout, stderr := runCLI(t, `{"x": 2}`, "bench", "-n", "200", "-vars", "-", "x * 3")
+	if code != exitOK {
+		t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+	}
+	for _, want := range []string{"iterations  200\n", "ns/op", "ops/sec"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("bench output missing %q:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	dir := t.TempDir()
+	adult := filepath.Join(dir, "adult.json")
+	minor := filepath.Join(dir, "minor.yaml")
+	if err := os.WriteFile(adult, []byte(`{"age": 30}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(minor, []byte("age: 12\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expr := `age >= 18 ? "adult" : age >= 13 ? "teen" : "child"`
+	code, stdout, stderr := runCLI(t, "", "cover", "-vars", adult, "-vars", minor, expr)
+	if code != exitOK {
+		t.Fatalf("exit code = %d (stderr: %s)", code, stderr)
+	}
+	want := `2 evaluations, 3 of 4 branches covered (75.0%)
+1:13  then  1    "adult"
+1:23  else  1    age >= 13 ? "teen" : "child"
+1:35  then  0  ! "teen"
+1:44  else  1    "child"
+`
+	if stdout != want {
+		t.Errorf("text report:\n%s\nwant:\n%s", stdout, want)
+	}
+
+	out := filepath.Join(dir, "cover.lcov")
+	code, _, stderr = runCLI(t, "", "cover", "-vars", adult, "-format", "lcov", "-o", out, expr)
+	if code != exitOK {
+		t.Fatalf("lcov exit code = %d (stderr: %s)", code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "SF:expr.uexl\nBRDA:1,0,0,1\nBRDA:1,0,1,0\n") {
+		t.Errorf("lcov report:\n%s", data)
+	}
+
+	// A failing vector is reported, and the others still count.
+	code, stdout, stderr = runCLI(t, "", "cover", "-vars", adult, "x.y + 1 > 0 || age > 1")
+	if code != exitRuntime || !strings.Contains(stderr, adult+": runtime error") || !strings.HasPrefix(stdout, "1 evaluation, 1 of 2") {
+		t.Errorf("got %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
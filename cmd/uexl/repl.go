@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/repl"
+)
+
+func runREPL(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	varsPath := fs.String("vars", "", "make the variables in a JSON or YAML `FILE` available as globals")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: uexl repl [-vars FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *varsPath == "-" {
+		fmt.Fprintln(stderr, "uexl repl: -vars cannot read stdin")
+		return exitUsage
+	}
+	vars, err := loadVars(*varsPath, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "uexl repl: %v\n", err)
+		return exitUsage
+	}
+
+	env := uexl.Default()
+	if len(vars) > 0 {
+		env = env.Extend(uexl.WithGlobals(vars))
+	}
+	if err := repl.Run(env, stdin, stdout); err != nil {
+		fmt.Fprintf(stderr, "uexl repl: %v\n", err)
+		return exitUsage
+	}
+	return exitOK
+}
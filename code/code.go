@@ -55,6 +55,12 @@ const (
 	OpSafeModeOff
 	OpStringConcat
 	OpStringPatternMatch
+	OpSetLocal
+	OpGetLocal
+	OpTypeIs
+	OpTypeAs
+	OpRange
+	OpPipeChain
 )
 
 func (op Opcode) String() string {
@@ -115,6 +121,12 @@ var definations = map[Opcode]*Definition{
 	OpSafeModeOff:        {"OpSafeModeOff", []int{}},
 	OpStringConcat:       {"OpStringConcat", []int{2}},          // Takes count of strings to concatenate
 	OpStringPatternMatch: {"OpStringPatternMatch", []int{2, 2}}, // prefix_constant_index, suffix_constant_index
+	OpSetLocal:           {"OpSetLocal", []int{2}},              // pops into program local slot
+	OpGetLocal:           {"OpGetLocal", []int{2}},              // pushes program local slot
+	OpTypeIs:             {"OpTypeIs", []int{2}},                // type_name_constant_index; pushes bool
+	OpTypeAs:             {"OpTypeAs", []int{2}},                // type_name_constant_index; converts top of stack
+	OpRange:              {"OpRange", []int{1}},                 // 1 for exclusive end, 0 for inclusive; pops start, end, step
+	OpPipeChain:          {"OpPipeChain", []int{2}},             // number of OpPipe instructions that follow as one chain
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/parser"
 	"github.com/maniartech/uexl/vm"
 )
 
@@ -14,6 +15,8 @@ import (
 type CompiledExpr struct {
 	bytecode *compiler.ByteCode
 	env      *Env
+	root     parser.Node // the compiled tree, for ExplainEval
+	source   string      // the source text, when compiled from one
 }
 
 // Eval executes the pre-compiled bytecode against vars, honoring ctx for
@@ -23,15 +26,49 @@ type CompiledExpr struct {
 //
 // vars may be nil — treated as an empty map.
 func (c *CompiledExpr) Eval(ctx context.Context, vars map[string]any) (any, error) {
+	return c.eval(ctx, vars, nil)
+}
+
+// eval is Eval that, when failed is not nil and the evaluation fails in an
+// instruction, sets *failed to the node of that instruction.
+func (c *CompiledExpr) eval(ctx context.Context, vars map[string]any, failed *parser.Node) (any, error) {
 	// Check for cancellation before borrowing from pool.
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	if c.env.profiler != nil {
+		return c.env.profiler.eval(ctx, c, vars, failed)
+	}
+	return c.run(ctx, vars, c.env.tracer, failed)
+}
+
+// EvalTrace is Eval with t observing the evaluation, in place of the env's
+// tracer. t sees each instruction with the sub-expression it belongs to (see
+// trace.Recorder for a ready-made one); it can pause the evaluation by
+// blocking, and stop it by cancelling ctx.
+func (c *CompiledExpr) EvalTrace(ctx context.Context, vars map[string]any, t Tracer) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.run(ctx, vars, t, nil)
+}
+
+// run evaluates the expression on a pooled VM with t as its tracer; failed is
+// as for eval.
+func (c *CompiledExpr) run(ctx context.Context, vars map[string]any, t Tracer, failed *parser.Node) (any, error) {
 	machine := c.env.pool.Get().(*vm.VM)
 	defer c.env.pool.Put(machine)
 
 	machine.SetContext(ctx)
-	return machine.Run(c.bytecode, mergeVars(c.env.globals, vars))
+	machine.SetTracer(t)
+	defer machine.SetTracer(nil)
+	out, err := machine.Run(c.bytecode, mergeVars(c.env.globals, vars))
+	if err != nil && failed != nil {
+		if entry, ok := machine.Failure(); ok {
+			*failed = entry.Node
+		}
+	}
+	return out, err
 }
 
 // Variables returns the sorted list of variable names (without $ prefix) that
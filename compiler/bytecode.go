@@ -10,6 +10,10 @@ type ByteCode struct {
 	Constants    []types.Value
 	ContextVars  []string
 	SystemVars   []any
+	NumLocals    int // local slots used by multi-statement programs
+	// SourceMap maps Instructions to the nodes they were compiled from; pipe
+	// predicate and argument blocks carry their own.
+	SourceMap SourceMap
 }
 
 func (c *Compiler) ByteCode() *ByteCode {
@@ -18,5 +22,7 @@ func (c *Compiler) ByteCode() *ByteCode {
 		Constants:    c.constants,
 		ContextVars:  c.contextVars,
 		SystemVars:   c.SystemVars,
+		NumLocals:    len(c.locals),
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
 	}
 }
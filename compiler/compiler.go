@@ -15,6 +15,8 @@ type Compiler struct {
 	SystemVars  []any
 	scopes      []CompilationScope
 	scopeIndex  int
+	locals      map[string]int // statement name -> local slot (multi-statement programs only)
+	node        parser.Node    // innermost node being compiled, recorded in the source map
 }
 
 type EmmittedInstruction struct {
@@ -26,10 +28,25 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmmittedInstruction
 	previousInstruction EmmittedInstruction
+	sourceMap           SourceMap
 }
 
 type InstructionBlock struct {
 	Instructions code.Instructions
+	SourceMap    SourceMap
+	// Implicit is set when the pipe omitted its predicate, as in `xs |sum:`;
+	// the block then evaluates $item.
+	Implicit bool
+}
+
+// ArgsBlock is the compiled argument list of a |name(args): pipe whose
+// arguments are not all literals. Instructions push each argument in the
+// enclosing scope and collect them into an array with OpArray; Count is the
+// number of arguments.
+type ArgsBlock struct {
+	Instructions code.Instructions
+	SourceMap    SourceMap
+	Count        int
 }
 
 type accessStep struct {
@@ -57,7 +74,20 @@ func (c *Compiler) compileShortCircuitChain(terms []parser.Node, jumpOpcode code
 	return nil
 }
 
+// Compile compiles node into the current scope, recording in the source map
+// which instructions each node produced.
 func (c *Compiler) Compile(node parser.Node) error {
+	outer := c.node
+	c.node = node
+	err := c.compile(node)
+	c.node = outer
+	if err == nil {
+		c.markResult(node)
+	}
+	return err
+}
+
+func (c *Compiler) compile(node parser.Node) error {
 	switch node := node.(type) {
 	case *parser.BinaryExpression:
 		left := node.Left
@@ -157,6 +187,35 @@ func (c *Compiler) Compile(node parser.Node) error {
 		case "~":
 			c.emit(code.OpBitwiseNot)
 		}
+	case *parser.TypeExpression:
+		if err := c.Compile(node.Operand); err != nil {
+			return err
+		}
+		typeIdx := c.addConstant(node.TypeName)
+		if node.Operator == "is" {
+			c.emit(code.OpTypeIs, typeIdx)
+		} else {
+			c.emit(code.OpTypeAs, typeIdx)
+		}
+	case *parser.RangeExpression:
+		if err := c.Compile(node.Start); err != nil {
+			return err
+		}
+		if err := c.Compile(node.End); err != nil {
+			return err
+		}
+		if node.Step != nil {
+			if err := c.Compile(node.Step); err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpNull)
+		}
+		exclusive := 0
+		if node.Exclusive {
+			exclusive = 1
+		}
+		c.emit(code.OpRange, exclusive)
 	case *parser.GroupedExpression:
 		// GroupedExpression is just a wrapper - compile the inner expression
 		return c.Compile(node.Expression)
@@ -197,6 +256,9 @@ func (c *Compiler) Compile(node parser.Node) error {
 		endPos := len(c.currentInstructions())
 		c.replaceOperand(jumpToEndPos+1, endPos)
 	case *parser.ProgramNode:
+		if err := checkStageAliases(node); err != nil {
+			return err
+		}
 		// First expression is the entry point will just be normal expression from which we get the result
 		// We will just compile it like a normal expression
 		if len(node.PipeExpressions) > 0 {
@@ -209,8 +271,16 @@ func (c *Compiler) Compile(node parser.Node) error {
 				c.emit(code.OpStore, aliasVarIdx)
 			}
 		}
+		// Consecutive stages are announced as a chain so that the VM can fuse
+		// the streaming-capable ones into a single lazy pass. Which stages can
+		// stream depends on the handlers bound at runtime, so the whole run is
+		// marked and the VM picks the fusable sub-runs.
+		if stages := len(node.PipeExpressions) - 1; stages >= 2 {
+			c.emit(code.OpPipeChain, stages)
+		}
 		// Compile each pipe expression
-		for _, pipeExpr := range node.PipeExpressions[1:] {
+		for i := 1; i < len(node.PipeExpressions); i++ {
+			pipeExpr := &node.PipeExpressions[i]
 			// Compile the pipe's predicate expression block
 			pipeTypeIdx := c.addConstant(pipeExpr.PipeType)
 			aliasIdx := c.addPipeLocalVar(pipeExpr.Alias)
@@ -218,13 +288,21 @@ func (c *Compiler) Compile(node parser.Node) error {
 			if err != nil {
 				return err
 			}
-			// Emit the 4th operand: argsIdx (0xFFFF = no args sentinel)
+			// Emit the 4th operand: argsIdx (0xFFFF = no args sentinel).
+			// Literal-only args are a []any constant; anything else is an *ArgsBlock.
 			argsIdx := 0xFFFF
 			if len(pipeExpr.Args) > 0 {
 				argsIdx = c.addConstant(pipeExpr.Args)
+			} else if len(pipeExpr.ArgExprs) > 0 {
+				argsIdx, err = c.compileArgsBlock(pipeExpr.ArgExprs)
+				if err != nil {
+					return err
+				}
 			}
-			c.emit(code.OpPipe, pipeTypeIdx, aliasIdx, blockIdx, argsIdx)
+			c.emitResult(pipeExpr, code.OpPipe, pipeTypeIdx, aliasIdx, blockIdx, argsIdx)
 		}
+	case *parser.StatementList:
+		return c.CompileProgram(node, nil)
 	case *parser.MemberAccess, *parser.IndexAccess:
 		return c.compileAccessNode(node, false)
 	case *parser.ObjectLiteral:
@@ -263,6 +341,9 @@ func (c *Compiler) Compile(node parser.Node) error {
 		// If identifer begins with a dollar sign, it is a local variable in the pipe context.
 		if isPipeLocalVar(node.Name) {
 			c.emit(code.OpIdentifier, c.addPipeLocalVar(node.Name))
+		} else if slot, ok := c.locals[node.Name]; ok {
+			// Statement names of a multi-statement program shadow context variables.
+			c.emit(code.OpGetLocal, slot)
 		} else {
 			c.emit(code.OpContextVar, c.addContextVar(node.Name))
 		}
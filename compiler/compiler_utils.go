@@ -31,6 +31,7 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	instruction := code.Make(op, operands...)
 	pos := c.addInstruction(instruction)
 	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].sourceMap = append(c.scopes[c.scopeIndex].sourceMap, SourceEntry{Offset: pos, Node: c.node})
 	return pos
 }
 
@@ -88,9 +89,13 @@ func (c *Compiler) exitScope() error {
 	return nil
 }
 
-func (c *Compiler) compilePredicateBlock(expr parser.Node) (int, error) {
-	if expr == nil {
-		return c.addConstant(&InstructionBlock{Instructions: nil}), nil
+// compilePredicateBlock compiles the predicate of a pipe stage into a block of
+// its own. A pipe may omit its predicate; the block then evaluates $item and
+// is marked Implicit, so that the pipe's handler can reject it.
+func (c *Compiler) compilePredicateBlock(expr parser.Expression) (int, error) {
+	implicit := expr == nil
+	if implicit {
+		expr = &parser.Identifier{Name: "$item"}
 	}
 	c.enterScope()
 	err := c.Compile(expr)
@@ -98,11 +103,89 @@ func (c *Compiler) compilePredicateBlock(expr parser.Node) (int, error) {
 		return 0, err
 	}
 	blockIns := c.ByteCode().Instructions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
 
 	if err := c.exitScope(); err != nil {
 		return 0, err
 	}
-	return c.addConstant(&InstructionBlock{Instructions: blockIns}), nil
+	return c.addConstant(&InstructionBlock{Instructions: blockIns, SourceMap: sourceMap, Implicit: implicit}), nil
+}
+
+// checkStageAliases rejects a stage that uses the alias of an earlier stage
+// of its chain. The alias of `|map as $o:` names the stage's item and is only
+// set while its predicate runs, so in `xs |map as $o: $o.lines |filter: $o`
+// the |filter stage, which runs after |map has returned, cannot see $o. The
+// pipe must be nested in the predicate instead.
+func checkStageAliases(node *parser.ProgramNode) error {
+	stages := node.PipeExpressions
+	for i := 1; i < len(stages); i++ {
+		alias := stages[i].Alias
+		if alias == "" || pipeVariables[alias] {
+			continue // a later stage reading $item reads its own
+		}
+		for j := i + 1; j < len(stages) && stages[j].Alias != alias; j++ {
+			if !usesIdentifier(&stages[j], alias) {
+				continue
+			}
+			outer, inner := stageName(stages[i].PipeType), stageName(stages[j].PipeType)
+			return fmt.Errorf("%s is the alias of the %s stage and is only visible in its predicate, not in the %s stage after it; "+
+				"to use it there, nest that pipe in the predicate in parentheses: %s (... %s ...)", alias, outer, inner, outer, inner)
+		}
+	}
+	return nil
+}
+
+// stageName returns how a pipe stage of the given type is written, as |map:.
+func stageName(pipeType string) string {
+	if pipeType == parser.DefaultPipeType {
+		return "|:"
+	}
+	return "|" + pipeType + ":"
+}
+
+// pipeVariables are the variables that pipes set for their predicates.
+var pipeVariables = map[string]bool{
+	"$acc": true, "$chunk": true, "$index": true, "$item": true, "$key": true,
+	"$last": true, "$parent": true, "$value": true, "$window": true,
+}
+
+// usesIdentifier reports whether node refers to the identifier name outside
+// the pipes nested in it that declare name themselves.
+func usesIdentifier(node parser.Node, name string) bool {
+	found := false
+	parser.Inspect(node, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.Identifier:
+			found = found || n.Name == name
+		case *parser.ProgramNode:
+			for _, stage := range n.PipeExpressions[1:] {
+				if stage.Alias == name {
+					return false
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// compileArgsBlock compiles runtime-evaluated pipe arguments into an *ArgsBlock
+// constant and returns its index.
+func (c *Compiler) compileArgsBlock(args []parser.Expression) (int, error) {
+	c.enterScope()
+	for _, arg := range args {
+		if err := c.Compile(arg); err != nil {
+			return 0, err
+		}
+	}
+	c.emit(code.OpArray, len(args))
+	blockIns := c.ByteCode().Instructions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+
+	if err := c.exitScope(); err != nil {
+		return 0, err
+	}
+	return c.addConstant(&ArgsBlock{Instructions: blockIns, SourceMap: sourceMap, Count: len(args)}), nil
 }
 
 func (c *Compiler) addPipeLocalVar(name string) int {
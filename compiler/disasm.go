@@ -0,0 +1,71 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/types"
+)
+
+// Disassemble formats bc as a human-readable listing: the context variables,
+// then the instructions, with each pipe's argument and predicate blocks
+// inlined (indented) under its OpPipe line.
+func Disassemble(bc *ByteCode) string {
+	var sb strings.Builder
+
+	if len(bc.ContextVars) > 0 {
+		sb.WriteString("=== Context Vars ===\n")
+		for i, v := range bc.ContextVars {
+			fmt.Fprintf(&sb, "%04d  %s\n", i, v)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("=== Instructions ===\n")
+	writeInstructions(&sb, bc.Instructions, bc.Constants, "")
+	return sb.String()
+}
+
+// writeInstructions writes a disassembled instruction stream to sb.
+// prefix is prepended to every line (used for indenting pipe blocks).
+func writeInstructions(sb *strings.Builder, ins code.Instructions, constants []types.Value, prefix string) {
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(sb, "%sERROR: %s\n", prefix, err)
+			i++
+			continue
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(sb, "%s%04d %s %v\n", prefix, i, op, operands)
+
+		// OpPipe operands: pipe type, alias, predicate block, args
+		if op == code.OpPipe && len(operands) == 4 {
+			name := "pipe"
+			if s, ok := constantAt(constants, operands[0]).(string); ok {
+				name = s
+			}
+			if blk, ok := constantAt(constants, operands[3]).(*ArgsBlock); ok && blk != nil {
+				fmt.Fprintf(sb, "%s  ; %s args:\n", prefix, name)
+				writeInstructions(sb, blk.Instructions, constants, prefix+"  ")
+			}
+			if blk, ok := constantAt(constants, operands[2]).(*InstructionBlock); ok && blk != nil && len(blk.Instructions) > 0 {
+				fmt.Fprintf(sb, "%s  ; %s predicate:\n", prefix, name)
+				writeInstructions(sb, blk.Instructions, constants, prefix+"  ")
+			}
+		}
+
+		i += 1 + read
+	}
+}
+
+// constantAt returns constants[idx] as a Go value, or nil when idx is out of
+// range (e.g. the 0xFFFF no-args sentinel).
+func constantAt(constants []types.Value, idx int) any {
+	if idx < 0 || idx >= len(constants) {
+		return nil
+	}
+	return constants[idx].ToAny()
+}
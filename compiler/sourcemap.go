@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/parser"
+)
+
+// SourceEntry ties the instruction at Offset to the node it was compiled from.
+type SourceEntry struct {
+	Offset int
+	Node   parser.Node
+	// Result is set on the instruction that completes Node: once it has run,
+	// the top of the stack is the value of Node. Nodes whose value comes from
+	// one of several branches (?:, &&, ||, ??) have no result instruction.
+	Result bool
+}
+
+// SourceMap maps the instructions of a block to the nodes they were compiled
+// from, one entry per instruction in offset order.
+type SourceMap []SourceEntry
+
+// At returns the entry of the instruction at offset.
+func (m SourceMap) At(offset int) (SourceEntry, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset >= offset })
+	if i < len(m) && m[i].Offset == offset {
+		return m[i], true
+	}
+	return SourceEntry{}, false
+}
+
+// markResult marks the last instruction of the current scope as the result
+// of node, if node emitted it and it leaves a value on the stack.
+func (c *Compiler) markResult(node parser.Node) {
+	scope := &c.scopes[c.scopeIndex]
+	n := len(scope.sourceMap)
+	if n == 0 {
+		return
+	}
+	last := &scope.sourceMap[n-1]
+	if last.Node != node || last.Offset != scope.lastInstruction.Position {
+		return
+	}
+	switch scope.lastInstruction.Opcode {
+	case code.OpJump, code.OpJumpIfTruthy, code.OpJumpIfFalsy, code.OpJumpIfNullish,
+		code.OpJumpIfNotNullish, code.OpPop, code.OpSetLocal, code.OpPipeChain:
+		return
+	}
+	last.Result = true
+}
+
+// emitResult emits op as the instruction that completes node.
+func (c *Compiler) emitResult(node parser.Node, op code.Opcode, operands ...int) int {
+	outer := c.node
+	c.node = node
+	pos := c.emit(op, operands...)
+	c.node = outer
+	c.markResult(node)
+	return pos
+}
@@ -0,0 +1,174 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/parser"
+)
+
+// CompileProgram compiles a multi-statement program into a single instruction
+// stream. Statements are evaluated in dependency order (source order where
+// there is no dependency), each result is kept in a local slot, and the stream
+// leaves an object of the requested outputs on the stack.
+//
+// outputs selects which statement names appear in the result object; nil or
+// empty means every statement. Statements not needed by the selected outputs
+// are not compiled. Duplicate names, unknown outputs and dependency cycles are
+// compile errors.
+func (c *Compiler) CompileProgram(list *parser.StatementList, outputs []string) error {
+	byName := make(map[string]*parser.Assignment, len(list.Statements))
+	for _, stmt := range list.Statements {
+		if prev, dup := byName[stmt.Name]; dup {
+			return fmt.Errorf("compile error: %q is assigned twice (line %d, column %d and line %d, column %d)",
+				stmt.Name, prev.Line, prev.Column, stmt.Line, stmt.Column)
+		}
+		byName[stmt.Name] = stmt
+	}
+
+	roots := list.Statements
+	if len(outputs) > 0 {
+		roots = make([]*parser.Assignment, 0, len(outputs))
+		seen := make(map[string]bool, len(outputs))
+		for _, name := range outputs {
+			stmt, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("compile error: unknown output %q", name)
+			}
+			if !seen[name] {
+				seen[name] = true
+				roots = append(roots, stmt)
+			}
+		}
+	}
+
+	order, err := orderAssignments(list.Statements, roots, byName)
+	if err != nil {
+		return err
+	}
+
+	if c.locals == nil {
+		c.locals = make(map[string]int, len(order))
+	}
+	for _, stmt := range order {
+		c.locals[stmt.Name] = len(c.locals)
+	}
+	for _, stmt := range order {
+		if err := c.Compile(stmt.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, c.locals[stmt.Name])
+	}
+
+	names := make([]string, len(roots))
+	for i, stmt := range roots {
+		names[i] = stmt.Name
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.emit(code.OpConstant, c.addConstant(name))
+		c.emit(code.OpGetLocal, c.locals[name])
+	}
+	c.emit(code.OpObject, len(names)*2)
+	return nil
+}
+
+// orderAssignments returns the statements reachable from roots in evaluation
+// order: every statement comes after the statements it references. Ties are
+// broken by source order so the result is deterministic.
+func orderAssignments(all, roots []*parser.Assignment, byName map[string]*parser.Assignment) ([]*parser.Assignment, error) {
+	index := make(map[string]int, len(all))
+	for i, stmt := range all {
+		index[stmt.Name] = i
+	}
+	deps := make(map[string][]string, len(all))
+	for _, stmt := range all {
+		seen := map[string]bool{}
+		collectIdentifiers(stmt.Value, func(name string) {
+			if _, ok := byName[name]; ok && !seen[name] {
+				seen[name] = true
+				deps[stmt.Name] = append(deps[stmt.Name], name)
+			}
+		})
+		// Object literal properties are walked in map order; sort for determinism.
+		d := deps[stmt.Name]
+		sort.Slice(d, func(i, j int) bool { return index[d[i]] < index[d[j]] })
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(all))
+	order := make([]*parser.Assignment, 0, len(all))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			start := 0
+			for i, n := range path {
+				if n == name {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			stmt := byName[name]
+			return fmt.Errorf("compile error: dependency cycle %s (line %d, column %d)",
+				strings.Join(cycle, " -> "), stmt.Line, stmt.Column)
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		order = append(order, byName[name])
+		return nil
+	}
+
+	// Visit roots in source order so independent statements keep their order.
+	rootSet := make(map[string]bool, len(roots))
+	for _, stmt := range roots {
+		rootSet[stmt.Name] = true
+	}
+	for _, stmt := range all {
+		if !rootSet[stmt.Name] {
+			continue
+		}
+		if err := visit(stmt.Name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// collectIdentifiers calls fn for every non-pipe identifier that is read as a
+// variable anywhere in node. Function names are not variable reads and are
+// skipped; member property names are not nodes.
+func collectIdentifiers(node parser.Node, fn func(name string)) {
+	callees := map[*parser.Identifier]bool{}
+	parser.Inspect(node, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.FunctionCall:
+			if id, ok := n.Function.(*parser.Identifier); ok {
+				callees[id] = true
+			}
+		case *parser.Identifier:
+			if !callees[n] && !isPipeLocalVar(n.Name) {
+				fn(n.Name)
+			}
+		}
+		return true
+	})
+}
@@ -1,9 +1,11 @@
 package compiler_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
 )
 
 type compilerTestCase struct {
@@ -600,12 +602,13 @@ func TestPipeExpression(t *testing.T) {
 			code.Make(code.OpArray, 2),              // build initial array
 			code.Make(code.OpPipe, 2, 0, 4, 0xFFFF), // pipeTypeIdx=2 ("map"), aliasIdx=0 (""), blockIdx=4, argsIdx=0xFFFF (no args)
 		}},
-		// Multiple pipes: two OpPipe instructions, each with its own block constants
+		// Multiple pipes: an OpPipeChain marker, then two OpPipe instructions, each with its own block constants
 		{`[1,2,3] |filter: $item > 1 |map: $item * 2`, []any{1.0, 2.0, 3.0, "filter", 1.0, nil, "map", 2.0, nil}, []code.Instructions{
 			code.Make(code.OpConstant, 0), // 1.0
 			code.Make(code.OpConstant, 1), // 2.0
 			code.Make(code.OpConstant, 2), // 3.0
 			code.Make(code.OpArray, 3),
+			code.Make(code.OpPipeChain, 2),          // the next 2 OpPipe instructions form one chain
 			code.Make(code.OpPipe, 3, 0, 5, 0xFFFF), // filter pipe: pipeTypeIdx=3, aliasIdx=0, blockIdx=5, argsIdx=0xFFFF
 			code.Make(code.OpPipe, 6, 2, 8, 0xFFFF), // map pipe: pipeTypeIdx=6, aliasIdx=2, blockIdx=8, argsIdx=0xFFFF
 		}},
@@ -613,6 +616,39 @@ func TestPipeExpression(t *testing.T) {
 	runCompilerTestCases(t, cases)
 }
 
+func TestPipeExpression_stageAliasScope(t *testing.T) {
+	// The alias of a stage names its item and ends with its predicate.
+	for _, input := range []string{
+		`orders |map as $o: $o.lines |filter: $item.sku == $o.sku`,
+		`[1, 2] |map: $item * 10 as $a |map: $a`,
+		`[1, 2] |map: $item as $a |map: $item + 1 as $b |find: $a == $b`,
+		`[1, 2] |map as $a: 1 |: len([$a])`,
+	} {
+		err := compiler.New().Compile(parse(input))
+		if err == nil || !strings.Contains(err.Error(), "is only visible in its predicate") {
+			t.Errorf("%s: got %v, want an alias scope error", input, err)
+		}
+	}
+	err := compiler.New().Compile(parse(`orders |map as $o: $o.lines |filter: $item.sku == $o.sku`))
+	want := "$o is the alias of the |map: stage and is only visible in its predicate, not in the |filter: stage after it; " +
+		"to use it there, nest that pipe in the predicate in parentheses: |map: (... |filter: ...)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+
+	// Nested pipes, a redeclared alias and the pipe variables are fine.
+	for _, input := range []string{
+		`orders |map as $o: ($o.lines |filter: $item.sku == $o.sku)`,
+		`[1, 2] |map as $a: $a |map as $a: $a * 2`,
+		`[1, 2] |map: $item as $item |: $item`,
+		`[[1]] |map as $o: ($o |map as $x: 1 |map as $o: $o)`,
+	} {
+		if err := compiler.New().Compile(parse(input)); err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+	}
+}
+
 func TestTernaryOperatorCompilation(t *testing.T) {
 	cases := []compilerTestCase{
 		{
@@ -0,0 +1,33 @@
+package compiler_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+)
+
+func TestDisassemble(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`xs |take(n): $item * 2`)); err != nil {
+		t.Fatal(err)
+	}
+	got := compiler.Disassemble(comp.ByteCode())
+	want := `=== Context Vars ===
+0000  xs
+0001  n
+
+=== Instructions ===
+0000 OpContextVar [0]
+0003 OpPipe [0 0 2 3]
+  ; take args:
+  0000 OpContextVar [1]
+  0003 OpArray [1]
+  ; take predicate:
+  0000 OpIdentifier [1]
+  0003 OpConstant [1]
+  0006 OpMul []
+`
+	if got != want {
+		t.Errorf("Disassemble:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -190,3 +190,36 @@ func TestPipeParams_Compiler_Bytecode_NoArgs(t *testing.T) {
 	}
 	runCompilerTestCases(t, cases)
 }
+
+// TestPipeParams_Compiler_RuntimeArgs verifies that non-literal args compile to an
+// *ArgsBlock that pushes each argument and collects them with OpArray.
+func TestPipeParams_Compiler_RuntimeArgs(t *testing.T) {
+	bc := compileExpr(t, "arr |window(size + 1): $window")
+	ops := findOpPipeOperands(t, bc.Instructions)
+	argsIdx := ops[3]
+	if argsIdx == 0xFFFF || argsIdx >= len(bc.Constants) {
+		t.Fatalf("bad argsIdx %d", argsIdx)
+	}
+	blk, ok := bc.Constants[argsIdx].ToAny().(*compiler.ArgsBlock)
+	if !ok {
+		t.Fatalf("constants[argsIdx] should be *compiler.ArgsBlock, got %T", bc.Constants[argsIdx].ToAny())
+	}
+	assert.Equal(t, 1, blk.Count)
+	assert.Equal(t, []string{"arr", "size"}, bc.ContextVars)
+
+	oneIdx := -1
+	for i, c := range bc.Constants {
+		if f, ok := c.ToAny().(float64); ok && f == 1 {
+			oneIdx = i
+		}
+	}
+	expected := []code.Instructions{
+		code.Make(code.OpContextVar, 1),
+		code.Make(code.OpConstant, oneIdx),
+		code.Make(code.OpAdd),
+		code.Make(code.OpArray, 1),
+	}
+	if err := testInstructions(expected, blk.Instructions); err != nil {
+		t.Fatal(err)
+	}
+}
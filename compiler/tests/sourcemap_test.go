@@ -0,0 +1,77 @@
+package compiler_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+)
+
+// results returns, in instruction order, the nodes whose result instructions
+// are in ins: their source, or "|name" for a pipe stage.
+func results(ins code.Instructions, sm compiler.SourceMap) []string {
+	var out []string
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			return append(out, err.Error())
+		}
+		if e, ok := sm.At(ip); ok && e.Result {
+			if stage, ok := e.Node.(*parser.PipeExpression); ok {
+				out = append(out, "|"+stage.PipeType)
+			} else {
+				out = append(out, format.Node(e.Node, nil))
+			}
+		}
+		_, read := code.ReadOperands(def, ins[ip+1:])
+		ip += 1 + read
+	}
+	return out
+}
+
+func TestSourceMap(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"a + b * 2", []string{"a", "b", "2", "b * 2", "a + b * 2"}},
+		{`len(x) > 1 ? "y" : "n"`, []string{"x", "len(x)", "1", "len(x) > 1", `"y"`, `"n"`}},
+		// the value of || comes from one of its terms
+		{"a || b", []string{"a", "b"}},
+		{"xs |map: $item |filter: $item", []string{"xs", "|map", "|filter"}},
+	}
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		bc := comp.ByteCode()
+		if got := results(bc.Instructions, bc.SourceMap); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: results %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSourceMap_Blocks(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("xs |map: $item.price * 2")); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range comp.ByteCode().Constants {
+		if blk, ok := c.ToAny().(*compiler.InstructionBlock); ok {
+			want := []string{"$item", "$item.price", "2", "$item.price * 2"}
+			if got := results(blk.Instructions, blk.SourceMap); !reflect.DeepEqual(got, want) {
+				t.Errorf("predicate results %q, want %q", got, want)
+			}
+			e, ok := blk.SourceMap.At(0)
+			if line, col := e.Node.Position(); !ok || line != 1 || col != 10 {
+				t.Errorf("first predicate instruction at %d:%d, want 1:10", line, col)
+			}
+			return
+		}
+	}
+	t.Fatal("no predicate block")
+}
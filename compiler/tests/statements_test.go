@@ -0,0 +1,107 @@
+package compiler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/parser"
+)
+
+func compileProgram(t *testing.T, src string, outputs ...string) (*compiler.ByteCode, error) {
+	t.Helper()
+	list, err := parser.ParseProgram(src)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	comp := compiler.New()
+	if err := comp.CompileProgram(list, outputs); err != nil {
+		return nil, err
+	}
+	return comp.ByteCode(), nil
+}
+
+func TestCompileProgram_dependencyOrder(t *testing.T) {
+	// b is declared first but depends on a, so a must be stored first.
+	bc, err := compileProgram(t, "b = a + 1\na = x")
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	expected := []code.Instructions{
+		code.Make(code.OpContextVar, 0), // x
+		code.Make(code.OpSetLocal, 0),   // a
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpConstant, 0), // 1
+		code.Make(code.OpAdd),
+		code.Make(code.OpSetLocal, 1), // b
+		code.Make(code.OpConstant, 1), // "a"
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpConstant, 2), // "b"
+		code.Make(code.OpGetLocal, 1),
+		code.Make(code.OpObject, 4),
+	}
+	if err := testInstructions(expected, bc.Instructions); err != nil {
+		t.Fatal(err)
+	}
+	if bc.NumLocals != 2 {
+		t.Errorf("NumLocals = %d, want 2", bc.NumLocals)
+	}
+	if len(bc.ContextVars) != 1 || bc.ContextVars[0] != "x" {
+		t.Errorf("ContextVars = %v, want [x]", bc.ContextVars)
+	}
+}
+
+func TestCompileProgram_selectedOutputsPruneUnusedStatements(t *testing.T) {
+	bc, err := compileProgram(t, "a = x; unused = y * 2; b = a + 1", "b")
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	if bc.NumLocals != 2 {
+		t.Errorf("NumLocals = %d, want 2 (a, b)", bc.NumLocals)
+	}
+	for _, v := range bc.ContextVars {
+		if v == "y" {
+			t.Errorf("pruned statement still compiled: ContextVars = %v", bc.ContextVars)
+		}
+	}
+}
+
+func TestCompileProgram_errors(t *testing.T) {
+	cases := []struct {
+		src     string
+		outputs []string
+		want    string
+	}{
+		{"a = b + 1\nb = c\nc = a", nil, "dependency cycle a -> b -> c -> a"},
+		{"a = a + 1", nil, "dependency cycle a -> a"},
+		{"a = 1\na = 2", nil, `"a" is assigned twice`},
+		{"a = 1", []string{"nope"}, `unknown output "nope"`},
+	}
+	for _, tc := range cases {
+		_, err := compileProgram(t, tc.src, tc.outputs...)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: error = %v, want containing %q", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestCompileProgram_cycleOutsideSelectedOutputsIsIgnored(t *testing.T) {
+	if _, err := compileProgram(t, "a = 1\nb = c\nc = b", "a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompileProgram_dependenciesInEveryNode(t *testing.T) {
+	// Each expression reads b somewhere inside; with b = a that is a cycle.
+	for _, expr := range []string{
+		"-b", "(b)", "b ? 1 : 2", "f(b)", "b.x", "b?.x", "xs[b]", "xs[b:]", "xs[::b]",
+		"[b]", `{"k": b}`, "b..5", "1..5 step b", "b as number",
+		"xs |map: $item + b", "xs |window(b): $window",
+	} {
+		_, err := compileProgram(t, "a = "+expr+"\nb = a")
+		if err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+			t.Errorf("%q: error = %v, want a dependency cycle", expr, err)
+		}
+	}
+}
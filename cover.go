@@ -0,0 +1,399 @@
+package uexl
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/internal/source"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/vm"
+)
+
+// Coverage counts how often each branch of an expression runs, across many
+// evaluations, to show which parts of a rule its test vectors exercise. The
+// branches are the places where the compiler emits jumps:
+//   - each term of a &&, || or ?? chain, which short-circuiting may skip;
+//   - the two branches of a ?: conditional;
+//   - the predicate of each pipe stage, which runs once per element.
+//
+// A Coverage is safe for concurrent use.
+type Coverage struct {
+	expr     *CompiledExpr
+	branches []CoverageBranch
+	entries  map[coverKey][]int // entry instruction -> indexes in branches
+	line     int                // the line the expression starts on
+
+	mu     sync.Mutex
+	counts []int
+	evals  int
+}
+
+// coverKey identifies an instruction by its node and offset; a node is
+// compiled into a single block.
+type coverKey struct {
+	node parser.Node
+	ip   int
+}
+
+// CoverageBranch is a branch of an expression and the number of times it ran.
+type CoverageBranch struct {
+	// Kind is the operator of a chain term ("&&", "||" or "??"), "then" or
+	// "else" for the branches of a conditional, or the pipe ("|map") for a
+	// predicate.
+	Kind string `json:"kind"`
+	// Decision numbers the chain, conditional or pipe stage the branch
+	// belongs to, in the order of their first branch.
+	Decision  int    `json:"decision"`
+	Expr      string `json:"expr"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Count     int    `json:"count"`
+
+	start, end int // byte offsets in the source
+}
+
+// NewCoverage returns a Coverage of expr with no evaluations counted. The
+// branches of an expression compiled with CompileNode have the parser's
+// positions and no end; one compiled with CompileProgram has no branches.
+func NewCoverage(expr *CompiledExpr) *Coverage {
+	cv := &Coverage{expr: expr, entries: map[coverKey][]int{}, line: 1}
+	if expr.root == nil {
+		return cv
+	}
+	var src *source.Source
+	if expr.source != "" {
+		src = source.New(expr.source)
+	}
+	cv.line = max(locate(src, expr.root).line, 1)
+
+	// Collect the branches, the parent of each node, and the roots of the
+	// blocks the compiler emits: the expression, pipe predicates and pipe
+	// arguments.
+	var nodes []parser.Node
+	parents := map[parser.Node]parser.Node{}
+	roots := map[parser.Node]bool{expr.root: true}
+	var path []parser.Node
+	add := func(kind string, decision int, node parser.Node) {
+		loc := locate(src, node)
+		cv.branches = append(cv.branches, CoverageBranch{
+			Kind: kind, Decision: decision, Expr: loc.expr,
+			Line: loc.line, Column: loc.column, EndLine: loc.endLine, EndColumn: loc.endColumn,
+			start: loc.start, end: loc.end,
+		})
+		nodes = append(nodes, node)
+	}
+	decisions := 0
+	parser.Inspect(expr.root, func(n parser.Node) bool {
+		if n == nil {
+			path = path[:len(path)-1]
+			return true
+		}
+		var parent parser.Node
+		if len(path) > 0 {
+			parent = path[len(path)-1]
+			parents[n] = parent
+		}
+		path = append(path, n)
+		switch n := n.(type) {
+		case *parser.BinaryExpression:
+			if n.Operator != "&&" && n.Operator != "||" && n.Operator != "??" {
+				break
+			}
+			if p, ok := parent.(*parser.BinaryExpression); ok && p.Operator == n.Operator {
+				break // a link of the enclosing chain
+			}
+			for _, term := range logicalTerms(n, n.Operator) {
+				add(n.Operator, decisions, term)
+			}
+			decisions++
+		case *parser.ConditionalExpression:
+			add("then", decisions, n.Consequent)
+			add("else", decisions, n.Alternate)
+			decisions++
+		case *parser.ProgramNode:
+			for i := 1; i < len(n.PipeExpressions); i++ {
+				stage := &n.PipeExpressions[i]
+				for _, arg := range stage.ArgExprs {
+					roots[arg] = true
+				}
+				if stage.Expression != nil {
+					roots[stage.Expression] = true
+					add("|"+stage.PipeType, decisions, stage.Expression)
+					decisions++
+				}
+			}
+		}
+		return true
+	})
+
+	// A node first runs at the lowest offset of its code, as its block only
+	// jumps forward. Find that instruction for each node.
+	first := map[parser.Node]coverKey{}
+	mark := func(sm compiler.SourceMap) {
+		for _, e := range sm {
+			for n := e.Node; n != nil; n = parents[n] {
+				if _, ok := first[n]; !ok {
+					first[n] = coverKey{e.Node, e.Offset}
+				}
+				if roots[n] {
+					break
+				}
+			}
+		}
+	}
+	bc := expr.bytecode
+	mark(bc.SourceMap)
+	for _, c := range bc.Constants {
+		switch blk := c.ToAny().(type) {
+		case *compiler.InstructionBlock:
+			if blk != nil {
+				mark(blk.SourceMap)
+			}
+		case *compiler.ArgsBlock:
+			if blk != nil {
+				mark(blk.SourceMap)
+			}
+		}
+	}
+
+	// Report the branches in source order, numbering decisions as they first
+	// appear.
+	order := make([]int, len(nodes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := cv.branches[order[i]], cv.branches[order[j]]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	branches := make([]CoverageBranch, len(order))
+	renumber := map[int]int{}
+	for i, old := range order {
+		br := cv.branches[old]
+		d, ok := renumber[br.Decision]
+		if !ok {
+			d = len(renumber)
+			renumber[br.Decision] = d
+		}
+		br.Decision = d
+		branches[i] = br
+		if k, ok := first[nodes[old]]; ok {
+			cv.entries[k] = append(cv.entries[k], i)
+		}
+	}
+	cv.branches = branches
+	cv.counts = make([]int, len(cv.branches))
+	return cv
+}
+
+// Eval evaluates the expression like CompiledExpr.Eval and counts the
+// branches that ran, also when the evaluation fails.
+func (cv *Coverage) Eval(ctx context.Context, vars map[string]any) (any, error) {
+	run := &coverRun{entries: cv.entries, counts: make([]int, len(cv.branches))}
+	result, err := cv.expr.EvalTrace(ctx, vars, run)
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	cv.evals++
+	for i, n := range run.counts {
+		cv.counts[i] += n
+	}
+	return result, err
+}
+
+// coverRun is the tracer counting the branches of one evaluation.
+type coverRun struct {
+	entries map[coverKey][]int
+	counts  []int
+}
+
+var _ vm.Tracer = (*coverRun)(nil)
+
+func (r *coverRun) OnInstruction(step vm.Step, _ []any) {
+	for _, i := range r.entries[coverKey{step.Source.Node, step.IP}] {
+		r.counts[i]++
+	}
+}
+
+func (r *coverRun) OnCall(string, []any, any, error) {}
+
+func (r *coverRun) OnPipe(string, any, any, error) {}
+
+// Report returns the counts so far.
+func (cv *Coverage) Report() *CoverageReport {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	r := &CoverageReport{Source: cv.expr.source, Evals: cv.evals, Branches: make([]CoverageBranch, len(cv.branches)), line: cv.line}
+	copy(r.Branches, cv.branches)
+	for i := range r.Branches {
+		r.Branches[i].Count = cv.counts[i]
+	}
+	return r
+}
+
+// CoverageReport is the coverage of an expression by a number of evaluations.
+type CoverageReport struct {
+	Source   string           `json:"source"` // empty for an expression compiled from a tree
+	Evals    int              `json:"evals"`
+	Branches []CoverageBranch `json:"branches"`
+
+	line int // the line the expression starts on
+}
+
+// Covered returns the number of branches that ran at least once, and the
+// number of branches.
+func (r *CoverageReport) Covered() (covered, total int) {
+	for _, b := range r.Branches {
+		if b.Count > 0 {
+			covered++
+		}
+	}
+	return covered, len(r.Branches)
+}
+
+// String lists the branches in source order with their counts, marking
+// those that never ran:
+//
+//	3 evaluations, 2 of 3 branches covered (66.7%)
+//	1:1   ??  3    limit
+//	1:10  ??  1    default_limit
+//	2:6   ??  0  ! 100
+func (r *CoverageReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", r.summary())
+	rows := make([][3]string, len(r.Branches))
+	var widths [3]int
+	for i, br := range r.Branches {
+		rows[i] = [3]string{fmt.Sprintf("%d:%d", br.Line, br.Column), br.Kind, fmt.Sprint(br.Count)}
+		for j, cell := range rows[i] {
+			widths[j] = max(widths[j], len(cell))
+		}
+	}
+	for i, br := range r.Branches {
+		mark := " "
+		if br.Count == 0 {
+			mark = "!"
+		}
+		fmt.Fprintf(&b, "%-*s  %-*s  %*s  %s %s\n", widths[0], rows[i][0], widths[1], rows[i][1], widths[2], rows[i][2], mark, oneLine(br.Expr))
+	}
+	return b.String()
+}
+
+// WriteLCOV writes the report as an lcov tracefile for the source file name.
+// Each decision is a block of BRDA branch records; a line's DA count is the
+// highest count of the branches that start on it, and the number of
+// evaluations for the line the expression starts on.
+func (r *CoverageReport) WriteLCOV(w io.Writer, name string) error {
+	lines := map[int]int{r.line: r.Evals}
+	var b strings.Builder
+	fmt.Fprintf(&b, "TN:\nSF:%s\n", name)
+	branches := map[int]int{} // branches so far, by decision
+	for _, br := range r.Branches {
+		fmt.Fprintf(&b, "BRDA:%d,%d,%d,%d\n", br.Line, br.Decision, branches[br.Decision], br.Count)
+		branches[br.Decision]++
+		lines[br.Line] = max(lines[br.Line], br.Count)
+	}
+	covered, total := r.Covered()
+	fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", total, covered)
+	nums := make([]int, 0, len(lines))
+	for l := range lines {
+		nums = append(nums, l)
+	}
+	sort.Ints(nums)
+	hit := 0
+	for _, l := range nums {
+		fmt.Fprintf(&b, "DA:%d,%d\n", l, lines[l])
+		if lines[l] > 0 {
+			hit++
+		}
+	}
+	fmt.Fprintf(&b, "LF:%d\nLH:%d\nend_of_record\n", len(nums), hit)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes the report as a standalone HTML page showing the source
+// with each branch highlighted as covered or not, and its count on hover.
+// It fails for a report without a source.
+func (r *CoverageReport) WriteHTML(w io.Writer, title string) error {
+	if r.Source == "" {
+		return fmt.Errorf("coverage report has no source to show")
+	}
+	// Each byte takes the class of the innermost branch around it.
+	inner := make([]int, len(r.Source))
+	for i := range inner {
+		inner[i] = -1
+	}
+	for i, br := range r.Branches {
+		for off := br.start; off < br.end; off++ {
+			if j := inner[off]; j < 0 || br.end-br.start <= r.Branches[j].end-r.Branches[j].start {
+				inner[off] = i
+			}
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, htmlHead, html.EscapeString(title))
+	fmt.Fprintf(&b, "<p>%s</p>\n<pre>", r.summary())
+	for start := 0; start < len(r.Source); {
+		end := start + 1
+		for end < len(r.Source) && inner[end] == inner[start] {
+			end++
+		}
+		text := html.EscapeString(r.Source[start:end])
+		if i := inner[start]; i >= 0 {
+			br := r.Branches[i]
+			class := "cov"
+			if br.Count == 0 {
+				class = "uncov"
+			}
+			fmt.Fprintf(&b, `<span class="%s" title="%s: %d">%s</span>`, class, html.EscapeString(br.Kind), br.Count, text)
+		} else {
+			b.WriteString(text)
+		}
+		start = end
+	}
+	b.WriteString("</pre>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; }
+pre { font-size: 14px; line-height: 1.5; }
+.cov { background: #c8f0c8; }
+.uncov { background: #f8c8c8; }
+</style>
+</head>
+<body>
+`
+
+// summary is the headline of the text and HTML reports.
+func (r *CoverageReport) summary() string {
+	evals := "evaluations"
+	if r.Evals == 1 {
+		evals = "evaluation"
+	}
+	covered, total := r.Covered()
+	pct := "100.0%"
+	if total > 0 {
+		pct = fmt.Sprintf("%.1f%%", 100*float64(covered)/float64(total))
+	}
+	return fmt.Sprintf("%d %s, %d of %d branches covered (%s)", r.Evals, evals, covered, total, pct)
+}
+
+// oneLine collapses the whitespace of a multi-line expression.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,110 @@
+package uexl_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const coverRule = `age >= 18 && country == "US" ? (limit ?? 100) : (orders |filter: $item.total > 10)`
+
+func TestCoverage(t *testing.T) {
+	compiled, err := uexl.Default().Compile(coverRule)
+	require.NoError(t, err)
+	cov := uexl.NewCoverage(compiled)
+	for _, vars := range []map[string]any{
+		{"age": 20.0, "country": "US", "limit": 5.0},
+		{"age": 16.0, "orders": []any{}},
+		{"age": 30.0, "country": "UK", "orders": []any{map[string]any{"total": 3.0}, map[string]any{"total": 30.0}}},
+	} {
+		_, err := cov.Eval(bg, vars)
+		require.NoError(t, err)
+	}
+	r := cov.Report()
+	assert.Equal(t, 3, r.Evals)
+	var got []string
+	for _, b := range r.Branches {
+		got = append(got, fmt.Sprintf("%s %s: %d", b.Kind, b.Expr, b.Count))
+	}
+	assert.Equal(t, []string{
+		"&& age >= 18: 3",
+		`&& country == "US": 2`,
+		"then (limit ?? 100): 1",
+		"?? limit: 1",
+		"?? 100: 0",
+		"else (orders |filter: $item.total > 10): 2",
+		"|filter $item.total > 10: 2",
+	}, got)
+	covered, total := r.Covered()
+	assert.Equal(t, []int{6, 7}, []int{covered, total})
+
+	// Branches of one decision share its number.
+	assert.Equal(t, []int{0, 0, 1, 2, 2, 1, 3}, []int{
+		r.Branches[0].Decision, r.Branches[1].Decision, r.Branches[2].Decision, r.Branches[3].Decision,
+		r.Branches[4].Decision, r.Branches[5].Decision, r.Branches[6].Decision,
+	})
+	b := r.Branches[4]
+	assert.Equal(t, []int{1, 42, 1, 45}, []int{b.Line, b.Column, b.EndLine, b.EndColumn})
+}
+
+func TestCoverage_Concurrent(t *testing.T) {
+	compiled, err := uexl.Default().Compile(`x > 5 || x < -5`)
+	require.NoError(t, err)
+	cov := uexl.NewCoverage(compiled)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(x float64) {
+			defer wg.Done()
+			_, err := cov.Eval(bg, map[string]any{"x": x})
+			assert.NoError(t, err)
+		}(float64(i))
+	}
+	wg.Wait()
+	r := cov.Report()
+	assert.Equal(t, 8, r.Evals)
+	assert.Equal(t, 8, r.Branches[0].Count)
+	assert.Equal(t, 6, r.Branches[1].Count) // x = 6 and 7 short-circuit
+}
+
+func TestCoverageReport_Formats(t *testing.T) {
+	compiled, err := uexl.Default().Compile("a ?? b\n  ?? c")
+	require.NoError(t, err)
+	cov := uexl.NewCoverage(compiled)
+	_, err = cov.Eval(bg, map[string]any{"b": 1.0})
+	require.NoError(t, err)
+	r := cov.Report()
+
+	assert.Equal(t, `1 evaluation, 2 of 3 branches covered (66.7%)
+1:1  ??  1    a
+1:6  ??  1    b
+2:6  ??  0  ! c
+`, r.String())
+
+	var lcov strings.Builder
+	require.NoError(t, r.WriteLCOV(&lcov, "rule.uexl"))
+	assert.Equal(t, `TN:
+SF:rule.uexl
+BRDA:1,0,0,1
+BRDA:1,0,1,1
+BRDA:2,0,2,0
+BRF:3
+BRH:2
+DA:1,1
+DA:2,0
+LF:2
+LH:1
+end_of_record
+`, lcov.String())
+
+	var page strings.Builder
+	require.NoError(t, r.WriteHTML(&page, "rule <1>"))
+	assert.Contains(t, page.String(), "<title>rule &lt;1&gt;</title>")
+	assert.Contains(t, page.String(), `<span class="cov" title="??: 1">a</span> ?? <span class="cov" title="??: 1">b</span>`)
+	assert.Contains(t, page.String(), `<span class="uncov" title="??: 0">c</span>`)
+}
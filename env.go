@@ -17,21 +17,50 @@ type Env struct {
 	functions    vm.VMFunctions
 	pipeHandlers vm.PipeHandlers
 	globals      map[string]any
+	pipeArgs     vm.PipeArgSchemas
+	collators    vm.Collators
+	streaming    vm.StreamingPipes
+	maxRangeLen  int
+	parallelism  int
+	sequential   map[string]bool
+	tracer       vm.Tracer
+	profiler     *Profiler
 	pool         sync.Pool // per-Env — never copied by Extend
 }
 
+// envPool lends the VMs of an Env's pool to parallel pipes.
+type envPool struct{ pool *sync.Pool }
+
+func (p envPool) Get() *vm.VM  { return p.pool.Get().(*vm.VM) }
+func (p envPool) Put(m *vm.VM) { p.pool.Put(m) }
+
 // newEnvFromConfig creates an Env from a finalized envConfig.
 func newEnvFromConfig(cfg *envConfig) *Env {
 	e := &Env{
 		functions:    cfg.functions,
 		pipeHandlers: cfg.pipeHandlers,
 		globals:      cfg.globals,
+		pipeArgs:     cfg.pipeArgs,
+		collators:    cfg.collators,
+		streaming:    cfg.streamingPipes,
+		maxRangeLen:  cfg.maxRangeLength,
+		parallelism:  cfg.parallelism,
+		sequential:   cfg.sequentialFuncs,
+		tracer:       cfg.tracer,
+		profiler:     cfg.profiler,
 	}
 	// Capture e in the closure; safe because Env is heap-allocated and never moved.
 	e.pool.New = func() any {
 		return vm.New(vm.LibContext{
-			Functions:    e.functions,
-			PipeHandlers: e.pipeHandlers,
+			Functions:           e.functions,
+			PipeHandlers:        e.pipeHandlers,
+			PipeArgSchemas:      e.pipeArgs,
+			MaxRangeLength:      e.maxRangeLen,
+			Collators:           e.collators,
+			StreamingPipes:      e.streaming,
+			Workers:             envPool{&e.pool},
+			Parallelism:         e.parallelism,
+			SequentialFunctions: e.sequential,
 		})
 	}
 	return e
@@ -44,6 +73,11 @@ func NewEnv(opts ...Option) *Env {
 		functions:    make(vm.VMFunctions),
 		pipeHandlers: make(vm.PipeHandlers),
 		globals:      make(map[string]any),
+		pipeArgs:     make(vm.PipeArgSchemas),
+		collators:    make(vm.Collators),
+
+		streamingPipes:  make(vm.StreamingPipes),
+		sequentialFuncs: make(map[string]bool),
 	}
 	for _, opt := range opts {
 		opt(cfg)
@@ -57,13 +91,15 @@ var (
 )
 
 // Default returns the singleton *Env pre-loaded with vm.Builtins as the function set
-// and vm.DefaultPipeHandlers as the pipe handler set. No globals.
+// and vm.DefaultPipeHandlers (with vm.DefaultPipeArgSchemas) as the pipe handler set.
+// No globals.
 // The same pointer is returned on every call (initialized via sync.Once).
 func Default() *Env {
 	defaultEnvOnce.Do(func() {
 		defaultEnv = NewEnv(
 			WithFunctions(vm.Builtins),
 			WithPipeHandlers(vm.DefaultPipeHandlers),
+			WithPipeArgSchemas(vm.DefaultPipeArgSchemas),
 		)
 	})
 	return defaultEnv
@@ -76,6 +112,15 @@ func (e *Env) Extend(opts ...Option) *Env {
 		functions:    copyMap(e.functions),
 		pipeHandlers: copyMap(e.pipeHandlers),
 		globals:      copyMap(e.globals),
+		pipeArgs:     copyMap(e.pipeArgs),
+		collators:    copyMap(e.collators),
+
+		streamingPipes:  copyMap(e.streaming),
+		maxRangeLength:  e.maxRangeLen,
+		parallelism:     e.parallelism,
+		sequentialFuncs: copyMap(e.sequential),
+		tracer:          e.tracer,
+		profiler:        e.profiler,
 	}
 	for _, opt := range opts {
 		opt(cfg)
@@ -92,10 +137,32 @@ func (e *Env) Compile(expr string) (*CompiledExpr, error) {
 	if err != nil {
 		return nil, err
 	}
+	ce, err := e.CompileNode(node)
+	if err != nil {
+		return nil, err
+	}
+	ce.source = expr
+	return ce, nil
+}
+
+// CompileNode compiles an already-parsed AST into a *CompiledExpr bounded to this Env,
+// with the same validation as Compile. Use it to compile trees that were rewritten
+// with parser.Rewrite or decoded with parser.UnmarshalNode.
+func (e *Env) CompileNode(node parser.Node) (*CompiledExpr, error) {
 	comp := compiler.New()
 	if err := comp.Compile(node); err != nil {
 		return nil, err
 	}
+	ce, err := e.bind(comp)
+	if err != nil {
+		return nil, err
+	}
+	ce.root = node
+	return ce, nil
+}
+
+// bind validates the compiler's output against this Env and wraps it in a *CompiledExpr.
+func (e *Env) bind(comp *compiler.Compiler) (*CompiledExpr, error) {
 	bc := comp.ByteCode()
 	if err := e.validateFunctionNames(bc); err != nil {
 		return nil, err
@@ -103,27 +170,55 @@ func (e *Env) Compile(expr string) (*CompiledExpr, error) {
 	return &CompiledExpr{bytecode: bc, env: e}, nil
 }
 
-// validateFunctionNames walks the bytecode (main stream + InstructionBlock pipe predicates)
-// and ensures every OpCallFunction references a function registered in e.functions.
+// validateFunctionNames walks the bytecode (main stream + InstructionBlock pipe predicates
+// + ArgsBlock pipe arguments) and ensures every OpCallFunction references a function
+// registered in e.functions and every OpPipe satisfies its pipe's argument schema.
 func (e *Env) validateFunctionNames(bc *compiler.ByteCode) error {
-	if err := e.walkInstructions(bc.Instructions, bc); err != nil {
+	if err := e.walkInstructions(bc.Instructions, bc.SourceMap, bc); err != nil {
 		return err
 	}
-	// Also validate function calls inside InstructionBlock constants (pipe predicates).
+	// Also validate instructions inside InstructionBlock (pipe predicate) and
+	// ArgsBlock (pipe argument) constants.
 	for _, cv := range bc.Constants {
-		blk, ok := cv.ToAny().(*compiler.InstructionBlock)
-		if !ok || blk == nil || blk.Instructions == nil {
+		var ins code.Instructions
+		var sm compiler.SourceMap
+		switch blk := cv.ToAny().(type) {
+		case *compiler.InstructionBlock:
+			if blk != nil {
+				ins, sm = blk.Instructions, blk.SourceMap
+			}
+		case *compiler.ArgsBlock:
+			if blk != nil {
+				ins, sm = blk.Instructions, blk.SourceMap
+			}
+		}
+		if ins == nil {
 			continue
 		}
-		if err := e.walkInstructions(blk.Instructions, bc); err != nil {
+		if err := e.walkInstructions(ins, sm, bc); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// walkInstructions iterates over an instruction stream and validates any OpCallFunction sites.
-func (e *Env) walkInstructions(ins code.Instructions, bc *compiler.ByteCode) error {
+// CompileError is a compile failure at a node of the expression, such as the
+// call of an unknown function. Line and Column are the node's parser position,
+// or 0 when the expression was compiled from a tree without positions.
+type CompileError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *CompileError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *CompileError) Unwrap() error { return e.Err }
+
+// walkInstructions iterates over an instruction stream and validates any OpCallFunction
+// sites; sm places the failures.
+func (e *Env) walkInstructions(ins code.Instructions, sm compiler.SourceMap, bc *compiler.ByteCode) error {
 	for i := 0; i < len(ins); {
 		def, err := code.Lookup(ins[i])
 		if err != nil {
@@ -136,11 +231,16 @@ func (e *Env) walkInstructions(ins code.Instructions, bc *compiler.ByteCode) err
 			if funcIdx < len(bc.Constants) {
 				if name, ok := bc.Constants[funcIdx].AsString(); ok {
 					if _, exists := e.functions[name]; !exists {
-						return fmt.Errorf("compile error: unknown function %q — not registered in this environment", name)
+						return compileErrorAt(sm, i, fmt.Errorf("compile error: unknown function %q — not registered in this environment", name))
 					}
 				}
 			}
 		}
+		if code.Opcode(ins[i]) == code.OpPipe && i+8 < len(ins) {
+			if err := e.validatePipeArgs(ins[i+1:i+9], bc); err != nil {
+				return compileErrorAt(sm, i, err)
+			}
+		}
 		// Advance past this opcode and its operands.
 		offset := 1
 		for _, w := range def.OperandWidths {
@@ -151,6 +251,61 @@ func (e *Env) walkInstructions(ins code.Instructions, bc *compiler.ByteCode) err
 	return nil
 }
 
+// compileErrorAt returns err as a *CompileError at the node of the instruction
+// at offset, as placed by sm: the name of a call, or the arguments of a pipe
+// (its predicate when it has none).
+func compileErrorAt(sm compiler.SourceMap, offset int, err error) error {
+	ce := &CompileError{Err: err}
+	entry, ok := sm.At(offset)
+	if !ok || entry.Node == nil {
+		return ce
+	}
+	var node parser.Node = entry.Node
+	switch n := node.(type) {
+	case *parser.FunctionCall:
+		node = n.Function
+	case *parser.PipeExpression:
+		node = n.Expression
+		if len(n.ArgExprs) > 0 {
+			node = n.ArgExprs[0]
+		}
+	}
+	if node != nil {
+		ce.Line, ce.Column = node.Position()
+	}
+	return ce
+}
+
+// validatePipeArgs checks the arguments of one OpPipe site (operands: pipe type,
+// alias, block, args) against the pipe's registered schema, if any. Runtime
+// arguments are only counted here; their types are checked by the VM.
+func (e *Env) validatePipeArgs(operands code.Instructions, bc *compiler.ByteCode) error {
+	name, ok := bc.Constants[code.ReadUint16(operands[0:2])].AsString()
+	if !ok {
+		return nil
+	}
+	schema, ok := e.pipeArgs[name]
+	if !ok {
+		return nil
+	}
+	var err error
+	argsIdx := code.ReadUint16(operands[6:8])
+	if argsIdx == 0xFFFF {
+		err = schema.CheckArity(name, 0)
+	} else {
+		switch args := bc.Constants[argsIdx].ToAny().(type) {
+		case []any:
+			err = schema.Validate(name, args)
+		case *compiler.ArgsBlock:
+			err = schema.CheckArity(name, args.Count)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("compile error: %w", err)
+	}
+	return nil
+}
+
 // MustCompile compiles expr within this env and panics on failure.
 // Intended exclusively for package-level var declarations with known-valid expressions.
 func (e *Env) MustCompile(expr string) *CompiledExpr {
@@ -8,6 +8,18 @@ type envConfig struct {
 	functions    vm.VMFunctions
 	pipeHandlers vm.PipeHandlers
 	globals      map[string]any
+	pipeArgs     vm.PipeArgSchemas
+	collators    vm.Collators
+	// streamingPipes holds the streaming form of pipes registered with
+	// WithStreamingPipes; replacing such a pipe's handler drops its entry.
+	streamingPipes vm.StreamingPipes
+
+	maxRangeLength int // 0 => vm.DefaultMaxRangeLength
+	parallelism    int // 0 => runtime.GOMAXPROCS(0)
+	// sequentialFuncs names functions that parallel pipes must not call concurrently.
+	sequentialFuncs map[string]bool
+	tracer          vm.Tracer // observes every evaluation; may be nil
+	profiler        *Profiler // profiles every evaluation; may be nil
 }
 
 // Lib is implemented by packages that ship reusable bundles of UExL extensions.
@@ -42,6 +54,50 @@ func (c *EnvConfig) AddPipeHandlers(pipes PipeHandlers) {
 	}
 	for k, v := range pipes {
 		c.cfg.pipeHandlers[k] = v
+		delete(c.cfg.streamingPipes, k)
+	}
+}
+
+// AddStreamingPipes registers pipes that can run lazily inside fused pipe
+// chains, along with a PipeHandler for each (see WithStreamingPipes).
+// Later calls for the same key win. Panics if pipes is nil.
+func (c *EnvConfig) AddStreamingPipes(pipes StreamingPipes) {
+	if pipes == nil {
+		panic("uexl: EnvConfig.AddStreamingPipes: pipes must not be nil")
+	}
+	for k, v := range pipes {
+		c.cfg.streamingPipes[k] = v
+		c.cfg.pipeHandlers[k] = vm.StreamingPipeHandler(v)
+	}
+}
+
+// AddSequentialFunctions marks functions as not safe for concurrent use (see
+// WithSequentialFunctions).
+func (c *EnvConfig) AddSequentialFunctions(names ...string) {
+	for _, name := range names {
+		c.cfg.sequentialFuncs[name] = true
+	}
+}
+
+// AddPipeArgSchemas merges pipe argument schemas into the in-progress env
+// configuration. Later calls for the same key win. Panics if schemas is nil.
+func (c *EnvConfig) AddPipeArgSchemas(schemas PipeArgSchemas) {
+	if schemas == nil {
+		panic("uexl: EnvConfig.AddPipeArgSchemas: schemas must not be nil")
+	}
+	for k, v := range schemas {
+		c.cfg.pipeArgs[k] = v
+	}
+}
+
+// AddCollators merges named sort collations into the in-progress env
+// configuration. Later calls for the same key win. Panics if collators is nil.
+func (c *EnvConfig) AddCollators(collators Collators) {
+	if collators == nil {
+		panic("uexl: EnvConfig.AddCollators: collators must not be nil")
+	}
+	for k, v := range collators {
+		c.cfg.collators[k] = v
 	}
 }
 
@@ -0,0 +1,449 @@
+package uexl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/internal/source"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/vm"
+)
+
+// Kinds of Explanation.
+const (
+	ExplainAnd       = "and"       // a && chain
+	ExplainOr        = "or"        // a || chain
+	ExplainNot       = "not"       // !x
+	ExplainCompare   = "compare"   // ==, !=, <>, <, <=, >, >=
+	ExplainCondition = "condition" // c ? a : b
+	ExplainSome      = "some"      // a |some: stage
+	ExplainEvery     = "every"     // an |every: stage
+	ExplainValue     = "value"     // any other sub-expression
+)
+
+// Explanation tells why a sub-expression of a rule has its value. Terms holds
+// the sub-expressions that decided it, and only those:
+//   - A && chain that is false has the first false term; one that is true has
+//     them all. A || chain is the other way round. Terms that short-circuiting
+//     skipped, or that did not change the outcome, are left out.
+//   - A ! has its operand, and a condition its test and the branch taken.
+//   - A |some: that is true, or an |every: that is false, has the predicate of
+//     the element that decided it, whose index is Index. Otherwise the
+//     predicate held (|every:) or failed (|some:) for all Count elements and
+//     Index is nil.
+//
+// A comparison records the values it compared in Left and Right.
+// Explanations end at comparisons and at sub-expressions of other kinds.
+type Explanation struct {
+	Kind string `json:"kind"`
+	Expr string `json:"expr"` // the source of the sub-expression
+	// The span of the source; for an expression compiled with CompileNode,
+	// the parser's position of the node, without an end.
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine,omitempty"`
+	EndColumn int `json:"endColumn,omitempty"`
+
+	Value    any            `json:"value"`
+	Operator string         `json:"operator,omitempty"`
+	Left     any            `json:"left,omitempty"`
+	Right    any            `json:"right,omitempty"`
+	Index    *int           `json:"index,omitempty"`
+	Count    int            `json:"count,omitempty"`
+	Terms    []*Explanation `json:"terms,omitempty"`
+}
+
+// String lays out the explanation as an indented tree, one sub-expression
+// per line:
+//
+//	age >= 18 && country == "US" = false
+//	  age >= 18 = false  (16 >= 18)
+func (e *Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%s = %s", strings.Repeat("  ", depth), e.Expr, formatValue(e.Value))
+	switch {
+	case e.Kind == ExplainCompare:
+		fmt.Fprintf(b, "  (%s %s %s)", formatValue(e.Left), e.Operator, formatValue(e.Right))
+	case e.Index != nil:
+		fmt.Fprintf(b, "  (element %d)", *e.Index)
+	case e.Kind == ExplainSome:
+		fmt.Fprintf(b, "  (none of %d elements)", e.Count)
+	case e.Kind == ExplainEvery:
+		fmt.Fprintf(b, "  (all %d elements)", e.Count)
+	}
+	b.WriteByte('\n')
+	for _, t := range e.Terms {
+		t.write(b, depth+1)
+	}
+}
+
+// ExplainEval is Eval that also explains the result: which comparisons and
+// other terms of the expression's &&, ||, ! and ?: tree decided it, with the
+// values they compared and their place in the source. The explanation of an
+// expression compiled with CompileProgram is its result alone.
+//
+// The evaluation is traced (see EvalTrace), so it is slower than Eval; use it
+// to answer why a rule failed, not to evaluate rules.
+func (c *CompiledExpr) ExplainEval(ctx context.Context, vars map[string]any) (any, *Explanation, error) {
+	x := newExplainer(c.root)
+	result, err := c.EvalTrace(ctx, vars, x)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.root == nil {
+		return result, &Explanation{Kind: ExplainValue, Value: result}, nil
+	}
+	b := &explainBuilder{}
+	if c.source != "" {
+		b.src = source.New(c.source)
+	}
+	return result, b.explain(c.root, x.scopes[0]), nil
+}
+
+// evalScope holds the values computed by one run of the main expression or
+// of a pipe predicate.
+type evalScope struct {
+	values   map[parser.Node]any
+	operands map[parser.Node][2]any
+	runs     map[*parser.PipeExpression][]*evalScope // predicate runs by stage
+	stack    []any                                   // stack after the last instruction
+}
+
+func newEvalScope() *evalScope {
+	return &evalScope{
+		values:   map[parser.Node]any{},
+		operands: map[parser.Node][2]any{},
+		runs:     map[*parser.PipeExpression][]*evalScope{},
+	}
+}
+
+// explainer is the tracer of ExplainEval. It keeps the values of each run of
+// a predicate apart, so that the run that decided a |some: or |every: can be
+// explained on its own.
+type explainer struct {
+	// owners maps the nodes of pipe predicates to their stage, and the nodes
+	// of pipe arguments to nil.
+	owners map[parser.Node]*parser.PipeExpression
+	scopes []*evalScope // by frame depth
+}
+
+var _ vm.Tracer = (*explainer)(nil)
+
+func newExplainer(root parser.Node) *explainer {
+	x := &explainer{owners: map[parser.Node]*parser.PipeExpression{}, scopes: []*evalScope{newEvalScope()}}
+	parser.Inspect(root, func(n parser.Node) bool {
+		prog, ok := n.(*parser.ProgramNode)
+		if !ok {
+			return true
+		}
+		// The first stage runs in the enclosing frame, the others in frames
+		// of their own. Stages nested in a predicate are visited later and
+		// claim their own nodes.
+		for i := 1; i < len(prog.PipeExpressions); i++ {
+			stage := &prog.PipeExpressions[i]
+			parser.Inspect(stage.Expression, func(n parser.Node) bool {
+				x.owners[n] = stage
+				return true
+			})
+			for _, arg := range stage.ArgExprs {
+				parser.Inspect(arg, func(n parser.Node) bool {
+					x.owners[n] = nil
+					return true
+				})
+			}
+		}
+		return true
+	})
+	return x
+}
+
+func (x *explainer) OnInstruction(step vm.Step, stack []any) {
+	d := step.Depth
+	if d > len(x.scopes) || d == len(x.scopes) && step.IP != 0 {
+		return
+	}
+	node := step.Source.Node
+	if d > 0 && step.IP == 0 {
+		// A block starts running: a predicate run of a stage, or its arguments.
+		s := newEvalScope()
+		if stage := x.owners[node]; stage != nil {
+			parent := x.scopes[d-1]
+			parent.runs[stage] = append(parent.runs[stage], s)
+		}
+		x.scopes = append(x.scopes[:d], s)
+	}
+	x.scopes = x.scopes[:d+1]
+	s := x.scopes[d]
+	if be, ok := node.(*parser.BinaryExpression); ok && isComparison(be.Operator) {
+		if l, r, ok := comparedValues(be, step.Op, s.stack); ok {
+			s.operands[be] = [2]any{l, r}
+		}
+	}
+	if step.Source.Result && len(stack) > 0 {
+		s.values[node] = stack[len(stack)-1]
+	}
+	s.stack = stack
+}
+
+func (x *explainer) OnCall(string, []any, any, error) {}
+
+func (x *explainer) OnPipe(string, any, any, error) {}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<>", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// comparedValues returns the operands of be from stack, the stack before op
+// ran, if op is the instruction comparing them.
+func comparedValues(be *parser.BinaryExpression, op code.Opcode, stack []any) (left, right any, ok bool) {
+	n := len(stack)
+	switch op {
+	case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual:
+		if n < 2 {
+			return nil, nil, false
+		}
+		left, right = stack[n-2], stack[n-1]
+		if be.Operator == "<" || be.Operator == "<=" {
+			// The compiler swaps the operands of < and <= to use > and >=.
+			left, right = right, left
+		}
+		return left, right, true
+	case code.OpStringPatternMatch:
+		// x == "prefix" + y + "suffix" pushes x, "prefix", y and "suffix".
+		if n < 4 {
+			return nil, nil, false
+		}
+		var joined any
+		prefix, _ := stack[n-3].(string)
+		middle, isString := stack[n-2].(string)
+		suffix, _ := stack[n-1].(string)
+		if isString {
+			joined = prefix + middle + suffix
+		}
+		if _, ok := be.Left.(*parser.Identifier); ok {
+			return stack[n-4], joined, true
+		}
+		return joined, stack[n-4], true
+	}
+	return nil, nil, false
+}
+
+// explainBuilder turns the recorded values into explanations.
+type explainBuilder struct {
+	src *source.Source // nil for an expression compiled from a tree
+}
+
+func (b *explainBuilder) explain(node parser.Node, s *evalScope) *Explanation {
+	node = unwrapGroups(node)
+	e := b.describe(node)
+	e.Kind = ExplainValue
+	e.Value, _ = b.value(node, s)
+	switch n := node.(type) {
+	case *parser.BinaryExpression:
+		switch {
+		case n.Operator == "&&" || n.Operator == "||":
+			e.Kind = ExplainAnd
+			if n.Operator == "||" {
+				e.Kind = ExplainOr
+			}
+			for _, term := range logicalTerms(n, n.Operator) {
+				v, ok := b.value(term, s)
+				if !ok {
+					break
+				}
+				if decides(n.Operator, v) {
+					e.Terms = []*Explanation{b.explain(term, s)}
+					break
+				}
+				e.Terms = append(e.Terms, b.explain(term, s))
+			}
+		case isComparison(n.Operator):
+			e.Kind = ExplainCompare
+			e.Operator = n.Operator
+			if ops, ok := s.operands[n]; ok {
+				e.Left, e.Right = ops[0], ops[1]
+			} else {
+				e.Left, _ = b.value(n.Left, s)
+				e.Right, _ = b.value(n.Right, s)
+			}
+		}
+	case *parser.UnaryExpression:
+		if n.Operator == "!" {
+			e.Kind = ExplainNot
+			e.Terms = []*Explanation{b.explain(n.Operand, s)}
+		}
+	case *parser.ConditionalExpression:
+		e.Kind = ExplainCondition
+		branch := n.Alternate
+		if v, _ := b.value(n.Condition, s); vm.IsTruthy(v) {
+			branch = n.Consequent
+		}
+		e.Terms = []*Explanation{b.explain(n.Condition, s), b.explain(branch, s)}
+	case *parser.ProgramNode:
+		last := len(n.PipeExpressions) - 1
+		if last > 0 {
+			stage := &n.PipeExpressions[last]
+			// A stage without a predicate, as in `flags |some:`, has no
+			// condition to explain.
+			if (stage.PipeType == "some" || stage.PipeType == "every") && stage.Expression != nil {
+				b.explainWitness(e, n, stage, s)
+			}
+		}
+	}
+	return e
+}
+
+// explainWitness explains the |some: or |every: stage that ends prog.
+func (b *explainBuilder) explainWitness(e *Explanation, prog *parser.ProgramNode, stage *parser.PipeExpression, s *evalScope) {
+	e.Kind = stage.PipeType
+	if b.src != nil {
+		// The stage's own text is only its predicate; span the pipeline up
+		// to it.
+		start := b.src.Span(prog.PipeExpressions[0].Expression).Start
+		end := b.src.Span(stage.Expression).End
+		e.Expr = b.src.Text[start:end]
+	}
+	runs := s.runs[stage]
+	e.Count = len(runs)
+	for i, run := range runs {
+		// |some: and |every: accept true alone, not any truthy value.
+		v, _ := b.value(stage.Expression, run)
+		if held := v == true; held == (stage.PipeType == "some") {
+			index := i
+			e.Index = &index
+			e.Terms = []*Explanation{b.explain(stage.Expression, run)}
+			return
+		}
+	}
+}
+
+// describe returns an explanation carrying the source of node.
+func (b *explainBuilder) describe(node parser.Node) *Explanation {
+	loc := locate(b.src, node)
+	return &Explanation{Expr: loc.expr, Line: loc.line, Column: loc.column, EndLine: loc.endLine, EndColumn: loc.endColumn}
+}
+
+// location is the source text and span of a node.
+type location struct {
+	expr                             string
+	line, column, endLine, endColumn int
+	start, end                       int // byte offsets, when the source is known
+}
+
+// locate returns the location of node in src. Without a source, the text is
+// the formatted node and the span is the parser's position of the node.
+func locate(src *source.Source, node parser.Node) location {
+	var loc location
+	if src == nil {
+		loc.expr = format.Node(node, nil)
+		loc.line, loc.column = node.Position()
+		return loc
+	}
+	sp := src.Span(node)
+	loc.start, loc.end = sp.Start, sp.End
+	loc.expr = src.Text[sp.Start:sp.End]
+	loc.line, loc.column = src.Position(sp.Start)
+	loc.endLine, loc.endColumn = src.Position(sp.End)
+	return loc
+}
+
+// value returns the value node had in s. Nodes whose value is one of their
+// operands' take it from there. ok is false if node was not evaluated.
+func (b *explainBuilder) value(node parser.Node, s *evalScope) (any, bool) {
+	node = unwrapGroups(node)
+	if v, ok := s.values[node]; ok {
+		return v, true
+	}
+	switch n := node.(type) {
+	case *parser.BinaryExpression:
+		if n.Operator != "&&" && n.Operator != "||" && n.Operator != "??" {
+			return nil, false
+		}
+		terms := logicalTerms(n, n.Operator)
+		for i, term := range terms {
+			v, ok := b.value(term, s)
+			if !ok {
+				return nil, false
+			}
+			if i == len(terms)-1 || decides(n.Operator, v) {
+				return v, true
+			}
+		}
+	case *parser.ConditionalExpression:
+		cond, ok := b.value(n.Condition, s)
+		if !ok {
+			return nil, false
+		}
+		if vm.IsTruthy(cond) {
+			return b.value(n.Consequent, s)
+		}
+		return b.value(n.Alternate, s)
+	case *parser.ProgramNode:
+		last := len(n.PipeExpressions) - 1
+		if last == 0 {
+			return b.value(n.PipeExpressions[0].Expression, s)
+		}
+		if last > 0 {
+			v, ok := s.values[&n.PipeExpressions[last]]
+			return v, ok
+		}
+	}
+	return nil, false
+}
+
+// decides reports whether a term with value v ends a chain of op.
+func decides(op string, v any) bool {
+	switch op {
+	case "&&":
+		return !vm.IsTruthy(v)
+	case "||":
+		return vm.IsTruthy(v)
+	}
+	return v != nil // ??
+}
+
+// logicalTerms returns the terms of a chain of op, as the compiler flattens
+// them.
+func logicalTerms(n parser.Node, op string) []parser.Node {
+	be, ok := n.(*parser.BinaryExpression)
+	if !ok || be.Operator != op {
+		return []parser.Node{n}
+	}
+	return append(logicalTerms(be.Left, op), logicalTerms(be.Right, op)...)
+}
+
+func unwrapGroups(node parser.Node) parser.Node {
+	for {
+		g, ok := node.(*parser.GroupedExpression)
+		if !ok {
+			return node
+		}
+		node = g.Expression
+	}
+}
+
+// formatValue formats v as compact JSON, or with fmt when it has no JSON
+// form.
+func formatValue(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,101 @@
+package uexl_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var applicant = map[string]any{
+	"age":     16.0,
+	"country": "US",
+	"orders":  []any{map[string]any{"total": 20.0}, map[string]any{"total": 250.0}, map[string]any{"total": 90.0}},
+}
+
+func explain(t *testing.T, expr string) (any, *uexl.Explanation) {
+	t.Helper()
+	compiled, err := uexl.Default().Compile(expr)
+	require.NoError(t, err)
+	result, e, err := compiled.ExplainEval(bg, applicant)
+	require.NoError(t, err)
+	return result, e
+}
+
+func TestExplainEval_ShortCircuit(t *testing.T) {
+	// A false && chain is explained by its first false term alone.
+	result, e := explain(t, `country == "US" && age >= 18 && orders[0].total > 10`)
+	assert.Equal(t, false, result)
+	assert.Equal(t, uexl.ExplainAnd, e.Kind)
+	require.Len(t, e.Terms, 1)
+	term := e.Terms[0]
+	assert.Equal(t, uexl.ExplainCompare, term.Kind)
+	assert.Equal(t, "age >= 18", term.Expr)
+	assert.Equal(t, []any{16.0, ">=", 18.0}, []any{term.Left, term.Operator, term.Right})
+	assert.Equal(t, []int{1, 20, 1, 29}, []int{term.Line, term.Column, term.EndLine, term.EndColumn})
+}
+
+func TestExplainEval_Tree(t *testing.T) {
+	result, e := explain(t, `age < 18 && !(country == "UK" || country == "CA") ? "minor" : "adult"`)
+	assert.Equal(t, "minor", result)
+	assert.Equal(t, `age < 18 && !(country == "UK" || country == "CA") ? "minor" : "adult" = "minor"
+  age < 18 && !(country == "UK" || country == "CA") = true
+    age < 18 = true  (16 < 18)
+    !(country == "UK" || country == "CA") = true
+      country == "UK" || country == "CA" = false
+        country == "UK" = false  ("US" == "UK")
+        country == "CA" = false  ("US" == "CA")
+  "minor" = "minor"
+`, e.String())
+}
+
+func TestExplainEval_Witness(t *testing.T) {
+	_, e := explain(t, `age > 3 && (orders |some: $item.total > 100)`)
+	require.Len(t, e.Terms, 2)
+	some := e.Terms[1]
+	assert.Equal(t, uexl.ExplainSome, some.Kind)
+	assert.Equal(t, "orders |some: $item.total > 100", some.Expr)
+	require.NotNil(t, some.Index)
+	assert.Equal(t, 1, *some.Index)
+	require.Len(t, some.Terms, 1)
+	assert.Equal(t, 250.0, some.Terms[0].Left)
+
+	// |every: is decided by its first failing element.
+	result, e := explain(t, `orders |every: $item.total >= 20 && $item.total < 100`)
+	assert.Equal(t, false, result)
+	assert.Equal(t, `orders |every: $item.total >= 20 && $item.total < 100 = false  (element 1)
+  $item.total >= 20 && $item.total < 100 = false
+    $item.total < 100 = false  (250 < 100)
+`, e.String())
+
+	// Without a witness, every element was tried.
+	result, e = explain(t, `orders |some: $item.total > 1000`)
+	assert.Equal(t, false, result)
+	assert.Nil(t, e.Index)
+	assert.Equal(t, 3, e.Count)
+	assert.Empty(t, e.Terms)
+
+	// A stage without a predicate has no condition to explain, and its
+	// header ends the chain's text.
+	result, e = explain(t, `orders |map: $item.total > 100 |some:`)
+	assert.Equal(t, true, result)
+	assert.Equal(t, "orders |map: $item.total > 100 |some:", e.Expr)
+	assert.Empty(t, e.Terms)
+}
+
+func TestExplainEval_CompileNode(t *testing.T) {
+	// Without the source, explanations carry the formatted tree and the
+	// parser's positions.
+	node, err := parser.ParseString(`age >= 18 || country == "US"`)
+	require.NoError(t, err)
+	compiled, err := uexl.Default().CompileNode(node)
+	require.NoError(t, err)
+	result, e, err := compiled.ExplainEval(bg, applicant)
+	require.NoError(t, err)
+	assert.Equal(t, true, result)
+	require.Len(t, e.Terms, 1)
+	assert.Equal(t, `country == "US"`, e.Terms[0].Expr)
+	assert.Equal(t, []int{1, 22, 0, 0}, []int{e.Terms[0].Line, e.Terms[0].Column, e.Terms[0].EndLine, e.Terms[0].EndColumn})
+}
@@ -0,0 +1,281 @@
+// Package format prints UExL expressions in a canonical layout, so that rules
+// written in different styles can be compared, reviewed and stored uniformly.
+//
+// The canonical form has single spaces around binary operators and none after
+// unary ones, only the parentheses that precedence requires, double-quoted
+// strings, sorted object keys, and pipe chains that are either kept on one
+// line or, when long, split one stage per line:
+//
+//	orders
+//	  |filter: $item.status == "paid" && $item.total > 100
+//	  |map: {"id": $item.id, "total": $item.total}
+//	  |sortBy: $item.total
+//
+// Comments are kept. Each is attached to the nearest pipe stage or statement:
+// a comment that follows code on the same line stays at the end of that line,
+// any other comment goes on its own line before it.
+//
+// Formatting is idempotent: formatting the output again returns it unchanged.
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maniartech/uexl/parser"
+)
+
+const (
+	// lineWidth is the width above which a pipe chain is split into lines.
+	lineWidth = 80
+
+	// maxInlinePipes is the number of pipes a chain may have and still be
+	// kept on one line.
+	maxInlinePipes = 2
+
+	// indent prefixes the continuation lines of a split pipe chain.
+	indent = "  "
+)
+
+// Source parses an expression and returns it in canonical form.
+func Source(src string) (string, error) {
+	node, comments, err := parser.ParseStringWithComments(src)
+	if err != nil {
+		return "", err
+	}
+	return Node(node, comments), nil
+}
+
+// Program parses a multi-statement program (see parser.ParseProgram) and
+// returns it in canonical form, one statement per line.
+func Program(src string) (string, error) {
+	opt := parser.DefaultOptions()
+	opt.PreserveComments = true
+	p := parser.NewParserWithOptions(src, opt)
+	list, err := p.ParseStatements()
+	if err != nil {
+		return "", err
+	}
+	return Node(list, p.Comments()), nil
+}
+
+// Node returns the canonical source of an expression or *parser.StatementList.
+// comments are the trivia returned by parser.ParseStringWithComments for the
+// same source; they are placed using the node positions, so pass nil for
+// nodes that were built or rewritten in code.
+func Node(node parser.Node, comments []parser.Comment) string {
+	groups := layout(node)
+	attachComments(groups, comments)
+
+	var lines []string
+	for _, g := range groups {
+		lines = append(lines, g.lines()...)
+	}
+	for _, c := range footer(groups, comments) {
+		lines = append(lines, c.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// group is one statement, or the whole expression, split into chunks.
+type group struct {
+	prefix string // "name = " for statements
+	chunks []*chunk
+}
+
+// chunk is the base expression or one stage of a top-level pipe chain.
+type chunk struct {
+	text     string
+	lines    map[int]int // source line -> first column holding code
+	first    pos
+	last     int // last source line holding code
+	leading  []string
+	trailing []string
+}
+
+type pos struct{ line, column int }
+
+func (p pos) before(q pos) bool {
+	return p.line < q.line || p.line == q.line && p.column < q.column
+}
+
+// layout renders each statement or pipe stage of node on its own.
+func layout(node parser.Node) []*group {
+	if list, ok := node.(*parser.StatementList); ok {
+		groups := make([]*group, len(list.Statements))
+		for i, stmt := range list.Statements {
+			groups[i] = chainGroup(stmt.Value)
+			groups[i].prefix = stmt.Name + " = "
+			groups[i].chunks[0].addPosition(stmt.Line, stmt.Column)
+		}
+		return groups
+	}
+	expr, _ := node.(parser.Expression)
+	return []*group{chainGroup(expr)}
+}
+
+func chainGroup(expr parser.Expression) *group {
+	g := &group{}
+	prog, ok := Unparen(expr).(*parser.ProgramNode)
+	if !ok {
+		g.chunks = []*chunk{newChunk(printExpr(expr, 0), expr)}
+		return g
+	}
+	for i := range prog.PipeExpressions {
+		stage := &prog.PipeExpressions[i]
+		c := newChunk(printStage(stage), stage.Expression)
+		for _, arg := range stage.ArgExprs {
+			c.addPositions(arg)
+		}
+		g.chunks = append(g.chunks, c)
+	}
+	return g
+}
+
+func newChunk(text string, expr parser.Expression) *chunk {
+	c := &chunk{text: text, lines: map[int]int{}}
+	c.addPositions(expr)
+	return c
+}
+
+// addPositions records where the code of expr is in the source, so that
+// comments can be placed relative to it.
+func (c *chunk) addPositions(expr parser.Expression) {
+	if expr == nil {
+		return
+	}
+	parser.Inspect(expr, func(n parser.Node) bool {
+		switch n.(type) {
+		case nil, *parser.ProgramNode, *parser.PipeExpression:
+			// Pipe stages all carry the position of the chain's start.
+		default:
+			c.addPosition(n.Position())
+		}
+		return true
+	})
+}
+
+func (c *chunk) addPosition(line, column int) {
+	if line <= 0 {
+		return
+	}
+	p := pos{line, column}
+	if len(c.lines) == 0 || p.before(c.first) {
+		c.first = p
+	}
+	if col, ok := c.lines[line]; !ok || column < col {
+		c.lines[line] = column
+	}
+	if line > c.last {
+		c.last = line
+	}
+}
+
+// attachComments gives every comment that is not a footer to a chunk.
+func attachComments(groups []*group, comments []parser.Comment) {
+	var chunks []*chunk
+	for _, g := range groups {
+		for _, c := range g.chunks {
+			if len(c.lines) > 0 {
+				chunks = append(chunks, c)
+			}
+		}
+	}
+	if len(chunks) == 0 {
+		return
+	}
+	for _, cm := range comments {
+		at := pos{cm.Line, cm.Column}
+		// The comment belongs to the last chunk starting before it.
+		i := -1
+		for i+1 < len(chunks) && chunks[i+1].first.before(at) {
+			i++
+		}
+		switch {
+		case i < 0:
+			chunks[0].leading = append(chunks[0].leading, cm.Text)
+		case chunks[i].hasCodeBefore(at):
+			chunks[i].trailing = append(chunks[i].trailing, cm.Text)
+			// A comment after a multi-line trailing comment trails too.
+			chunks[i].addPosition(cm.EndLine, 0)
+		case cm.Line <= chunks[i].last:
+			chunks[i].leading = append(chunks[i].leading, cm.Text)
+		case i+1 < len(chunks):
+			chunks[i+1].leading = append(chunks[i+1].leading, cm.Text)
+		}
+	}
+}
+
+// footer returns the comments after the last line of code, which
+// attachComments leaves for Node to print at the end.
+func footer(groups []*group, comments []parser.Comment) []parser.Comment {
+	last := 0
+	for _, g := range groups {
+		for _, c := range g.chunks {
+			if c.last > last {
+				last = c.last
+			}
+		}
+	}
+	var out []parser.Comment
+	for _, cm := range comments {
+		if cm.Line > last {
+			out = append(out, cm)
+		}
+	}
+	return out
+}
+
+func (c *chunk) hasCodeBefore(at pos) bool {
+	col, ok := c.lines[at.line]
+	return ok && col < at.column
+}
+
+// lines prints the group, keeping a pipe chain on one line unless it is long
+// or has comments between its stages.
+func (g *group) lines() []string {
+	var out []string
+	out = append(out, g.chunks[0].leading...)
+
+	if g.fitsOnOneLine() {
+		parts := make([]string, len(g.chunks))
+		for i, c := range g.chunks {
+			parts[i] = c.text
+		}
+		last := g.chunks[len(g.chunks)-1]
+		return append(out, withTrailing(g.prefix+strings.Join(parts, " "), last.trailing))
+	}
+
+	out = append(out, withTrailing(g.prefix+g.chunks[0].text, g.chunks[0].trailing))
+	for _, c := range g.chunks[1:] {
+		for _, text := range c.leading {
+			out = append(out, indent+text)
+		}
+		out = append(out, withTrailing(indent+c.text, c.trailing))
+	}
+	return out
+}
+
+func (g *group) fitsOnOneLine() bool {
+	if len(g.chunks) == 1 {
+		return true
+	}
+	if len(g.chunks)-1 > maxInlinePipes {
+		return false
+	}
+	width := utf8.RuneCountInString(g.prefix) + len(g.chunks) - 1
+	for i, c := range g.chunks {
+		if i > 0 && len(c.leading) > 0 || i < len(g.chunks)-1 && len(c.trailing) > 0 {
+			return false
+		}
+		width += utf8.RuneCountInString(c.text)
+	}
+	return width <= lineWidth
+}
+
+func withTrailing(line string, comments []string) string {
+	for _, text := range comments {
+		line += " " + text
+	}
+	return line
+}
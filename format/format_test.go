@@ -0,0 +1,270 @@
+package format_test
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"spacing", "a+b*  c", "a + b * c"},
+		{"unary", "- x + ! y", "-x + !y"},
+		{"double minus", "-(-x)", "- -x"},
+		{"redundant parens", "((a * b)) + (c)", "a * b + c"},
+		{"needed parens", "(a + b) * c", "(a + b) * c"},
+		{"left assoc", "a - (b - c) - d", "a - (b - c) - d"},
+		{"power right assoc", "(a ** b) ** c + a ** (b ** c)", "(a ** b) ** c + a ** b ** c"},
+		{"power unary", "(-2) ** 2 + -(2 ** 2)", "-2 ** 2 + -(2 ** 2)"},
+		{"nullish", "(a ?? b) + 1 + (c + 1 ?? d)", "(a ?? b) + 1 + (c + 1 ?? d)"},
+		{"logical", "(a || b) && c || (d && e)", "(a || b) && c || d && e"},
+		{"conditional", "(a ? b : c) ? (d ? e : f) : (g ? h : i)", "(a ? b : c) ? d ? e : f : g ? h : i"},
+		{"range", "(0)..(n - 1) step (2)", "0..n - 1 step 2"},
+		{"nested range", "(1..2)..<3", "(1..2)..<3"},
+		{"type", "(a + b) as string == \"3\"", "a + b as string == \"3\""},
+		{"member", "(a).b?.c.0[1]?[2].d", "a.b?.c.0[1]?[2].d"},
+		{"index forms", "a.(i + 1) ?.[j]", "a[i + 1]?[j]"},
+		{"number target", "(1).x", "(1).x"},
+		{"slices", "s[ : 2] + s[1:] + s[::-1]", "s[:2] + s[1:] + s[::-1]"},
+		{"call", "max( a,b ,  [1,2] )", "max(a, b, [1, 2])"},
+		{"object", "{ 'b' : 1,'a':{ }, }", `{"a": {}, "b": 1}`},
+		{"strings", `'it\'s' + 'say "hi"' + "\t"`, `"it's" + "say \"hi\"" + "\t"`},
+		{"raw strings", `r'\d+' + r'plain'`, `r"\d+" + "plain"`},
+		{"numbers", "1.50 + 1e21 + 1e-7 + 2E3", "1.5 + 1e21 + 1e-7 + 2000"},
+		{"specials", "NaN + -Inf", "NaN + -Inf"},
+		{"short pipe", "xs|filter:$item>1|map:$item*2", "xs |filter: $item > 1 |map: $item * 2"},
+		{"long pipe", "xs |filter: $item > 1 |map: $item * 2 |sum: $acc + $item",
+			"xs\n  |filter: $item > 1\n  |map: $item * 2\n  |sum: $acc + $item"},
+		{"pipe args and aliases", "xs as $xs |take( 2 ) :$item |: $item as $y |: $y",
+			"xs as $xs\n  |take(2): $item\n  |pipe as $y: $item\n  |: $y"},
+		{"nested pipe", "f((xs |map: $item)) + (xs |sum: $item)", "f(xs |map: $item) + (xs |sum: $item)"},
+		{"pipe in stage", "xs |map: ($item.lines |sum: $item)", "xs |map: ($item.lines |sum: $item)"},
+		{"omitted predicates", "(xs |take( 2 ) |sort as $s:|sum:) + 1", "(xs |take(2): |sort as $s: |sum:) + 1"},
+		{"bitwise or before colon", "c ? (a | b) : d + s[(x | y):] + (c ? (a || b) : d)", "c ? (a | b) : d + s[(x | y):] + (c ? a || b : d)"},
+		{"bitwise or of call", "a | (f(x)) | b", "a | (f(x)) | b"},
+		{"conditional pipe", "(a ? b : c) |map: $item", "a ? b : c |map: $item"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := format.Source(tt.src)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assertIdempotent(t, got)
+		})
+	}
+}
+
+func TestSource_LongLine(t *testing.T) {
+	got, err := format.Source(`orders |filter: $item.status == "paid" && $item.total > 100 |map: {"id": $item.id}`)
+	require.NoError(t, err)
+	assert.Equal(t, "orders\n  |filter: $item.status == \"paid\" && $item.total > 100\n  |map: {\"id\": $item.id}", got)
+}
+
+func TestSource_Comments(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"leading", "// total\n a+b", "// total\na + b"},
+		{"trailing", "a+b // total", "a + b // total"},
+		{"block inside", "a + /* why */ b", "a + b /* why */"},
+		{"footer", "a\n# done", "a\n# done"},
+		{"between stages", "xs\n// paid only\n|filter: $item.paid |map: $item.id // ids",
+			"xs\n  // paid only\n  |filter: $item.paid\n  |map: $item.id // ids"},
+		{"trailing stage", "xs |filter: $item.paid // paid\n |map: $item.id",
+			"xs\n  |filter: $item.paid // paid\n  |map: $item.id"},
+		{"last stage trailing stays inline", "xs |map: $item.id // ids", "xs |map: $item.id // ids"},
+		{"inside multi-line expression", "max(\n  a,\n  // fallback\n  b\n)", "// fallback\nmax(a, b)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := format.Source(tt.src)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assertIdempotent(t, got)
+		})
+	}
+}
+
+func TestProgram(t *testing.T) {
+	src := "subtotal=sum(items|map:$item.price) ; // before discount\n" +
+		"discount = subtotal>100?subtotal*0.1:0 // 10%\n" +
+		"total = items |map: $item.price |filter: $item > 0 |sum: $acc + $item"
+	got, err := format.Program(src)
+	require.NoError(t, err)
+	assert.Equal(t, "subtotal = sum(items |map: $item.price) // before discount\n"+
+		"discount = subtotal > 100 ? subtotal * 0.1 : 0 // 10%\n"+
+		"total = items\n  |map: $item.price\n  |filter: $item > 0\n  |sum: $acc + $item", got)
+
+	again, err := format.Program(got)
+	require.NoError(t, err)
+	assert.Equal(t, got, again)
+
+	_, err = format.Program("x = ")
+	assert.Error(t, err)
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{"a ? b : c", constants.PrecedenceConditional},
+		{"a ?? b", constants.PrecedenceNullish},
+		{"a + b", constants.PrecedenceSum},
+		{"-a", constants.PrecedencePrefix},
+		{"f(x)", constants.PrecedenceCall},
+		{"a.b", constants.PrecedenceIndex},
+		{"a[1:]", constants.PrecedenceIndex},
+		{"(a + b)", constants.PrecedenceHighest},
+		{"a", constants.PrecedenceHighest},
+	}
+	for _, tt := range tests {
+		node, err := parser.ParseString(tt.src)
+		require.NoError(t, err, tt.src)
+		expr := node.(parser.Expression)
+		assert.Equal(t, tt.want, format.Precedence(expr), tt.src)
+		_, grouped := format.Unparen(expr).(*parser.GroupedExpression)
+		assert.False(t, grouped, tt.src)
+	}
+}
+
+func TestSource_Error(t *testing.T) {
+	_, err := format.Source("a +")
+	assert.Error(t, err)
+}
+
+// TestCorpus formats every string literal of the parser tests that parses,
+// and checks that the output parses to the same tree and is a fixed point.
+func TestCorpus(t *testing.T) {
+	corpus := parserCorpus(t)
+	require.NotEmpty(t, corpus)
+
+	parsed := 0
+	for _, src := range corpus {
+		node, err := parser.ParseString(src)
+		if err != nil {
+			continue
+		}
+		parsed++
+		got, err := format.Source(src)
+		if !assert.NoError(t, err, "format %q", src) {
+			continue
+		}
+		reparsed, err := parser.ParseString(got)
+		if !assert.NoError(t, err, "parse formatted %q (from %q)", got, src) {
+			continue
+		}
+		assert.Equal(t, shape(node), shape(reparsed), "tree of %q formatted as %q", src, got)
+		assertIdempotent(t, got)
+	}
+	t.Logf("%d of %d corpus strings parse", parsed, len(corpus))
+	assert.Greater(t, parsed, 500)
+}
+
+func assertIdempotent(t *testing.T, formatted string) {
+	t.Helper()
+	again, err := format.Source(formatted)
+	if assert.NoError(t, err, "reformat %q", formatted) {
+		assert.Equal(t, formatted, again, "format is not idempotent")
+	}
+}
+
+// parserCorpus returns the distinct string literals of the parser's tests.
+func parserCorpus(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob("../parser/tests/*.go")
+	require.NoError(t, err)
+	more, err := filepath.Glob("../parser/*_test.go")
+	require.NoError(t, err)
+
+	seen := map[string]bool{}
+	fset := token.NewFileSet()
+	for _, path := range append(files, more...) {
+		f, err := goparser.ParseFile(fset, path, nil, 0)
+		require.NoError(t, err)
+		goast.Inspect(f, func(n goast.Node) bool {
+			if lit, ok := n.(*goast.BasicLit); ok && lit.Kind == token.STRING {
+				if s, err := strconv.Unquote(lit.Value); err == nil {
+					seen[s] = true
+				}
+			}
+			return true
+		})
+	}
+	corpus := make([]string, 0, len(seen))
+	for s := range seen {
+		corpus = append(corpus, s)
+	}
+	sort.Strings(corpus)
+	return corpus
+}
+
+// spelling matches the Dump fields that record how the source was written
+// rather than what it means.
+var spelling = regexp.MustCompile(` @\d+:\d+| (Token|IsRaw|IsSingleQuoted)=("(\\.|[^"\\])*"|\w+)`)
+
+// shape dumps node without positions, parentheses or literal spelling.
+func shape(node parser.Node) string {
+	return spelling.ReplaceAllString(parser.Dump(stripGroups(reflect.ValueOf(node)).Interface().(parser.Node)), "")
+}
+
+// stripGroups replaces every GroupedExpression beneath v by its contents.
+func stripGroups(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return stripGroups(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if g, ok := v.Interface().(*parser.GroupedExpression); ok {
+			return stripGroups(reflect.ValueOf(g.Expression))
+		}
+		stripGroups(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				setStripped(f, f)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			setStripped(v.Index(i), v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if s := stripGroups(v.MapIndex(k)); s.IsValid() {
+				v.SetMapIndex(k, s)
+			}
+		}
+	}
+	return v
+}
+
+func setStripped(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if s := stripGroups(src); s.IsValid() && s.Type().AssignableTo(dst.Type()) {
+			dst.Set(s)
+		}
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		stripGroups(src)
+	}
+}
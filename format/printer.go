@@ -0,0 +1,308 @@
+package format
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// printExpr returns the single-line source of expr, parenthesized if its
+// precedence is looser than prec, the precedence its position requires.
+func printExpr(expr parser.Expression, prec int) string {
+	expr = Unparen(expr)
+	s := printBare(expr)
+	if Precedence(expr) < prec {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// Unparen returns expr without its enclosing parentheses. The printer strips
+// the parentheses of the source and adds back the ones that are needed.
+func Unparen(expr parser.Expression) parser.Expression {
+	for {
+		g, ok := expr.(*parser.GroupedExpression)
+		if !ok {
+			return expr
+		}
+		expr = g.Expression
+	}
+}
+
+// Precedence returns how tightly expr binds, from the table in
+// parser/constants. Parenthesized expressions, literals and identifiers bind
+// tightest; expr needs parentheses where its position requires a higher
+// precedence.
+func Precedence(expr parser.Expression) int {
+	switch e := expr.(type) {
+	case *parser.ProgramNode:
+		return constants.PrecedencePipe
+	case *parser.ConditionalExpression:
+		return constants.PrecedenceConditional
+	case *parser.BinaryExpression:
+		return constants.BinaryPrecedence(e.Operator)
+	case *parser.TypeExpression:
+		return constants.PrecedenceType
+	case *parser.RangeExpression:
+		return constants.PrecedenceRange
+	case *parser.UnaryExpression:
+		return constants.PrecedencePrefix
+	case *parser.NumberLiteral:
+		if math.Signbit(e.Value) && !math.IsNaN(e.Value) {
+			return constants.PrecedencePrefix // printed as unary minus
+		}
+	case *parser.FunctionCall:
+		return constants.PrecedenceCall
+	case *parser.MemberAccess, *parser.IndexAccess, *parser.SliceExpression:
+		return constants.PrecedenceIndex
+	}
+	return constants.PrecedenceHighest
+}
+
+func printBare(expr parser.Expression) string {
+	switch e := expr.(type) {
+	case *parser.ProgramNode:
+		parts := make([]string, len(e.PipeExpressions))
+		for i := range e.PipeExpressions {
+			parts[i] = printStage(&e.PipeExpressions[i])
+		}
+		return strings.Join(parts, " ")
+
+	case *parser.ConditionalExpression:
+		return printExpr(e.Condition, constants.PrecedenceConditional+1) + " ? " +
+			beforeColon(printExpr(e.Consequent, constants.PrecedenceConditional)) + " : " +
+			printExpr(e.Alternate, constants.PrecedenceConditional)
+
+	case *parser.BinaryExpression:
+		prec := constants.BinaryPrecedence(e.Operator)
+		left, right := prec, prec+1 // left-associative
+		if prec == constants.PrecedencePower {
+			left, right = prec+1, prec
+		}
+		rhs := printExpr(e.Right, right)
+		if e.Operator == constants.SymbolBitwiseOr && pipeNameAt(rhs) > 0 && strings.HasPrefix(rhs[pipeNameAt(rhs):], "(") {
+			rhs = "(" + rhs + ")" // a | f(x) would read as the pipe |f(x):
+		}
+		return printExpr(e.Left, left) + " " + e.Operator + " " + rhs
+
+	case *parser.UnaryExpression:
+		operand := printExpr(e.Operand, constants.PrecedencePrefix)
+		if e.Operator == constants.SymbolMinus && strings.HasPrefix(operand, constants.SymbolMinus) {
+			return e.Operator + " " + operand // "--" would be a decrement
+		}
+		return e.Operator + operand
+
+	case *parser.TypeExpression:
+		return printExpr(e.Operand, constants.PrecedenceType) + " " + e.Operator + " " + e.TypeName
+
+	case *parser.RangeExpression:
+		op := constants.SymbolRange
+		if e.Exclusive {
+			op = constants.SymbolRangeExcl
+		}
+		s := printExpr(e.Start, constants.PrecedenceNullish) + op + printExpr(e.End, constants.PrecedenceNullish)
+		if e.Step != nil {
+			s += " " + constants.SymbolStep + " " + printExpr(e.Step, constants.PrecedenceNullish)
+		}
+		return s
+
+	case *parser.FunctionCall:
+		return printExpr(e.Function, constants.PrecedenceCall) + "(" + printList(e.Arguments) + ")"
+
+	case *parser.MemberAccess:
+		target := printExpr(e.Target, constants.PrecedenceCall)
+		if _, ok := Unparen(e.Target).(*parser.NumberLiteral); ok && !strings.HasPrefix(target, "(") {
+			target = "(" + target + ")" // 1.x would read as a number
+		}
+		dot := constants.SymbolDot
+		if e.Optional {
+			dot = "?."
+		}
+		if e.Property.Kind == parser.PropInt {
+			return target + dot + strconv.Itoa(e.Property.I)
+		}
+		return target + dot + e.Property.S
+
+	case *parser.IndexAccess:
+		return printExpr(e.Target, constants.PrecedenceCall) + openBracket(e.Optional) + printExpr(e.Index, 0) + "]"
+
+	case *parser.SliceExpression:
+		s := printExpr(e.Target, constants.PrecedenceCall) + openBracket(e.Optional) +
+			beforeColon(printOptional(e.Start)) + ":" + beforeColon(printOptional(e.End))
+		if e.Step != nil {
+			s += ":" + printExpr(e.Step, 0)
+		}
+		return s + "]"
+
+	case *parser.ArrayLiteral:
+		return "[" + printList(e.Elements) + "]"
+
+	case *parser.ObjectLiteral:
+		keys := make([]string, 0, len(e.Properties))
+		for k := range e.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = quote(k) + ": " + printExpr(e.Properties[k], 0)
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+
+	case *parser.StringLiteral:
+		if e.IsRaw && strings.Contains(e.Value, `\`) {
+			// Keep raw strings where they save escaping, e.g. in patterns.
+			return `r"` + strings.ReplaceAll(e.Value, `"`, `""`) + `"`
+		}
+		return quote(e.Value)
+
+	case *parser.NumberLiteral:
+		return formatNumber(e.Value)
+	case *parser.BooleanLiteral:
+		return strconv.FormatBool(e.Value)
+	case *parser.NullLiteral:
+		return "null"
+	case *parser.Identifier:
+		return e.Name
+	}
+	return ""
+}
+
+// printStage prints one stage of a pipe chain. The first stage is the
+// chain's input and only carries an optional alias.
+func printStage(stage *parser.PipeExpression) string {
+	expr := ""
+	if stage.Expression != nil { // nil when the predicate is omitted: xs |sum:
+		expr = printExpr(stage.Expression, constants.PrecedenceConditional)
+	}
+	if stage.Index == 0 {
+		if stage.Alias != "" {
+			expr += " " + constants.SymbolAs + " " + stage.Alias
+		}
+		return expr
+	}
+	if stage.PipeType == constants.DefaultPipeType && stage.Alias == "" && stage.ArgExprs == nil {
+		return strings.TrimSuffix(constants.SymbolPipe+" "+expr, " ")
+	}
+	header := constants.SymbolNamedPipe + stage.PipeType
+	if stage.ArgExprs != nil {
+		header += "(" + printList(stage.ArgExprs) + ")"
+	}
+	if stage.Alias != "" {
+		header += " " + constants.SymbolAs + " " + stage.Alias
+	}
+	return strings.TrimSuffix(header+": "+expr, " ")
+}
+
+// beforeColon parenthesizes s if it ends in a bitwise or of a bare word,
+// which a following ':' would turn into a pipe: c ? a | b : d.
+func beforeColon(s string) string {
+	i := len(s)
+	for i > 0 && isPipeNameByte(s[i-1]) {
+		i--
+	}
+	if i == len(s) {
+		return s
+	}
+	rest := strings.TrimRight(s[:i], " ")
+	if strings.HasSuffix(rest, constants.SymbolBitwiseOr) && !strings.HasSuffix(rest, constants.SymbolLogicalOr) {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// pipeNameAt returns the length of the word s starts with, counting only the
+// ASCII letters the tokenizer accepts in pipe names.
+func pipeNameAt(s string) int {
+	n := 0
+	for n < len(s) && isPipeNameByte(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isPipeNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func printList(exprs []parser.Expression) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = printExpr(e, 0)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printOptional(expr parser.Expression) string {
+	if expr == nil {
+		return ""
+	}
+	return printExpr(expr, 0)
+}
+
+func openBracket(optional bool) string {
+	if optional {
+		return "?["
+	}
+	return "["
+}
+
+// quote returns s as a double-quoted string literal.
+func quote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				b.WriteString(`\u00`)
+				b.WriteByte("0123456789abcdef"[c>>4])
+				b.WriteByte("0123456789abcdef"[c&0xf])
+			} else {
+				b.WriteByte(c) // UTF-8 sequences are copied unchanged
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatNumber prints v in plain decimal notation, switching to an exponent
+// only for very large or small magnitudes: 1e21, 1e-7.
+func formatNumber(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	abs := math.Abs(v)
+	if abs == 0 || abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(v, 'e', -1, 64)
+	mant, exp, _ := strings.Cut(s, "e")
+	sign := ""
+	if exp[0] == '-' {
+		sign = "-"
+	}
+	return mant + "e" + sign + strings.TrimLeft(exp[1:], "0")
+}
@@ -0,0 +1,190 @@
+// Package source indexes the text of an expression, so that the parser's
+// positions, which mark a single token of each node, can be turned into the
+// spans of whole nodes.
+package source
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// Source is the indexed text of an expression.
+type Source struct {
+	Text   string
+	Tokens []Token
+
+	lines []int          // byte offset of the start of each line
+	at    map[[2]int]int // parser position -> index in Tokens
+	spans map[parser.Node]Span
+}
+
+// Token is a token of the text.
+type Token struct {
+	Type constants.TokenType
+	Text string
+	Span
+	Match int // index of the matching bracket, or -1
+}
+
+// Span is a byte range of the text.
+type Span struct{ Start, End int }
+
+// New indexes text.
+func New(text string) *Source {
+	s := &Source{Text: text, lines: []int{0}, at: map[[2]int]int{}, spans: map[parser.Node]Span{}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	var open []int
+	tz := parser.NewTokenizer(text)
+	for {
+		tok, err := tz.NextToken()
+		if err != nil || tok.Type == constants.TokenEOF {
+			break
+		}
+		start := s.Offset(tok.Line, tok.Column)
+		end := start + len(tok.Token)
+		if tok.Type == constants.TokenPipe {
+			// A pipe token's text is its name; it starts at the '|'.
+			if i := strings.Index(text[start:], tok.Token); i >= 0 {
+				end = start + i + len(tok.Token)
+			}
+		}
+		t := Token{Type: tok.Type, Text: tok.Token, Span: Span{start, end}, Match: -1}
+		i := len(s.Tokens)
+		switch tok.Type {
+		case constants.TokenLeftParen, constants.TokenLeftBracket, constants.TokenLeftBrace, constants.TokenQuestionLeftBracket:
+			open = append(open, i)
+		case constants.TokenRightParen, constants.TokenRightBracket, constants.TokenRightBrace:
+			if n := len(open); n > 0 {
+				t.Match = open[n-1]
+				s.Tokens[open[n-1]].Match = i
+				open = open[:n-1]
+			}
+		}
+		s.at[[2]int{tok.Line, tok.Column}] = i
+		s.Tokens = append(s.Tokens, t)
+	}
+	return s
+}
+
+// Offset returns the byte offset of a parser position: a 1-based line and a
+// 1-based column counted in runes.
+func (s *Source) Offset(line, column int) int {
+	if line < 1 {
+		return 0
+	}
+	if line > len(s.lines) {
+		return len(s.Text)
+	}
+	off := s.lines[line-1]
+	for n := 1; n < column && off < len(s.Text) && s.Text[off] != '\n'; n++ {
+		_, size := utf8.DecodeRuneInString(s.Text[off:])
+		off += size
+	}
+	return off
+}
+
+// Position returns the parser position of byte offset off.
+func (s *Source) Position(off int) (line, column int) {
+	line = 1
+	for line < len(s.lines) && s.lines[line] <= off {
+		line++
+	}
+	return line, utf8.RuneCountInString(s.Text[s.lines[line-1]:off]) + 1
+}
+
+// Anchor returns the index in Tokens of the token at node's position.
+func (s *Source) Anchor(node parser.Node) (int, bool) {
+	line, column := node.Position()
+	i, ok := s.at[[2]int{line, column}]
+	return i, ok
+}
+
+// Span returns the text of node and its children, including the brackets
+// that close it.
+func (s *Source) Span(node parser.Node) Span {
+	if sp, ok := s.spans[node]; ok {
+		return sp
+	}
+	sp := Span{len(s.Text), 0}
+	i, ok := s.Anchor(node)
+	if ok {
+		sp = s.Tokens[i].Span
+	}
+	parser.Inspect(node, func(child parser.Node) bool {
+		if child == nil || child == node {
+			return child == node
+		}
+		c := s.Span(child)
+		sp.Start, sp.End = min(sp.Start, c.Start), max(sp.End, c.End)
+		return false
+	})
+	if prog, isProg := node.(*parser.ProgramNode); isProg {
+		sp.End = max(sp.End, s.chainEnd(prog))
+	}
+	if ok {
+		switch node.(type) {
+		case *parser.MemberAccess, *parser.TypeExpression:
+			// The property or type name follows the '.' or 'as'.
+			if i+1 < len(s.Tokens) {
+				sp.End = max(sp.End, s.Tokens[i+1].End)
+			}
+		default:
+			if m := s.Tokens[i].Match; m > i {
+				sp.End = max(sp.End, s.Tokens[m].End)
+			}
+		}
+	}
+	s.spans[node] = sp
+	return sp
+}
+
+// chainEnd returns the end of the last stage of prog. A stage without a
+// predicate ends with its header, as in `xs |take(2) |sum:`, which no node of
+// the stage spans.
+func (s *Source) chainEnd(prog *parser.ProgramNode) int {
+	end := 0
+	for i := range prog.PipeExpressions {
+		stage := &prog.PipeExpressions[i]
+		if stage.Expression != nil {
+			end = max(end, s.Span(stage.Expression).End)
+		} else {
+			end = s.headerEnd(end)
+		}
+	}
+	return end
+}
+
+// headerEnd returns the end of the pipe header that follows offset off:
+// `|:`, or `|name`, with optional arguments and alias, and its ':'.
+func (s *Source) headerEnd(off int) int {
+	k := 0
+	for k < len(s.Tokens) && s.Tokens[k].Start < off {
+		k++
+	}
+	if k == len(s.Tokens) || s.Tokens[k].Type != constants.TokenPipe {
+		return off
+	}
+	named := s.Tokens[k].Text != ":"
+	end := s.Tokens[k].End
+	k++
+	if named && k < len(s.Tokens) && s.Tokens[k].Type == constants.TokenLeftParen && s.Tokens[k].Match > k {
+		k = s.Tokens[k].Match
+		end = s.Tokens[k].End
+		k++
+	}
+	if k+1 < len(s.Tokens) && s.Tokens[k].Type == constants.TokenAs {
+		end = s.Tokens[k+1].End
+		k += 2
+	}
+	if named && k < len(s.Tokens) && s.Tokens[k].Type == constants.TokenColon {
+		end = s.Tokens[k].End
+	}
+	return end
+}
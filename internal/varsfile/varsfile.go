@@ -0,0 +1,92 @@
+// Package varsfile decodes the JSON and YAML variable files accepted by the
+// command-line tools.
+package varsfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the variables object in the file at path. See Decode.
+func Load(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, filepath.Ext(path))
+}
+
+// Decode parses data as a variables object. ext (a file extension such as
+// ".json") selects the format; ".yaml" and ".yml" are YAML, anything else is
+// tried as JSON first, then YAML. Empty input yields nil.
+//
+// YAML values are converted to the types JSON decoding produces: numbers
+// become float64, timestamps RFC 3339 strings and map keys strings.
+func Decode(data []byte, ext string) (map[string]any, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var (
+		vars map[string]any
+		err  error
+	)
+	switch strings.ToLower(ext) {
+	case ".json":
+		err = json.Unmarshal(data, &vars)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &vars)
+	default:
+		if err = json.Unmarshal(data, &vars); err != nil {
+			vars = nil
+			if yamlErr := yaml.Unmarshal(data, &vars); yamlErr == nil {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range vars {
+		vars[k] = normalize(v)
+	}
+	return vars, nil
+}
+
+// normalize converts one decoded YAML value, recursively.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []any:
+		for i, e := range v {
+			v[i] = normalize(e)
+		}
+		return v
+	case map[string]any:
+		for k, e := range v {
+			v[k] = normalize(e)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = normalize(e)
+		}
+		return m
+	}
+	return v
+}
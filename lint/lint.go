@@ -0,0 +1,296 @@
+// Package lint reports expressions that are legal but probably wrong, such
+// as `$acc || 0` in a reduce predicate or a `x == null ? d : x` conditional
+// that should be `x ?? d`.
+//
+// A Linter runs a set of Rules over the parse tree of an expression. Each
+// rule reports Diagnostics with a severity and, when the intent is clear, a
+// Fix: text edits that Apply turns into corrected source.
+//
+//	diags, err := lint.New().Lint(`orders |reduce: ($acc || 0) + $item.total`)
+//	// reduce-acc-or: $acc || ... replaces falsy accumulators such as 0; use ?? instead
+//
+// Rules are pluggable: implement Rule, or wrap a function with NewRule, and
+// add it to Linter.Rules.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maniartech/uexl/internal/source"
+	"github.com/maniartech/uexl/parser"
+)
+
+// Severity is how serious a diagnostic is.
+type Severity int
+
+const (
+	// Off disables a rule in Linter.Severity.
+	Off Severity = iota
+	Info
+	Warning
+	Error
+)
+
+var severityNames = []string{"off", "info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < Off || s > Error {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity returns the severity named s: "off", "info", "warning" or
+// "error".
+func ParseSeverity(s string) (Severity, error) {
+	for i, name := range severityNames {
+		if s == name {
+			return Severity(i), nil
+		}
+	}
+	return Off, fmt.Errorf("unknown severity %q", s)
+}
+
+// MarshalText encodes s by name, so that diagnostics read well as JSON.
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// UnmarshalText decodes a severity name.
+func (s *Severity) UnmarshalText(text []byte) (err error) {
+	*s, err = ParseSeverity(string(text))
+	return err
+}
+
+// Edit replaces the source between two positions with NewText. Positions
+// follow the parser: 1-based lines, and 1-based columns counted in runes.
+// The end is exclusive.
+type Edit struct {
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	NewText   string `json:"newText"`
+}
+
+// Fix is a suggested correction of a diagnostic.
+type Fix struct {
+	Message string `json:"message"`
+	Edits   []Edit `json:"edits"`
+}
+
+// Diagnostic is one finding of a rule, located at the span of the offending
+// node.
+type Diagnostic struct {
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	EndLine   int      `json:"endLine"`
+	EndColumn int      `json:"endColumn"`
+	Fix       *Fix     `json:"fix,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// Rule checks one kind of problem.
+type Rule interface {
+	// Name identifies the rule in diagnostics and in Linter.Severity.
+	Name() string
+	// Doc describes what the rule reports.
+	Doc() string
+	// Severity is the severity of the rule's diagnostics unless the
+	// Linter overrides it.
+	Severity() Severity
+	// Check inspects p.Root and reports problems with p.Report.
+	Check(p *Pass)
+}
+
+// NewRule returns a Rule that runs check.
+func NewRule(name, doc string, severity Severity, check func(p *Pass)) Rule {
+	return &funcRule{name, doc, severity, check}
+}
+
+type funcRule struct {
+	name, doc string
+	severity  Severity
+	check     func(p *Pass)
+}
+
+func (r *funcRule) Name() string       { return r.name }
+func (r *funcRule) Doc() string        { return r.doc }
+func (r *funcRule) Severity() Severity { return r.severity }
+func (r *funcRule) Check(p *Pass)      { r.check(p) }
+
+// Linter runs rules over expressions. The zero value runs no rules; use New
+// for the built-in ones.
+type Linter struct {
+	Rules []Rule
+	// Severity overrides the severity of rules by name; Off disables a rule.
+	Severity map[string]Severity
+	// Variables declares the types of context variables, as typeof() names
+	// them: "number", "string", "boolean", "array" or "object". A trailing
+	// "?" (e.g. "object?") marks a variable that may be null. Rules that
+	// depend on types skip undeclared variables.
+	Variables map[string]string
+}
+
+// New returns a Linter running DefaultRules.
+func New() *Linter {
+	return &Linter{Rules: DefaultRules()}
+}
+
+// Lint lints src with the built-in rules.
+func Lint(src string) ([]Diagnostic, error) {
+	return New().Lint(src)
+}
+
+// Lint parses src and runs the rules over it. Diagnostics are sorted by
+// position. A parse error is returned as is; there is nothing to lint.
+func (l *Linter) Lint(src string) ([]Diagnostic, error) {
+	root, err := parser.ParseString(src)
+	if err != nil {
+		return nil, err
+	}
+	diags := []Diagnostic{}
+	s := source.New(src)
+	for _, rule := range l.Rules {
+		severity := rule.Severity()
+		if o, ok := l.Severity[rule.Name()]; ok {
+			severity = o
+		}
+		if severity == Off {
+			continue
+		}
+		rule.Check(&Pass{Root: root, Source: src, rule: rule.Name(), severity: severity, vars: l.Variables, src: s, diags: &diags})
+	}
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return diags, nil
+}
+
+// Pass is the state of one rule run over one expression.
+type Pass struct {
+	Root   parser.Node
+	Source string
+
+	rule     string
+	severity Severity
+	vars     map[string]string
+	src      *source.Source
+	diags    *[]Diagnostic
+}
+
+// Report records a diagnostic spanning node. fix may be nil.
+func (p *Pass) Report(node parser.Node, message string, fix *Fix) {
+	d := Diagnostic{Rule: p.rule, Severity: p.severity, Message: message, Fix: fix}
+	sp := p.src.Span(node)
+	d.Line, d.Column = p.src.Position(sp.Start)
+	d.EndLine, d.EndColumn = p.src.Position(sp.End)
+	*p.diags = append(*p.diags, d)
+}
+
+// Text returns the source of node.
+func (p *Pass) Text(node parser.Node) string {
+	sp := p.src.Span(node)
+	return p.Source[sp.Start:sp.End]
+}
+
+// Replace returns an edit replacing the source of node with text.
+func (p *Pass) Replace(node parser.Node, text string) Edit {
+	return edit(p.src, p.src.Span(node), text)
+}
+
+// ReplaceToken returns an edit replacing the token at node's position with
+// text: the operator of a binary or unary expression, the '.' or '?.' of a
+// member access, the '(' of a call. ok is false if there is no such token.
+func (p *Pass) ReplaceToken(node parser.Node, text string) (e Edit, ok bool) {
+	i, ok := p.src.Anchor(node)
+	if !ok {
+		return Edit{}, false
+	}
+	return edit(p.src, p.src.Tokens[i].Span, text), true
+}
+
+// edit returns an edit replacing sp of s with text.
+func edit(s *source.Source, sp source.Span, text string) Edit {
+	e := Edit{NewText: text}
+	e.Line, e.Column = s.Position(sp.Start)
+	e.EndLine, e.EndColumn = s.Position(sp.End)
+	return e
+}
+
+// VarType returns the declared type of the context variable name, without
+// the nullable marker, and whether the variable may be null. ok is false for
+// undeclared variables.
+func (p *Pass) VarType(name string) (typ string, nullable, ok bool) {
+	typ, ok = p.vars[name]
+	if !ok {
+		return "", false, false
+	}
+	if strings.HasSuffix(typ, "?") {
+		return strings.TrimSuffix(typ, "?"), true, true
+	}
+	return typ, typ == "null", true
+}
+
+// Apply returns src with edits applied. Edits must not overlap.
+func Apply(src string, edits []Edit) (string, error) {
+	s := source.New(src)
+	type change struct {
+		source.Span
+		text string
+	}
+	changes := make([]change, len(edits))
+	for i, e := range edits {
+		changes[i] = change{source.Span{Start: s.Offset(e.Line, e.Column), End: s.Offset(e.EndLine, e.EndColumn)}, e.NewText}
+		if changes[i].End < changes[i].Start {
+			return "", fmt.Errorf("edit %d:%d-%d:%d ends before it starts", e.Line, e.Column, e.EndLine, e.EndColumn)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Start < changes[j].Start })
+	var b strings.Builder
+	last := 0
+	for _, c := range changes {
+		if c.Start < last {
+			return "", fmt.Errorf("overlapping edits at offset %d", c.Start)
+		}
+		b.WriteString(src[last:c.Start])
+		b.WriteString(c.text)
+		last = c.End
+	}
+	b.WriteString(src[last:])
+	return b.String(), nil
+}
+
+// Fixes returns the edits of the fixes of diags, skipping fixes that overlap
+// an earlier one, so that the result can be passed to Apply.
+func Fixes(diags []Diagnostic) []Edit {
+	var edits []Edit
+	before := func(a, b Edit) bool { // a ends at or before the start of b
+		return a.EndLine < b.Line || a.EndLine == b.Line && a.EndColumn <= b.Column
+	}
+next:
+	for _, d := range diags {
+		if d.Fix == nil {
+			continue
+		}
+		for _, e := range d.Fix.Edits {
+			for _, t := range edits {
+				if !before(e, t) && !before(t, e) {
+					continue next
+				}
+			}
+		}
+		edits = append(edits, d.Fix.Edits...)
+	}
+	return edits
+}
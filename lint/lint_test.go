@@ -0,0 +1,182 @@
+package lint_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/maniartech/uexl/lint"
+	"github.com/maniartech/uexl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixed returns src with the fixes of diags applied.
+func fixed(t *testing.T, src string, diags []lint.Diagnostic) string {
+	t.Helper()
+	out, err := lint.Apply(src, lint.Fixes(diags))
+	require.NoError(t, err)
+	return out
+}
+
+func TestRules(t *testing.T) {
+	l := lint.New()
+	l.Variables = map[string]string{"order": "object", "name": "string", "note": "string?"}
+
+	tests := []struct {
+		src   string
+		rules []string // rules reported, in order
+		fixed string   // src with all fixes applied
+	}{
+		// reduce-acc-or
+		{"orders |reduce: ($acc || 0) + $item", []string{"reduce-acc-or"}, "orders |reduce: ($acc ?? 0) + $item"},
+		{"orders |reduce: $acc || a ? b : c", []string{"reduce-acc-or"}, "orders |reduce: $acc ?? a ? b : c"},
+		{"orders |reduce: $acc || a == b", []string{"reduce-acc-or"}, "orders |reduce: $acc ?? (a == b)"},
+		{"orders |reduce: ($acc ?? 0) + $item", nil, ""},
+		{"orders |map: $item || 0", nil, ""},
+
+		// null-comparison
+		{"x == null ? 0 : x", []string{"null-comparison"}, "x ?? 0"},
+		{"null != a.b ? a.b : 'none'", []string{"null-comparison"}, "a.b ?? 'none'"},
+		{"isNullish(x) ? d || e : (x)", []string{"null-comparison"}, "x ?? (d || e)"},
+		{"a as string == null ? '' : a as string", []string{"null-comparison"}, "(a as string) ?? ''"},
+		{"a + b == null ? 0 : a + b", []string{"null-comparison"}, "a + b ?? 0"},
+		{"f(x) == null ? a[0] : f(x)", []string{"null-comparison"}, "f(x) ?? a[0]"},
+		{"a[1:] == null ? -1 : a[1:]", []string{"null-comparison"}, "a[1:] ?? -1"},
+		{"x == null ? 0 : y", nil, ""},
+		{"x == 0 ? 0 : x", nil, ""},
+
+		// len-on-string
+		{"len(name)", []string{"len-on-string"}, "graphemeLen(name)"},
+		{`len("héllo") + len(str(n)) + len(a + "!")`, []string{"len-on-string", "len-on-string", "len-on-string"}, `graphemeLen("héllo") + graphemeLen(str(n)) + graphemeLen(a + "!")`},
+		{"len(x as string)", []string{"len-on-string"}, "graphemeLen(x as string)"},
+		{`len("abc") + len(items) + len(note) + len(order)`, nil, ""},
+
+		// unused-alias
+		{"orders |map as $o: $item * 2", []string{"unused-alias"}, "orders |map: $item * 2"},
+		{"orders |map: $item * 2 as $m |filter: $item", []string{"unused-alias"}, "orders |map: $item * 2 |filter: $item"},
+		{"orders as $all |map: $item / len($all)", nil, ""},
+		{"orders |map as $o: ($o.lines |sum: $item.qty)", nil, ""},
+
+		// constant-condition
+		{"1 > 2 ? a : b", []string{"constant-condition"}, "b"},
+		{"!(1 > 2) ? a : b", []string{"constant-condition"}, "a"},
+		{"orders |filter: $item > 1 || true", []string{"constant-condition"}, "orders |filter: $item > 1 || true"},
+		{"orders |every: false && $item", []string{"constant-condition"}, "orders |every: false && $item"},
+		{"x > 2 ? a : b", nil, ""},
+		{"orders |map: true", nil, ""},
+
+		// needless-optional-chain
+		{"order?.customer?.name", []string{"needless-optional-chain"}, "order.customer?.name"},
+		{"order?.[0] + order?[1]", []string{"needless-optional-chain", "needless-optional-chain"}, "order[0] + order[1]"},
+		{"note?.x + other?.x", nil, ""},
+	}
+	for _, tt := range tests {
+		diags, err := l.Lint(tt.src)
+		require.NoError(t, err, tt.src)
+		var rules []string
+		for _, d := range diags {
+			rules = append(rules, d.Rule)
+		}
+		assert.Equal(t, tt.rules, rules, tt.src)
+		if tt.rules != nil {
+			assert.Equal(t, tt.fixed, fixed(t, tt.src, diags), tt.src)
+		}
+	}
+}
+
+func TestLint_Diagnostic(t *testing.T) {
+	diags, err := lint.Lint("items\n  |reduce: $acc || 0")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	d := diags[0]
+	assert.Equal(t, lint.Diagnostic{
+		Rule: "reduce-acc-or", Severity: lint.Warning,
+		Message: "$acc || ... replaces falsy accumulators such as 0; use ?? instead",
+		Line:    2, Column: 12, EndLine: 2, EndColumn: 21,
+		Fix: &lint.Fix{Message: "use ??", Edits: []lint.Edit{{Line: 2, Column: 17, EndLine: 2, EndColumn: 19, NewText: "??"}}},
+	}, d)
+	assert.Equal(t, "2:12: warning: $acc || ... replaces falsy accumulators such as 0; use ?? instead (reduce-acc-or)", d.String())
+
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"severity":"warning"`)
+	var back lint.Diagnostic
+	require.NoError(t, json.Unmarshal(data, &back))
+	assert.Equal(t, d, back)
+
+	_, err = lint.Lint("1 +")
+	assert.Error(t, err)
+}
+
+func TestLint_Positions(t *testing.T) {
+	// Columns count runes, after non-ASCII strings too.
+	diags, err := lint.Lint(`"日本" + (x == null ? "é" : x)`)
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, [4]int{1, 9, 1, 28}, [4]int{diags[0].Line, diags[0].Column, diags[0].EndLine, diags[0].EndColumn})
+	assert.Equal(t, `"日本" + (x ?? "é")`, fixed(t, `"日本" + (x == null ? "é" : x)`, diags))
+}
+
+func TestLinter_Severity(t *testing.T) {
+	l := lint.New()
+	l.Severity = map[string]lint.Severity{"reduce-acc-or": lint.Error, "constant-condition": lint.Off}
+	diags, err := l.Lint("orders |reduce: ($acc || 0) + (true ? 1 : 2)")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, lint.Error, diags[0].Severity)
+
+	for _, name := range []string{"off", "info", "warning", "error"} {
+		s, err := lint.ParseSeverity(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, s.String())
+	}
+	_, err = lint.ParseSeverity("fatal")
+	assert.EqualError(t, err, `unknown severity "fatal"`)
+	assert.Equal(t, "Severity(9)", lint.Severity(9).String())
+}
+
+func TestNewRule(t *testing.T) {
+	noTake := lint.NewRule("no-take", "reports |take:", lint.Info, func(p *lint.Pass) {
+		parser.Inspect(p.Root, func(n parser.Node) bool {
+			if stage, ok := n.(*parser.PipeExpression); ok && stage.PipeType == "take" {
+				p.Report(stage.Expression, "take is discouraged: "+p.Text(stage.Expression), nil)
+			}
+			return true
+		})
+	})
+	assert.Equal(t, "no-take", noTake.Name())
+	assert.Equal(t, "reports |take:", noTake.Doc())
+
+	l := &lint.Linter{Rules: []lint.Rule{noTake}}
+	diags, err := l.Lint("orders |take(2): $item.id")
+	require.NoError(t, err)
+	require.Len(t, diags, 1)
+	assert.Equal(t, "take is discouraged: $item.id", diags[0].Message)
+	assert.Equal(t, lint.Info, diags[0].Severity)
+	assert.Equal(t, 18, diags[0].Column)
+}
+
+func TestApply(t *testing.T) {
+	out, err := lint.Apply("a + b", []lint.Edit{
+		{Line: 1, Column: 5, EndLine: 1, EndColumn: 6, NewText: "c"},
+		{Line: 1, Column: 1, EndLine: 1, EndColumn: 2, NewText: "x"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "x + c", out)
+
+	_, err = lint.Apply("a + b", []lint.Edit{
+		{Line: 1, Column: 1, EndLine: 1, EndColumn: 4},
+		{Line: 1, Column: 3, EndLine: 1, EndColumn: 5},
+	})
+	assert.EqualError(t, err, "overlapping edits at offset 2")
+
+	_, err = lint.Apply("a + b", []lint.Edit{{Line: 1, Column: 3, EndLine: 1, EndColumn: 1}})
+	assert.EqualError(t, err, "edit 1:3-1:1 ends before it starts")
+
+	// Overlapping fixes: the first one wins, the rest wait for another run.
+	src := "x == null ? 1 > 2 ? a : b : x"
+	diags, err := lint.Lint(src)
+	require.NoError(t, err)
+	require.Len(t, diags, 2)
+	assert.Equal(t, "x ?? (1 > 2 ? a : b)", fixed(t, src, diags))
+}
@@ -0,0 +1,400 @@
+package lint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/internal/source"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// Built-in rules.
+var (
+	// ReduceAccOr reports `$acc || x`, which resets the accumulator whenever
+	// it is falsy, e.g. a running total of 0.
+	ReduceAccOr = NewRule("reduce-acc-or",
+		"reports `$acc || x` in reduce predicates; `$acc ?? x` or |reduce(x): keep falsy accumulators such as 0",
+		Warning, checkReduceAccOr)
+
+	// NullComparison reports conditionals that spell out `x ?? d`.
+	NullComparison = NewRule("null-comparison",
+		"reports `x == null ? d : x` and similar conditionals that can be written `x ?? d`",
+		Warning, checkNullComparison)
+
+	// LenOnString reports len() of strings, which counts bytes.
+	LenOnString = NewRule("len-on-string",
+		"reports len() of strings, which counts bytes; graphemeLen counts the characters a reader sees",
+		Warning, checkLenOnString)
+
+	// UnusedAlias reports pipe aliases that nothing refers to.
+	UnusedAlias = NewRule("unused-alias",
+		"reports `as $name` pipe aliases that are never referenced",
+		Warning, checkUnusedAlias)
+
+	// ConstantCondition reports conditions and filter predicates that do not
+	// depend on any variable.
+	ConstantCondition = NewRule("constant-condition",
+		"reports conditions and filter-like predicates that are always true or always false",
+		Warning, checkConstantCondition)
+
+	// NeedlessOptionalChain reports `?.` and `?.[` on variables declared
+	// non-nullable in Linter.Variables.
+	NeedlessOptionalChain = NewRule("needless-optional-chain",
+		"reports ?. and ?.[ on variables that are declared never null",
+		Info, checkNeedlessOptionalChain)
+)
+
+// DefaultRules returns the built-in rules.
+func DefaultRules() []Rule {
+	return []Rule{ReduceAccOr, NullComparison, LenOnString, UnusedAlias, ConstantCondition, NeedlessOptionalChain}
+}
+
+// predicatePipes are the built-in pipes whose predicate is a condition.
+var predicatePipes = map[string]bool{
+	"filter": true, "pfilter": true, "find": true, "some": true, "every": true,
+	"partition": true, "takeWhile": true, "skipWhile": true,
+}
+
+// stringFunctions are the built-in functions that return strings.
+var stringFunctions = map[string]bool{
+	"str": true, "substr": true, "runeSubstr": true, "graphemeSubstr": true, "join": true, "typeof": true,
+}
+
+func checkReduceAccOr(p *Pass) {
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		b, ok := n.(*parser.BinaryExpression)
+		if !ok || b.Operator != constants.SymbolLogicalOr || !isIdent(b.Left, "$acc") {
+			return true
+		}
+		var fix *Fix
+		if op, ok := p.ReplaceToken(b, "??"); ok {
+			fix = &Fix{Message: "use ??", Edits: []Edit{op}}
+			if format.Precedence(b.Right) <= constants.PrecedenceNullish {
+				// ?? binds tighter than ||: keep the right operand whole.
+				fix.Edits = append(fix.Edits, p.Replace(b.Right, "("+p.Text(b.Right)+")"))
+			}
+		}
+		p.Report(b, "$acc || ... replaces falsy accumulators such as 0; use ?? instead", fix)
+		return true
+	})
+}
+
+func checkNullComparison(p *Pass) {
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		c, ok := n.(*parser.ConditionalExpression)
+		if !ok {
+			return true
+		}
+		x, isNull, ok := nullTest(c.Condition)
+		if !ok {
+			return true
+		}
+		value, fallback := c.Alternate, c.Consequent
+		if !isNull {
+			value, fallback = c.Consequent, c.Alternate
+		}
+		if !sameExpr(x, value) {
+			return true
+		}
+		left, right := p.Text(x), p.Text(fallback)
+		if format.Precedence(x) < constants.PrecedenceNullish {
+			left = "(" + left + ")"
+		}
+		if format.Precedence(fallback) <= constants.PrecedenceNullish {
+			right = "(" + right + ")"
+		}
+		text := left + " ?? " + right
+		p.Report(c, fmt.Sprintf("comparison with null can be written %s", text),
+			&Fix{Message: "use ??", Edits: []Edit{p.Replace(c, text)}})
+		return true
+	})
+}
+
+// nullTest matches `x == null`, `x != null` (either way round) and
+// `isNullish(x)`, returning x and whether the condition holds when x is null.
+func nullTest(cond parser.Expression) (x parser.Expression, isNull, ok bool) {
+	switch c := format.Unparen(cond).(type) {
+	case *parser.BinaryExpression:
+		if c.Operator != "==" && c.Operator != "!=" {
+			return nil, false, false
+		}
+		switch {
+		case isNullLiteral(c.Right):
+			x = c.Left
+		case isNullLiteral(c.Left):
+			x = c.Right
+		default:
+			return nil, false, false
+		}
+		return x, c.Operator == "==", true
+	case *parser.FunctionCall:
+		if isIdent(c.Function, "isNullish") && len(c.Arguments) == 1 {
+			return c.Arguments[0], true, true
+		}
+	}
+	return nil, false, false
+}
+
+func checkLenOnString(p *Pass) {
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		call, ok := n.(*parser.FunctionCall)
+		if !ok || !isIdent(call.Function, "len") || len(call.Arguments) != 1 {
+			return true
+		}
+		arg := format.Unparen(call.Arguments[0])
+		if lit, ok := arg.(*parser.StringLiteral); ok && isASCII(lit.Value) {
+			return true // bytes and characters agree
+		}
+		if isString(p, arg) {
+			p.Report(call, "len counts the bytes of a string; use graphemeLen to count characters",
+				&Fix{Message: "use graphemeLen", Edits: []Edit{p.Replace(call.Function, "graphemeLen")}})
+		}
+		return true
+	})
+}
+
+// isString reports whether expr is known to be a string.
+func isString(p *Pass, expr parser.Expression) bool {
+	switch e := format.Unparen(expr).(type) {
+	case *parser.StringLiteral:
+		return true
+	case *parser.BinaryExpression:
+		return e.Operator == "+" && (isString(p, e.Left) || isString(p, e.Right))
+	case *parser.ConditionalExpression:
+		return isString(p, e.Consequent) && isString(p, e.Alternate)
+	case *parser.FunctionCall:
+		id, ok := e.Function.(*parser.Identifier)
+		return ok && stringFunctions[id.Name]
+	case *parser.TypeExpression:
+		return e.Operator == "as" && e.TypeName == "string"
+	case *parser.Identifier:
+		typ, nullable, ok := p.VarType(e.Name)
+		return ok && !nullable && typ == "string"
+	}
+	return false
+}
+
+func checkUnusedAlias(p *Pass) {
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		prog, ok := n.(*parser.ProgramNode)
+		if !ok {
+			return true
+		}
+		for i := range prog.PipeExpressions {
+			stage := &prog.PipeExpressions[i]
+			if stage.Alias == "" || referenced(prog.PipeExpressions[i:], stage.Alias) {
+				continue
+			}
+			var fix *Fix
+			if e, ok := aliasEdit(p, stage); ok {
+				fix = &Fix{Message: "remove the alias", Edits: []Edit{e}}
+			}
+			var at parser.Node = stage
+			if stage.Expression != nil {
+				at = stage.Expression
+			}
+			p.Report(at, fmt.Sprintf("alias %s is never used", stage.Alias), fix)
+		}
+		return true
+	})
+}
+
+// referenced reports whether any of stages refers to name. An alias is
+// visible in the predicate of its stage and, for the input of a chain, in
+// the stages that follow.
+func referenced(stages []parser.PipeExpression, name string) bool {
+	found := false
+	for i := range stages {
+		parser.Inspect(&stages[i], func(n parser.Node) bool {
+			found = found || isIdent(n, name)
+			return !found
+		})
+	}
+	return found
+}
+
+// aliasEdit returns an edit removing the `as $name` of stage, which either
+// follows its predicate or precedes the ':' of its header.
+func aliasEdit(p *Pass, stage *parser.PipeExpression) (Edit, bool) {
+	if stage.Expression == nil {
+		return Edit{}, false
+	}
+	s := p.src
+	sp := s.Span(stage.Expression)
+	toks := s.Tokens
+	k := 0
+	for k < len(toks) && toks[k].Start < sp.End {
+		k++
+	}
+	if k+1 < len(toks) && toks[k].Type == constants.TokenAs && toks[k+1].Text == stage.Alias {
+		return edit(s, source.Span{Start: sp.End, End: toks[k+1].End}, ""), true
+	}
+	j := len(toks) - 1
+	for j >= 0 && toks[j].End > sp.Start {
+		j--
+	}
+	if j >= 3 && toks[j].Type == constants.TokenColon && toks[j-1].Text == stage.Alias && toks[j-2].Type == constants.TokenAs {
+		return edit(s, source.Span{Start: toks[j-3].End, End: toks[j-1].End}, ""), true
+	}
+	return Edit{}, false
+}
+
+func checkConstantCondition(p *Pass) {
+	report := func(node parser.Node, cond parser.Expression, fix func(bool) *Fix) {
+		if truthy, ok := constantTruth(cond); ok {
+			p.Report(node, fmt.Sprintf("condition is always %t", truthy), fix(truthy))
+		}
+	}
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.ConditionalExpression:
+			report(n.Condition, n.Condition, func(truthy bool) *Fix {
+				branch := n.Alternate
+				if truthy {
+					branch = n.Consequent
+				}
+				return &Fix{Message: "keep the branch that is taken", Edits: []Edit{p.Replace(n, p.Text(branch))}}
+			})
+		case *parser.PipeExpression:
+			if predicatePipes[n.PipeType] && n.Expression != nil {
+				report(n.Expression, n.Expression, func(bool) *Fix { return nil })
+			}
+		}
+		return true
+	})
+}
+
+// constantTruth returns the truthiness of cond when it does not depend on
+// variables, function calls or pipes. `x || true` and `x && false` are
+// constant too.
+func constantTruth(cond parser.Expression) (truthy, ok bool) {
+	switch c := format.Unparen(cond).(type) {
+	case *parser.BinaryExpression:
+		switch c.Operator {
+		case constants.SymbolLogicalOr, constants.SymbolLogicalAnd:
+			or := c.Operator == constants.SymbolLogicalOr
+			l, lok := constantTruth(c.Left)
+			r, rok := constantTruth(c.Right)
+			switch {
+			case lok && l == or, rok && r == or:
+				return or, true
+			case lok && rok:
+				return !or, true
+			}
+			return false, false
+		}
+	case *parser.UnaryExpression:
+		if c.Operator == "!" {
+			t, ok := constantTruth(c.Operand)
+			return !t, ok
+		}
+	}
+	pure := true
+	parser.Inspect(cond, func(n parser.Node) bool {
+		switch n.(type) {
+		case *parser.Identifier, *parser.FunctionCall, *parser.ProgramNode:
+			pure = false
+		}
+		return pure
+	})
+	if !pure {
+		return false, false
+	}
+	prog, err := uexl.Default().CompileNode(&parser.FunctionCall{
+		Function:  &parser.Identifier{Name: "isTruthy"},
+		Arguments: []parser.Expression{cond},
+	})
+	if err != nil {
+		return false, false
+	}
+	v, err := prog.Eval(context.Background(), nil)
+	if err != nil {
+		return false, false
+	}
+	truthy, ok = v.(bool)
+	return truthy, ok
+}
+
+func checkNeedlessOptionalChain(p *Pass) {
+	parser.Inspect(p.Root, func(n parser.Node) bool {
+		var target parser.Expression
+		switch n := n.(type) {
+		case *parser.MemberAccess:
+			if n.Optional {
+				target = n.Target
+			}
+		case *parser.IndexAccess:
+			if n.Optional {
+				target = n.Target
+			}
+		case *parser.SliceExpression:
+			if n.Optional {
+				target = n.Target
+			}
+		}
+		id, ok := format.Unparen(target).(*parser.Identifier)
+		if !ok {
+			return true
+		}
+		typ, nullable, ok := p.VarType(id.Name)
+		if !ok || nullable {
+			return true
+		}
+		var fix *Fix
+		if e, ok := optionalEdit(p, n); ok {
+			fix = &Fix{Message: "use plain access", Edits: []Edit{e}}
+		}
+		p.Report(n, fmt.Sprintf("%s is declared %s and is never null; optional chaining is not needed", id.Name, typ), fix)
+		return true
+	})
+}
+
+// optionalEdit returns an edit turning the optional access node into a
+// plain one: `?.` becomes `.`, `?[` becomes `[` and `?.[` becomes `[`.
+func optionalEdit(p *Pass, node parser.Node) (Edit, bool) {
+	s := p.src
+	i, ok := s.Anchor(node)
+	if !ok {
+		return Edit{}, false
+	}
+	switch t := s.Tokens[i]; {
+	case t.Type == constants.TokenQuestionDot:
+		return edit(s, t.Span, "."), true
+	case t.Type == constants.TokenQuestionLeftBracket:
+		return edit(s, t.Span, "["), true
+	case t.Type == constants.TokenLeftBracket && i > 0 && s.Tokens[i-1].Type == constants.TokenQuestionDot:
+		return edit(s, s.Tokens[i-1].Span, ""), true
+	}
+	return Edit{}, false
+}
+
+// sameExpr reports whether a and b are the same expression, ignoring layout
+// and redundant parentheses.
+func sameExpr(a, b parser.Expression) bool {
+	return format.Node(format.Unparen(a), nil) == format.Node(format.Unparen(b), nil)
+}
+
+func isIdent(n parser.Node, name string) bool {
+	if e, ok := n.(parser.Expression); ok {
+		n = format.Unparen(e)
+	}
+	id, ok := n.(*parser.Identifier)
+	return ok && id.Name == name
+}
+
+func isNullLiteral(e parser.Expression) bool {
+	_, ok := format.Unparen(e).(*parser.NullLiteral)
+	return ok
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
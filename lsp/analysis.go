@@ -0,0 +1,417 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+	"github.com/maniartech/uexl/vm"
+)
+
+const diagnosticSource = "uexl"
+
+// functionInfo returns the documentation of a function registered in the
+// env or described by the symbols file.
+func (s *Server) functionInfo(name string) (Function, bool) {
+	if f, ok := s.symbols.Functions[name]; ok {
+		return f, true
+	}
+	if !s.env.HasFunction(name) {
+		return Function{}, false
+	}
+	return builtinFunctions[name], true
+}
+
+// pipeInfo returns the documentation of a pipe registered in the env or
+// described by the symbols file, with its scope variables filled in.
+func (s *Server) pipeInfo(name string) (Pipe, bool) {
+	p, ok := s.symbols.Pipes[name]
+	if !ok {
+		if !s.env.HasPipe(name) {
+			return Pipe{}, false
+		}
+		p = builtinPipes[name]
+		if schema, ok := vm.DefaultPipeArgSchemas[name]; ok && p.Params == nil {
+			p.Params = pipeArgLabels(schema)
+		}
+	}
+	if p.Vars == nil {
+		p.Vars = itemVars
+	}
+	return p, true
+}
+
+// scopeVars returns the $-variables visible at c: those of the innermost
+// predicate, the aliases of all enclosing ones and, in a nested predicate,
+// $parent.
+func (s *Server) scopeVars(c cursor) []string {
+	preds := c.predicates()
+	if len(preds) == 0 {
+		return nil
+	}
+	inner := preds[len(preds)-1]
+	var vars []string
+	if p, ok := s.pipeInfo(inner.name); ok {
+		vars = append(vars, p.Vars...)
+	} else {
+		vars = append(vars, itemVars...)
+	}
+	if len(preds) > 1 {
+		vars = append(vars, "$parent")
+	}
+	for _, p := range preds {
+		if p.alias != "" {
+			vars = append(vars, p.alias)
+		}
+	}
+	return vars
+}
+
+// diagnose parses and compiles the document, returning its errors, and
+// warns about pipes and variables that are neither registered nor declared.
+func (s *Server) diagnose(d *document) []Diagnostic {
+	diags := []Diagnostic{}
+	if strings.TrimSpace(d.text) == "" {
+		return diags
+	}
+	node, err := parser.ParseString(d.text)
+	if err != nil {
+		list, ok := parsererrors.AsList(err)
+		if !ok {
+			list = parsererrors.ErrorList{{Code: parsererrors.ErrUnknown, Message: err.Error(), Line: 1, Column: 1}}
+		}
+		for _, pe := range list {
+			diags = append(diags, Diagnostic{
+				Range:    d.span(pe.Line, pe.Column, max(len([]rune(pe.Token)), 1)),
+				Severity: SeverityError,
+				Code:     string(pe.Code),
+				Source:   diagnosticSource,
+				Message:  pe.Message,
+			})
+		}
+		return diags
+	}
+
+	toks := tokens(d.text)
+	if _, err := s.env.CompileNode(node); err != nil {
+		msg := strings.TrimPrefix(err.Error(), "compile error: ")
+		for _, r := range s.compileErrorRanges(d, node, toks, msg) {
+			diags = append(diags, Diagnostic{Range: r, Severity: SeverityError, Code: "compile-error", Source: diagnosticSource, Message: msg})
+		}
+	}
+	for _, tok := range toks {
+		if tok.Type != constants.TokenPipe || tok.Token == ":" {
+			continue
+		}
+		if _, ok := s.pipeInfo(tok.Token); !ok {
+			diags = append(diags, Diagnostic{
+				Range:    pipeNameRange(d, tok),
+				Severity: SeverityError,
+				Code:     "unknown-pipe",
+				Source:   diagnosticSource,
+				Message:  fmt.Sprintf("unknown pipe %q", tok.Token),
+			})
+		}
+	}
+	return append(diags, s.unknownVariables(d, node)...)
+}
+
+var (
+	unknownFunctionError = regexp.MustCompile(`^unknown function "([^"]+)"`)
+	pipeArgsError        = regexp.MustCompile(`^pipe (\w+) `)
+)
+
+// compileErrorRanges places a compile error, which has no position, on the
+// calls or pipes it names; other errors go on the first line.
+func (s *Server) compileErrorRanges(d *document, node parser.Node, toks []parser.Token, msg string) []Range {
+	var ranges []Range
+	if m := unknownFunctionError.FindStringSubmatch(msg); m != nil {
+		parser.Inspect(node, func(n parser.Node) bool {
+			if call, ok := n.(*parser.FunctionCall); ok {
+				if id, ok := call.Function.(*parser.Identifier); ok && id.Name == m[1] {
+					ranges = append(ranges, d.span(id.Line, id.Column, len([]rune(id.Name))))
+				}
+			}
+			return true
+		})
+	} else if m := pipeArgsError.FindStringSubmatch(msg); m != nil {
+		for _, tok := range toks {
+			if tok.Type == constants.TokenPipe && tok.Token == m[1] {
+				ranges = append(ranges, pipeNameRange(d, tok))
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		ranges = append(ranges, d.rangeOf(0, d.lineEnd(0)))
+	}
+	return ranges
+}
+
+// pipeNameRange returns the range of a pipe token from its '|' to the end of
+// its name.
+func pipeNameRange(d *document, tok parser.Token) Range {
+	start := d.at(tok.Line, tok.Column)
+	end := start
+	if i := strings.Index(d.text[start:], tok.Token); i >= 0 {
+		end = start + i + len(tok.Token)
+	}
+	return d.rangeOf(start, end)
+}
+
+// unknownVariables warns about context variables that the symbols file does
+// not declare. It only checks when the file declares some variables.
+func (s *Server) unknownVariables(d *document, node parser.Node) []Diagnostic {
+	if len(s.symbols.Variables) == 0 {
+		return nil
+	}
+	callees := map[*parser.Identifier]bool{}
+	var diags []Diagnostic
+	parser.Inspect(node, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.FunctionCall:
+			if id, ok := n.Function.(*parser.Identifier); ok {
+				callees[id] = true
+			}
+		case *parser.Identifier:
+			if callees[n] || strings.HasPrefix(n.Name, "$") || s.env.HasGlobal(n.Name) {
+				break
+			}
+			if _, ok := s.symbols.Variables[n.Name]; !ok {
+				diags = append(diags, Diagnostic{
+					Range:    d.span(n.Line, n.Column, len([]rune(n.Name))),
+					Severity: SeverityWarning,
+					Code:     "unknown-variable",
+					Source:   diagnosticSource,
+					Message:  fmt.Sprintf("unknown variable %q", n.Name),
+				})
+			}
+		}
+		return true
+	})
+	return diags
+}
+
+// complete returns the completions at byte offset off: pipe names after a
+// '|', the $-variables in scope for a '$' word, and functions, variables,
+// globals, keywords and $-variables elsewhere.
+func (s *Server) complete(d *document, off int) []CompletionItem {
+	prefix := d.text[:off]
+	if !inCode(prefix) {
+		return nil
+	}
+	start, _ := d.wordAt(off)
+	word := d.text[start:off]
+	before := strings.TrimRight(d.text[:start], " \t\r\n")
+
+	var items []CompletionItem
+	switch {
+	case strings.HasSuffix(before, "|") && !strings.HasSuffix(before, "||"):
+		for _, name := range s.pipeNames() {
+			p, _ := s.pipeInfo(name)
+			items = append(items, CompletionItem{Label: name, Kind: KindOperator, Detail: pipeSignature(name, p), Documentation: markdown(p.Doc)})
+		}
+		return items
+	case strings.HasSuffix(before, ".") && !strings.HasSuffix(before, ".."):
+		return nil // properties of values the server knows nothing about
+	}
+
+	for _, v := range s.scopeVars(scanCursor(d.text[:start])) {
+		items = append(items, CompletionItem{Label: v, Kind: KindVariable, Documentation: markdown(scopeVarDoc(v))})
+	}
+	if strings.HasPrefix(word, "$") {
+		return items
+	}
+	for _, name := range s.functionNames() {
+		f, _ := s.functionInfo(name)
+		items = append(items, CompletionItem{Label: name, Kind: KindFunction, Detail: functionSignature(name, f), Documentation: markdown(f.Doc)})
+	}
+	for _, name := range sortedNames(s.symbols.Variables) {
+		v := s.symbols.Variables[name]
+		items = append(items, CompletionItem{Label: name, Kind: KindVariable, Detail: v.Type, Documentation: markdown(v.Doc)})
+	}
+	for _, name := range s.env.Info().Globals {
+		items = append(items, CompletionItem{Label: name, Kind: KindConstant, Detail: "global"})
+	}
+	for _, kw := range []string{"true", "false", "null"} {
+		items = append(items, CompletionItem{Label: kw, Kind: KindKeyword})
+	}
+	return items
+}
+
+// hover describes the word at byte offset off.
+func (s *Server) hover(d *document, off int) *Hover {
+	start, end := d.wordAt(off)
+	if start == end || !inCode(d.text[:start]) {
+		return nil
+	}
+	word := d.text[start:end]
+	before := strings.TrimRight(d.text[:start], " \t\r\n")
+	after := strings.TrimLeft(d.text[end:], " \t\r\n")
+
+	var code, doc string
+	switch {
+	case strings.HasPrefix(word, "$"):
+		if !contains(s.scopeVars(scanCursor(d.text[:start])), word) {
+			return nil
+		}
+		code, doc = word, scopeVarDoc(word)
+	case strings.HasSuffix(before, "|") && !strings.HasSuffix(before, "||"):
+		p, ok := s.pipeInfo(word)
+		if !ok {
+			return nil
+		}
+		code, doc = pipeSignature(word, p), p.Doc
+		if len(p.Vars) > 0 {
+			doc = joinParagraphs(doc, "Scope: `"+strings.Join(p.Vars, "`, `")+"`")
+		}
+	case strings.HasSuffix(before, ".") && !strings.HasSuffix(before, ".."):
+		return nil
+	case strings.HasPrefix(after, "("):
+		f, ok := s.functionInfo(word)
+		if !ok {
+			return nil
+		}
+		code, doc = functionSignature(word, f), f.Doc
+	default:
+		if v, ok := s.symbols.Variables[word]; ok {
+			code, doc = word, v.Doc
+			if v.Type != "" {
+				code += ": " + v.Type
+			}
+		} else if s.env.HasGlobal(word) {
+			code, doc = word, "Global registered in the environment."
+		} else {
+			return nil
+		}
+	}
+	r := d.rangeOf(start, end)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: joinParagraphs("```uexl\n"+code+"\n```", doc)}, Range: &r}
+}
+
+// signatureHelp describes the function call or pipe header whose arguments
+// byte offset off is in.
+func (s *Server) signatureHelp(d *document, off int) *SignatureHelp {
+	if !inCode(d.text[:off]) {
+		return nil
+	}
+	c := scanCursor(d.text[:off])
+	call, ok := c.call()
+	if !ok {
+		return nil
+	}
+	var sig SignatureInformation
+	var params []string
+	if call.pipe {
+		p, ok := s.pipeInfo(call.callee)
+		if !ok {
+			return nil
+		}
+		params = p.Params
+		sig = SignatureInformation{Label: pipeSignature(call.callee, p), Documentation: markdown(p.Doc)}
+	} else {
+		f, ok := s.functionInfo(call.callee)
+		if !ok {
+			return nil
+		}
+		params = f.Params
+		sig = SignatureInformation{Label: functionSignature(call.callee, f), Documentation: markdown(f.Doc)}
+	}
+	sig.Parameters = make([]ParameterInformation, len(params))
+	for i, p := range params {
+		sig.Parameters[i] = ParameterInformation{Label: p}
+	}
+	active := call.commas
+	if len(params) > 0 {
+		active = min(active, len(params)-1)
+	}
+	return &SignatureHelp{Signatures: []SignatureInformation{sig}, ActiveParameter: active}
+}
+
+// formatEdits returns the edit that puts the document in canonical form, or
+// nil when it does not parse.
+func formatEdits(d *document) []TextEdit {
+	formatted, err := format.Source(d.text)
+	if err != nil {
+		return nil
+	}
+	if strings.HasSuffix(d.text, "\n") {
+		formatted += "\n"
+	}
+	if formatted == d.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{Range: d.rangeOf(0, len(d.text)), NewText: formatted}}
+}
+
+func (s *Server) functionNames() []string {
+	names := s.env.Info().Functions
+	for name := range s.symbols.Functions {
+		if !s.env.HasFunction(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) pipeNames() []string {
+	names := s.env.Info().PipeHandlers
+	for name := range s.symbols.Pipes {
+		if !s.env.HasPipe(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func functionSignature(name string, f Function) string {
+	sig := name + "(" + strings.Join(f.Params, ", ") + ")"
+	if f.Returns != "" {
+		sig += ": " + f.Returns
+	}
+	return sig
+}
+
+func pipeSignature(name string, p Pipe) string {
+	sig := "|" + name
+	if len(p.Params) > 0 {
+		sig += "(" + strings.Join(p.Params, ", ") + ")"
+	}
+	return sig + ":"
+}
+
+func scopeVarDoc(name string) string {
+	if doc, ok := scopeVarDocs[name]; ok {
+		return doc
+	}
+	return "Alias declared with `as " + name + "`."
+}
+
+func markdown(text string) *MarkupContent {
+	if text == "" {
+		return nil
+	}
+	return &MarkupContent{Kind: "markdown", Value: text}
+}
+
+func joinParagraphs(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + "\n\n" + b
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer(t *testing.T) *Server {
+	t.Helper()
+	symbols, err := DecodeSymbols([]byte(`
+variables:
+  orders: {type: array, doc: The customer's orders.}
+  tier: {type: string}
+functions:
+  discount:
+    params: ["price: number", "tier: string"]
+    returns: number
+    doc: Discount rate for a tier.
+pipes:
+  dedupe:
+    params: ["key?: string"]
+    vars: [$item]
+    doc: Drops repeated elements.
+`), ".yaml")
+	require.NoError(t, err)
+	return NewServer(uexl.Default(), symbols)
+}
+
+// at splits src at the ‸ marker into a document and the byte offset of the
+// marker.
+func at(src string) (*document, int) {
+	off := strings.Index(src, "‸")
+	return newDocument(strings.Replace(src, "‸", "", 1)), off
+}
+
+func labels(items []CompletionItem) []string {
+	out := make([]string, len(items))
+	for i, it := range items {
+		out[i] = it.Label
+	}
+	return out
+}
+
+func TestScopeVars(t *testing.T) {
+	s := testServer(t)
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"‸", nil},
+		{"orders |map: ‸", []string{"$item", "$index", "$key", "$value"}},
+		{"orders |reduce(0): $acc + ‸", []string{"$acc", "$item", "$index", "$key", "$value"}},
+		{"orders |window(3): ‸", []string{"$window", "$index"}},
+		{"orders |: ‸", []string{"$last"}},
+		{"orders |dedupe: ‸", []string{"$item"}},
+		{"orders |take(‸", nil},
+		{"orders |map as $o: ‸", []string{"$item", "$index", "$key", "$value", "$o"}},
+		{"orders as $o |filter: ‸", []string{"$item", "$index", "$key", "$value", "$o"}},
+		{"orders |map as $o: ($o.lines |sum: ‸", []string{"$item", "$index", "$key", "$value", "$parent", "$o"}},
+		{"orders |map: ($item.lines |sum: $item) + ‸", []string{"$item", "$index", "$key", "$value"}},
+		{"orders |map: $item |reduce: ‸", []string{"$acc", "$item", "$index", "$key", "$value"}},
+		{"f(orders |map: $item, ‸", nil},
+	}
+	for _, tt := range tests {
+		d, off := at(tt.src)
+		assert.Equal(t, tt.want, s.scopeVars(scanCursor(d.text[:off])), tt.src)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := testServer(t)
+
+	d, off := at("orders |‸")
+	got := labels(s.complete(d, off))
+	assert.Contains(t, got, "map")
+	assert.Contains(t, got, "dedupe")
+	assert.NotContains(t, got, "len")
+
+	d, off = at("orders |reduce: $‸")
+	assert.Equal(t, []string{"$acc", "$item", "$index", "$key", "$value"}, labels(s.complete(d, off)))
+
+	d, off = at("orders |filter: le‸")
+	got = labels(s.complete(d, off))
+	assert.Subset(t, got, []string{"$item", "len", "discount", "orders", "tier", "true"})
+
+	items := s.complete(at("disc‸"))
+	for _, it := range items {
+		if it.Label == "discount" {
+			assert.Equal(t, "discount(price: number, tier: string): number", it.Detail)
+			assert.Equal(t, "Discount rate for a tier.", it.Documentation.Value)
+		}
+	}
+
+	for _, src := range []string{`"ab‸`, "a // le‸", "a /* le‸", "orders.‸", "a || ‸"} {
+		d, off := at(src)
+		got := labels(s.complete(d, off))
+		if src == "a || ‸" {
+			assert.Contains(t, got, "len", src)
+			assert.NotContains(t, got, "map", src)
+		} else {
+			assert.Empty(t, got, src)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	s := testServer(t)
+	tests := []struct {
+		src, want string
+	}{
+		{"disc‸ount(1, tier)", "```uexl\ndiscount(price: number, tier: string): number\n```\n\nDiscount rate for a tier."},
+		{"len(‸orders)", "```uexl\norders: array\n```\n\nThe customer's orders."},
+		{"le‸n(orders)", "```uexl\nlen(value): number\n```\n\nLength of a string in bytes, or the number of elements of an array or range."},
+		{"orders |wi‸ndow(3): $window", "```uexl\n|window(size?: number):\n```\n\nEvaluates the predicate for every sliding window of size elements (default 2).\n\nScope: `$window`, `$index`"},
+		{"orders |reduce: $a‸cc", "```uexl\n$acc\n```\n\nThe accumulated value of |reduce:."},
+		{"orders as $o |map: $‸o", "```uexl\n$o\n```\n\nAlias declared with `as $o`."},
+	}
+	for _, tt := range tests {
+		d, off := at(tt.src)
+		h := s.hover(d, off)
+		if assert.NotNil(t, h, tt.src) {
+			assert.Equal(t, tt.want, h.Contents.Value, tt.src)
+		}
+	}
+
+	d, off := at("disc‸ount(1, tier)")
+	assert.Equal(t, Range{Start: Position{0, 0}, End: Position{0, 8}}, *s.hover(d, off).Range)
+
+	for _, src := range []string{"orders.ti‸er", "$ac‸c", `"or‸ders"`, "unkn‸own", "1 +‸ 2"} {
+		d, off := at(src)
+		assert.Nil(t, s.hover(d, off), src)
+	}
+}
+
+func TestSignatureHelp(t *testing.T) {
+	s := testServer(t)
+
+	d, off := at("discount(orders |sum: $item, ‸")
+	h := s.signatureHelp(d, off)
+	require.NotNil(t, h)
+	assert.Equal(t, "discount(price: number, tier: string): number", h.Signatures[0].Label)
+	assert.Len(t, h.Signatures[0].Parameters, 2)
+	assert.Equal(t, 1, h.ActiveParameter)
+
+	d, off = at("orders |take(‸")
+	h = s.signatureHelp(d, off)
+	require.NotNil(t, h)
+	assert.Equal(t, "|take(count: number):", h.Signatures[0].Label)
+	assert.Equal(t, 0, h.ActiveParameter)
+
+	d, off = at("len([1, ‸")
+	assert.Nil(t, s.signatureHelp(d, off))
+	d, off = at("nope(‸")
+	assert.Nil(t, s.signatureHelp(d, off))
+}
+
+func TestDiagnose(t *testing.T) {
+	s := testServer(t)
+	tests := []struct {
+		src  string
+		want []Diagnostic
+	}{
+		{"discount(1, tier)", []Diagnostic{}},
+		{"  ", []Diagnostic{}},
+		{"1 +\n  * 2", []Diagnostic{{
+			Range: Range{Start: Position{1, 2}, End: Position{1, 3}}, Severity: SeverityError,
+			Code: "unexpected-token", Source: "uexl", Message: "unexpected token",
+		}}},
+		{"tier + nope(1) + nope(2)", []Diagnostic{
+			{Range: Range{Start: Position{0, 7}, End: Position{0, 11}}, Severity: SeverityError, Code: "compile-error", Source: "uexl", Message: `unknown function "nope" — not registered in this environment`},
+			{Range: Range{Start: Position{0, 17}, End: Position{0, 21}}, Severity: SeverityError, Code: "compile-error", Source: "uexl", Message: `unknown function "nope" — not registered in this environment`},
+		}},
+		{`orders |take("a"): $item`, []Diagnostic{
+			{Range: Range{Start: Position{0, 7}, End: Position{0, 12}}, Severity: SeverityError, Code: "compile-error", Source: "uexl", Message: `pipe take argument "count" must be number, got string`},
+		}},
+		{"orders\n  |nope: $item", []Diagnostic{
+			{Range: Range{Start: Position{1, 2}, End: Position{1, 7}}, Severity: SeverityError, Code: "unknown-pipe", Source: "uexl", Message: `unknown pipe "nope"`},
+		}},
+		{"ordrs |map: $item.x + tier", []Diagnostic{
+			{Range: Range{Start: Position{0, 0}, End: Position{0, 5}}, Severity: SeverityWarning, Code: "unknown-variable", Source: "uexl", Message: `unknown variable "ordrs"`},
+		}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, s.diagnose(newDocument(tt.src)), tt.src)
+	}
+}
+
+func TestFormatEdits(t *testing.T) {
+	d := newDocument("a+b\n")
+	assert.Equal(t, []TextEdit{{Range: Range{End: Position{1, 0}}, NewText: "a + b\n"}}, formatEdits(d))
+	assert.Equal(t, []TextEdit{}, formatEdits(newDocument("a + b")))
+	assert.Nil(t, formatEdits(newDocument("a +")))
+}
+
+func TestDocument_Positions(t *testing.T) {
+	d := newDocument("é😀x\r\nab")
+	assert.Equal(t, Position{0, 3}, d.position(len("é😀")))
+	assert.Equal(t, len("é😀"), d.offset(Position{0, 3}))
+	assert.Equal(t, len("é😀x"), d.offset(Position{0, 99}))
+	assert.Equal(t, len("é😀x\r\n")+1, d.offset(Position{1, 1}))
+	assert.Equal(t, len("é😀"), d.at(1, 3))
+	assert.Equal(t, Range{Start: Position{0, 1}, End: Position{0, 3}}, d.span(1, 2, 1))
+}
@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"github.com/maniartech/uexl/parser/constants"
+	"github.com/maniartech/uexl/vm"
+)
+
+// builtinFunctions documents vm.Builtins.
+var builtinFunctions = map[string]Function{
+	"len":            {Params: []string{"value"}, Returns: "number", Doc: "Length of a string in bytes, or the number of elements of an array or range."},
+	"substr":         {Params: []string{"s: string", "start: number", "length: number"}, Returns: "string", Doc: "Substring of s by byte offsets."},
+	"contains":       {Params: []string{"s", "part"}, Returns: "boolean", Doc: "Whether s contains part."},
+	"set":            {Params: []string{"obj: object", "key", "value"}, Returns: "object", Doc: "obj with key set to value."},
+	"str":            {Params: []string{"value"}, Returns: "string", Doc: "The string representation of value."},
+	"runeLen":        {Params: []string{"s: string"}, Returns: "number", Doc: "Number of Unicode code points in s."},
+	"runeSubstr":     {Params: []string{"s: string", "start: number", "length: number"}, Returns: "string", Doc: "Substring of s by code point indices."},
+	"graphemeLen":    {Params: []string{"s: string"}, Returns: "number", Doc: "Number of user-perceived characters (grapheme clusters) in s."},
+	"graphemeSubstr": {Params: []string{"s: string", "start: number", "length: number"}, Returns: "string", Doc: "Substring of s by grapheme cluster indices."},
+	"runes":          {Params: []string{"s: string"}, Returns: "array", Doc: "The code points of s, as single-character strings."},
+	"graphemes":      {Params: []string{"s: string"}, Returns: "array", Doc: "The grapheme clusters of s, as strings."},
+	"bytes":          {Params: []string{"s: string"}, Returns: "array", Doc: "The bytes of s, as numbers."},
+	"join":           {Params: []string{"arr: array", "sep?: string"}, Returns: "string", Doc: "The strings of arr concatenated, separated by sep."},
+	"typeof":         {Params: []string{"value"}, Returns: "string", Doc: `The type of value: "number", "string", "boolean", "null", "array" or "object".`},
+	"isNullish":      {Params: []string{"value"}, Returns: "boolean", Doc: "Whether value is null."},
+	"isTruthy":       {Params: []string{"value"}, Returns: "boolean", Doc: "The truthiness used by &&, || and conditions."},
+	"isFalsy":        {Params: []string{"value"}, Returns: "boolean", Doc: "The negation of isTruthy(value)."},
+	"stop":           {Params: []string{"value?"}, Doc: "Ends the enclosing map, filter, flatMap or reduce; with value, that is the current element's result."},
+	"skip":           {Doc: "Drops the current element of the enclosing map, filter, flatMap or reduce."},
+}
+
+// builtinPipes documents vm.DefaultPipeHandlers. Params are filled in from
+// vm.DefaultPipeArgSchemas by pipeInfo.
+var builtinPipes = map[string]Pipe{
+	constants.DefaultPipeType: {Vars: []string{"$last"}, Doc: "Evaluates the predicate once with the previous stage's result as $last."},
+
+	"map":     {Doc: "Transforms every element. An object input maps each value and keeps the keys."},
+	"filter":  {Doc: "Keeps the elements for which the predicate is true."},
+	"reduce":  {Vars: []string{"$acc", "$item", "$index", "$key", "$value"}, Doc: "Folds the input into $acc, which starts as the initial argument or null."},
+	"find":    {Doc: "The first element for which the predicate is true, or null."},
+	"some":    {Doc: "Whether the predicate is true for any element."},
+	"every":   {Doc: "Whether the predicate is true for all elements."},
+	"unique":  {Doc: "Drops repeated elements, keeping the first of each."},
+	"sort":    {Doc: `Orders the input by the key the predicate returns. Options: "asc", "desc", "nullsFirst", "nullsLast", "ci".`},
+	"groupBy": {Doc: "An object mapping each key to the elements that produce it."},
+	"window":  {Vars: []string{"$window", "$index"}, Doc: "Evaluates the predicate for every sliding window of size elements (default 2)."},
+	"chunk":   {Vars: []string{"$chunk", "$index"}, Doc: "Evaluates the predicate for consecutive chunks of size elements (default 2)."},
+	"flatMap": {Doc: "Maps each element and flattens the resulting arrays."},
+	"sum":     {Doc: "Sum of the predicate results."},
+	"avg":     {Doc: "Average of the predicate results."},
+	"min":     {Doc: "Smallest predicate result."},
+	"max":     {Doc: "Largest predicate result."},
+	"count":   {Doc: "Number of elements whose predicate result is neither null nor false."},
+	"minBy":   {Doc: "The element with the smallest predicate result."},
+	"maxBy":   {Doc: "The element with the largest predicate result."},
+
+	"entries":     {Doc: "A [key, projection] pair for every entry of an object; without a predicate, its [key, value] entries."},
+	"fromEntries": {Doc: "An object built from the [key, value] entries the predicate returns."},
+	"keys":        {Doc: "The projection of every entry of an object; without a predicate or with $key, its sorted keys."},
+	"values":      {Doc: "The projection of every entry of an object; without a predicate or with $value, its values."},
+
+	"zip":        {Doc: "Combines an array of arrays element-wise into tuples; $item is the tuple."},
+	"partition":  {Doc: "Splits the input into [matched, rest], preserving order."},
+	"distinctBy": {Doc: "Keeps the first element for each distinct key."},
+	"indexBy":    {Doc: "An object mapping each element's key to the element; the last one wins."},
+	"countBy":    {Doc: "An object mapping each key to the number of elements that produce it."},
+	"take":       {Doc: "The first count elements, projected by the predicate if there is one."},
+	"skip":       {Doc: "All but the first count elements, projected by the predicate if there is one."},
+	"takeWhile":  {Doc: "The leading elements for which the predicate is true."},
+	"skipWhile":  {Doc: "The elements after the leading ones for which the predicate is true."},
+	"pmap":       {Doc: "|map: evaluated across goroutines."},
+	"pfilter":    {Doc: "|filter: evaluated across goroutines."},
+}
+
+// itemVars are the scope variables of pipes that evaluate their predicate
+// once per element or object entry.
+var itemVars = []string{"$item", "$index", "$key", "$value"}
+
+// scopeVarDocs documents the pipe scope variables.
+var scopeVarDocs = map[string]string{
+	"$item":   "The current element; for an object input, the value of the current entry.",
+	"$index":  "The zero-based position of the current element.",
+	"$key":    "The key of the current entry of an object input.",
+	"$value":  "The value of the current entry of an object input.",
+	"$acc":    "The accumulated value of |reduce:.",
+	"$window": "The current window of |window:.",
+	"$chunk":  "The current chunk of |chunk:.",
+	"$last":   "The result of the previous stage.",
+	"$parent": "The $item of the enclosing pipe.",
+}
+
+// pipeArgLabels returns the parameter labels of a pipe argument schema.
+func pipeArgLabels(schema vm.PipeArgSchema) []string {
+	labels := make([]string, len(schema))
+	for i, spec := range schema {
+		label := spec.Name
+		if spec.Optional {
+			label += "?"
+		}
+		if spec.Type != "" {
+			label += ": " + spec.Type
+		}
+		labels[i] = label
+	}
+	return labels
+}
@@ -0,0 +1,16 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+// The documentation of the built-ins must cover exactly what the VM provides,
+// so that a function or pipe added to or removed from the VM is also added to
+// or removed from hover and completion.
+func TestBuiltins_matchVM(t *testing.T) {
+	assert.Equal(t, sortedNames(vm.Builtins), sortedNames(builtinFunctions), "builtinFunctions must document vm.Builtins")
+	assert.Equal(t, sortedNames(vm.DefaultPipeHandlers), sortedNames(builtinPipes), "builtinPipes must document vm.DefaultPipeHandlers")
+}
@@ -0,0 +1,167 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// document is the text of an open file, indexed by line to convert between
+// byte offsets, the parser's positions and protocol positions.
+type document struct {
+	text  string
+	lines []int // byte offset of the start of each line
+}
+
+func newDocument(text string) *document {
+	d := &document{text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+	return d
+}
+
+// lineEnd returns the byte offset of the end of line i, before its newline.
+func (d *document) lineEnd(i int) int {
+	if i+1 < len(d.lines) {
+		end := d.lines[i+1] - 1
+		if end > d.lines[i] && d.text[end-1] == '\r' {
+			end--
+		}
+		return end
+	}
+	return len(d.text)
+}
+
+// offset returns the byte offset of p, clamped to its line.
+func (d *document) offset(p Position) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	off, end := d.lines[p.Line], d.lineEnd(p.Line)
+	for units := 0; off < end && units < p.Character; {
+		r, size := utf8.DecodeRuneInString(d.text[off:])
+		units += utf16Len(r)
+		off += size
+	}
+	return off
+}
+
+// position returns the protocol position of byte offset off.
+func (d *document) position(off int) Position {
+	off = min(max(off, 0), len(d.text))
+	line := 0
+	for line+1 < len(d.lines) && d.lines[line+1] <= off {
+		line++
+	}
+	units := 0
+	for _, r := range d.text[d.lines[line]:off] {
+		units += utf16Len(r)
+	}
+	return Position{Line: line, Character: units}
+}
+
+// at returns the byte offset of a parser position: a 1-based line and a
+// 1-based column counted in runes. Positions past the end of a line are
+// clamped to it.
+func (d *document) at(line, column int) int {
+	if line < 1 {
+		return 0
+	}
+	if line > len(d.lines) {
+		return len(d.text)
+	}
+	off, end := d.lines[line-1], d.lineEnd(line-1)
+	for n := 1; off < end && n < column; n++ {
+		_, size := utf8.DecodeRuneInString(d.text[off:])
+		off += size
+	}
+	return off
+}
+
+// span returns the range of the n runes that start at parser position line,
+// column.
+func (d *document) span(line, column, n int) Range {
+	start := d.at(line, column)
+	end := start
+	for ; n > 0 && end < len(d.text) && d.text[end] != '\n'; n-- {
+		_, size := utf8.DecodeRuneInString(d.text[end:])
+		end += size
+	}
+	return d.rangeOf(start, end)
+}
+
+func (d *document) rangeOf(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// wordAt returns the bounds of the identifier, $-variable or pipe name
+// around byte offset off; start == end when there is none.
+func (d *document) wordAt(off int) (start, end int) {
+	start, end = off, off
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(d.text[:start])
+		if !isWordRune(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(d.text) {
+		r, size := utf8.DecodeRuneInString(d.text[end:])
+		if !isWordRune(r) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
+
+// utf16Len returns the number of UTF-16 code units that encode r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// inCode reports whether the end of prefix is outside strings and comments.
+func inCode(prefix string) bool {
+	for i := 0; i < len(prefix); i++ {
+		switch c := prefix[i]; {
+		case c == '"' || c == '\'':
+			raw := i > 0 && prefix[i-1] == 'r' && (i == 1 || !isWordRune(rune(prefix[i-2])))
+			j := i + 1
+			for ; j < len(prefix) && prefix[j] != c; j++ {
+				if prefix[j] == '\\' && !raw {
+					j++
+				}
+			}
+			if j >= len(prefix) {
+				return false
+			}
+			i = j // a doubled quote in a raw string reopens it
+		case c == '#' || c == '/' && strings.HasPrefix(prefix[i+1:], "/"):
+			nl := strings.IndexByte(prefix[i:], '\n')
+			if nl < 0 {
+				return false
+			}
+			i += nl
+		case c == '/' && strings.HasPrefix(prefix[i+1:], "*"):
+			end := strings.Index(prefix[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += 2 + end + 1
+		}
+	}
+	return true
+}
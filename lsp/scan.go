@@ -0,0 +1,144 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// tokens returns the tokens of text up to the end or the first tokenizer
+// error, whichever comes first.
+func tokens(text string) []parser.Token {
+	tz := parser.NewTokenizer(text)
+	var out []parser.Token
+	for {
+		tok, err := tz.NextToken()
+		if err != nil || tok.Type == constants.TokenEOF {
+			return out
+		}
+		out = append(out, tok)
+	}
+}
+
+// cursor is what the tokens before a position say about it: the brackets
+// and pipe stages it is inside. The text does not need to parse, so it
+// works on the incomplete expression being typed.
+type cursor struct {
+	brackets []bracket   // open brackets, innermost last
+	stages   []pipeStage // enclosing pipe stages, innermost last
+}
+
+// bracket is an open '(', '[' or '{'. For the '(' of a function call or a
+// pipe header, callee names the function or pipe.
+type bracket struct {
+	callee string
+	pipe   bool
+	commas int
+}
+
+// pipeStage is a pipe stage the cursor is in. While header is set the
+// cursor is in the stage's |name(args) as $x: header, which belongs to the
+// enclosing scope, rather than in its predicate.
+type pipeStage struct {
+	depth  int // len(brackets) where the pipe token is
+	name   string
+	alias  string
+	header bool
+}
+
+// scanCursor scans prefix, the text before the cursor.
+func scanCursor(prefix string) cursor {
+	var c cursor
+	var prev parser.Token
+	pending := map[int]string{} // trailing "as $x" aliases, by depth, for the next stage
+	for _, tok := range tokens(prefix) {
+		depth := len(c.brackets)
+		switch tok.Type {
+		case constants.TokenLeftParen, constants.TokenLeftBracket, constants.TokenLeftBrace, constants.TokenQuestionLeftBracket:
+			b := bracket{}
+			if tok.Type == constants.TokenLeftParen {
+				switch prev.Type {
+				case constants.TokenIdentifier:
+					b.callee = prev.Token
+				case constants.TokenPipe:
+					b.callee, b.pipe = prev.Token, true
+				}
+			}
+			c.brackets = append(c.brackets, b)
+		case constants.TokenRightParen, constants.TokenRightBracket, constants.TokenRightBrace:
+			if depth > 0 {
+				c.brackets = c.brackets[:depth-1]
+				c.endStages(depth)
+				delete(pending, depth)
+			}
+		case constants.TokenComma:
+			if depth > 0 {
+				c.brackets[depth-1].commas++
+			}
+			c.endStages(depth)
+			delete(pending, depth)
+		case constants.TokenPipe:
+			c.endStages(depth)
+			stage := pipeStage{depth: depth, name: tok.Token, alias: pending[depth], header: true}
+			if tok.Token == ":" {
+				stage.name, stage.header = constants.DefaultPipeType, false
+			}
+			c.stages = append(c.stages, stage)
+			delete(pending, depth)
+		case constants.TokenColon:
+			if s := c.stage(depth); s != nil && s.header {
+				s.header = false
+			}
+		case constants.TokenIdentifier:
+			if prev.Type == constants.TokenAs && strings.HasPrefix(tok.Token, "$") {
+				if s := c.stage(depth); s != nil && s.header {
+					s.alias = tok.Token
+				} else {
+					pending[depth] = tok.Token
+				}
+			}
+		}
+		prev = tok
+	}
+	return c
+}
+
+// endStages drops the stages at depth or deeper, which a ',', a closing
+// bracket or the next stage of their chain has ended.
+func (c *cursor) endStages(depth int) {
+	n := len(c.stages)
+	for n > 0 && c.stages[n-1].depth >= depth {
+		n--
+	}
+	c.stages = c.stages[:n]
+}
+
+// stage returns the innermost stage if it is at depth.
+func (c *cursor) stage(depth int) *pipeStage {
+	if n := len(c.stages); n > 0 && c.stages[n-1].depth == depth {
+		return &c.stages[n-1]
+	}
+	return nil
+}
+
+// predicates returns the stages whose predicate the cursor is in,
+// innermost last.
+func (c *cursor) predicates() []pipeStage {
+	var out []pipeStage
+	for _, s := range c.stages {
+		if !s.header {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// call returns the innermost open bracket if it is a function call or pipe
+// header.
+func (c *cursor) call() (bracket, bool) {
+	if n := len(c.brackets); n > 0 && c.brackets[n-1].callee != "" {
+		return c.brackets[n-1], true
+	}
+	return bracket{}, false
+}
@@ -0,0 +1,212 @@
+// Package lsp implements a Language Server Protocol server for UExL
+// expressions, so that editors such as VS Code can check and complete
+// expressions as they are typed.
+//
+// Each open document holds one expression. The server offers:
+//
+//   - diagnostics for parse errors, compile errors (unknown functions,
+//     invalid pipe arguments), unknown pipes and, when the symbols file
+//     declares variables, undeclared ones
+//   - hover for functions, pipes, context variables and pipe scope variables
+//   - completion of functions, context variables, pipe names after '|', and
+//     the $-variables valid at the cursor, such as $acc inside |reduce:
+//   - signature help for function calls and pipe arguments
+//   - formatting with package format
+//
+// Expressions are checked against a *uexl.Env; a Symbols file describes what
+// the host application adds to it (see Symbols). The server speaks JSON-RPC
+// over a reader and writer pair; cmd/uexl-lsp runs it on stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/maniartech/uexl"
+)
+
+// Server is a language server for one client connection.
+type Server struct {
+	env      *uexl.Env
+	symbols  *Symbols
+	docs     map[string]*document
+	out      io.Writer
+	shutdown bool
+}
+
+// NewServer returns a server that checks expressions against env extended
+// with the functions of symbols (see Symbols.Env). symbols may be nil.
+func NewServer(env *uexl.Env, symbols *Symbols) *Server {
+	if symbols == nil {
+		symbols = &Symbols{}
+	}
+	return &Server{env: symbols.Env(env), symbols: symbols, docs: map[string]*document{}}
+}
+
+// Serve reads requests from in and writes responses and notifications to
+// out until the client sends exit. It returns an error if in ends first, if
+// exit comes without a shutdown request, or if reading or writing fails.
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		body, err := readMessage(r)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.reply(json.RawMessage("null"), nil, &rpcError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				return err // only writing a notification fails here
+			}
+			continue
+		}
+		var rerr *rpcError
+		if err != nil && !errors.As(err, &rerr) {
+			return err
+		}
+		if err := s.reply(msg.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// handle runs one request or notification. Errors of type *rpcError are
+// reported to the client; any other error ends Serve.
+func (s *Server) handle(msg message) (any, error) {
+	if s.shutdown && msg.ID != nil {
+		return nil, &rpcError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		return initializeResult, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := decodeParams(msg, &p); err != nil {
+			return nil, nil // a notification cannot report it
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := decodeParams(msg, &p); err != nil || len(p.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := decodeParams(msg, &p); err != nil {
+			return nil, nil
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.publish(p.TextDocument.URI, []Diagnostic{})
+
+	case "textDocument/hover":
+		return withPosition(s, msg, s.hover)
+	case "textDocument/completion":
+		return withPosition(s, msg, func(d *document, off int) *CompletionList {
+			return &CompletionList{Items: append([]CompletionItem{}, s.complete(d, off)...)}
+		})
+	case "textDocument/signatureHelp":
+		return withPosition(s, msg, s.signatureHelp)
+	case "textDocument/formatting":
+		var p DocumentFormattingParams
+		if err := decodeParams(msg, &p); err != nil {
+			return nil, err
+		}
+		if d, ok := s.docs[p.TextDocument.URI]; ok {
+			return formatEdits(d), nil
+		}
+		return nil, nil
+	}
+	if msg.ID != nil {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+	return nil, nil // other notifications, such as initialized, need nothing
+}
+
+// withPosition decodes the document and position of a request and passes
+// the document and the byte offset of the position to f.
+func withPosition[T any](s *Server, msg message, f func(d *document, off int) *T) (any, error) {
+	var p TextDocumentPositionParams
+	if err := decodeParams(msg, &p); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[p.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	if res := f(d, d.offset(p.Position)); res != nil {
+		return res, nil
+	}
+	return nil, nil
+}
+
+// update stores the new text of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	d := newDocument(text)
+	s.docs[uri] = d
+	return s.publish(uri, s.diagnose(d))
+}
+
+func (s *Server) publish(uri string, diags []Diagnostic) error {
+	return writeMessage(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+func (s *Server) reply(id json.RawMessage, result any, rerr *rpcError) error {
+	resp := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return writeMessage(s.out, resp)
+}
+
+func decodeParams(msg message, v any) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// initializeResult announces the server's capabilities: full document sync,
+// hover, completion, signature help and formatting.
+var initializeResult = map[string]any{
+	"capabilities": map[string]any{
+		"textDocumentSync":           1,
+		"hoverProvider":              true,
+		"completionProvider":         map[string]any{"triggerCharacters": []string{"|", "$"}},
+		"signatureHelpProvider":      map[string]any{"triggerCharacters": []string{"(", ","}},
+		"documentFormattingProvider": true,
+	},
+	"serverInfo": map[string]any{"name": "uexl-lsp"},
+}
@@ -0,0 +1,205 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/lsp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frame encodes messages as a client would send them.
+func frame(t *testing.T, msgs ...map[string]any) io.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		m["jsonrpc"] = "2.0"
+		body, err := json.Marshal(m)
+		require.NoError(t, err)
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return &buf
+}
+
+// unframe decodes the messages the server wrote.
+func unframe(t *testing.T, out []byte) []map[string]json.RawMessage {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(out))
+	var msgs []map[string]json.RawMessage
+	for {
+		header, err := textproto.NewReader(r).ReadMIMEHeader()
+		if err == io.EOF {
+			return msgs
+		}
+		require.NoError(t, err)
+		n, err := strconv.Atoi(header.Get("Content-Length"))
+		require.NoError(t, err)
+		body := make([]byte, n)
+		_, err = io.ReadFull(r, body)
+		require.NoError(t, err)
+		var m map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(body, &m))
+		msgs = append(msgs, m)
+	}
+}
+
+func request(id int, method string, params any) map[string]any {
+	return map[string]any{"id": id, "method": method, "params": params}
+}
+
+func notify(method string, params any) map[string]any {
+	return map[string]any{"method": method, "params": params}
+}
+
+func position(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func TestServe(t *testing.T) {
+	const uri = "file:///rules/total.uexl"
+	symbols, err := lsp.DecodeSymbols([]byte(`{"functions": {"discount": {"params": ["price", "tier"], "doc": "Discount rate."}}}`), ".json")
+	require.NoError(t, err)
+
+	in := frame(t,
+		request(1, "initialize", map[string]any{"capabilities": map[string]any{}}),
+		notify("initialized", map[string]any{}),
+		notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{
+			"uri": uri, "languageId": "uexl", "version": 1, "text": "items |map: $item.price * discount(1, tier",
+		}}),
+		notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{"text": "items|reduce(0):$acc+discount($item.price,tier)"}},
+		}),
+		request(2, "textDocument/hover", position(uri, 0, 23)),
+		request(3, "textDocument/completion", position(uri, 0, 21)),
+		request(4, "textDocument/signatureHelp", position(uri, 0, 42)),
+		request(5, "textDocument/formatting", map[string]any{"textDocument": map[string]any{"uri": uri}, "options": map[string]any{}}),
+		request(6, "workspace/symbol", map[string]any{}),
+		request(7, "textDocument/hover", position("file:///unknown.uexl", 0, 0)),
+		notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+		request(8, "shutdown", nil),
+		notify("exit", nil),
+	)
+	var out bytes.Buffer
+	require.NoError(t, lsp.NewServer(uexl.Default(), symbols).Serve(in, &out))
+
+	msgs := unframe(t, out.Bytes())
+	require.Len(t, msgs, 11)
+
+	var init struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	require.NoError(t, json.Unmarshal(msgs[0]["result"], &init))
+	assert.Equal(t, true, init.Capabilities["hoverProvider"])
+
+	var diags lsp.PublishDiagnosticsParams
+	require.NoError(t, json.Unmarshal(msgs[1]["params"], &diags))
+	assert.Equal(t, uri, diags.URI)
+	require.Len(t, diags.Diagnostics, 1)
+	assert.Equal(t, lsp.Position{Line: 0, Character: 42}, diags.Diagnostics[0].Range.Start)
+
+	require.NoError(t, json.Unmarshal(msgs[2]["params"], &diags))
+	assert.Empty(t, diags.Diagnostics)
+	assert.Equal(t, "[]", string(mustField(t, msgs[2]["params"], "diagnostics")))
+
+	var hover lsp.Hover
+	require.NoError(t, json.Unmarshal(msgs[3]["result"], &hover))
+	assert.Equal(t, "```uexl\ndiscount(price, tier)\n```\n\nDiscount rate.", hover.Contents.Value)
+
+	var list lsp.CompletionList
+	require.NoError(t, json.Unmarshal(msgs[4]["result"], &list))
+	var names []string
+	for _, it := range list.Items {
+		names = append(names, it.Label)
+	}
+	assert.Subset(t, names, []string{"$acc", "$item", "discount", "len"})
+
+	var sig lsp.SignatureHelp
+	require.NoError(t, json.Unmarshal(msgs[5]["result"], &sig))
+	assert.Equal(t, "discount(price, tier)", sig.Signatures[0].Label)
+	assert.Equal(t, 1, sig.ActiveParameter)
+
+	var edits []lsp.TextEdit
+	require.NoError(t, json.Unmarshal(msgs[6]["result"], &edits))
+	require.Len(t, edits, 1)
+	assert.Equal(t, "items |reduce(0): $acc + discount($item.price, tier)", edits[0].NewText)
+
+	assert.Contains(t, string(msgs[7]["error"]), `"code":-32601`)
+	assert.Equal(t, "null", string(msgs[8]["result"]))
+
+	require.NoError(t, json.Unmarshal(msgs[9]["params"], &diags))
+	assert.Empty(t, diags.Diagnostics)
+	assert.Equal(t, "8", string(msgs[10]["id"]))
+	assert.Equal(t, "null", string(msgs[10]["result"]))
+}
+
+func mustField(t *testing.T, obj json.RawMessage, key string) json.RawMessage {
+	t.Helper()
+	var m map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(obj, &m))
+	return m[key]
+}
+
+func TestServe_Errors(t *testing.T) {
+	var out bytes.Buffer
+	err := lsp.NewServer(uexl.Default(), nil).Serve(frame(t, notify("exit", nil)), &out)
+	assert.EqualError(t, err, "exit without shutdown")
+
+	err = lsp.NewServer(uexl.Default(), nil).Serve(frame(t, request(1, "shutdown", nil)), &out)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	err = lsp.NewServer(uexl.Default(), nil).Serve(strings.NewReader("Content-Type: x\r\n\r\n"), &out)
+	assert.EqualError(t, err, "missing Content-Length header")
+
+	out.Reset()
+	in := io.MultiReader(strings.NewReader("Content-Length: 5\r\n\r\n{oops"),
+		frame(t, request(1, "textDocument/hover", "bad"), request(2, "shutdown", nil), request(3, "initialize", nil), notify("exit", nil)))
+	require.NoError(t, lsp.NewServer(uexl.Default(), nil).Serve(in, &out))
+	msgs := unframe(t, out.Bytes())
+	require.Len(t, msgs, 4)
+	assert.Contains(t, string(msgs[0]["error"]), `"code":-32700`)
+	assert.Contains(t, string(msgs[1]["error"]), `"code":-32602`)
+	assert.Contains(t, string(msgs[3]["error"]), `"code":-32600`)
+}
+
+func TestLoadSymbols(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "symbols.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("variables:\n  price: {type: number, doc: Unit price.}\n"), 0o644))
+	s, err := lsp.LoadSymbols(path)
+	require.NoError(t, err)
+	assert.Equal(t, lsp.Variable{Type: "number", Doc: "Unit price."}, s.Variables["price"])
+
+	require.NoError(t, os.WriteFile(path, []byte("functions:\n  f: {parms: [a]}\n"), 0o644))
+	_, err = lsp.LoadSymbols(path)
+	assert.ErrorContains(t, err, `unknown field "parms"`)
+
+	_, err = lsp.LoadSymbols(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestSymbols_Env(t *testing.T) {
+	s := &lsp.Symbols{Functions: map[string]lsp.Function{"discount": {}, "len": {Doc: "Overridden doc."}}}
+	env := s.Env(uexl.Default())
+	assert.True(t, env.HasFunction("discount"))
+	v, err := env.Eval(context.Background(), `len("abc")`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, v) // the builtin is kept, not stubbed
+	_, err = env.Eval(context.Background(), "discount()", nil)
+	assert.ErrorContains(t, err, "stub function cannot be called")
+}
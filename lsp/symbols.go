@@ -0,0 +1,126 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/internal/varsfile"
+)
+
+// Symbols describes what the host application makes available to
+// expressions: context variables, host functions and custom pipes. It is read
+// from a JSON or YAML file, so editors get hover, completion and signature
+// help for a host without loading its code:
+//
+//	variables:
+//	  order:
+//	    type: object
+//	    doc: The order being priced.
+//	functions:
+//	  discount:
+//	    params: [price, tier]
+//	    returns: number
+//	    doc: Returns the discount rate for a customer tier.
+//	pipes:
+//	  dedupe:
+//	    params: ["key?: string"]
+//	    vars: [$item, $index]
+//	    doc: Drops repeated elements.
+//
+// Functions and pipes that are built into UExL are documented already; an
+// entry with the same name replaces that documentation.
+type Symbols struct {
+	Variables map[string]Variable `json:"variables,omitempty"`
+	Functions map[string]Function `json:"functions,omitempty"`
+	Pipes     map[string]Pipe     `json:"pipes,omitempty"`
+}
+
+// Variable describes a context variable.
+type Variable struct {
+	Type string `json:"type,omitempty"` // free text, e.g. "number" or "array of orders"
+	Doc  string `json:"doc,omitempty"`
+}
+
+// Function describes a function callable from expressions.
+type Function struct {
+	Params  []string `json:"params,omitempty"` // labels shown in signature help, e.g. "price: number"
+	Returns string   `json:"returns,omitempty"`
+	Doc     string   `json:"doc,omitempty"`
+}
+
+// Pipe describes a pipe usable as |name: or |name(args):.
+type Pipe struct {
+	Params []string `json:"params,omitempty"` // labels of the header arguments
+	Vars   []string `json:"vars,omitempty"`   // scope variables of the predicate; default $item, $index, $key, $value
+	Doc    string   `json:"doc,omitempty"`
+}
+
+// LoadSymbols reads a symbols file. The extension selects the format as in
+// DecodeSymbols.
+func LoadSymbols(path string) (*Symbols, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := DecodeSymbols(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("invalid symbols file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// DecodeSymbols parses a symbols file. ext (a file extension such as ".yaml")
+// selects the format as for variable files: ".yaml" and ".yml" are YAML,
+// anything else is tried as JSON first, then YAML. Unknown keys are errors,
+// so that misspelt entries are not silently ignored.
+func DecodeSymbols(data []byte, ext string) (*Symbols, error) {
+	raw, err := varsfile.Decode(data, ext)
+	if err != nil {
+		return nil, err
+	}
+	// Decode normalizes YAML to JSON types; round-trip through JSON to fill
+	// the struct with strict field checks.
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	s := &Symbols{}
+	if err := dec.Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Env returns base extended with a stub for every function in s that base
+// does not register, so that expressions calling host functions compile. The
+// stubs are never run.
+func (s *Symbols) Env(base *uexl.Env) *uexl.Env {
+	stubs := uexl.Functions{}
+	for _, name := range sortedNames(s.Functions) {
+		if !base.HasFunction(name) {
+			stubs[name] = func(args ...any) (any, error) {
+				return nil, fmt.Errorf("%s: stub function cannot be called", name)
+			}
+		}
+	}
+	if len(stubs) == 0 {
+		return base
+	}
+	return base.Extend(uexl.WithFunctions(stubs))
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -137,6 +137,8 @@ func TestTokenTypeString(t *testing.T) {
 		{TokenNull, "Null"},
 		{TokenDollar, "Dollar"},
 		{TokenAs, "As"},
+		{TokenSemicolon, "Semicolon"},
+		{TokenRange, "Range"},
 		{TokenError, "Error"},
 	}
 
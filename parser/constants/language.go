@@ -14,25 +14,65 @@ const (
 	DefaultParserState = "default"
 )
 
-// Operator precedence levels
+// Operator precedence levels, loosest first. The parser's descent order
+// (parser.go) is the authority; this table mirrors it for tools that print
+// expressions, such as the formatter, to decide where parentheses are needed.
 const (
-	PrecedenceLowest  = 0
-	PrecedenceOr      = 1  // ||
-	PrecedenceAnd     = 2  // &&
-	PrecedenceBitOr   = 3  // |
-	PrecedenceBitAnd  = 4  // &
-	PrecedenceEquals  = 5  // == !=
-	PrecedenceCompare = 6  // > < >= <=
-	PrecedenceShift   = 7  // << >>
-	PrecedenceSum     = 8  // + -
-	PrecedenceProduct = 9  // * / %
-	PrecedencePower   = 10 // ** (right-associative)
-	PrecedencePrefix  = 11 // -x !x ~x
-	PrecedenceCall    = 13 // myFunction(x)
-	PrecedenceIndex   = 14 // array[index]
-	PrecedenceHighest = 15
+	PrecedenceLowest      = 0
+	PrecedencePipe        = 1  // x |map: y
+	PrecedenceConditional = 2  // c ? a : b (right-associative)
+	PrecedenceOr          = 3  // ||
+	PrecedenceAnd         = 4  // &&
+	PrecedenceBitOr       = 5  // |
+	PrecedenceBitXor      = 6  // ~ (binary)
+	PrecedenceBitAnd      = 7  // &
+	PrecedenceEquals      = 8  // == != <>
+	PrecedenceCompare     = 9  // > < >= <=
+	PrecedenceType        = 10 // x is T, x as T (postfix)
+	PrecedenceRange       = 11 // a..b, a..<b step s (non-associative)
+	PrecedenceNullish     = 12 // ??
+	PrecedenceShift       = 13 // << >>
+	PrecedenceSum         = 14 // + -
+	PrecedenceProduct     = 15 // * / %
+	PrecedencePower       = 16 // ** ^ (right-associative, looser than prefix: -2**2 is (-2)**2)
+	PrecedencePrefix      = 17 // -x !x ~x
+	PrecedenceCall        = 18 // myFunction(x)
+	PrecedenceIndex       = 19 // array[index], obj.prop
+	PrecedenceHighest     = 20
 )
 
+// BinaryPrecedence returns the precedence of a binary operator, or
+// PrecedenceLowest if op is not one.
+func BinaryPrecedence(op string) int {
+	switch op {
+	case SymbolLogicalOr:
+		return PrecedenceOr
+	case SymbolLogicalAnd:
+		return PrecedenceAnd
+	case SymbolBitwiseOr:
+		return PrecedenceBitOr
+	case SymbolBitwiseXor:
+		return PrecedenceBitXor
+	case SymbolBitwiseAnd:
+		return PrecedenceBitAnd
+	case SymbolEqual, SymbolNotEqual, SymbolNotEqualExcel:
+		return PrecedenceEquals
+	case SymbolLessThan, SymbolGreaterThan, SymbolLessOrEqual, SymbolGreaterOrEqual:
+		return PrecedenceCompare
+	case SymbolNullish:
+		return PrecedenceNullish
+	case SymbolLeftShift, SymbolRightShift:
+		return PrecedenceShift
+	case SymbolPlus, SymbolMinus:
+		return PrecedenceSum
+	case SymbolMultiply, SymbolDivide, SymbolModulo:
+		return PrecedenceProduct
+	case SymbolPower, SymbolPowerAlt:
+		return PrecedencePower
+	}
+	return PrecedenceLowest
+}
+
 // Operator symbols - centralized string constants
 const (
 	// Arithmetic operators
@@ -81,6 +121,7 @@ const (
 	// Logical operators
 	SymbolLogicalAnd = "&&"
 	SymbolLogicalOr  = "||"
+	SymbolNullish    = "??"
 
 	// Conditional operators
 	SymbolConditional = "?:"
@@ -103,8 +144,36 @@ const (
 	SymbolColon        = ":"
 	SymbolDollar       = "$"
 	SymbolAs           = "as"
+	SymbolIs           = "is" // contextual: only a keyword when followed by a type name
+	SymbolRange        = ".."
+	SymbolRangeExcl    = "..<"
+	SymbolStep         = "step" // contextual: only a keyword right after a range
 )
 
+// Type names used by typeof(), `x is <type>` and `x as <type>`
+const (
+	TypeNameNumber  = "number"
+	TypeNameString  = "string"
+	TypeNameBoolean = "boolean"
+	TypeNameNull    = "null"
+	TypeNameArray   = "array"
+	TypeNameObject  = "object"
+)
+
+// IsTypeName reports whether name is a type name accepted by `is`.
+func IsTypeName(name string) bool {
+	switch name {
+	case TypeNameNumber, TypeNameString, TypeNameBoolean, TypeNameNull, TypeNameArray, TypeNameObject:
+		return true
+	}
+	return false
+}
+
+// IsConvertibleTypeName reports whether name is a conversion target accepted by `as`.
+func IsConvertibleTypeName(name string) bool {
+	return name == TypeNameNumber || name == TypeNameString || name == TypeNameBoolean
+}
+
 // Literal constants
 const (
 	LiteralTrue  = "true"
@@ -28,7 +28,9 @@ const (
 	TokenNull
 	TokenDollar
 	TokenAs
-	TokenError // Special token type for tokenizer errors
+	TokenSemicolon // ';' statement separator in multi-statement programs
+	TokenRange     // '..' (inclusive) or '..<' (exclusive) range operator
+	TokenError     // Special token type for tokenizer errors
 )
 
 // String returns the string representation of a token type
@@ -76,6 +78,10 @@ func (t TokenType) String() string {
 		return "Dollar"
 	case TokenAs:
 		return "As"
+	case TokenSemicolon:
+		return "Semicolon"
+	case TokenRange:
+		return "Range"
 	case TokenError:
 		return "Error"
 	default:
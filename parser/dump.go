@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Dump returns a human-readable listing of the tree rooted at node, one node
+// per line:
+//
+//	NodeType Field=value ... @line:col
+//
+// Child nodes follow on indented lines labelled with their field names, e.g.
+// "Left:", "Arguments[1]:" or `Properties["k"]:`. Intended for debugging and
+// tooling output; the format is not stable enough to be parsed.
+func Dump(node Node) string {
+	var sb strings.Builder
+	writeNode(&sb, reflect.ValueOf(node), "")
+	return sb.String()
+}
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	propertyType = reflect.TypeOf(Property{})
+)
+
+// writeNode writes one node line and then its children. It works on the node
+// structs reflectively so new node types print without changes here.
+func writeNode(sb *strings.Builder, v reflect.Value, indent string) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	node, _ := v.Interface().(Node)
+	if v.Kind() != reflect.Pointer {
+		// ProgramNode stores its pipe stages by value.
+		node, _ = v.Addr().Interface().(Node)
+	}
+	s := reflect.Indirect(v)
+
+	sb.WriteString(string(node.Type()))
+	type child struct {
+		label string
+		value reflect.Value
+	}
+	var children []child
+	for i := 0; i < s.NumField(); i++ {
+		f, fv := s.Type().Field(i), s.Field(i)
+		switch {
+		case f.Name == "Line" || f.Name == "Column" || f.Name == "Args":
+			// Position is printed at the end; Args duplicates ArgExprs.
+		case f.Type == propertyType:
+			p := fv.Interface().(Property)
+			if p.IsInt() {
+				fmt.Fprintf(sb, " %s=%d", f.Name, p.I)
+			} else {
+				fmt.Fprintf(sb, " %s=%q", f.Name, p.S)
+			}
+		case f.Type.Implements(nodeType) || reflect.PointerTo(f.Type).Implements(nodeType):
+			if !isNilValue(fv) {
+				children = append(children, child{f.Name, fv})
+			}
+		case fv.Kind() == reflect.Slice:
+			for j := 0; j < fv.Len(); j++ {
+				children = append(children, child{fmt.Sprintf("%s[%d]", f.Name, j), fv.Index(j)})
+			}
+		case fv.Kind() == reflect.Map:
+			keys := make([]string, 0, fv.Len())
+			for _, k := range fv.MapKeys() {
+				keys = append(keys, k.String())
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				children = append(children, child{fmt.Sprintf("%s[%q]", f.Name, k), fv.MapIndex(reflect.ValueOf(k))})
+			}
+		case !fv.IsZero() || f.Name == "Value":
+			if fv.Kind() == reflect.String {
+				fmt.Fprintf(sb, " %s=%q", f.Name, fv.String())
+			} else {
+				fmt.Fprintf(sb, " %s=%v", f.Name, fv.Interface())
+			}
+		}
+	}
+	line, col := node.Position()
+	fmt.Fprintf(sb, " @%d:%d\n", line, col)
+
+	for _, c := range children {
+		fmt.Fprintf(sb, "%s  %s: ", indent, c.label)
+		if isNilValue(c.value) {
+			sb.WriteString("<nil>\n")
+			continue
+		}
+		writeNode(sb, c.value, indent+"  ")
+	}
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
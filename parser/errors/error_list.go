@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -97,3 +98,29 @@ func (p *ErrorList) AddError(err ParserError) {
 func (p *ErrorList) Reset() {
 	*p = (*p)[:0]
 }
+
+// AsList returns the parser errors carried by err, whichever of the shapes the
+// parser returns it has (ParserError, ParseErrors, ErrorList, or pointers to
+// them, possibly wrapped). ok is false when err is not a parser error.
+func AsList(err error) (list ErrorList, ok bool) {
+	if stderrors.As(err, &list) {
+		return list, true
+	}
+	var pes *ParseErrors
+	if stderrors.As(err, &pes) {
+		return pes.Errors, true
+	}
+	var pesv ParseErrors
+	if stderrors.As(err, &pesv) {
+		return pesv.Errors, true
+	}
+	var pe *ParserError
+	if stderrors.As(err, &pe) {
+		return ErrorList{*pe}, true
+	}
+	var pev ParserError
+	if stderrors.As(err, &pev) {
+		return ErrorList{pev}, true
+	}
+	return nil, false
+}
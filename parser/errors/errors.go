@@ -22,8 +22,10 @@ const (
 	ErrExpressionTooLong ErrorCode = "expression-too-long"
 
 	// Pipe Errors
-	ErrEmptyPipe           ErrorCode = "empty-pipe"
-	ErrEmptyPipeWithAlias  ErrorCode = "empty-pipe-with-alias"
+	ErrEmptyPipe          ErrorCode = "empty-pipe"
+	ErrEmptyPipeWithAlias ErrorCode = "empty-pipe-with-alias"
+	// Deprecated: pipes are allowed in sub-expressions and run in a nested
+	// scope; the parser no longer reports this code.
 	ErrPipeInSubExpression ErrorCode = "pipe-in-sub-expression"
 	ErrInvalidPipeType     ErrorCode = "invalid-pipe-type"
 	ErrMissingPipeType     ErrorCode = "missing-pipe-type"
@@ -33,6 +35,7 @@ const (
 	ErrInvalidAlias       ErrorCode = "invalid-alias"
 	ErrMissingDollarSign  ErrorCode = "missing-dollar-sign"
 	ErrAliasInSubExpr     ErrorCode = "alias-in-sub-expression"
+	ErrInvalidTypeName    ErrorCode = "invalid-type-name"
 
 	// Literal Errors
 	ErrInvalidNumber      ErrorCode = "invalid-number"
@@ -51,11 +54,12 @@ const (
 	ErrInvalidArgument  ErrorCode = "invalid-argument"
 
 	// Tokenizer Errors
-	ErrConsecutiveDots   ErrorCode = "consecutive-dots"
-	ErrInvalidToken      ErrorCode = "invalid-token"
-	ErrInvalidCharacter  ErrorCode = "invalid-character"
-	ErrUnterminatedQuote ErrorCode = "unterminated-quote"
-	ErrTooManyArguments  ErrorCode = "too-many-arguments"
+	ErrConsecutiveDots     ErrorCode = "consecutive-dots"
+	ErrInvalidToken        ErrorCode = "invalid-token"
+	ErrInvalidCharacter    ErrorCode = "invalid-character"
+	ErrUnterminatedQuote   ErrorCode = "unterminated-quote"
+	ErrUnterminatedComment ErrorCode = "unterminated-comment"
+	ErrTooManyArguments    ErrorCode = "too-many-arguments"
 
 	// Operator Errors
 	ErrInvalidOperator ErrorCode = "invalid-operator"
@@ -153,6 +157,7 @@ var errorMessages = map[ErrorCode]string{
 	ErrInvalidAlias:       "invalid alias",
 	ErrMissingDollarSign:  "expected identifier starting with $",
 	ErrAliasInSubExpr:     "aliases cannot be used in sub-expressions",
+	ErrInvalidTypeName:    "invalid type name",
 
 	ErrInvalidNumber:      "invalid number format",
 	ErrInvalidString:      "invalid string format",
@@ -168,10 +173,11 @@ var errorMessages = map[ErrorCode]string{
 	ErrInvalidArgument:  "invalid function argument",
 	ErrTooManyArguments: "too many function arguments",
 
-	ErrConsecutiveDots:   "consecutive dots in identifier",
-	ErrInvalidToken:      "invalid token",
-	ErrInvalidCharacter:  "invalid character",
-	ErrUnterminatedQuote: "unterminated quoted string",
+	ErrConsecutiveDots:     "consecutive dots in identifier",
+	ErrInvalidToken:        "invalid token",
+	ErrInvalidCharacter:    "invalid character",
+	ErrUnterminatedQuote:   "unterminated quoted string",
+	ErrUnterminatedComment: "unterminated block comment, expected '*/'",
 
 	ErrInvalidOperator: "invalid operator",
 	ErrMissingOperand:  "missing operand",
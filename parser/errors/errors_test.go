@@ -1,6 +1,7 @@
 package errors
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
@@ -294,3 +295,27 @@ func TestGetErrorMessage(t *testing.T) {
 		assert.Equal(t, "unknown error", result)
 	})
 }
+
+func TestAsList(t *testing.T) {
+	pe := NewParserError(ErrUnexpectedToken, 1, 3, "unexpected token")
+	wrapped := fmt.Errorf("compiling rule: %w", &ParseErrors{Errors: []ParserError{pe, pe}})
+
+	for name, err := range map[string]error{
+		"value":        pe,
+		"pointer":      &pe,
+		"ErrorList":    ErrorList{pe},
+		"ParseErrors":  ParseErrors{Errors: []ParserError{pe}},
+		"*ParseErrors": &ParseErrors{Errors: []ParserError{pe}},
+	} {
+		list, ok := AsList(err)
+		assert.True(t, ok, name)
+		assert.Equal(t, ErrorList{pe}, list, name)
+	}
+
+	list, ok := AsList(wrapped)
+	assert.True(t, ok)
+	assert.Len(t, list, 2)
+
+	_, ok = AsList(fmt.Errorf("runtime failure"))
+	assert.False(t, ok)
+}
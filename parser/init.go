@@ -3,3 +3,23 @@ package parser
 func ParseString(input string) (Node, error) {
 	return NewParser(input).Parse()
 }
+
+// ParseStringWithComments parses input and also returns the comments found in
+// it, in source order. Intended for tools (formatters, linters) that need the
+// comment trivia the regular parse discards.
+func ParseStringWithComments(input string) (Node, []Comment, error) {
+	opt := DefaultOptions()
+	opt.PreserveComments = true
+	p := NewParserWithOptions(input, opt)
+	node, err := p.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	return node, p.Comments(), nil
+}
+
+// ParseProgram parses a multi-statement program of `name = expr` assignments.
+// See Parser.ParseStatements.
+func ParseProgram(input string) (*StatementList, error) {
+	return NewParser(input).ParseStatements()
+}
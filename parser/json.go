@@ -0,0 +1,453 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// JSON form of the AST
+//
+// Every node marshals to an object with its NodeType in "type", its position
+// in "line" and "column", and its fields under their Go names in lower camel
+// case: {"type": "BinaryExpression", "operator": "+", "left": {...}, ...}.
+// Absent children, false flags and empty aliases are omitted. A MemberAccess
+// property is a JSON string or, for a.0, a number. NumberLiteral values that
+// JSON cannot hold are written as the strings "NaN", "Inf" and "-Inf".
+// UnmarshalNode reads this form back.
+
+func (be *BinaryExpression) MarshalJSON() ([]byte, error)      { return marshalNode(be) }
+func (ce *ConditionalExpression) MarshalJSON() ([]byte, error) { return marshalNode(ce) }
+func (ue *UnaryExpression) MarshalJSON() ([]byte, error)       { return marshalNode(ue) }
+func (ge *GroupedExpression) MarshalJSON() ([]byte, error)     { return marshalNode(ge) }
+func (nl *NumberLiteral) MarshalJSON() ([]byte, error)         { return marshalNode(nl) }
+func (sl *StringLiteral) MarshalJSON() ([]byte, error)         { return marshalNode(sl) }
+func (bl *BooleanLiteral) MarshalJSON() ([]byte, error)        { return marshalNode(bl) }
+func (nl *NullLiteral) MarshalJSON() ([]byte, error)           { return marshalNode(nl) }
+func (i *Identifier) MarshalJSON() ([]byte, error)             { return marshalNode(i) }
+func (al *ArrayLiteral) MarshalJSON() ([]byte, error)          { return marshalNode(al) }
+func (ol *ObjectLiteral) MarshalJSON() ([]byte, error)         { return marshalNode(ol) }
+func (fc *FunctionCall) MarshalJSON() ([]byte, error)          { return marshalNode(fc) }
+func (ma *MemberAccess) MarshalJSON() ([]byte, error)          { return marshalNode(ma) }
+func (se *SliceExpression) MarshalJSON() ([]byte, error)       { return marshalNode(se) }
+func (ia *IndexAccess) MarshalJSON() ([]byte, error)           { return marshalNode(ia) }
+func (te *TypeExpression) MarshalJSON() ([]byte, error)        { return marshalNode(te) }
+func (re *RangeExpression) MarshalJSON() ([]byte, error)       { return marshalNode(re) }
+func (pe *PipeExpression) MarshalJSON() ([]byte, error)        { return marshalNode(pe) }
+func (pn *ProgramNode) MarshalJSON() ([]byte, error)           { return marshalNode(pn) }
+func (a *Assignment) MarshalJSON() ([]byte, error)             { return marshalNode(a) }
+func (sl *StatementList) MarshalJSON() ([]byte, error)         { return marshalNode(sl) }
+
+// marshalNode encodes the fields of n as a map, whose keys encoding/json
+// sorts, so the output is stable. Children are encoded by their own
+// MarshalJSON methods.
+func marshalNode(n Node) ([]byte, error) {
+	line, column := n.Position()
+	m := map[string]any{"type": n.Type(), "line": line, "column": column}
+	child := func(key string, e Expression) {
+		if e != nil {
+			m[key] = e
+		}
+	}
+	flag := func(key string, b bool) {
+		if b {
+			m[key] = true
+		}
+	}
+	list := func(key string, es []Expression) {
+		if es == nil {
+			es = []Expression{}
+		}
+		m[key] = es
+	}
+
+	switch n := n.(type) {
+	case *BinaryExpression:
+		child("left", n.Left)
+		m["operator"] = n.Operator
+		child("right", n.Right)
+	case *ConditionalExpression:
+		child("condition", n.Condition)
+		child("consequent", n.Consequent)
+		child("alternate", n.Alternate)
+	case *UnaryExpression:
+		m["operator"] = n.Operator
+		child("operand", n.Operand)
+	case *GroupedExpression:
+		child("expression", n.Expression)
+	case *NumberLiteral:
+		switch {
+		case math.IsNaN(n.Value):
+			m["value"] = "NaN"
+		case math.IsInf(n.Value, 1):
+			m["value"] = "Inf"
+		case math.IsInf(n.Value, -1):
+			m["value"] = "-Inf"
+		default:
+			m["value"] = n.Value
+		}
+	case *StringLiteral:
+		m["value"] = n.Value
+		if n.Token != "" {
+			m["token"] = n.Token
+		}
+		flag("raw", n.IsRaw)
+		flag("singleQuoted", n.IsSingleQuoted)
+	case *BooleanLiteral:
+		m["value"] = n.Value
+	case *NullLiteral:
+	case *Identifier:
+		m["name"] = n.Name
+	case *ArrayLiteral:
+		list("elements", n.Elements)
+	case *ObjectLiteral:
+		props := n.Properties
+		if props == nil {
+			props = map[string]Expression{}
+		}
+		m["properties"] = props
+	case *FunctionCall:
+		child("function", n.Function)
+		list("arguments", n.Arguments)
+	case *MemberAccess:
+		child("target", n.Target)
+		if n.Property.IsInt() {
+			m["property"] = n.Property.I
+		} else {
+			m["property"] = n.Property.S
+		}
+		flag("optional", n.Optional)
+	case *IndexAccess:
+		child("target", n.Target)
+		child("index", n.Index)
+		flag("optional", n.Optional)
+	case *SliceExpression:
+		child("target", n.Target)
+		child("start", n.Start)
+		child("end", n.End)
+		child("step", n.Step)
+		flag("optional", n.Optional)
+	case *TypeExpression:
+		m["operator"] = n.Operator
+		child("operand", n.Operand)
+		m["typeName"] = n.TypeName
+	case *RangeExpression:
+		child("start", n.Start)
+		child("end", n.End)
+		child("step", n.Step)
+		flag("exclusive", n.Exclusive)
+	case *PipeExpression:
+		m["pipeType"] = n.PipeType
+		if n.Alias != "" {
+			m["alias"] = n.Alias
+		}
+		if n.ArgExprs != nil {
+			m["args"] = n.ArgExprs
+		}
+		child("expression", n.Expression)
+		m["index"] = n.Index
+	case *ProgramNode:
+		stages := make([]*PipeExpression, len(n.PipeExpressions))
+		for i := range n.PipeExpressions {
+			stages[i] = &n.PipeExpressions[i]
+		}
+		m["pipeExpressions"] = stages
+	case *Assignment:
+		m["name"] = n.Name
+		child("value", n.Value)
+	case *StatementList:
+		stmts := n.Statements
+		if stmts == nil {
+			stmts = []*Assignment{}
+		}
+		m["statements"] = stmts
+	default:
+		return nil, fmt.Errorf("cannot marshal node type %s", n.Type())
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalNode decodes a node from the JSON form written by the nodes'
+// MarshalJSON methods. The result can be compiled, formatted or walked like
+// a parsed tree.
+func UnmarshalNode(data []byte) (Node, error) {
+	return decodeNode(data)
+}
+
+// nodeDecoder reads the fields of one JSON node, keeping the first error.
+type nodeDecoder struct {
+	typ    NodeType
+	fields map[string]json.RawMessage
+	err    error
+}
+
+func decodeNode(data []byte) (Node, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("node is null")
+	}
+	d := &nodeDecoder{fields: fields}
+	var typ string
+	d.value("type", &typ, true)
+	if d.err != nil {
+		return nil, d.err
+	}
+	d.typ = NodeType(typ)
+
+	var line, column int
+	d.value("line", &line, false)
+	d.value("column", &column, false)
+
+	var node Node
+	switch d.typ {
+	case NodeTypeBinaryExpression:
+		n := &BinaryExpression{Line: line, Column: column}
+		n.Left = d.expr("left", true)
+		d.value("operator", &n.Operator, true)
+		n.Right = d.expr("right", true)
+		node = n
+	case NodeTypeConditional:
+		n := &ConditionalExpression{Line: line, Column: column}
+		n.Condition = d.expr("condition", true)
+		n.Consequent = d.expr("consequent", true)
+		n.Alternate = d.expr("alternate", true)
+		node = n
+	case NodeTypeUnaryExpression:
+		n := &UnaryExpression{Line: line, Column: column}
+		d.value("operator", &n.Operator, true)
+		n.Operand = d.expr("operand", true)
+		node = n
+	case NodeTypeGroupedExpression:
+		node = &GroupedExpression{Expression: d.expr("expression", true), Line: line, Column: column}
+	case NodeTypeNumberLiteral:
+		node = &NumberLiteral{Value: d.number("value"), Line: line, Column: column}
+	case NodeTypeStringLiteral:
+		n := &StringLiteral{Line: line, Column: column}
+		d.value("value", &n.Value, true)
+		d.value("token", &n.Token, false)
+		d.value("raw", &n.IsRaw, false)
+		d.value("singleQuoted", &n.IsSingleQuoted, false)
+		node = n
+	case NodeTypeBooleanLiteral:
+		n := &BooleanLiteral{Line: line, Column: column}
+		d.value("value", &n.Value, true)
+		node = n
+	case NodeTypeNullLiteral:
+		node = &NullLiteral{Line: line, Column: column}
+	case NodeTypeIdentifier:
+		n := &Identifier{Line: line, Column: column}
+		d.value("name", &n.Name, true)
+		node = n
+	case NodeTypeArrayLiteral:
+		node = &ArrayLiteral{Elements: d.exprs("elements"), Line: line, Column: column}
+	case NodeTypeObjectLiteral:
+		node = &ObjectLiteral{Properties: d.properties("properties"), Line: line, Column: column}
+	case NodeTypeFunctionCall:
+		n := &FunctionCall{Line: line, Column: column}
+		n.Function = d.expr("function", true)
+		n.Arguments = d.exprs("arguments")
+		node = n
+	case NodeTypeMemberAccess:
+		n := &MemberAccess{Line: line, Column: column}
+		n.Target = d.expr("target", true)
+		n.Property = d.property("property")
+		d.value("optional", &n.Optional, false)
+		node = n
+	case NodeTypeIndexAccess:
+		n := &IndexAccess{Line: line, Column: column}
+		n.Target = d.expr("target", true)
+		n.Index = d.expr("index", true)
+		d.value("optional", &n.Optional, false)
+		node = n
+	case NodeTypeSliceExpression:
+		n := &SliceExpression{Line: line, Column: column}
+		n.Target = d.expr("target", true)
+		n.Start = d.expr("start", false)
+		n.End = d.expr("end", false)
+		n.Step = d.expr("step", false)
+		d.value("optional", &n.Optional, false)
+		node = n
+	case NodeTypeTypeExpression:
+		n := &TypeExpression{Line: line, Column: column}
+		d.value("operator", &n.Operator, true)
+		n.Operand = d.expr("operand", true)
+		d.value("typeName", &n.TypeName, true)
+		node = n
+	case NodeTypeRangeExpression:
+		n := &RangeExpression{Line: line, Column: column}
+		n.Start = d.expr("start", true)
+		n.End = d.expr("end", true)
+		n.Step = d.expr("step", false)
+		d.value("exclusive", &n.Exclusive, false)
+		node = n
+	case NodeTypePipeExpression:
+		n := &PipeExpression{Line: line, Column: column}
+		d.value("pipeType", &n.PipeType, true)
+		d.value("alias", &n.Alias, false)
+		if _, ok := d.fields["args"]; ok {
+			n.ArgExprs = d.exprs("args")
+			n.Args = literalArgs(n.ArgExprs)
+		}
+		n.Expression = d.expr("expression", false)
+		d.value("index", &n.Index, false)
+		node = n
+	case NodeTypeProgram:
+		n := &ProgramNode{Line: line, Column: column}
+		for _, raw := range d.list("pipeExpressions") {
+			if stage, ok := d.decode(raw).(*PipeExpression); ok {
+				n.PipeExpressions = append(n.PipeExpressions, *stage)
+			} else if d.err == nil {
+				d.fail("pipeExpressions", fmt.Errorf("expected PipeExpression nodes"))
+			}
+		}
+		node = n
+	case NodeTypeAssignment:
+		n := &Assignment{Line: line, Column: column}
+		d.value("name", &n.Name, true)
+		n.Value = d.expr("value", true)
+		node = n
+	case NodeTypeStatementList:
+		n := &StatementList{Line: line, Column: column}
+		for _, raw := range d.list("statements") {
+			if stmt, ok := d.decode(raw).(*Assignment); ok {
+				n.Statements = append(n.Statements, stmt)
+			} else if d.err == nil {
+				d.fail("statements", fmt.Errorf("expected Assignment nodes"))
+			}
+		}
+		node = n
+	default:
+		return nil, fmt.Errorf("unknown node type %q", typ)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+func (d *nodeDecoder) fail(key string, err error) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%s.%s: %w", d.typ, key, err)
+	}
+}
+
+// value decodes field key into dst. A required field must be present.
+func (d *nodeDecoder) value(key string, dst any, required bool) {
+	raw, ok := d.fields[key]
+	if !ok {
+		if required {
+			d.fail(key, fmt.Errorf("missing field"))
+		}
+		return
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		d.fail(key, err)
+	}
+}
+
+func (d *nodeDecoder) decode(raw json.RawMessage) Node {
+	if d.err != nil {
+		return nil
+	}
+	n, err := decodeNode(raw)
+	if err != nil {
+		d.err = err
+		return nil
+	}
+	return n
+}
+
+// expr decodes the child expression in field key; absent or null optional
+// children are nil.
+func (d *nodeDecoder) expr(key string, required bool) Expression {
+	raw, ok := d.fields[key]
+	if !ok || string(raw) == "null" {
+		if required {
+			d.fail(key, fmt.Errorf("missing expression"))
+		}
+		return nil
+	}
+	return d.asExpr(key, d.decode(raw))
+}
+
+func (d *nodeDecoder) asExpr(key string, n Node) Expression {
+	if n == nil {
+		return nil
+	}
+	e, ok := n.(Expression)
+	if !ok {
+		d.fail(key, fmt.Errorf("%s is not an expression", n.Type()))
+	}
+	return e
+}
+
+func (d *nodeDecoder) list(key string) []json.RawMessage {
+	var raws []json.RawMessage
+	d.value(key, &raws, true)
+	return raws
+}
+
+func (d *nodeDecoder) exprs(key string) []Expression {
+	raws := d.list(key)
+	exprs := make([]Expression, 0, len(raws))
+	for _, raw := range raws {
+		if e := d.asExpr(key, d.decode(raw)); e != nil {
+			exprs = append(exprs, e)
+		}
+	}
+	return exprs
+}
+
+func (d *nodeDecoder) properties(key string) map[string]Expression {
+	var raws map[string]json.RawMessage
+	d.value(key, &raws, true)
+	props := make(map[string]Expression, len(raws))
+	for k, raw := range raws {
+		if e := d.asExpr(key, d.decode(raw)); e != nil {
+			props[k] = e
+		}
+	}
+	return props
+}
+
+func (d *nodeDecoder) number(key string) float64 {
+	raw, ok := d.fields[key]
+	if !ok {
+		d.fail(key, fmt.Errorf("missing field"))
+		return 0
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		switch s {
+		case "NaN":
+			return math.NaN()
+		case "Inf":
+			return math.Inf(1)
+		case "-Inf":
+			return math.Inf(-1)
+		}
+		d.fail(key, fmt.Errorf("invalid number %q", s))
+		return 0
+	}
+	var v float64
+	d.value(key, &v, true)
+	return v
+}
+
+func (d *nodeDecoder) property(key string) Property {
+	raw, ok := d.fields[key]
+	if !ok {
+		d.fail(key, fmt.Errorf("missing field"))
+		return Property{}
+	}
+	var i int
+	if json.Unmarshal(raw, &i) == nil {
+		return PropI(i)
+	}
+	var s string
+	d.value(key, &s, true)
+	return PropS(s)
+}
@@ -21,7 +21,6 @@ type Parser struct {
 	errors              []errors.ParserError // Changed from []string
 	pos                 int
 	subExpressionActive bool
-	inParenthesis       bool
 	options             Options
 }
 
@@ -64,6 +63,12 @@ func NewParserWithValidation(input string) (*Parser, error) {
 	return p, nil
 }
 
+// Comments returns the comments collected while parsing. Always empty unless
+// the parser was created with Options.PreserveComments.
+func (p *Parser) Comments() []Comment {
+	return p.tokenizer.Comments()
+}
+
 // Parse parses the input and returns an Expression or an error
 func (p *Parser) Parse() (Expression, error) {
 	expr := p.parseExpression()
@@ -88,14 +93,10 @@ func (p *Parser) parseExpression() Expression {
 	return p.parsePipeExpression()
 }
 
-// parsePipeExpression parses pipe expressions with proper error handling
+// parsePipeExpression parses pipe expressions with proper error handling.
+// Pipes may appear in any sub-expression (grouping, arguments, array and object
+// literals); a pipe inside a predicate runs in a scope nested in the outer one.
 func (p *Parser) parsePipeExpression() Expression {
-	// Only disallow pipe expressions in sub-expressions that aren't in parentheses
-	if p.subExpressionActive && !p.inParenthesis {
-		p.addError(errors.ErrPipeInSubExpression, errors.GetErrorMessage(errors.ErrPipeInSubExpression))
-		return nil
-	}
-
 	// Handle leading pipe at the start of the expression
 	if p.pos == 1 && p.current.Type == constants.TokenPipe {
 		return p.handleLeadingPipe()
@@ -106,14 +107,10 @@ func (p *Parser) parsePipeExpression() Expression {
 		return nil
 	}
 
-	if p.subExpressionActive && !p.inParenthesis {
-		return firstExpression
-	}
-
 	aliases := []string{}
 	expressions := []Expression{firstExpression}
 	pipeTypes := []string{DefaultPipeType}
-	pipeArgsList := [][]any{nil} // parallel slice; first entry is for the base expression (no args)
+	pipeArgsList := [][]Expression{nil} // parallel slice; first entry is for the base expression (no args)
 
 	startLine, startColumn := expressions[0].Position()
 
@@ -152,15 +149,12 @@ func (p *Parser) parsePipeExpression() Expression {
 	}
 
 	for i, expr := range expressions {
-		if expr == nil {
-			p.addError(errors.ErrInvalidExpression, fmt.Sprintf("nil expression at index %d", i))
-			continue
-		}
 		programNode.PipeExpressions = append(programNode.PipeExpressions, PipeExpression{
 			Expression: expr,
 			PipeType:   pipeTypes[i],
 			Alias:      aliases[i],
-			Args:       pipeArgsList[i],
+			Args:       literalArgs(pipeArgsList[i]),
+			ArgExprs:   pipeArgsList[i],
 			Index:      i,
 			Line:       startLine,
 			Column:     startColumn,
@@ -215,12 +209,12 @@ func (p *Parser) parseConditional() Expression {
 	return condition
 }
 
+// parsePipeAlias parses the optional `as $name` after a pipe expression. In a
+// sub-expression the alias must be followed by a pipe that can use it, as in
+// `($item.lines as $lines |map: ...)`.
 func (p *Parser) parsePipeAlias() (string, error) {
 	if p.current.Type == constants.TokenAs {
-		// If we're in a sub-expression (not top-level pipe), error
-		if p.subExpressionActive {
-			return "", errors.NewParserError(errors.ErrAliasInSubExpr, p.current.Line, p.current.Column, errors.GetErrorMessage(errors.ErrAliasInSubExpr))
-		}
+		as := p.current
 		p.advance() // consume 'as'
 
 		if p.current.Type != constants.TokenIdentifier || !strings.HasPrefix(p.current.Token, constants.SymbolDollar) {
@@ -230,6 +224,9 @@ func (p *Parser) parsePipeAlias() (string, error) {
 		alias := p.current.Token
 		p.advance()
 
+		if p.subExpressionActive && p.current.Type != constants.TokenPipe {
+			return "", errors.NewParserError(errors.ErrAliasInSubExpr, as.Line, as.Column, errors.GetErrorMessage(errors.ErrAliasInSubExpr))
+		}
 		return alias, nil
 	}
 	return "", nil
@@ -263,8 +260,88 @@ func (p *Parser) parseEquality() Expression {
 }
 
 func (p *Parser) parseComparison() Expression {
-	// Comparison is looser than nullish; parse nullish first
-	return p.parseBinaryOp(p.parseNullish, "<", ">", "<=", ">=")
+	// Comparison is looser than the type operators and nullish; parse those first
+	return p.parseBinaryOp(p.parseTypeOperation, "<", ">", "<=", ">=")
+}
+
+// parseTypeOperation parses the postfix type operators `x is <type>` and `x as <type>`.
+// Precedence: looser than nullish/arithmetic, tighter than comparison/equality,
+// so `a + b as string == "3"` is `((a + b) as string) == "3"`.
+// `as` followed by a $-identifier is a pipe alias and is left to parsePipeAlias;
+// `is` is a contextual keyword recognized only when followed by a type name.
+func (p *Parser) parseTypeOperation() Expression {
+	left := p.parseRange()
+	for left != nil {
+		var op string
+		switch {
+		case p.current.Type == constants.TokenAs:
+			op = constants.SymbolAs
+		case p.current.Type == constants.TokenIdentifier && p.current.Token == constants.SymbolIs:
+			op = constants.SymbolIs
+		default:
+			return left
+		}
+		next := p.peekToken()
+		if (next.Type != constants.TokenIdentifier && next.Type != constants.TokenNull) || !constants.IsTypeName(next.Token) {
+			return left
+		}
+		opTok := p.current
+		p.advance() // consume 'is' / 'as'
+		if op == constants.SymbolAs && !constants.IsConvertibleTypeName(p.current.Token) {
+			p.addErrorWithToken(errors.ErrInvalidTypeName, fmt.Sprintf("cannot convert with 'as' to %s; expected number, string or boolean", p.current.Token))
+			return nil
+		}
+		left = &TypeExpression{Operator: op, Operand: left, TypeName: p.current.Token, Line: opTok.Line, Column: opTok.Column}
+		p.advance() // consume type name
+	}
+	return left
+}
+
+// parseRange parses range literals: a..b, a..<b and a..b step s.
+// Precedence: looser than nullish/arithmetic (`0..n-1` is `0..(n-1)`), tighter than
+// the type operators. Ranges do not chain: `1..2..3` is an error.
+func (p *Parser) parseRange() Expression {
+	start := p.parseNullish()
+	if start == nil || p.current.Type != constants.TokenRange {
+		return start
+	}
+	opTok := p.current
+	p.advance() // consume '..' / '..<'
+	end := p.parseNullish()
+	if end == nil {
+		if len(p.errors) == 0 {
+			p.addError(errors.ErrMissingOperand, "expected range end after '"+opTok.Token+"'")
+		}
+		return nil
+	}
+	rng := &RangeExpression{Start: start, End: end, Exclusive: opTok.Token == constants.SymbolRangeExcl, Line: opTok.Line, Column: opTok.Column}
+
+	if p.current.Type == constants.TokenIdentifier && p.current.Token == constants.SymbolStep {
+		p.advance() // consume 'step'
+		rng.Step = p.parseNullish()
+		if rng.Step == nil {
+			if len(p.errors) == 0 {
+				p.addError(errors.ErrMissingOperand, "expected step value after 'step'")
+			}
+			return nil
+		}
+	}
+	if p.current.Type == constants.TokenRange {
+		p.addErrorWithToken(errors.ErrInvalidOperator, "ranges cannot be chained")
+		return nil
+	}
+	return rng
+}
+
+// peekToken returns the token after the current one without consuming anything.
+func (p *Parser) peekToken() Token {
+	saved := *p.tokenizer
+	tok, err := p.tokenizer.NextToken()
+	*p.tokenizer = saved
+	if err != nil {
+		return Token{Type: constants.TokenError}
+	}
+	return tok
 }
 
 func (p *Parser) parseBitwiseShift() Expression {
@@ -351,9 +428,7 @@ func (p *Parser) parseMemberAccess() Expression {
 				p.advance() // consume '['
 
 				// Save and set flags for index expression
-				wasInParenthesis := p.inParenthesis
 				wasSubExpressionActive := p.subExpressionActive
-				p.inParenthesis = true
 				p.subExpressionActive = true
 
 				indexExpr := p.parseExpression()
@@ -365,7 +440,6 @@ func (p *Parser) parseMemberAccess() Expression {
 				}
 
 				// Restore flags
-				p.inParenthesis = wasInParenthesis
 				p.subExpressionActive = wasSubExpressionActive
 
 				expr = &IndexAccess{
@@ -461,15 +535,12 @@ func (p *Parser) parseMemberAccess() Expression {
 			case constants.TokenLeftParen:
 				// Treat .(expr) as index access using grouped expression
 				// Save previous state similar to bracket indexing to allow full expressions
-				wasInParenthesis := p.inParenthesis
 				wasSubExpressionActive := p.subExpressionActive
-				p.inParenthesis = true
 				p.subExpressionActive = true
 
 				indexExpr := p.parseGroupedExpression()
 
 				// Restore previous state
-				p.inParenthesis = wasInParenthesis
 				p.subExpressionActive = wasSubExpressionActive
 
 				expr = &IndexAccess{
@@ -522,11 +593,9 @@ func (p *Parser) parseIndexOrSliceExpression(target Expression) Expression {
 	p.advance() // consume '[' or '?['
 
 	// Save previous state
-	wasInParenthesis := p.inParenthesis
 	wasSubExpressionActive := p.subExpressionActive
 
 	// Allow expressions within array index/slice
-	p.inParenthesis = true
 	p.subExpressionActive = true
 
 	// Peek ahead to see if this is a slice. A slice must contain at least one ':'.
@@ -585,7 +654,6 @@ func (p *Parser) parseIndexOrSliceExpression(target Expression) Expression {
 			}
 
 			// Restore previous state
-			p.inParenthesis = wasInParenthesis
 			p.subExpressionActive = wasSubExpressionActive
 
 			return &IndexAccess{
@@ -605,7 +673,6 @@ func (p *Parser) parseIndexOrSliceExpression(target Expression) Expression {
 	}
 
 	// Restore previous state
-	p.inParenthesis = wasInParenthesis
 	p.subExpressionActive = wasSubExpressionActive
 
 	return &SliceExpression{
@@ -662,11 +729,9 @@ func (p *Parser) parseFunctionCall(function Expression) Expression {
 	p.advance() // consume '('
 
 	// Save previous state
-	wasInParenthesis := p.inParenthesis
 	wasSubExpressionActive := p.subExpressionActive
 
 	// Set flags for function arguments
-	p.inParenthesis = true // Allow parenthesized expressions in function args
 	p.subExpressionActive = true
 
 	args := []Expression{}
@@ -688,7 +753,6 @@ func (p *Parser) parseFunctionCall(function Expression) Expression {
 	p.advance() // consume ')'
 
 	// Restore previous state
-	p.inParenthesis = wasInParenthesis
 	p.subExpressionActive = wasSubExpressionActive
 
 	return &FunctionCall{
@@ -761,8 +825,6 @@ func (p *Parser) parseGroupedExpression() Expression {
 	p.advance() // consume '('
 
 	// Set both flags to track that we're in a parenthesized expression
-	wasInParenthesis := p.inParenthesis
-	p.inParenthesis = true
 	wasSubExpressionActive := p.subExpressionActive
 	p.subExpressionActive = true
 
@@ -774,7 +836,6 @@ func (p *Parser) parseGroupedExpression() Expression {
 	}
 
 	// Restore previous state
-	p.inParenthesis = wasInParenthesis
 	p.subExpressionActive = wasSubExpressionActive
 
 	// Wrap in GroupedExpression to preserve the fact that parentheses were used
@@ -790,11 +851,9 @@ func (p *Parser) parseArray() Expression {
 	p.advance() // consume '['
 
 	// Save previous state
-	wasInParenthesis := p.inParenthesis
 	wasSubExpressionActive := p.subExpressionActive
 
 	// Set flags for array elements
-	p.inParenthesis = true
 	p.subExpressionActive = true
 
 	elements := []Expression{}
@@ -822,7 +881,6 @@ func (p *Parser) parseArray() Expression {
 	}
 
 	// Restore previous state
-	p.inParenthesis = wasInParenthesis
 	p.subExpressionActive = wasSubExpressionActive
 
 	return &ArrayLiteral{Elements: elements, Line: token.Line, Column: token.Column}
@@ -833,11 +891,9 @@ func (p *Parser) parseObject() Expression {
 	p.advance() // consume '{'
 
 	// Save previous state
-	wasInParenthesis := p.inParenthesis
 	wasSubExpressionActive := p.subExpressionActive
 
 	// Set flags for object properties
-	p.inParenthesis = true
 	p.subExpressionActive = true
 
 	properties := make(map[string]Expression)
@@ -891,7 +947,6 @@ func (p *Parser) parseObject() Expression {
 	}
 
 	// Restore previous state
-	p.inParenthesis = wasInParenthesis
 	p.subExpressionActive = wasSubExpressionActive
 
 	return &ObjectLiteral{Properties: properties, Line: token.Line, Column: token.Column}
@@ -976,9 +1031,77 @@ func (p *Parser) handleLeadingPipe() Expression {
 	return nil
 }
 
+// parsePipeArgs parses the parenthesized argument list of |pipe(arg1, arg2, ...):.
+// Arguments are ordinary expressions evaluated in the enclosing scope; like
+// function arguments they may not contain unparenthesized pipes.
+func (p *Parser) parsePipeArgs() ([]Expression, bool) {
+	p.advance() // consume '('
+
+	wasSubExpressionActive := p.subExpressionActive
+	p.subExpressionActive = true
+	defer func() {
+		p.subExpressionActive = wasSubExpressionActive
+	}()
+
+	var args []Expression
+	for p.current.Type != constants.TokenRightParen && p.current.Type != constants.TokenEOF {
+		arg := p.parseExpression()
+		if arg == nil {
+			if len(p.errors) == 0 {
+				p.addError(errors.ErrInvalidArgument, "invalid pipe argument")
+			}
+			p.consumeRemainingTokens()
+			return nil, false
+		}
+		args = append(args, arg)
+		if p.current.Type != constants.TokenComma {
+			break
+		}
+		p.advance() // consume ','
+		// Reject trailing comma
+		if p.current.Type == constants.TokenRightParen {
+			p.addError(errors.ErrInvalidArgument, "trailing comma not allowed in pipe arguments")
+			p.consumeRemainingTokens()
+			return nil, false
+		}
+	}
+	if p.current.Type != constants.TokenRightParen {
+		p.addError(errors.ErrUnclosedFunction, "expected ')' after pipe arguments")
+		p.consumeRemainingTokens()
+		return nil, false
+	}
+	p.advance() // consume ')'
+	return args, true
+}
+
+// literalArgs returns the values of args when every argument is a literal
+// (number, string, boolean or null), and nil otherwise. Literal-only argument
+// lists are stored in the constant pool instead of being compiled.
+func literalArgs(args []Expression) []any {
+	if len(args) == 0 {
+		return nil
+	}
+	values := make([]any, len(args))
+	for i, arg := range args {
+		switch lit := arg.(type) {
+		case *NumberLiteral:
+			values[i] = lit.Value
+		case *StringLiteral:
+			values[i] = lit.Value
+		case *BooleanLiteral:
+			values[i] = lit.Value
+		case *NullLiteral:
+			values[i] = nil
+		default:
+			return nil
+		}
+	}
+	return values
+}
+
 // processPipeSegment processes a single pipe segment and returns false if parsing should stop.
-// pipeArgsList receives compiled-time literal arguments parsed from |pipe(arg1, arg2, ...): syntax.
-func (p *Parser) processPipeSegment(expressions *[]Expression, pipeTypes *[]string, aliases *[]string, pipeArgsList *[][]any) bool {
+// pipeArgsList receives the argument expressions parsed from |pipe(arg1, arg2, ...): syntax.
+func (p *Parser) processPipeSegment(expressions *[]Expression, pipeTypes *[]string, aliases *[]string, pipeArgsList *[][]Expression) bool {
 	op := p.current
 	p.advance()
 
@@ -988,60 +1111,41 @@ func (p *Parser) processPipeSegment(expressions *[]Expression, pipeTypes *[]stri
 	// For named pipes (|name: or |name(args):), the tokenizer leaves ':' unconsumed so
 	// the parser can distinguish args-form from predicate-form unambiguously.
 	// The default pipe (|:) has ':' as its name and was already consumed by the tokenizer.
-	var args []any
+	var args []Expression
 	isNamedPipe := op.Value.Str != ":"
 
+	headerAlias := ""
 	if isNamedPipe {
-		if p.current.Type == constants.TokenLeftParen {
-			// Args form: |pipe(lit, lit, ...): predicate
-			p.advance() // consume '('
-			for p.current.Type != constants.TokenRightParen && p.current.Type != constants.TokenEOF {
-				switch p.current.Type {
-				case constants.TokenNumber:
-					args = append(args, p.current.Value.Num)
-					p.advance()
-				case constants.TokenString:
-					args = append(args, p.current.Value.Str)
-					p.advance()
-				case constants.TokenBoolean:
-					args = append(args, p.current.Value.Bool)
-					p.advance()
-				case constants.TokenNull:
-					args = append(args, nil)
-					p.advance()
-				default:
-					// ':' or '|' inside args means ')' was never written — report as unclosed
-					if p.current.Type == constants.TokenColon || p.current.Type == constants.TokenPipe {
-						p.addError(errors.ErrUnclosedFunction, "expected ')' to close pipe arguments")
-					} else {
-						p.addError(errors.ErrInvalidArgument, "pipe arguments must be compile-time literals (number, string, bool, or null)")
-					}
-					p.consumeRemainingTokens()
-					return false
-				}
-				if p.current.Type == constants.TokenComma {
-					p.advance() // consume ','
-					// Reject trailing comma
-					if p.current.Type == constants.TokenRightParen {
-						p.addError(errors.ErrInvalidArgument, "trailing comma not allowed in pipe arguments")
-						p.consumeRemainingTokens()
-						return false
-					}
-				}
-			}
-			if p.current.Type != constants.TokenRightParen {
-				p.addError(errors.ErrUnclosedFunction, "expected ')' after pipe arguments")
+		hasArgs := p.current.Type == constants.TokenLeftParen
+		if hasArgs {
+			// Args form: |pipe(expr, expr, ...): predicate
+			var ok bool
+			if args, ok = p.parsePipeArgs(); !ok {
 				return false
 			}
-			p.advance() // consume ')'
-			if p.current.Type != constants.TokenColon {
-				p.addErrorWithExpected(errors.ErrExpectedToken, "expected ':' after pipe arguments", ":")
+		}
+		if p.current.Type == constants.TokenAs {
+			// Header alias: |pipe as $x: predicate, |pipe(args) as $x: predicate
+			p.advance() // consume 'as'
+			if p.current.Type != constants.TokenIdentifier || !strings.HasPrefix(p.current.Token, constants.SymbolDollar) {
+				p.addError(errors.ErrMissingDollarSign, errors.GetErrorMessage(errors.ErrMissingDollarSign))
 				return false
 			}
+			headerAlias = p.current.Token
+			p.advance()
+		}
+		switch {
+		case p.current.Type == constants.TokenColon:
 			p.advance() // consume ':'
-		} else if p.current.Type == constants.TokenColon {
-			p.advance() // consume ':' — standard |name: predicate form
-		} else {
+		case hasArgs && headerAlias == "" && p.atPredicateEnd():
+			// |take(2) without a predicate needs no ':'.
+		case headerAlias != "":
+			p.addErrorWithExpected(errors.ErrExpectedToken, "expected ':' after pipe alias", ":")
+			return false
+		case hasArgs:
+			p.addErrorWithExpected(errors.ErrExpectedToken, "expected ':' after pipe arguments", ":")
+			return false
+		default:
 			p.addErrorWithExpected(errors.ErrExpectedToken, "expected ':' or '(' after pipe name", ":")
 			return false
 		}
@@ -1059,11 +1163,16 @@ func (p *Parser) processPipeSegment(expressions *[]Expression, pipeTypes *[]stri
 		return false
 	}
 
-	nextExpr := p.parseConditional()
-	if nextExpr == nil {
-		p.addError(errors.ErrEmptyPipe, errors.GetErrorMessage(errors.ErrEmptyPipe))
-		p.consumeRemainingTokens()
-		return false
+	// Any pipe may omit its predicate, as in `prices |sum:`. The stage's
+	// Expression is then nil; the compiler evaluates $item in its place and
+	// the pipe's handler decides whether it needs a predicate.
+	var nextExpr Expression
+	if !p.atPredicateEnd() {
+		if nextExpr = p.parseConditional(); nextExpr == nil {
+			p.addError(errors.ErrEmptyPipe, errors.GetErrorMessage(errors.ErrEmptyPipe))
+			p.consumeRemainingTokens()
+			return false
+		}
 	}
 
 	*expressions = append(*expressions, nextExpr)
@@ -1077,6 +1186,13 @@ func (p *Parser) processPipeSegment(expressions *[]Expression, pipeTypes *[]stri
 		}
 		return false
 	}
+	if headerAlias != "" {
+		if alias != "" {
+			p.addError(errors.ErrInvalidAlias, fmt.Sprintf("pipe declares two aliases: %s and %s", headerAlias, alias))
+			return false
+		}
+		alias = headerAlias
+	}
 	*aliases = append(*aliases, alias)
 	return true
 }
@@ -1095,6 +1211,17 @@ func (p *Parser) determinePipeType(op Token) string {
 	return DefaultPipeType
 }
 
+// atPredicateEnd reports whether the current token ends a pipe predicate, so
+// that the predicate is empty.
+func (p *Parser) atPredicateEnd() bool {
+	switch p.current.Type {
+	case constants.TokenEOF, constants.TokenPipe, constants.TokenRightParen,
+		constants.TokenRightBracket, constants.TokenRightBrace, constants.TokenComma:
+		return true
+	}
+	return false
+}
+
 // consumeRemainingTokens consumes all tokens until EOF to prevent further errors
 func (p *Parser) consumeRemainingTokens() {
 	for p.current.Type != constants.TokenEOF {
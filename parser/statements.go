@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"github.com/maniartech/uexl/parser/constants"
+	"github.com/maniartech/uexl/parser/errors"
+)
+
+// ParseStatements parses a multi-statement program: a sequence of
+// `name = expr` assignments, optionally separated by ';'. Statements need no
+// separator at all since an expression can never be followed by `name =`:
+//
+//	subtotal = sum(items |map: $item.price)
+//	discount = subtotal > 100 ? subtotal * 0.1 : 0
+//	total    = subtotal - discount
+//
+// Names must be plain identifiers (no '$'). The parser does not check for
+// duplicates or cycles; that is left to the compiler.
+func (p *Parser) ParseStatements() (*StatementList, error) {
+	list := &StatementList{Line: p.current.Line, Column: p.current.Column}
+
+	for p.current.Type != constants.TokenEOF && len(p.errors) == 0 {
+		if p.current.Type == constants.TokenSemicolon {
+			p.advance()
+			continue
+		}
+		stmt := p.parseAssignment()
+		if stmt == nil {
+			break
+		}
+		list.Statements = append(list.Statements, stmt)
+	}
+
+	if len(p.errors) > 0 {
+		return nil, &errors.ParseErrors{Errors: p.errors}
+	}
+	if len(list.Statements) == 0 {
+		return nil, errors.NewParserError(errors.ErrEmptyExpression, p.current.Line, p.current.Column, constants.MsgEmptyExpression)
+	}
+	return list, nil
+}
+
+// parseAssignment parses one `name = expr` statement.
+func (p *Parser) parseAssignment() *Assignment {
+	if p.current.Type != constants.TokenIdentifier || isPipeVariable(p.current.Value.Str) {
+		p.addErrorWithExpected(errors.ErrExpectedIdentifier, "expected statement of the form name = expression", "identifier")
+		return nil
+	}
+	stmt := &Assignment{Name: p.current.Value.Str, Line: p.current.Line, Column: p.current.Column}
+	p.advance()
+
+	if p.current.Type != constants.TokenOperator || p.current.Value.Str != "=" {
+		p.addErrorWithExpected(errors.ErrExpectedToken, "expected '=' after statement name", "=")
+		return nil
+	}
+	p.advance()
+
+	expr := p.parseExpression()
+	if expr == nil {
+		if len(p.errors) == 0 {
+			p.addError(errors.ErrEmptyExpression, "expected expression after '='")
+		}
+		return nil
+	}
+	stmt.Value = expr
+	return stmt
+}
+
+// isPipeVariable reports whether name is a '$'-prefixed pipe variable.
+func isPipeVariable(name string) bool {
+	return len(name) > 0 && name[0] == '$'
+}
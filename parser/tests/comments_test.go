@@ -0,0 +1,104 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/constants"
+	"github.com/maniartech/uexl/parser/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComments_skippedByParser(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 // trailing", "1 + 2"},
+		{"# leading\n1 + 2", "1 + 2"},
+		{"1 /* inline */ + 2", "1 + 2"},
+		{"a / /*c*/ b", "a / b"},
+		{"a /* multi\nline */ * b", "a * b"},
+		{"[1, // one\n 2 # two\n]", "[1, 2]"},
+		{`"// not a comment" + '# nor this'`, `"// not a comment" + '# nor this'`},
+	}
+	for _, tt := range tests {
+		got, err := parser.ParseString(tt.input)
+		require.NoError(t, err, tt.input)
+		want, err := parser.ParseString(tt.expected)
+		require.NoError(t, err, tt.expected)
+		assert.Equal(t, stripPositions(want), stripPositions(got), tt.input)
+	}
+}
+
+// stripPositions renders a node without positions so comment-bearing and
+// comment-free inputs can be compared structurally.
+func stripPositions(n parser.Node) string {
+	switch v := n.(type) {
+	case *parser.BinaryExpression:
+		return "(" + stripPositions(v.Left) + " " + v.Operator + " " + stripPositions(v.Right) + ")"
+	case *parser.ArrayLiteral:
+		s := "["
+		for i, e := range v.Elements {
+			if i > 0 {
+				s += ","
+			}
+			s += stripPositions(e)
+		}
+		return s + "]"
+	case *parser.NumberLiteral:
+		return "num"
+	case *parser.StringLiteral:
+		return v.Value
+	case *parser.Identifier:
+		return v.Name
+	}
+	return string(n.Type())
+}
+
+func TestComments_positionsAfterComments(t *testing.T) {
+	tok := parser.NewTokenizer("/* a\nb */ x // c\n  y")
+	first, err := tok.NextToken()
+	require.NoError(t, err)
+	assert.Equal(t, "x", first.Token)
+	assert.Equal(t, 2, first.Line)
+	assert.Equal(t, 6, first.Column)
+
+	second, err := tok.NextToken()
+	require.NoError(t, err)
+	assert.Equal(t, "y", second.Token)
+	assert.Equal(t, 3, second.Line)
+	assert.Equal(t, 3, second.Column)
+
+	eof, err := tok.NextToken()
+	require.NoError(t, err)
+	assert.Equal(t, constants.TokenEOF, eof.Type)
+	assert.Empty(t, tok.Comments(), "comments are not retained by default")
+}
+
+func TestComments_preservedAsTrivia(t *testing.T) {
+	node, comments, err := parser.ParseStringWithComments("# head\nx /* mid\n */ + 1 // tail")
+	require.NoError(t, err)
+	require.NotNil(t, node)
+	require.Len(t, comments, 3)
+
+	assert.Equal(t, parser.Comment{Text: "# head", Line: 1, Column: 1, EndLine: 1, EndColumn: 7}, comments[0])
+	assert.Equal(t, parser.Comment{Text: "/* mid\n */", Block: true, Line: 2, Column: 3, EndLine: 3, EndColumn: 4}, comments[1])
+	assert.Equal(t, parser.Comment{Text: "// tail", Line: 3, Column: 9, EndLine: 3, EndColumn: 16}, comments[2])
+}
+
+func TestComments_unterminatedBlock(t *testing.T) {
+	_, err := parser.ParseString("1 + /* never closed")
+	require.Error(t, err)
+	pe, ok := err.(*errors.ParseErrors)
+	require.True(t, ok, "expected *errors.ParseErrors, got %T", err)
+	assert.Equal(t, errors.ErrUnterminatedComment, pe.Errors[0].Code)
+	assert.Equal(t, 1, pe.Errors[0].Line)
+	assert.Equal(t, 5, pe.Errors[0].Column)
+}
+
+func TestComments_onlyCommentsIsEmptyExpression(t *testing.T) {
+	_, err := parser.ParseString("// nothing here")
+	assert.Error(t, err)
+}
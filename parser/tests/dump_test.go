@@ -0,0 +1,43 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	node, err := parser.ParseString(`-a?.b[1:] ?? (c ? [true, null] : 1..<n step 2) is number`)
+	require.NoError(t, err)
+	assert.Equal(t, `TypeExpression Operator="is" TypeName="number" @1:48
+  Operand: BinaryExpression Operator="??" @1:11
+    Left: UnaryExpression Operator="-" @1:1
+      Operand: SliceExpression @1:6
+        Target: MemberAccess Property="b" Optional=true @1:3
+          Target: Identifier Name="a" @1:2
+        Start: NumberLiteral Value=1 @1:7
+    Right: GroupedExpression @1:14
+      Expression: ConditionalExpression @1:17
+        Condition: Identifier Name="c" @1:15
+        Consequent: ArrayLiteral @1:19
+          Elements[0]: BooleanLiteral Value=true @1:20
+          Elements[1]: NullLiteral @1:26
+        Alternate: RangeExpression Exclusive=true @1:35
+          Start: NumberLiteral Value=1 @1:34
+          End: Identifier Name="n" @1:38
+          Step: NumberLiteral Value=2 @1:45
+`, parser.Dump(node))
+
+	node, err = parser.ParseString(`xs |take(2) as $t: {"k": $t}`)
+	require.NoError(t, err)
+	assert.Equal(t, `Program @1:1
+  PipeExpressions[0]: PipeExpression PipeType="pipe" @1:1
+    Expression: Identifier Name="xs" @1:1
+  PipeExpressions[1]: PipeExpression PipeType="take" Alias="$t" Index=1 @1:1
+    Expression: ObjectLiteral @1:20
+      Properties["k"]: Identifier Name="$t" @1:26
+    ArgExprs[0]: NumberLiteral Value=2 @1:10
+`, parser.Dump(node))
+}
@@ -292,7 +292,7 @@ func TestIdentifierTokenization(t *testing.T) {
 			description: "Dot notation with number should be separate tokens (0 then .)",
 		},
 
-		// Invalid dot patterns (tokenized correctly but should cause parsing errors)
+		// Double dots are the range operator
 		{
 			name:  "Double dot",
 			input: "obj..prop",
@@ -301,11 +301,10 @@ func TestIdentifierTokenization(t *testing.T) {
 				tokenType constants.TokenType
 			}{
 				{"obj", constants.TokenIdentifier},
-				{".", constants.TokenDot},
-				{".", constants.TokenDot},
+				{"..", constants.TokenRange},
 				{"prop", constants.TokenIdentifier},
 			},
-			description: "Double dots tokenized correctly (but invalid syntax)",
+			description: "Double dots tokenize as the range operator",
 		},
 		{
 			name:  "Trailing dot",
@@ -340,12 +339,11 @@ func TestIdentifierTokenization(t *testing.T) {
 				tokenType constants.TokenType
 			}{
 				{"obj", constants.TokenIdentifier},
-				{".", constants.TokenDot},
-				{".", constants.TokenDot},
+				{"..", constants.TokenRange},
 				{".", constants.TokenDot},
 				{"prop", constants.TokenIdentifier},
 			},
-			description: "Three consecutive dots should be separate tokens",
+			description: "Three consecutive dots are a range operator followed by a dot",
 		},
 		{
 			name:  "Dot at start of expression",
@@ -371,13 +369,12 @@ func TestIdentifierTokenization(t *testing.T) {
 				{"obj", constants.TokenIdentifier},
 				{".", constants.TokenDot},
 				{"prop", constants.TokenIdentifier},
-				{".", constants.TokenDot},
-				{".", constants.TokenDot},
+				{"..", constants.TokenRange},
 				{"method", constants.TokenIdentifier},
 				{".", constants.TokenDot},
 				{"name", constants.TokenIdentifier},
 			},
-			description: "Mixed valid and invalid dot patterns should be separate tokens",
+			description: "Member dots and range dots are distinct tokens",
 		},
 
 		// Edge cases that should work
@@ -751,11 +748,6 @@ func TestIdentifierParsingErrors(t *testing.T) {
 		input       string
 		description string
 	}{
-		{
-			name:        "Double dot",
-			input:       "obj..prop",
-			description: "Double dots should cause parsing error",
-		},
 		{
 			name:        "Triple dot",
 			input:       "obj...prop",
@@ -771,11 +763,6 @@ func TestIdentifierParsingErrors(t *testing.T) {
 			input:       ".prop",
 			description: "Leading dot should cause parsing error",
 		},
-		{
-			name:        "Double dot in middle",
-			input:       "obj.prop..method",
-			description: "Double dot in middle should cause parsing error",
-		},
 		{
 			name:        "Multiple consecutive dots",
 			input:       "obj....prop",
@@ -841,8 +828,8 @@ func TestIdentifierSyntaxValidation(t *testing.T) {
 		{
 			name:        "Double dot",
 			input:       "obj..prop",
-			shouldError: true,
-			description: "Double dots should cause parsing error",
+			shouldError: false,
+			description: "Double dots are a range between two values",
 		},
 		{
 			name:        "Trailing dot",
@@ -863,10 +850,10 @@ func TestIdentifierSyntaxValidation(t *testing.T) {
 			description: "Dot followed by number is valid index access now",
 		},
 		{
-			name:        "Mixed invalid pattern",
+			name:        "Member access range",
 			input:       "obj.prop..method",
-			shouldError: true,
-			description: "Mixed valid and invalid patterns should cause parsing error",
+			shouldError: false,
+			description: "Range between two member accesses",
 		},
 	}
 
@@ -0,0 +1,120 @@
+package parser_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeJSON_Golden(t *testing.T) {
+	node, err := parser.ParseString(`a.b[0] + f('x')`)
+	require.NoError(t, err)
+	data, err := json.Marshal(node)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "BinaryExpression", "operator": "+", "line": 1, "column": 8,
+		"left": {
+			"type": "IndexAccess", "line": 1, "column": 4,
+			"target": {
+				"type": "MemberAccess", "property": "b", "line": 1, "column": 2,
+				"target": {"type": "Identifier", "name": "a", "line": 1, "column": 1}
+			},
+			"index": {"type": "NumberLiteral", "value": 0, "line": 1, "column": 5}
+		},
+		"right": {
+			"type": "FunctionCall", "line": 1, "column": 11,
+			"function": {"type": "Identifier", "name": "f", "line": 1, "column": 10},
+			"arguments": [
+				{"type": "StringLiteral", "value": "x", "token": "'x'", "singleQuoted": true, "line": 1, "column": 12}
+			]
+		}
+	}`, string(data))
+}
+
+func TestNodeJSON_RoundTrip(t *testing.T) {
+	sources := []string{
+		`-a?.b[1:] ?? (c ? [true, null] : 1..<n step 2) is number`,
+		`xs as $xs |window(2, "x") as $w: {"first": $w[0], "n": len($xs)} |: $item.first`,
+		`a.0.1 + a.(i)?[j] + s[::2] + (x as string)`,
+		`NaN + Inf + -Inf + 1.5e-300 + r'\d+' + ~a ~ b`,
+		`f(g(1)(2), [], {})`,
+	}
+	for _, src := range sources {
+		t.Run(src, func(t *testing.T) {
+			node, err := parser.ParseString(src)
+			require.NoError(t, err)
+			data, err := json.Marshal(node)
+			require.NoError(t, err)
+			decoded, err := parser.UnmarshalNode(data)
+			require.NoError(t, err)
+			assert.Equal(t, parser.Dump(node), parser.Dump(decoded))
+
+			again, err := json.Marshal(decoded)
+			require.NoError(t, err)
+			assert.Equal(t, string(data), string(again), "encoding is not stable")
+		})
+	}
+}
+
+func TestNodeJSON_Program(t *testing.T) {
+	list, err := parser.ParseProgram("total = sum(xs)\ndouble = total * 2")
+	require.NoError(t, err)
+	data, err := json.Marshal(list)
+	require.NoError(t, err)
+	decoded, err := parser.UnmarshalNode(data)
+	require.NoError(t, err)
+	assert.Equal(t, parser.Dump(list), parser.Dump(decoded))
+}
+
+func TestNodeJSON_PipeArgs(t *testing.T) {
+	node, err := parser.ParseString(`xs |take(2): $item`)
+	require.NoError(t, err)
+	data, err := json.Marshal(node)
+	require.NoError(t, err)
+	decoded, err := parser.UnmarshalNode(data)
+	require.NoError(t, err)
+	stage := decoded.(*parser.ProgramNode).PipeExpressions[1]
+	assert.Equal(t, []any{2.0}, stage.Args, "literal args are restored")
+
+	// A stage without a predicate round-trips with a nil Expression.
+	node, err = parser.ParseString(`xs |take(2)`)
+	require.NoError(t, err)
+	data, err = json.Marshal(node)
+	require.NoError(t, err)
+	decoded, err = parser.UnmarshalNode(data)
+	require.NoError(t, err)
+	assert.Equal(t, parser.Dump(node), parser.Dump(decoded))
+	assert.Nil(t, decoded.(*parser.ProgramNode).PipeExpressions[1].Expression)
+}
+
+func TestNodeJSON_Numbers(t *testing.T) {
+	decoded, err := parser.UnmarshalNode([]byte(`{"type": "NumberLiteral", "value": "NaN"}`))
+	require.NoError(t, err)
+	assert.True(t, math.IsNaN(decoded.(*parser.NumberLiteral).Value))
+}
+
+func TestNodeJSON_Errors(t *testing.T) {
+	tests := []struct{ name, json, err string }{
+		{"not json", `{`, "unexpected end of JSON input"},
+		{"unknown type", `{"type": "Loop"}`, `unknown node type "Loop"`},
+		{"missing type", `{"name": "x"}`, `.type: missing field`},
+		{"missing child", `{"type": "UnaryExpression", "operator": "-"}`, "UnaryExpression.operand: missing expression"},
+		{"bad field", `{"type": "Identifier", "name": 1}`, "Identifier.name: json: cannot unmarshal number"},
+		{"nested", `{"type": "ArrayLiteral", "elements": [{"type": "Identifier"}]}`, "Identifier.name: missing field"},
+		{"statement as expression", `{"type": "GroupedExpression", "expression": {"type": "Assignment", "name": "a", "value": {"type": "NullLiteral"}}}`,
+			"GroupedExpression.expression: Assignment is not an expression"},
+		{"bad stage", `{"type": "Program", "pipeExpressions": [{"type": "NullLiteral"}]}`, "expected PipeExpression nodes"},
+		{"bad number", `{"type": "NumberLiteral", "value": "ten"}`, `invalid number "ten"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.UnmarshalNode([]byte(tt.json))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
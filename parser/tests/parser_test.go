@@ -283,8 +283,7 @@ func TestEmptyPipeExpressions(t *testing.T) {
 		expectedErr string
 	}{
 		{"|: x + 1", "empty pipe expression is not allowed"},
-		{"x + 1 |: |map: y + 2", "empty pipe expression is not allowed"},
-		{"x + 1 |map:", "empty pipe expression is not allowed"},
+		{"x + 1 |map: )", "unexpected token"},
 	}
 
 	for _, tt := range tests {
@@ -298,6 +297,100 @@ func TestEmptyPipeExpressions(t *testing.T) {
 	}
 }
 
+// TestPipeHeaderAlias covers aliases declared in the pipe header, |map as $x:.
+func TestPipeHeaderAlias(t *testing.T) {
+	tests := []struct {
+		input string
+		alias string // alias of the second pipe expression
+	}{
+		{"orders |map as $o: $o.total", "$o"},
+		{"orders | map  as  $o : $o.total", "$o"},
+		{"orders |reduce(0) as $n: $acc + $n", "$n"},
+		{"orders |filter as $o: $o.paid |map: $item.id", "$o"},
+		{"orders |map: $item.total as $o", "$o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ast, err := parser.NewParser(tt.input).Parse()
+			assert.NoError(t, err)
+			program, ok := ast.(*parser.ProgramNode)
+			if assert.True(t, ok) {
+				assert.Equal(t, tt.alias, program.PipeExpressions[1].Alias)
+			}
+		})
+	}
+
+	// "| map as $o" without a ':' is still a bitwise OR followed by an alias
+	ast, err := parser.NewParser("a | map as $o |: $o").Parse()
+	assert.NoError(t, err)
+	program := ast.(*parser.ProgramNode)
+	assert.IsType(t, &parser.BinaryExpression{}, program.PipeExpressions[0].Expression)
+	assert.Equal(t, "$o", program.PipeExpressions[0].Alias)
+
+	for input, wantErr := range map[string]string{
+		"x |map as o: o":           "expected identifier starting with $",
+		"x |map as $a: $a as $b":   "pipe declares two aliases: $a and $b",
+		"x |take(1) as $a $a":      "expected ':' after pipe alias",
+		"x |map as $a: ($a as $b)": "aliases cannot be used in sub-expressions",
+	} {
+		_, err := parser.NewParser(input).Parse()
+		if assert.Error(t, err, input) {
+			assert.Contains(t, err.Error(), wantErr, input)
+		}
+	}
+}
+
+// TestNestedPipes checks that pipes and aliases followed by a pipe parse in
+// sub-expressions.
+func TestNestedPipes(t *testing.T) {
+	for _, input := range []string{
+		"orders |map as $o: ($o.lines |filter: $item.sku == $o.sku)",
+		"orders |map: ($item.lines as $lines |map: $item.qty / len($lines))",
+		"orders |map: [($item.lines |sum: $item.qty), $parent]",
+		"f(xs |map: $item * 2, ys as $y |filter: $item > 1)",
+		`{"total": items |sum: $item}`,
+	} {
+		_, err := parser.NewParser(input).Parse()
+		assert.NoError(t, err, input)
+	}
+}
+
+// TestOptionalPredicatePipes ensures any pipe may omit its predicate, leaving
+// the stage's Expression nil, and that a pipe with arguments then needs no ':'.
+func TestOptionalPredicatePipes(t *testing.T) {
+	for _, input := range []string{
+		"xs |sum:", "xs |avg: |map: $item", "(xs |min:) + 1", "[xs |max:, 1]", `{"n": xs |count:}`,
+		"x + 1 |map:", "x + 1 |: |map: y + 2", "xs |sort as $s:",
+		"xs |take(2)", "xs |take(2):", "xs |skip(1) |map: $item", "f(xs |take(n), 1)",
+	} {
+		t.Run(input, func(t *testing.T) {
+			node, err := parser.ParseString(input)
+			assert.NoError(t, err)
+			var found bool
+			parser.Inspect(node, func(n parser.Node) bool {
+				if pe, ok := n.(*parser.PipeExpression); ok && pe.Index == 1 {
+					found = pe.Expression == nil
+				}
+				return true
+			})
+			assert.True(t, found, "predicate of the first stage should be omitted")
+		})
+	}
+	for input, msg := range map[string]string{
+		"xs |sum: as $x":    "empty pipe expression cannot have an alias",
+		"xs |take(2) as $x": "expected ':' after pipe alias",
+		"xs |take(2) $item": "expected ':' after pipe arguments",
+		"xs |sum":           "", // a bitwise or, not a pipe
+	} {
+		_, err := parser.ParseString(input)
+		if msg == "" {
+			assert.NoError(t, err, input)
+		} else {
+			assert.ErrorContains(t, err, msg, input)
+		}
+	}
+}
+
 // TestEmptyPipeWithAlias ensures empty pipe expressions cannot have aliases
 func TestEmptyPipeWithAlias(t *testing.T) {
 	tests := []struct {
@@ -131,12 +131,8 @@ func TestPipeParams_ParseErrors(t *testing.T) {
 		errCode errors.ErrorCode
 		desc    string
 	}{
-		// Variable reference not allowed in args
-		{`arr |window($x): $window`, errors.ErrInvalidArgument, "variable reference not allowed"},
-		// Expression not allowed
-		{`arr |window(1+2): $window`, errors.ErrInvalidArgument, "arithmetic expression not allowed"},
-		// Function call not allowed
-		{`arr |window(len(x)): $window`, errors.ErrInvalidArgument, "function call not allowed"},
+		// Empty argument
+		{`arr |window(,3): $window`, errors.ErrUnexpectedToken, "empty argument"},
 		// Missing closing paren
 		{`arr |window(3: $window`, errors.ErrUnclosedFunction, "missing closing paren"},
 		// Missing colon after closing paren
@@ -153,6 +149,44 @@ func TestPipeParams_ParseErrors(t *testing.T) {
 	}
 }
 
+// TestPipeParams_ExpressionArgs verifies that non-literal args are kept as
+// expressions (ArgExprs) and leave Args nil, so the compiler evaluates them at runtime.
+func TestPipeParams_ExpressionArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantArgs []string // node types of ArgExprs
+	}{
+		{`arr |window($x): $window`, []string{"Identifier"}},
+		{`arr |window(1+2): $window`, []string{"BinaryExpression"}},
+		{`arr |window(len(x)): $window`, []string{"FunctionCall"}},
+		{`arr |chunk(config.batch): $chunk`, []string{"MemberAccess"}},
+		{`arr |myPipe(3, size ?? 10): $item`, []string{"NumberLiteral", "BinaryExpression"}},
+		// Like function arguments, pipe args may contain pipes of their own.
+		{`arr |myPipe(x |map: $item): $item`, []string{"Program"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.input, func(t *testing.T) {
+			pipes, err := parsePipeArgs(t, tt.input)
+			assert.NoError(t, err)
+			assert.Len(t, pipes, 2)
+			assert.Nil(t, pipes[1].Args, "non-literal args must not be folded into Args")
+			var got []string
+			for _, arg := range pipes[1].ArgExprs {
+				got = append(got, string(arg.Type()))
+			}
+			assert.Equal(t, tt.wantArgs, got)
+		})
+	}
+
+	// Literal-only args are available both ways.
+	pipes, err := parsePipeArgs(t, `arr |window(3): $window`)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{float64(3)}, pipes[1].Args)
+	assert.Len(t, pipes[1].ArgExprs, 1)
+}
+
 // TestPipeParams_DefaultPipe verifies that |: syntax is unaffected by the args feature.
 func TestPipeParams_DefaultPipe(t *testing.T) {
 	// Compact form
@@ -0,0 +1,78 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRange_parse(t *testing.T) {
+	node, err := parser.ParseString("1..10")
+	require.NoError(t, err)
+	rng, ok := node.(*parser.RangeExpression)
+	require.True(t, ok, "got %T", node)
+	assert.False(t, rng.Exclusive)
+	assert.Nil(t, rng.Step)
+	assert.Equal(t, 1.0, rng.Start.(*parser.NumberLiteral).Value)
+	assert.Equal(t, 10.0, rng.End.(*parser.NumberLiteral).Value)
+	assert.Equal(t, 1, rng.Line)
+	assert.Equal(t, 2, rng.Column)
+
+	node, err = parser.ParseString("0..<n")
+	require.NoError(t, err)
+	rng = node.(*parser.RangeExpression)
+	assert.True(t, rng.Exclusive)
+	assert.Equal(t, "n", rng.End.(*parser.Identifier).Name)
+
+	node, err = parser.ParseString("0..100 step 5")
+	require.NoError(t, err)
+	rng = node.(*parser.RangeExpression)
+	assert.Equal(t, 5.0, rng.Step.(*parser.NumberLiteral).Value)
+}
+
+func TestRange_precedence(t *testing.T) {
+	// Arithmetic binds tighter than '..'; comparison binds looser.
+	node, err := parser.ParseString("a + 1..b * 2")
+	require.NoError(t, err)
+	rng, ok := node.(*parser.RangeExpression)
+	require.True(t, ok, "got %T", node)
+	assert.IsType(t, &parser.BinaryExpression{}, rng.Start)
+	assert.IsType(t, &parser.BinaryExpression{}, rng.End)
+
+	node, err = parser.ParseString("1..n |map: $item * 2")
+	require.NoError(t, err)
+	prog, ok := node.(*parser.ProgramNode)
+	require.True(t, ok, "got %T", node)
+	assert.IsType(t, &parser.RangeExpression{}, prog.PipeExpressions[0].Expression)
+
+	node, err = parser.ParseString("len(1..3) == 3")
+	require.NoError(t, err)
+	assert.IsType(t, &parser.BinaryExpression{}, node)
+}
+
+func TestRange_stepIsContextual(t *testing.T) {
+	node, err := parser.ParseString("step + 1")
+	require.NoError(t, err)
+	assert.IsType(t, &parser.BinaryExpression{}, node)
+}
+
+func TestRange_errors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  errors.ErrorCode
+	}{
+		{"1..2..3", errors.ErrInvalidOperator},
+		{"1..", errors.ErrUnexpectedToken},
+		{"1..5 step", errors.ErrUnexpectedToken},
+	}
+	for _, tt := range tests {
+		_, err := parser.ParseString(tt.input)
+		require.Error(t, err, tt.input)
+		pe, ok := err.(*errors.ParseErrors)
+		require.True(t, ok, "got %T", err)
+		assert.Equal(t, tt.code, pe.Errors[0].Code, tt.input)
+	}
+}
@@ -0,0 +1,65 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProgram_statements(t *testing.T) {
+	src := "subtotal = price * qty // line comment\n" +
+		"discount = subtotal > 100 ? subtotal * 0.1 : 0; total = subtotal - discount\n" +
+		"names = items |map: $item.name"
+	list, err := parser.ParseProgram(src)
+	require.NoError(t, err)
+	require.Len(t, list.Statements, 4)
+
+	names := make([]string, len(list.Statements))
+	for i, s := range list.Statements {
+		names[i] = s.Name
+	}
+	assert.Equal(t, []string{"subtotal", "discount", "total", "names"}, names)
+
+	assert.Equal(t, 2, list.Statements[1].Line)
+	assert.Equal(t, 1, list.Statements[1].Column)
+	assert.Equal(t, 2, list.Statements[2].Line)
+	assert.Equal(t, 49, list.Statements[2].Column)
+	assert.IsType(t, &parser.ConditionalExpression{}, list.Statements[1].Value)
+	assert.IsType(t, &parser.ProgramNode{}, list.Statements[3].Value)
+}
+
+func TestParseProgram_singleLineWithoutSeparators(t *testing.T) {
+	list, err := parser.ParseProgram("a = 1 b = a + 2")
+	require.NoError(t, err)
+	require.Len(t, list.Statements, 2)
+	assert.Equal(t, "b", list.Statements[1].Name)
+}
+
+func TestParseProgram_errors(t *testing.T) {
+	cases := []struct {
+		src  string
+		code errors.ErrorCode
+	}{
+		{"1 + 2", errors.ErrExpectedIdentifier},
+		{"a 1", errors.ErrExpectedToken},
+		{"a == 1", errors.ErrExpectedToken},
+		{"$a = 1", errors.ErrExpectedIdentifier},
+		{"a = ", errors.ErrUnexpectedToken},
+		{"a = 1 + ", errors.ErrUnexpectedToken},
+	}
+	for _, tc := range cases {
+		_, err := parser.ParseProgram(tc.src)
+		require.Error(t, err, tc.src)
+		pe, ok := err.(*errors.ParseErrors)
+		require.True(t, ok, "%q: expected *errors.ParseErrors, got %T (%v)", tc.src, err, err)
+		assert.Equal(t, tc.code, pe.Errors[0].Code, "%q: %v", tc.src, err)
+	}
+}
+
+func TestParseProgram_empty(t *testing.T) {
+	_, err := parser.ParseProgram("  // nothing\n ;; ")
+	assert.Error(t, err)
+}
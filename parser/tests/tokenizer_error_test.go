@@ -85,8 +85,8 @@ func TestTokenizerErrorIntegrationWithParser(t *testing.T) {
 	}{
 		{
 			name:          "consecutive dots in parser",
-			input:         "a..b + 1",
-			expectedError: errors.ErrExpectedIdentifier,
+			input:         "a...b + 1",
+			expectedError: errors.ErrUnexpectedToken,
 			description:   "parser should catch consecutive dots error from tokenizer",
 		},
 		{
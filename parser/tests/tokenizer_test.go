@@ -83,3 +83,14 @@ func TestTokenizerBasic(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizer_ColumnsAfterNonASCIIStrings(t *testing.T) {
+	// Columns count runes, inside string literals too.
+	tokens := NewTokenizer(`"héllo" + r'日本' + "é\"" + x`).PreloadTokens()
+	want := []int{1, 9, 11, 17, 19, 25, 27}
+	for i, col := range want {
+		if tokens[i].Column != col {
+			t.Errorf("token %d (%s): column = %d, want %d", i, tokens[i].Token, tokens[i].Column, col)
+		}
+	}
+}
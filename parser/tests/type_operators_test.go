@@ -0,0 +1,63 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/parser/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeOperators_parse(t *testing.T) {
+	node, err := parser.ParseString("x is number")
+	require.NoError(t, err)
+	te, ok := node.(*parser.TypeExpression)
+	require.True(t, ok, "got %T", node)
+	assert.Equal(t, "is", te.Operator)
+	assert.Equal(t, "number", te.TypeName)
+	assert.Equal(t, 1, te.Line)
+	assert.Equal(t, 3, te.Column)
+
+	node, err = parser.ParseString("a + b as string == c")
+	require.NoError(t, err)
+	eq, ok := node.(*parser.BinaryExpression)
+	require.True(t, ok, "got %T", node)
+	assert.Equal(t, "==", eq.Operator)
+	conv, ok := eq.Left.(*parser.TypeExpression)
+	require.True(t, ok, "got %T", eq.Left)
+	assert.Equal(t, "as", conv.Operator)
+	assert.IsType(t, &parser.BinaryExpression{}, conv.Operand)
+
+	node, err = parser.ParseString("x is null")
+	require.NoError(t, err)
+	assert.Equal(t, "null", node.(*parser.TypeExpression).TypeName)
+}
+
+func TestTypeOperators_pipeAliasStillWorks(t *testing.T) {
+	node, err := parser.ParseString("[1, 2] as $nums |map: $item as number")
+	require.NoError(t, err)
+	prog, ok := node.(*parser.ProgramNode)
+	require.True(t, ok, "got %T", node)
+	assert.Equal(t, "$nums", prog.PipeExpressions[0].Alias)
+	assert.IsType(t, &parser.TypeExpression{}, prog.PipeExpressions[1].Expression)
+}
+
+func TestTypeOperators_isIsContextual(t *testing.T) {
+	// "is" not followed by a type name stays an ordinary identifier.
+	node, err := parser.ParseString("is + 1")
+	require.NoError(t, err)
+	assert.IsType(t, &parser.BinaryExpression{}, node)
+}
+
+func TestTypeOperators_errors(t *testing.T) {
+	_, err := parser.ParseString("x as array")
+	require.Error(t, err)
+	pe, ok := err.(*errors.ParseErrors)
+	require.True(t, ok, "got %T", err)
+	assert.Equal(t, errors.ErrInvalidTypeName, pe.Errors[0].Code)
+
+	// Unknown type names fall through to pipe-alias handling.
+	_, err = parser.ParseString("x as foo")
+	require.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect_Order(t *testing.T) {
+	node, err := parser.ParseString(`xs |take(n): f($item.price, {"b": y, "a": x}) ?? -1`)
+	require.NoError(t, err)
+
+	var names []string
+	parser.Inspect(node, func(n parser.Node) bool {
+		if id, ok := n.(*parser.Identifier); ok {
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	// Pipe arguments come before the predicate; object values in key order.
+	assert.Equal(t, []string{"xs", "n", "f", "$item", "x", "y"}, names)
+}
+
+func TestInspect_Prune(t *testing.T) {
+	node, err := parser.ParseString(`f(a) + g(b)`)
+	require.NoError(t, err)
+
+	var types []parser.NodeType
+	parser.Inspect(node, func(n parser.Node) bool {
+		if n == nil {
+			return false
+		}
+		types = append(types, n.Type())
+		return n.Type() != parser.NodeTypeFunctionCall
+	})
+	assert.Equal(t, []parser.NodeType{parser.NodeTypeBinaryExpression, parser.NodeTypeFunctionCall, parser.NodeTypeFunctionCall}, types)
+}
+
+// depthVisitor records the depth of every node; Visit(nil) closes a level.
+type depthVisitor struct {
+	depth  int
+	depths *[]int
+}
+
+func (v depthVisitor) Visit(n parser.Node) parser.Visitor {
+	if n == nil {
+		return nil
+	}
+	*v.depths = append(*v.depths, v.depth)
+	return depthVisitor{v.depth + 1, v.depths}
+}
+
+func TestWalk(t *testing.T) {
+	list, err := parser.ParseProgram("a = x[1:]\nb = a |map: $item")
+	require.NoError(t, err)
+	var depths []int
+	parser.Walk(depthVisitor{depths: &depths}, list)
+	// StatementList, Assignment, Slice, x, 1, Assignment, Program, stage, a, stage, $item
+	assert.Equal(t, []int{0, 1, 2, 3, 3, 1, 2, 3, 4, 3, 4}, depths)
+}
+
+func TestRewrite(t *testing.T) {
+	node, err := parser.ParseString(`qty * price |map: round($item, digits) + rate`)
+	require.NoError(t, err)
+
+	got := parser.Rewrite(node, func(n parser.Node) parser.Node {
+		switch n := n.(type) {
+		case *parser.Identifier:
+			switch n.Name {
+			case "qty":
+				n.Name = "quantity" // rename a variable
+			case "round":
+				n.Name = "roundTo" // swap a function
+			case "rate":
+				return &parser.NumberLiteral{Value: 0.2} // inline a constant
+			}
+		}
+		return n
+	})
+
+	var names []string
+	var numbers []float64
+	parser.Inspect(got, func(n parser.Node) bool {
+		switch n := n.(type) {
+		case *parser.Identifier:
+			names = append(names, n.Name)
+		case *parser.NumberLiteral:
+			numbers = append(numbers, n.Value)
+		}
+		return true
+	})
+	assert.Equal(t, []string{"quantity", "price", "roundTo", "$item", "digits"}, names)
+	assert.Equal(t, []float64{0.2}, numbers)
+}
+
+func TestRewrite_ReplaceRoot(t *testing.T) {
+	node, err := parser.ParseString(`(1 + 2)`)
+	require.NoError(t, err)
+	got := parser.Rewrite(node, func(n parser.Node) parser.Node {
+		if g, ok := n.(*parser.GroupedExpression); ok {
+			return g.Expression
+		}
+		return n
+	})
+	assert.Equal(t, parser.NodeTypeBinaryExpression, got.Type())
+}
+
+func TestRewrite_PipeArgs(t *testing.T) {
+	node, err := parser.ParseString(`xs |take(n): $item`)
+	require.NoError(t, err)
+	parser.Rewrite(node, func(n parser.Node) parser.Node {
+		if id, ok := n.(*parser.Identifier); ok && id.Name == "n" {
+			return &parser.NumberLiteral{Value: 3}
+		}
+		return n
+	})
+	stage := node.(*parser.ProgramNode).PipeExpressions[1]
+	assert.Equal(t, []any{3.0}, stage.Args, "literal args are recomputed")
+}
+
+func TestRewrite_InvalidReplacement(t *testing.T) {
+	node, err := parser.ParseString(`a + b`)
+	require.NoError(t, err)
+	assert.PanicsWithValue(t, "parser.Rewrite: *parser.Identifier replaced by *parser.Assignment, which is not an expression", func() {
+		parser.Rewrite(node, func(n parser.Node) parser.Node {
+			if _, ok := n.(*parser.Identifier); ok {
+				return &parser.Assignment{Name: "x"}
+			}
+			return n
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -65,6 +66,20 @@ type Tokenizer struct {
 	strBuf []byte
 	// options for feature flags
 	options Options
+	// comments collected as trivia when options.PreserveComments is set
+	comments []Comment
+}
+
+// Comment is a source comment skipped by the tokenizer. Comments are only
+// collected when Options.PreserveComments is enabled, so that tools such as
+// formatters can re-attach them by position.
+type Comment struct {
+	Text      string // raw comment text including its markers ("// x", "# x", "/* x */")
+	Block     bool   // true for /* ... */ comments
+	Line      int    // position of the first marker character
+	Column    int
+	EndLine   int // position just past the comment
+	EndColumn int
 }
 
 func (t Token) String() string {
@@ -90,7 +105,9 @@ func NewTokenizerWithOptions(input string, opt Options) *Tokenizer {
 }
 
 func (t *Tokenizer) NextToken() (Token, error) {
-	t.skipWhitespace()
+	if err := t.skipWhitespace(); err != nil {
+		return Token{}, err
+	}
 
 	if t.pos >= len(t.input) {
 		return Token{Type: constants.TokenEOF, Line: t.line, Column: t.column}, nil
@@ -125,9 +142,14 @@ func (t *Tokenizer) NextToken() (Token, error) {
 	case ch == ',':
 		return t.singleCharToken(constants.TokenComma)
 	case ch == '.':
+		if t.peek() == '.' {
+			return t.readRange()
+		}
 		return t.singleCharToken(constants.TokenDot)
 	case ch == ':':
 		return t.singleCharToken(constants.TokenColon)
+	case ch == ';':
+		return t.singleCharToken(constants.TokenSemicolon)
 	case ch == '?':
 		return t.readQuestionOrNullish()
 	case ch == '|':
@@ -382,8 +404,8 @@ func (t *Tokenizer) readString() (Token, error) {
 				if t.input[t.pos] == '\n' {
 					t.line++
 					t.column = 1
-				} else {
-					t.column++
+				} else if utf8.RuneStart(t.input[t.pos]) {
+					t.column++ // columns count runes, not bytes
 				}
 				t.pos++
 			}
@@ -398,7 +420,7 @@ func (t *Tokenizer) readString() (Token, error) {
 					if t.input[t.pos] == '\n' {
 						t.line++
 						t.column = 1
-					} else {
+					} else if utf8.RuneStart(t.input[t.pos]) {
 						t.column++
 					}
 					t.pos++
@@ -407,7 +429,7 @@ func (t *Tokenizer) readString() (Token, error) {
 				if t.input[t.pos] == '\n' {
 					t.line++
 					t.column = 1
-				} else {
+				} else if utf8.RuneStart(t.input[t.pos]) {
 					t.column++
 				}
 				t.pos++
@@ -494,20 +516,7 @@ func (t *Tokenizer) readPipeOrBitwiseOr() (Token, error) {
 	// Lookahead using string index (does not advance t.pos) to skip optional whitespace
 	// and identify whether this '|' is a pipe operator or a bitwise OR.
 	s := t.input
-	i := t.pos
-	for i < len(s) {
-		c := s[i]
-		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
-			i++
-			continue
-		}
-		r, size := utf8.DecodeRuneInString(s[i:])
-		if r != utf8.RuneError && unicode.IsSpace(r) {
-			i += size
-			continue
-		}
-		break
-	}
+	i := skipSpaces(s, t.pos)
 	// i now points to the first non-whitespace character after '|'.
 
 	if i >= len(s) {
@@ -548,22 +557,13 @@ func (t *Tokenizer) readPipeOrBitwiseOr() (Token, error) {
 		//   "|map:"  == "|map :"  == "| map :"
 		//   "|window(3):" == "|window (3):" == "| window ( 3 ):"
 		// Both ':' and '(' are left unconsumed for the parser to disambiguate.
-		j := nameEnd
-		for j < len(s) {
-			c := s[j]
-			if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
-				j++
-				continue
-			}
-			r, size := utf8.DecodeRuneInString(s[j:])
-			if r != utf8.RuneError && unicode.IsSpace(r) {
-				j += size
-				continue
-			}
-			break
-		}
+		j := skipSpaces(s, nameEnd)
 
-		if j < len(s) && (s[j] == ':' || s[j] == '(') {
+		// "|map as $o:" declares an alias in the pipe header; 'as' is left for
+		// the parser. Without the trailing ':' it is "| map as $o", a bitwise OR.
+		isHeaderAlias := j < len(s) && isHeaderAliasAt(s, j)
+
+		if j < len(s) && (s[j] == ':' || s[j] == '(' || isHeaderAlias) {
 			// Advance t.pos past leading whitespace + name + trailing whitespace.
 			// Leave ':' or '(' unconsumed for the parser.
 			for t.pos < j {
@@ -713,6 +713,19 @@ func (t *Tokenizer) readOperator() (Token, error) {
 	return Token{Type: constants.TokenOperator, Value: TokenValue{Kind: TVKOperator, Str: operator}, Token: operator, Line: t.line, Column: startColumn}, nil
 }
 
+// readRange reads the range operators '..' and '..<'.
+func (t *Tokenizer) readRange() (Token, error) {
+	line, startColumn := t.line, t.column
+	t.advance()
+	t.advance()
+	op := constants.SymbolRange
+	if t.current() == '<' {
+		t.advance()
+		op = constants.SymbolRangeExcl
+	}
+	return Token{Type: constants.TokenRange, Value: TokenValue{Kind: TVKOperator, Str: op}, Token: op, Line: line, Column: startColumn}, nil
+}
+
 // readQuestionOrNullish handles tokens that start with '?': either '?' or '??'
 func (t *Tokenizer) readQuestionOrNullish() (Token, error) {
 	startColumn := t.column
@@ -782,17 +795,28 @@ func (t *Tokenizer) advance() {
 	t.setCur()
 }
 
-func (t *Tokenizer) skipWhitespace() {
-	// Fast path for common ASCII whitespace
+// skipWhitespace skips whitespace and comments (trivia) before the next token.
+// Line comments start with "//" or "#" and run to the end of the line; block
+// comments are delimited by "/*" and "*/" and may span lines. An unterminated
+// block comment is an error.
+func (t *Tokenizer) skipWhitespace() error {
 	for t.pos < len(t.input) {
-		if t.pos >= len(t.input) {
-			return
-		}
+		// Fast path for common ASCII whitespace
 		c := t.input[t.pos]
 		if c == ' ' || c == '\n' || c == '\t' || c == '\r' {
 			t.advance()
 			continue
 		}
+		if c == '#' || (c == '/' && t.pos+1 < len(t.input) && t.input[t.pos+1] == '/') {
+			t.skipLineComment()
+			continue
+		}
+		if c == '/' && t.pos+1 < len(t.input) && t.input[t.pos+1] == '*' {
+			if err := t.skipBlockComment(); err != nil {
+				return err
+			}
+			continue
+		}
 		// Fallback for non-ASCII spaces
 		if t.current() != 0 && unicode.IsSpace(t.current()) {
 			t.advance()
@@ -800,6 +824,53 @@ func (t *Tokenizer) skipWhitespace() {
 		}
 		break
 	}
+	return nil
+}
+
+// skipLineComment consumes a "//" or "#" comment up to (not including) the newline.
+func (t *Tokenizer) skipLineComment() {
+	start, line, column := t.pos, t.line, t.column
+	for t.pos < len(t.input) && t.input[t.pos] != '\n' {
+		t.advance()
+	}
+	t.recordComment(start, line, column, false)
+}
+
+// skipBlockComment consumes a "/* ... */" comment, tracking newlines for positions.
+func (t *Tokenizer) skipBlockComment() error {
+	start, line, column := t.pos, t.line, t.column
+	t.advance() // '/'
+	t.advance() // '*'
+	for t.pos < len(t.input) {
+		if t.input[t.pos] == '*' && t.pos+1 < len(t.input) && t.input[t.pos+1] == '/' {
+			t.advance()
+			t.advance()
+			t.recordComment(start, line, column, true)
+			return nil
+		}
+		t.advance()
+	}
+	return errors.NewParserError(errors.ErrUnterminatedComment, line, column, errors.GetErrorMessage(errors.ErrUnterminatedComment))
+}
+
+func (t *Tokenizer) recordComment(start, line, column int, block bool) {
+	if !t.options.PreserveComments {
+		return
+	}
+	t.comments = append(t.comments, Comment{
+		Text:      t.input[start:t.pos],
+		Block:     block,
+		Line:      line,
+		Column:    column,
+		EndLine:   t.line,
+		EndColumn: t.column,
+	})
+}
+
+// Comments returns the comments skipped so far. Always empty unless the
+// tokenizer was created with Options.PreserveComments.
+func (t *Tokenizer) Comments() []Comment {
+	return t.comments
 }
 
 func isDigit(r rune) bool {
@@ -815,6 +886,48 @@ func isLetter(r rune) bool {
 	return unicode.IsLetter(r) || r == '_'
 }
 
+// skipSpaces returns the index of the first non-whitespace character of s at
+// or after i.
+func skipSpaces(s string, i int) int {
+	for i < len(s) {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r != utf8.RuneError && unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+		break
+	}
+	return i
+}
+
+// isHeaderAliasAt reports whether s[i:] starts with the alias of a pipe
+// header, `as $name` followed by ':'.
+func isHeaderAliasAt(s string, i int) bool {
+	if !strings.HasPrefix(s[i:], "as") {
+		return false
+	}
+	j := skipSpaces(s, i+2)
+	if j == i+2 || j >= len(s) || s[j] != '$' {
+		return false
+	}
+	j++
+	for j < len(s) {
+		c := s[j]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$' {
+			j++
+			continue
+		}
+		break
+	}
+	j = skipSpaces(s, j)
+	return j < len(s) && s[j] == ':'
+}
+
 func isOperatorChar(r rune) bool {
 	switch r {
 	case '+', '-', '*', '/', '%', '<', '>', '=', '!', '&', '|', '^', '~', '?':
@@ -57,6 +57,9 @@ type Options struct {
 	// Opt-in support for IEEE-754 special numeric literals: NaN, Inf (signless)
 	// When enabled, tokenizer emits TokenNumber for NaN and Inf; signs are parsed via unary minus only.
 	EnableIeeeSpecials bool
+	// Collect skipped comments as trivia (see Tokenizer.Comments / Parser.Comments).
+	// Comments are always skipped; this only controls whether they are retained.
+	PreserveComments bool
 
 	// Limits & safety
 	MaxDepth int // 0 => unlimited
@@ -90,8 +93,13 @@ const (
 	NodeTypeFunctionCall      NodeType = "FunctionCall"
 	NodeTypeMemberAccess      NodeType = "MemberAccess"
 	NodeTypeSliceExpression   NodeType = "SliceExpression"
+	NodeTypeIndexAccess       NodeType = "IndexAccess"
 	NodeTypePipeExpression    NodeType = "PipeExpression"
 	NodeTypeProgram           NodeType = "Program"
+	NodeTypeTypeExpression    NodeType = "TypeExpression"
+	NodeTypeRangeExpression   NodeType = "RangeExpression"
+	NodeTypeAssignment        NodeType = "Assignment"
+	NodeTypeStatementList     NodeType = "StatementList"
 )
 
 type Node interface {
@@ -273,14 +281,45 @@ type IndexAccess struct {
 
 func (ia *IndexAccess) expressionNode()      {}
 func (ia *IndexAccess) Position() (int, int) { return ia.Line, ia.Column }
-func (ia *IndexAccess) Type() NodeType       { return NodeType("IndexAccess") }
+func (ia *IndexAccess) Type() NodeType       { return NodeTypeIndexAccess }
+
+// TypeExpression represents the postfix type operators `x is <type>` (type
+// test, yields a boolean) and `x as <type>` (conversion). TypeName is one of
+// the names returned by typeof(): number, string, boolean, null, array, object.
+type TypeExpression struct {
+	Operator string // "is" or "as"
+	Operand  Expression
+	TypeName string
+	Line     int
+	Column   int
+}
+
+func (te *TypeExpression) expressionNode()      {}
+func (te *TypeExpression) Type() NodeType       { return NodeTypeTypeExpression }
+func (te *TypeExpression) Position() (int, int) { return te.Line, te.Column }
+
+// RangeExpression represents a range literal: start..end (inclusive),
+// start..<end (exclusive), optionally followed by `step n`.
+type RangeExpression struct {
+	Start     Expression
+	End       Expression
+	Step      Expression // optional, can be nil (step 1)
+	Exclusive bool
+	Line      int
+	Column    int
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) Type() NodeType       { return NodeTypeRangeExpression }
+func (re *RangeExpression) Position() (int, int) { return re.Line, re.Column }
 
 type PipeExpression struct {
-	Expression Expression // The pipe's predicate expression block
+	Expression Expression // The pipe's predicate expression block; nil when omitted
 	PipeType   string
 	Alias      string
-	Args       []any // Compile-time literal arguments; nil = no args
-	Index      int   // Index of the predicate block
+	Args       []any        // Argument values when every argument is a literal; nil otherwise
+	ArgExprs   []Expression // Argument expressions of |name(args):; nil = no args
+	Index      int          // Index of the predicate block
 	Line       int
 	Column     int
 }
@@ -298,3 +337,25 @@ type ProgramNode struct {
 func (pn *ProgramNode) expressionNode()      {}
 func (pn *ProgramNode) Type() NodeType       { return NodeTypeProgram }
 func (pn *ProgramNode) Position() (int, int) { return pn.Line, pn.Column }
+
+// Assignment is a single `name = expr` statement of a multi-statement program.
+type Assignment struct {
+	Name   string
+	Value  Expression
+	Line   int
+	Column int
+}
+
+func (a *Assignment) Type() NodeType       { return NodeTypeAssignment }
+func (a *Assignment) Position() (int, int) { return a.Line, a.Column }
+
+// StatementList is a multi-statement program: a sequence of assignments whose
+// values may reference each other by name. See Parser.ParseStatements.
+type StatementList struct {
+	Statements []*Assignment
+	Line       int
+	Column     int
+}
+
+func (sl *StatementList) Type() NodeType       { return NodeTypeStatementList }
+func (sl *StatementList) Position() (int, int) { return sl.Line, sl.Column }
@@ -0,0 +1,232 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk. If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order, children in
+// source order. Object properties are visited in key order, and the stages
+// of a ProgramNode are visited as *PipeExpression nodes.
+func Walk(v Visitor, node Node) {
+	if node == nil {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	eachChild(node, func(child Node) { Walk(v, child) })
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node like Walk, calling f for each
+// node and then f(nil) after its children. If f returns false, the children
+// of the node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// eachChild calls fn for each non-nil direct child of node.
+func eachChild(node Node, fn func(Node)) {
+	expr := func(e Expression) {
+		if e != nil {
+			fn(e)
+		}
+	}
+	switch n := node.(type) {
+	case *BinaryExpression:
+		expr(n.Left)
+		expr(n.Right)
+	case *ConditionalExpression:
+		expr(n.Condition)
+		expr(n.Consequent)
+		expr(n.Alternate)
+	case *UnaryExpression:
+		expr(n.Operand)
+	case *GroupedExpression:
+		expr(n.Expression)
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			expr(e)
+		}
+	case *ObjectLiteral:
+		for _, k := range sortedKeys(n.Properties) {
+			expr(n.Properties[k])
+		}
+	case *FunctionCall:
+		expr(n.Function)
+		for _, e := range n.Arguments {
+			expr(e)
+		}
+	case *MemberAccess:
+		expr(n.Target)
+	case *IndexAccess:
+		expr(n.Target)
+		expr(n.Index)
+	case *SliceExpression:
+		expr(n.Target)
+		expr(n.Start)
+		expr(n.End)
+		expr(n.Step)
+	case *TypeExpression:
+		expr(n.Operand)
+	case *RangeExpression:
+		expr(n.Start)
+		expr(n.End)
+		expr(n.Step)
+	case *PipeExpression:
+		for _, e := range n.ArgExprs {
+			expr(e)
+		}
+		expr(n.Expression)
+	case *ProgramNode:
+		for i := range n.PipeExpressions {
+			fn(&n.PipeExpressions[i])
+		}
+	case *Assignment:
+		expr(n.Value)
+	case *StatementList:
+		for _, s := range n.Statements {
+			fn(s)
+		}
+	}
+}
+
+// Rewrite transforms the tree rooted at node bottom-up: the children of each
+// node are rewritten first, then f is called with the node and its result
+// takes the node's place. f returns its argument to keep a node.
+//
+// The tree is modified in place; Rewrite returns the new root. A replacement
+// must fit the place of the node it replaces: an Expression for expressions,
+// a *PipeExpression for pipe stages and an *Assignment for statements.
+// Rewrite panics otherwise.
+//
+// For example, to rename a variable:
+//
+//	parser.Rewrite(node, func(n parser.Node) parser.Node {
+//		if id, ok := n.(*parser.Identifier); ok && id.Name == "qty" {
+//			id.Name = "quantity"
+//		}
+//		return n
+//	})
+func Rewrite(node Node, f func(Node) Node) Node {
+	if node == nil {
+		return nil
+	}
+	rewriteChildren(node, f)
+	return f(node)
+}
+
+func rewriteChildren(node Node, f func(Node) Node) {
+	expr := func(e *Expression) {
+		if *e != nil {
+			*e = asExpression(Rewrite(*e, f), *e)
+		}
+	}
+	exprs := func(es []Expression) {
+		for i := range es {
+			expr(&es[i])
+		}
+	}
+	switch n := node.(type) {
+	case *BinaryExpression:
+		expr(&n.Left)
+		expr(&n.Right)
+	case *ConditionalExpression:
+		expr(&n.Condition)
+		expr(&n.Consequent)
+		expr(&n.Alternate)
+	case *UnaryExpression:
+		expr(&n.Operand)
+	case *GroupedExpression:
+		expr(&n.Expression)
+	case *ArrayLiteral:
+		exprs(n.Elements)
+	case *ObjectLiteral:
+		for _, k := range sortedKeys(n.Properties) {
+			e := n.Properties[k]
+			expr(&e)
+			n.Properties[k] = e
+		}
+	case *FunctionCall:
+		expr(&n.Function)
+		exprs(n.Arguments)
+	case *MemberAccess:
+		expr(&n.Target)
+	case *IndexAccess:
+		expr(&n.Target)
+		expr(&n.Index)
+	case *SliceExpression:
+		expr(&n.Target)
+		expr(&n.Start)
+		expr(&n.End)
+		expr(&n.Step)
+	case *TypeExpression:
+		expr(&n.Operand)
+	case *RangeExpression:
+		expr(&n.Start)
+		expr(&n.End)
+		expr(&n.Step)
+	case *PipeExpression:
+		exprs(n.ArgExprs)
+		n.Args = literalArgs(n.ArgExprs)
+		expr(&n.Expression)
+	case *ProgramNode:
+		for i := range n.PipeExpressions {
+			stage := &n.PipeExpressions[i]
+			res := Rewrite(stage, f)
+			r, ok := res.(*PipeExpression)
+			if !ok || r == nil {
+				panic(fmt.Sprintf("parser.Rewrite: pipe stage replaced by %T", res))
+			}
+			if r != stage {
+				*stage = *r
+			}
+		}
+	case *Assignment:
+		expr(&n.Value)
+	case *StatementList:
+		for i, s := range n.Statements {
+			res := Rewrite(s, f)
+			r, ok := res.(*Assignment)
+			if !ok || r == nil {
+				panic(fmt.Sprintf("parser.Rewrite: statement replaced by %T", res))
+			}
+			n.Statements[i] = r
+		}
+	}
+}
+
+// asExpression returns n, the replacement for old, as an Expression.
+func asExpression(n Node, old Expression) Expression {
+	e, ok := n.(Expression)
+	if !ok || e == nil {
+		panic(fmt.Sprintf("parser.Rewrite: %T replaced by %T, which is not an expression", old, n))
+	}
+	return e
+}
+
+func sortedKeys(m map[string]Expression) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
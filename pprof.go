@@ -0,0 +1,208 @@
+package uexl
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WritePprof writes the profiles in the gzipped protocol buffer format of
+// pprof, so that "go tool pprof" can show them, for example as a flame graph
+// with -http. Each expression is a root frame; below it are its pipe stages
+// ("|map"), host functions ("len()") and opcodes. A sample has two values:
+// count, the number of times its stack ran, and time, the default.
+//
+// The root frame of an expression is named "expr#N" and the start of its
+// source up to the first parenthesis, which pprof would cut the name at; N
+// numbers the expressions in the order of their source. The full source is
+// the frame's system name and file name.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	b := newPprofBuilder()
+	exprs := make([]*CompiledExpr, 0, len(p.exprs))
+	for c := range p.exprs {
+		exprs = append(exprs, c)
+	}
+	sort.Slice(exprs, func(i, j int) bool { return exprSource(exprs[i]) < exprSource(exprs[j]) })
+	for i, c := range exprs {
+		root := b.root(i+1, oneLine(exprSource(c)))
+		stacks := p.exprs[c].stacks
+		keys := make([]string, 0, len(stacks))
+		for key := range stacks {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var frames []string
+			if key != "" {
+				frames = strings.Split(key, "\x00")
+			}
+			b.sample(root, frames, stacks[key])
+		}
+	}
+	start := p.start
+	p.mu.Unlock()
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.profile(start, time.Since(start))); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// pprofBuilder encodes a profile.proto message. A frame is both a function
+// and its location, so both share an id.
+type pprofBuilder struct {
+	strings []string
+	index   map[string]int64
+	frames  map[string]uint64
+	ids     uint64 // frames added
+	funcs   []byte // encoded Function and Location messages
+	samples []byte
+}
+
+// maxRootName is the length, in runes, of the source in a root frame name.
+const maxRootName = 40
+
+func newPprofBuilder() *pprofBuilder {
+	return &pprofBuilder{strings: []string{""}, index: map[string]int64{"": 0}, frames: map[string]uint64{}}
+}
+
+func (b *pprofBuilder) str(s string) int64 {
+	i, ok := b.index[s]
+	if !ok {
+		i = int64(len(b.strings))
+		b.strings = append(b.strings, s)
+		b.index[s] = i
+	}
+	return i
+}
+
+// root adds the root frame of the nth expression, with the given source.
+func (b *pprofBuilder) root(n int, source string) uint64 {
+	name, _, _ := strings.Cut(source, "(")
+	name = strings.TrimSpace(name)
+	if r := []rune(name); len(r) > maxRootName {
+		name = strings.TrimSpace(string(r[:maxRootName])) + "…"
+	}
+	if name != "" {
+		name = " " + name
+	}
+	return b.add(fmt.Sprintf("expr#%d%s", n, name), source, source)
+}
+
+// frame returns the frame named name, adding it on first use.
+func (b *pprofBuilder) frame(name string) uint64 {
+	id, ok := b.frames[name]
+	if !ok {
+		id = b.add(name, name, "")
+		b.frames[name] = id
+	}
+	return id
+}
+
+func (b *pprofBuilder) add(name, systemName, filename string) uint64 {
+	b.ids++
+	id := b.ids
+	var fn protoBuf
+	fn.uint(1, id)
+	fn.int(2, b.str(name))
+	fn.int(3, b.str(systemName))
+	if filename != "" {
+		fn.int(4, b.str(filename))
+	}
+	b.funcs = appendMessage(b.funcs, 5, fn)
+	var line, loc protoBuf
+	line.uint(1, id)
+	loc.uint(1, id)
+	loc.message(4, line)
+	b.funcs = appendMessage(b.funcs, 4, loc)
+	return id
+}
+
+// sample adds a sample for the stack of frames below root, outermost first.
+func (b *pprofBuilder) sample(root uint64, frames []string, st *ProfileStat) {
+	ids := make([]uint64, len(frames)+1)
+	ids[len(frames)] = root
+	for i, f := range frames {
+		ids[len(frames)-1-i] = b.frame(f)
+	}
+	var s protoBuf
+	s.packed(1, ids)
+	s.packed(2, []uint64{uint64(st.Count), uint64(st.Time)})
+	b.samples = appendMessage(b.samples, 2, s)
+}
+
+func (b *pprofBuilder) profile(start time.Time, d time.Duration) []byte {
+	var out protoBuf
+	for _, t := range [][2]string{{"count", "count"}, {"time", "nanoseconds"}} {
+		out.message(1, b.valueType(t[0], t[1]))
+	}
+	out = append(out, b.samples...)
+	out = append(out, b.funcs...)
+	periodType := b.valueType("time", "nanoseconds")
+	defaultType := b.str("time")
+	for _, s := range b.strings {
+		out.bytes(6, []byte(s))
+	}
+	out.int(9, start.UnixNano())
+	out.int(10, int64(d))
+	out.message(11, periodType)
+	out.int(12, 1)
+	out.int(14, defaultType)
+	return out
+}
+
+func (b *pprofBuilder) valueType(typ, unit string) protoBuf {
+	var v protoBuf
+	v.int(1, b.str(typ))
+	v.int(2, b.str(unit))
+	return v
+}
+
+// protoBuf is an encoded protocol buffer message.
+type protoBuf []byte
+
+func (m *protoBuf) varint(x uint64) {
+	for x >= 0x80 {
+		*m = append(*m, byte(x)|0x80)
+		x >>= 7
+	}
+	*m = append(*m, byte(x))
+}
+
+func (m *protoBuf) uint(field int, x uint64) {
+	m.varint(uint64(field) << 3)
+	m.varint(x)
+}
+
+func (m *protoBuf) int(field int, x int64) {
+	m.uint(field, uint64(x))
+}
+
+func (m *protoBuf) bytes(field int, data []byte) {
+	m.varint(uint64(field)<<3 | 2)
+	m.varint(uint64(len(data)))
+	*m = append(*m, data...)
+}
+
+func (m *protoBuf) message(field int, sub protoBuf) {
+	m.bytes(field, sub)
+}
+
+func (m *protoBuf) packed(field int, xs []uint64) {
+	var data protoBuf
+	for _, x := range xs {
+		data.varint(x)
+	}
+	m.bytes(field, data)
+}
+
+func appendMessage(dst []byte, field int, sub protoBuf) []byte {
+	m := protoBuf(dst)
+	m.message(field, sub)
+	return m
+}
@@ -0,0 +1,333 @@
+package uexl
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/vm"
+)
+
+// Profiler aggregates, per compiled expression, where the evaluations of an
+// Env spend their time: in which opcodes, host functions and pipe stages. It
+// answers which of many stored rules are expensive and why, which a profile
+// of the whole process cannot. Install it with WithProfiler.
+//
+// Profiled evaluations are traced (see Tracer), which makes them several
+// times slower: times are measured between the tracer's callbacks and include
+// its overhead, so compare them with each other rather than with Eval.
+// Evaluations with EvalTrace, ExplainEval or a Coverage are not profiled.
+//
+// A Profiler is safe for concurrent use and may be shared by several Envs.
+type Profiler struct {
+	mu    sync.Mutex
+	start time.Time
+	exprs map[*CompiledExpr]*exprStats
+}
+
+// NewProfiler returns an empty Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{start: time.Now(), exprs: map[*CompiledExpr]*exprStats{}}
+}
+
+// WithProfiler returns an Option that profiles every evaluation in the env
+// with p. A nil p removes a profiler inherited through Extend.
+func WithProfiler(p *Profiler) Option {
+	return func(cfg *envConfig) {
+		cfg.profiler = p
+	}
+}
+
+// ProfileStat is the number of times something ran and the time it took.
+type ProfileStat struct {
+	Count int64
+	Time  time.Duration
+}
+
+// PipeStat is the profile of a pipe stage: how often it ran, for how long
+// including its predicate, and the sizes of its inputs.
+type PipeStat struct {
+	Count    int64
+	Time     time.Duration
+	Items    int64 // input elements, summed over the runs
+	MaxItems int64 // the largest input
+}
+
+// ExprProfile is the profile of one compiled expression.
+type ExprProfile struct {
+	Expr   *CompiledExpr
+	Source string // the expression's source, or its formatted tree
+	Evals  int64
+	Errors int64
+	Time   time.Duration // the total time of the evaluations
+	// Opcodes is the time spent in each opcode, by name. Time is the
+	// opcode's own: a pipe or a function call is counted under Pipes or
+	// Functions.
+	Opcodes   map[string]ProfileStat
+	Functions map[string]ProfileStat // host functions, by name
+	Pipes     map[string]PipeStat    // pipe stages, by pipe name
+}
+
+// Snapshot returns the profiles so far, most expensive expression first.
+func (p *Profiler) Snapshot() []ExprProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]ExprProfile, 0, len(p.exprs))
+	for c, s := range p.exprs {
+		ep := ExprProfile{
+			Expr: c, Source: exprSource(c), Evals: s.evals, Errors: s.errors, Time: s.time,
+			Opcodes:   make(map[string]ProfileStat, len(s.ops)),
+			Functions: make(map[string]ProfileStat, len(s.funcs)),
+			Pipes:     make(map[string]PipeStat, len(s.pipes)),
+		}
+		for op, st := range s.ops {
+			ep.Opcodes[op.String()] = *st
+		}
+		for name, st := range s.funcs {
+			ep.Functions[name] = *st
+		}
+		for name, st := range s.pipes {
+			ep.Pipes[name] = *st
+		}
+		out = append(out, ep)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Time != out[j].Time {
+			return out[i].Time > out[j].Time
+		}
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+// Reset discards the profiles.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = time.Now()
+	p.exprs = map[*CompiledExpr]*exprStats{}
+}
+
+// exprSource returns the text that names c in profiles.
+func exprSource(c *CompiledExpr) string {
+	switch {
+	case c.source != "":
+		return c.source
+	case c.root != nil:
+		return format.Node(c.root, nil)
+	}
+	return "<program>"
+}
+
+// exprStats accumulates the profile of an expression, first for one
+// evaluation and then for all of them.
+type exprStats struct {
+	evals, errors int64
+	time          time.Duration
+	ops           map[code.Opcode]*ProfileStat
+	funcs         map[string]*ProfileStat
+	pipes         map[string]*PipeStat
+	// stacks holds the time of each call stack below the expression, for
+	// the pprof export: frames joined by "\x00", leaf last. The empty stack
+	// is the time outside any opcode.
+	stacks map[string]*ProfileStat
+}
+
+func newExprStats() *exprStats {
+	return &exprStats{
+		ops:    map[code.Opcode]*ProfileStat{},
+		funcs:  map[string]*ProfileStat{},
+		pipes:  map[string]*PipeStat{},
+		stacks: map[string]*ProfileStat{},
+	}
+}
+
+func (s *exprStats) merge(o *exprStats) {
+	s.evals += o.evals
+	s.errors += o.errors
+	s.time += o.time
+	for op, st := range o.ops {
+		addStat(s.ops, op, st.Count, st.Time)
+	}
+	for name, st := range o.funcs {
+		addStat(s.funcs, name, st.Count, st.Time)
+	}
+	for key, st := range o.stacks {
+		addStat(s.stacks, key, st.Count, st.Time)
+	}
+	for name, st := range o.pipes {
+		t := s.pipes[name]
+		if t == nil {
+			t = &PipeStat{}
+			s.pipes[name] = t
+		}
+		t.Count += st.Count
+		t.Time += st.Time
+		t.Items += st.Items
+		t.MaxItems = max(t.MaxItems, st.MaxItems)
+	}
+}
+
+func addStat[K comparable](m map[K]*ProfileStat, k K, count int64, d time.Duration) {
+	st := m[k]
+	if st == nil {
+		st = &ProfileStat{}
+		m[k] = st
+	}
+	st.Count += count
+	st.Time += d
+}
+
+// eval is CompiledExpr.eval with the evaluation profiled.
+func (p *Profiler) eval(ctx context.Context, c *CompiledExpr, vars map[string]any, failed *parser.Node) (any, error) {
+	r := &profRun{stats: newExprStats(), next: c.env.tracer}
+	start := time.Now()
+	r.last = start
+	result, err := c.run(ctx, vars, r, failed)
+	elapsed := time.Since(start)
+
+	s := r.stats
+	s.evals = 1
+	if err != nil {
+		s.errors = 1
+	}
+	s.time = elapsed
+	addStat(s.stacks, "", 1, elapsed-r.measured)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := p.exprs[c]
+	if total == nil {
+		total = newExprStats()
+		p.exprs[c] = total
+	}
+	total.merge(s)
+	return result, err
+}
+
+// profRun is the tracer profiling one evaluation. Each callback charges the
+// time since the previous one to what just ran. A predicate runs before its
+// pipe stage reports, so the samples of a frame are held until the OpPipe
+// that ran it, which names the stage they belong to.
+type profRun struct {
+	stats    *exprStats
+	next     Tracer // the env's tracer, if any
+	last     time.Time
+	measured time.Duration // time charged to samples
+
+	marks   []time.Time    // end of the last instruction, by depth
+	pending [][]profSample // samples of running predicates, by depth
+	call    *profSample    // a function call, until its OpCallFunction
+	pipe    *pipeRun       // a pipe stage, until its OpPipe
+}
+
+type profSample struct {
+	frames []string // leaf last
+	count  int64
+	time   time.Duration
+}
+
+type pipeRun struct {
+	name  string
+	items int64
+	end   time.Time
+	self  time.Duration // time after the predicate's last instruction
+}
+
+var _ vm.Tracer = (*profRun)(nil)
+
+// tick charges the time since the last callback.
+func (r *profRun) tick() (time.Time, time.Duration) {
+	now := time.Now()
+	d := now.Sub(r.last)
+	r.last = now
+	r.measured += d
+	return now, d
+}
+
+func (r *profRun) OnInstruction(step vm.Step, stack []any) {
+	now, d := r.tick()
+	depth := step.Depth
+	for len(r.pending) <= depth {
+		r.pending = append(r.pending, nil)
+	}
+	for len(r.marks) <= depth {
+		r.marks = append(r.marks, now.Add(-d))
+	}
+	if r.call != nil {
+		r.add(depth, *r.call)
+		r.call = nil
+	}
+	if p := r.pipe; step.Op == code.OpPipe && p != nil {
+		r.pipe = nil
+		st := r.stats.pipes[p.name]
+		if st == nil {
+			st = &PipeStat{}
+			r.stats.pipes[p.name] = st
+		}
+		st.Count++
+		st.Time += p.end.Sub(r.marks[depth])
+		st.Items += p.items
+		st.MaxItems = max(st.MaxItems, p.items)
+		frame := "|" + p.name
+		for k := depth + 1; k < len(r.pending); k++ {
+			for _, s := range r.pending[k] {
+				s.frames = append([]string{frame}, s.frames...)
+				r.add(depth, s)
+			}
+			r.pending[k] = nil
+		}
+		r.add(depth, profSample{frames: []string{frame}, count: 1, time: p.self})
+	}
+	addStat(r.stats.ops, step.Op, 1, d)
+	r.add(depth, profSample{frames: []string{step.Op.String()}, count: 1, time: d})
+	r.marks = append(r.marks[:depth], now)
+	if r.next != nil {
+		r.next.OnInstruction(step, stack)
+	}
+}
+
+func (r *profRun) OnCall(name string, args []any, result any, err error) {
+	_, d := r.tick()
+	addStat(r.stats.funcs, name, 1, d)
+	r.call = &profSample{frames: []string{name + "()"}, count: 1, time: d}
+	if r.next != nil {
+		r.next.OnCall(name, args, result, err)
+	}
+}
+
+func (r *profRun) OnPipe(name string, input, output any, err error) {
+	now, d := r.tick()
+	r.pipe = &pipeRun{name: name, items: inputSize(input), end: now, self: d}
+	if r.next != nil {
+		r.next.OnPipe(name, input, output, err)
+	}
+}
+
+// add records s for the frame at depth: at once in the main expression,
+// otherwise when the stage running the frame is known.
+func (r *profRun) add(depth int, s profSample) {
+	if depth > 0 {
+		r.pending[depth] = append(r.pending[depth], s)
+		return
+	}
+	addStat(r.stats.stacks, strings.Join(s.frames, "\x00"), s.count, s.time)
+}
+
+// inputSize returns the number of elements of a pipe's input.
+func inputSize(v any) int64 {
+	switch v := v.(type) {
+	case []any:
+		return int64(len(v))
+	case map[string]any:
+		return int64(len(v))
+	case *vm.Range:
+		return int64(v.Count)
+	}
+	return 0
+}
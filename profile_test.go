@@ -0,0 +1,153 @@
+package uexl_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfiler(t *testing.T) {
+	p := uexl.NewProfiler()
+	env := uexl.Default().Extend(uexl.WithProfiler(p))
+	orders, err := env.Compile(`orders |filter: $item.total > 10 |map: len(str($item.total))`)
+	require.NoError(t, err)
+	double, err := env.Compile(`x * 2`)
+	require.NoError(t, err)
+
+	vars := map[string]any{"orders": []any{
+		map[string]any{"total": 5.0}, map[string]any{"total": 20.0}, map[string]any{"total": 300.0},
+	}}
+	for i := 0; i < 2; i++ {
+		got, err := orders.Eval(bg, vars)
+		require.NoError(t, err)
+		assert.Equal(t, []any{2.0, 3.0}, got)
+	}
+	_, err = double.Eval(bg, map[string]any{"x": "a"})
+	require.Error(t, err)
+
+	snap := p.Snapshot()
+	require.Len(t, snap, 2)
+	byExpr := map[*uexl.CompiledExpr]uexl.ExprProfile{snap[0].Expr: snap[0], snap[1].Expr: snap[1]}
+
+	op := byExpr[orders]
+	assert.Equal(t, `orders |filter: $item.total > 10 |map: len(str($item.total))`, op.Source)
+	assert.Equal(t, []int64{2, 0}, []int64{op.Evals, op.Errors})
+	assert.Positive(t, op.Time)
+	assert.Equal(t, int64(6), op.Opcodes["OpGreaterThan"].Count)
+	assert.Equal(t, int64(4), op.Functions["len"].Count)
+	assert.Equal(t, int64(4), op.Functions["str"].Count)
+	assert.Equal(t, uexl.PipeStat{Count: 2, Time: op.Pipes["filter"].Time, Items: 6, MaxItems: 3}, op.Pipes["filter"])
+	assert.Equal(t, uexl.PipeStat{Count: 2, Time: op.Pipes["map"].Time, Items: 4, MaxItems: 2}, op.Pipes["map"])
+
+	dp := byExpr[double]
+	assert.Equal(t, []int64{1, 1}, []int64{dp.Evals, dp.Errors})
+	assert.Empty(t, dp.Pipes)
+
+	p.Reset()
+	assert.Empty(t, p.Snapshot())
+}
+
+func TestProfiler_WritePprof(t *testing.T) {
+	p := uexl.NewProfiler()
+	compiled, err := uexl.Default().Extend(uexl.WithProfiler(p)).Compile(`xs |map: $item + 1`)
+	require.NoError(t, err)
+	_, err = compiled.Eval(bg, map[string]any{"xs": []any{1.0, 2.0}})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WritePprof(&buf))
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	// The string table holds the frame names.
+	for _, s := range []string{"xs |map: $item + 1", "|map", "OpAdd", "nanoseconds"} {
+		assert.Contains(t, string(data), s)
+	}
+}
+
+func TestProfiler_WritePprofRootNames(t *testing.T) {
+	// The rules differ only inside a call, where pprof would cut their names.
+	p := uexl.NewProfiler()
+	env := uexl.Default().Extend(uexl.WithProfiler(p))
+	sources := []string{`xs |map: len(str($item + 1)) * 2`, `xs |map: len(str($item)) * 2`} // in source order
+	for _, src := range sources {
+		compiled, err := env.Compile(src)
+		require.NoError(t, err)
+		_, err = compiled.Eval(bg, map[string]any{"xs": []any{1.0}})
+		require.NoError(t, err)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, p.WritePprof(&buf))
+	funcs := pprofFunctions(t, &buf)
+	assert.Equal(t, [3]string{"expr#1 xs |map: len", sources[0], sources[0]}, funcs[sources[0]])
+	assert.Equal(t, [3]string{"expr#2 xs |map: len", sources[1], sources[1]}, funcs[sources[1]])
+	assert.Equal(t, [3]string{"|map", "|map", ""}, funcs["|map"])
+}
+
+// pprofFunctions decodes a gzipped pprof profile and returns the name, system
+// name and file name of its functions, by system name.
+func pprofFunctions(t *testing.T, r io.Reader) map[string][3]string {
+	zr, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	strs := []string{}
+	var funcs [][3]uint64
+	for _, f := range protoFields(t, data) {
+		switch f.num {
+		case 5: // Function
+			var fn [3]uint64
+			for _, g := range protoFields(t, f.data) {
+				if g.num >= 2 && g.num <= 4 {
+					fn[g.num-2] = g.value
+				}
+			}
+			funcs = append(funcs, fn)
+		case 6: // string_table
+			strs = append(strs, string(f.data))
+		}
+	}
+	out := map[string][3]string{}
+	for _, fn := range funcs {
+		out[strs[fn[1]]] = [3]string{strs[fn[0]], strs[fn[1]], strs[fn[2]]}
+	}
+	return out
+}
+
+type protoField struct {
+	num   int
+	value uint64 // varint fields
+	data  []byte // length-delimited fields
+}
+
+func protoFields(t *testing.T, b []byte) []protoField {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+		f := protoField{num: int(key >> 3)}
+		v, n := binary.Uvarint(b)
+		require.Positive(t, n)
+		b = b[n:]
+		switch key & 7 {
+		case 0:
+			f.value = v
+		case 2:
+			f.data, b = b[:v], b[v:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
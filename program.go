@@ -0,0 +1,113 @@
+package uexl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/parser"
+)
+
+// Program is an immutable compiled multi-statement program: a sequence of
+// `name = expr` statements where statements may reference each other by name.
+//
+//	subtotal = price * qty
+//	discount = subtotal > 100 ? subtotal * 0.1 : 0
+//	total    = subtotal - discount
+//
+// The whole program compiles to a single bytecode unit. Statements run in
+// dependency order, each at most once per evaluation, and the result is a map
+// of the program's outputs. Like CompiledExpr, a Program is goroutine-safe.
+type Program struct {
+	expr    *CompiledExpr
+	outputs []string
+}
+
+// CompileProgram compiles src against the default environment.
+// See (*Env).CompileProgram.
+func CompileProgram(src string, outputs ...string) (*Program, error) {
+	return Default().CompileProgram(src, outputs...)
+}
+
+// CompileProgram parses and compiles a multi-statement program bounded to this Env.
+//
+// outputs selects the statements returned by Eval; when omitted every
+// statement is an output. Statements the selected outputs do not depend on are
+// not compiled. Statement names shadow context variables of the same name.
+// Duplicate names, unknown outputs and dependency cycles (e.g. a = b + 1 and
+// b = a * 2) are reported as compile errors.
+func (e *Env) CompileProgram(src string, outputs ...string) (*Program, error) {
+	list, err := parser.ParseProgram(src)
+	if err != nil {
+		return nil, err
+	}
+	comp := compiler.New()
+	if err := comp.CompileProgram(list, outputs); err != nil {
+		return nil, err
+	}
+	ce, err := e.bind(comp)
+	if err != nil {
+		return nil, err
+	}
+
+	names := outputs
+	if len(names) == 0 {
+		names = make([]string, len(list.Statements))
+		for i, stmt := range list.Statements {
+			names[i] = stmt.Name
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	return &Program{expr: ce, outputs: sorted}, nil
+}
+
+// Eval runs the program against vars and returns its outputs keyed by statement name.
+func (p *Program) Eval(ctx context.Context, vars map[string]any) (map[string]any, error) {
+	res, err := p.expr.Eval(ctx, vars)
+	if err != nil {
+		return nil, err
+	}
+	out, ok := res.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("program produced %T, expected map[string]any", res)
+	}
+	return out, nil
+}
+
+// EvalOutput runs the program and returns the single output name.
+// The whole program is evaluated; compile with CompileProgram(src, name) to
+// evaluate only what name depends on.
+func (p *Program) EvalOutput(ctx context.Context, vars map[string]any, name string) (any, error) {
+	out, err := p.Eval(ctx, vars)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := out[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown program output %q", name)
+	}
+	return v, nil
+}
+
+// Outputs returns the sorted names of the program's outputs. The returned
+// slice is a copy — safe to mutate.
+func (p *Program) Outputs() []string {
+	cp := make([]string, len(p.outputs))
+	copy(cp, p.outputs)
+	return cp
+}
+
+// Variables returns the sorted list of context variables the program reads.
+// Statement names are not included.
+func (p *Program) Variables() []string {
+	return p.expr.Variables()
+}
@@ -0,0 +1,107 @@
+package uexl_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pricingProgram = `
+# shared intermediate
+subtotal = price * qty
+discount = subtotal >= 100 ? subtotal * 0.1 : 0
+shipping = total > 150 ? 0 : 10
+total    = subtotal - discount
+flags    = {"bulk": qty > 10, "free_shipping": shipping == 0}
+`
+
+func TestProgram_evalAllOutputs(t *testing.T) {
+	p, err := uexl.CompileProgram(pricingProgram)
+	require.NoError(t, err)
+	out, err := p.Eval(bg, map[string]any{"price": 20.0, "qty": 12.0})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"subtotal": 240.0,
+		"discount": 24.0,
+		"total":    216.0,
+		"shipping": 0.0,
+		"flags":    map[string]any{"bulk": true, "free_shipping": true},
+	}, out)
+	assert.Equal(t, []string{"discount", "flags", "shipping", "subtotal", "total"}, p.Outputs())
+	assert.Equal(t, []string{"price", "qty"}, p.Variables())
+}
+
+func TestProgram_selectedOutputs(t *testing.T) {
+	p, err := uexl.CompileProgram(pricingProgram, "shipping")
+	require.NoError(t, err)
+	out, err := p.Eval(bg, map[string]any{"price": 5.0, "qty": 2.0})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"shipping": 10.0}, out)
+
+	v, err := p.EvalOutput(bg, map[string]any{"price": 5.0, "qty": 2.0}, "shipping")
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, v)
+
+	_, err = p.EvalOutput(bg, map[string]any{"price": 5.0, "qty": 2.0}, "total")
+	assert.ErrorContains(t, err, `unknown program output "total"`)
+}
+
+func TestProgram_statementsVisibleInsidePipes(t *testing.T) {
+	p, err := uexl.CompileProgram("factor = 3\nscaled = xs |map: $item * factor")
+	require.NoError(t, err)
+	out, err := p.Eval(bg, map[string]any{"xs": []any{1.0, 2.0}})
+	require.NoError(t, err)
+	assert.Equal(t, []any{3.0, 6.0}, out["scaled"])
+}
+
+func TestProgram_statementShadowsContextVariable(t *testing.T) {
+	p, err := uexl.CompileProgram("x = 1; y = x + 1")
+	require.NoError(t, err)
+	out, err := p.Eval(bg, map[string]any{"x": 100.0})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, out["y"])
+}
+
+func TestProgram_compileErrors(t *testing.T) {
+	_, err := uexl.CompileProgram("a = b\nb = a")
+	assert.ErrorContains(t, err, "dependency cycle a -> b -> a")
+
+	_, err = uexl.CompileProgram("a = nope(1)")
+	assert.ErrorContains(t, err, "unknown function")
+
+	_, err = uexl.CompileProgram("a + 1")
+	assert.Error(t, err)
+}
+
+func TestProgram_runtimeError(t *testing.T) {
+	p, err := uexl.CompileProgram("a = 1 / x")
+	require.NoError(t, err)
+	_, err = p.Eval(bg, map[string]any{"x": 0.0})
+	assert.ErrorContains(t, err, "division by zero")
+}
+
+func TestProgram_reusableAcrossEvaluations(t *testing.T) {
+	env := uexl.Default()
+	p, err := env.CompileProgram("a = x * 2\nb = a + 1")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		out, err := p.Eval(bg, map[string]any{"x": float64(i)})
+		require.NoError(t, err)
+		assert.Equal(t, float64(i*2+1), out["b"])
+	}
+	// Plain expressions still work on VMs that previously ran a program.
+	v, err := env.Eval(bg, "1 + 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, v)
+}
+
+func TestProgram_controlSignalCannotBeStored(t *testing.T) {
+	for _, src := range []string{"a = stop(1)\nb = 2", "a = [stop(1)]", "a = skip()\nb = a"} {
+		p, err := uexl.CompileProgram(src)
+		require.NoError(t, err)
+		_, err = p.Eval(bg, nil)
+		assert.ErrorContains(t, err, "stop() and skip() can only be used as the result of a pipe predicate", src)
+	}
+}
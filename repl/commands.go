@@ -0,0 +1,250 @@
+package repl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/internal/varsfile"
+	"github.com/maniartech/uexl/parser"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+)
+
+// commandHelp lists the meta-commands in the order :help shows them. Their
+// names also feed tab completion.
+var commandHelp = []struct{ name, args, help string }{
+	{"set", "NAME = EXPR", "evaluate EXPR and store it as variable NAME"},
+	{"unset", "NAME...", "remove variables"},
+	{"load", "FILE", "load variables from a JSON or YAML object"},
+	{"vars", "", "list the session variables"},
+	{"env", "", "list the functions, pipes and globals of the environment"},
+	{"ast", "EXPR", "print the parse tree of EXPR"},
+	{"bytecode", "EXPR", "print the compiled bytecode of EXPR"},
+	{"time", "EXPR", "evaluate EXPR and report compile and evaluation time"},
+	{"trace", "EXPR", "evaluate EXPR and list the values of its sub-expressions"},
+	{"debug", "EXPR", "step through the evaluation of EXPR"},
+	{"break", "[TARGET...]", "pause :debug at a function, |pipe or LINE:COL; list breakpoints"},
+	{"unbreak", "[TARGET...]", "remove the given breakpoints, or all of them"},
+	{"history", "", "list previous inputs"},
+	{"help", "", "show this help"},
+	{"quit", "", "leave the REPL (also :q, :exit or Ctrl-D)"},
+}
+
+// splitCommand splits ":name args" into its name and trimmed arguments.
+func splitCommand(input string) (name, args string) {
+	input = strings.TrimPrefix(strings.TrimSpace(input), ":")
+	if i := strings.IndexFunc(input, unicode.IsSpace); i >= 0 {
+		return input[:i], strings.TrimSpace(input[i:])
+	}
+	return input, ""
+}
+
+// command executes one meta-command. It reports whether the session should end.
+func (s *session) command(input string) (quit bool) {
+	name, args := splitCommand(input)
+	switch name {
+	case "set":
+		s.set(args)
+	case "unset":
+		for _, v := range strings.Fields(args) {
+			delete(s.vars, v)
+		}
+	case "load":
+		s.load(args)
+	case "vars":
+		s.listVars()
+	case "env":
+		fmt.Fprint(s.out, s.env.Info())
+	case "ast":
+		if node, ok := s.parse(args); ok {
+			fmt.Fprint(s.out, parser.Dump(node))
+		}
+	case "bytecode":
+		s.bytecode(args)
+	case "time":
+		s.time(args)
+	case "trace":
+		s.explain(args)
+	case "debug":
+		s.debug(args)
+	case "break":
+		s.setBreaks(args)
+	case "unbreak":
+		s.clearBreaks(args)
+	case "history":
+		for i, h := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, strings.ReplaceAll(h, "\n", "\n      "))
+		}
+	case "help":
+		s.help()
+	case "quit", "q", "exit":
+		return true
+	default:
+		fmt.Fprintf(s.out, "unknown command :%s (try :help)\n", name)
+	}
+	return false
+}
+
+func (s *session) help() {
+	fmt.Fprintln(s.out, "Enter an expression to evaluate it, or a command:")
+	for _, c := range commandHelp {
+		fmt.Fprintf(s.out, "  %-22s %s\n", strings.TrimSpace(":"+c.name+" "+c.args), c.help)
+	}
+	fmt.Fprintln(s.out, "Unfinished expressions continue on the next line; an empty line submits them.")
+}
+
+// set handles ":set NAME = EXPR".
+func (s *session) set(args string) {
+	name, expr, ok := strings.Cut(args, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !isIdentifier(name) || strings.TrimSpace(expr) == "" {
+		fmt.Fprintln(s.out, "usage: :set NAME = EXPR")
+		return
+	}
+	if result, ok := s.eval(expr); ok {
+		s.vars[name] = result
+		s.print(result)
+	}
+}
+
+// load handles ":load FILE", merging the file's variables into the session.
+func (s *session) load(path string) {
+	if path == "" {
+		fmt.Fprintln(s.out, "usage: :load FILE")
+		return
+	}
+	vars, err := varsfile.Load(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "load error: %v\n", err)
+		return
+	}
+	names := make([]string, 0, len(vars))
+	for k, v := range vars {
+		s.vars[k] = v
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(s.out, "loaded %d variables: %s\n", len(names), strings.Join(names, ", "))
+}
+
+func (s *session) listVars() {
+	names := make([]string, 0, len(s.vars))
+	for k := range s.vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(s.out, "%s = %s\n", k, formatValue(s.vars[k], false))
+	}
+}
+
+// parse parses expr, reporting errors.
+func (s *session) parse(expr string) (parser.Node, bool) {
+	node, err := parser.ParseString(expr)
+	if err != nil {
+		s.printError(err)
+		return nil, false
+	}
+	return node, true
+}
+
+func (s *session) bytecode(expr string) {
+	node, ok := s.parse(expr)
+	if !ok {
+		return
+	}
+	comp := compiler.New()
+	if err := comp.Compile(node); err != nil {
+		s.printError(err)
+		return
+	}
+	fmt.Fprint(s.out, compiler.Disassemble(comp.ByteCode()))
+}
+
+func (s *session) time(expr string) {
+	start := time.Now()
+	compiled, ok := s.compile(expr)
+	compileTime := time.Since(start)
+	if !ok {
+		return
+	}
+	start = time.Now()
+	result, ok := s.run(compiled)
+	evalTime := time.Since(start)
+	if ok {
+		s.print(result)
+	}
+	fmt.Fprintf(s.out, "compile %v, eval %v\n", compileTime, evalTime)
+}
+
+// eval compiles and evaluates expr with the session variables, reporting errors.
+func (s *session) eval(expr string) (any, bool) {
+	compiled, ok := s.compile(expr)
+	if !ok {
+		return nil, false
+	}
+	return s.run(compiled)
+}
+
+func (s *session) compile(expr string) (*uexl.CompiledExpr, bool) {
+	compiled, err := s.env.Compile(expr)
+	if err != nil {
+		s.printError(err)
+		return nil, false
+	}
+	return compiled, true
+}
+
+func (s *session) run(compiled *uexl.CompiledExpr) (any, bool) {
+	result, err := compiled.Eval(s.ctx, s.vars)
+	if err != nil {
+		fmt.Fprintf(s.out, "runtime error: %v\n", err)
+		return nil, false
+	}
+	return result, true
+}
+
+// printError reports a parse or compile error.
+func (s *session) printError(err error) {
+	if list, ok := parsererrors.AsList(err); ok {
+		for _, pe := range list {
+			fmt.Fprintf(s.out, "parse error: %s\n", pe.Error())
+		}
+		return
+	}
+	fmt.Fprintf(s.out, "compile error: %s\n", strings.TrimPrefix(err.Error(), "compile error: "))
+}
+
+func (s *session) print(v any) {
+	fmt.Fprintln(s.out, formatValue(v, true))
+}
+
+// formatValue renders v as JSON, indented when pretty is set. Values JSON
+// cannot represent (NaN, Inf) fall back to Go formatting.
+func formatValue(v any, pretty bool) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
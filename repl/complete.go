@@ -0,0 +1,75 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+)
+
+// pipeVars are the scope variables available inside pipe predicates.
+var pipeVars = []string{"$acc", "$chunk", "$index", "$item", "$key", "$last", "$parent", "$value", "$window"}
+
+// complete returns the completions of the word that ends line (the text
+// before the cursor) and the byte offset in line where that word starts.
+//
+// A ":" word at the start of the input completes command names; a word right
+// after "|" completes pipe names; a "$" word completes pipe scope variables;
+// any other word completes functions, globals, session variables and
+// keywords.
+func (s *session) complete(line string) (start int, candidates []string) {
+	start = len(line)
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	word := line[start:]
+	before := strings.TrimRight(line[:start], " \t")
+
+	var names []string
+	switch {
+	case strings.TrimSpace(before) == ":":
+		start = strings.IndexByte(line, ':')
+		word = line[start:]
+		for _, c := range commandHelp {
+			names = append(names, ":"+c.name)
+		}
+	case strings.HasSuffix(before, "|"):
+		names = s.env.Info().PipeHandlers
+	case strings.HasPrefix(word, "$"):
+		names = pipeVars
+	default:
+		info := s.env.Info()
+		names = append(names, info.Functions...)
+		names = append(names, info.Globals...)
+		for k := range s.vars {
+			names = append(names, k)
+		}
+		names = append(names, "true", "false", "null")
+	}
+
+	seen := map[string]bool{}
+	for _, n := range names {
+		if strings.HasPrefix(n, word) && n != word && !seen[n] {
+			seen[n] = true
+			candidates = append(candidates, n)
+		}
+	}
+	sort.Strings(candidates)
+	return start, candidates
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b == '$' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+// commonPrefix returns the longest prefix shared by all of names.
+func commonPrefix(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	prefix := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,194 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/trace"
+	"github.com/maniartech/uexl/vm"
+)
+
+const debugPrompt = "debug> "
+
+// traceLimit caps the events :trace records, so that a long pipe cannot
+// exhaust memory.
+const traceLimit = 100000
+
+// explain handles ":trace EXPR".
+func (s *session) explain(expr string) {
+	compiled, ok := s.compile(expr)
+	if !ok {
+		return
+	}
+	rec := &trace.Recorder{Limit: traceLimit}
+	result, err := compiled.EvalTrace(s.ctx, s.vars, rec)
+	fmt.Fprint(s.out, rec.Explain())
+	if err != nil {
+		fmt.Fprintf(s.out, "runtime error: %v\n", err)
+		return
+	}
+	s.print(result)
+}
+
+// debug handles ":debug EXPR": it evaluates EXPR one sub-expression at a
+// time, reading debugger commands from the session's input.
+func (s *session) debug(expr string) {
+	compiled, ok := s.compile(expr)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	d := &debugger{s: s, cancel: cancel, step: true}
+	result, err := compiled.EvalTrace(ctx, s.vars, d)
+	switch {
+	case d.stopped:
+		fmt.Fprintln(s.out, "stopped")
+	case err != nil:
+		fmt.Fprintf(s.out, "runtime error: %v\n", err)
+	default:
+		s.print(result)
+	}
+}
+
+// setBreaks handles ":break TARGET...", or lists the breakpoints.
+func (s *session) setBreaks(args string) {
+	targets := strings.Fields(args)
+	if len(targets) == 0 {
+		names := make([]string, 0, len(s.breaks))
+		for b := range s.breaks {
+			names = append(names, b)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			fmt.Fprintln(s.out, "no breakpoints")
+		}
+		for _, b := range names {
+			fmt.Fprintln(s.out, b)
+		}
+		return
+	}
+	for _, b := range targets {
+		s.breaks[b] = true
+	}
+}
+
+// clearBreaks handles ":unbreak [TARGET...]".
+func (s *session) clearBreaks(args string) {
+	targets := strings.Fields(args)
+	if len(targets) == 0 {
+		clear(s.breaks)
+	}
+	for _, b := range targets {
+		delete(s.breaks, b)
+	}
+}
+
+// debugger is the tracer of :debug. While stepping it pauses at the value of
+// every sub-expression other than a literal; otherwise only at breakpoints:
+// a function name, a pipe name such as |map, or the LINE:COL of a
+// sub-expression as :trace lists it.
+type debugger struct {
+	s       *session
+	cancel  context.CancelFunc
+	step    bool
+	stopped bool
+	stack   []any // stack of the last instruction
+}
+
+var _ vm.Tracer = (*debugger)(nil)
+
+func (d *debugger) OnInstruction(step vm.Step, stack []any) {
+	node := step.Source.Node
+	if d.stopped || !step.Source.Result || node == nil || len(stack) == 0 {
+		return
+	}
+	d.stack = stack
+	line, column := trace.Position(node)
+	if line == 0 {
+		return
+	}
+	pos := fmt.Sprintf("%d:%d", line, column)
+	if d.s.breaks[pos] || d.step && !isLiteral(node) {
+		d.pause(fmt.Sprintf("%s  %s = %s", pos, trace.Text(node), trace.FormatValue(stack[len(stack)-1])))
+	}
+}
+
+func (d *debugger) OnCall(name string, args []any, result any, err error) {
+	if d.stopped || !d.s.breaks[name] {
+		return
+	}
+	list := make([]string, len(args))
+	for i, a := range args {
+		list[i] = trace.FormatValue(a)
+	}
+	call := fmt.Sprintf("call %s(%s)", name, strings.Join(list, ", "))
+	if err != nil {
+		d.pause(call + " failed: " + err.Error())
+		return
+	}
+	d.pause(call + " = " + trace.FormatValue(result))
+}
+
+func (d *debugger) OnPipe(name string, input, output any, err error) {
+	if d.stopped || !d.s.breaks["|"+name] {
+		return
+	}
+	pipe := fmt.Sprintf("pipe |%s: %s", name, trace.FormatValue(input))
+	if err != nil {
+		d.pause(pipe + " failed: " + err.Error())
+		return
+	}
+	d.pause(pipe + " -> " + trace.FormatValue(output))
+}
+
+// pause shows where the evaluation stopped and reads debugger commands
+// until one resumes or stops it.
+func (d *debugger) pause(where string) {
+	fmt.Fprintln(d.s.out, where)
+	for {
+		line, err := d.s.in.ReadLine(debugPrompt)
+		if err != nil {
+			d.stop()
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "", "s", "step":
+			d.step = true
+			return
+		case "c", "continue":
+			d.step = false
+			return
+		case "p", "stack":
+			if len(d.stack) == 0 {
+				fmt.Fprintln(d.s.out, "(empty)")
+			}
+			for i := len(d.stack) - 1; i >= 0; i-- {
+				fmt.Fprintf(d.s.out, "%3d  %s\n", i, trace.FormatValue(d.stack[i]))
+			}
+		case "q", "quit":
+			d.stop()
+			return
+		default:
+			fmt.Fprintln(d.s.out, "commands: step (s or Enter), continue (c), stack (p), quit (q)")
+		}
+	}
+}
+
+// stop abandons the evaluation; the VM notices before the next instruction.
+func (d *debugger) stop() {
+	d.stopped = true
+	d.cancel()
+}
+
+// isLiteral reports whether node is a literal, which stepping skips.
+func isLiteral(node parser.Node) bool {
+	switch node.(type) {
+	case *parser.NumberLiteral, *parser.StringLiteral, *parser.BooleanLiteral, *parser.NullLiteral:
+		return true
+	}
+	return false
+}
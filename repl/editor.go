@@ -0,0 +1,211 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// editor is a minimal line editor for terminals: cursor movement, history and
+// tab completion, using only ANSI escape sequences.
+//
+// Keys: Left/Right (Ctrl-B/F), Home/End (Ctrl-A/E), Up/Down (Ctrl-P/N) for
+// history, Backspace, Delete, Ctrl-U/Ctrl-K/Ctrl-W to delete to the start,
+// the end or the previous word, Tab to complete, Ctrl-C to discard the input
+// and Ctrl-D on an empty line to quit.
+type editor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	rawMode  func() (restore func() error, err error)
+	complete func(line string) (start int, candidates []string)
+	history  []string
+}
+
+// maxHistory bounds the lines the editor remembers.
+const maxHistory = 1000
+
+func newEditor(in io.Reader, out io.Writer, fd uintptr, complete func(string) (int, []string)) *editor {
+	return &editor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		rawMode:  func() (func() error, error) { return makeRaw(fd) },
+		complete: complete,
+	}
+}
+
+// ReadLine reads one line in raw terminal mode, restoring the terminal before
+// it returns so that results print normally.
+func (e *editor) ReadLine(prompt string) (string, error) {
+	restore, err := e.rawMode()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var (
+		buf     []rune
+		pos     int
+		histPos = len(e.history)
+		pending string // the unsubmitted line while browsing history
+	)
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", n)
+		}
+	}
+	recall := func(i int) {
+		if i < 0 || i > len(e.history) {
+			return
+		}
+		if histPos == len(e.history) {
+			pending = string(buf)
+		}
+		histPos = i
+		if i == len(e.history) {
+			buf = []rune(pending)
+		} else {
+			buf = []rune(e.history[i])
+		}
+		pos = len(buf)
+		refresh()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(buf)
+			e.remember(line)
+			return line, nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupt
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			pos = max(pos-1, 0)
+		case 6: // Ctrl-F
+			pos = min(pos+1, len(buf))
+		case 16: // Ctrl-P
+			recall(histPos - 1)
+		case 14: // Ctrl-N
+			recall(histPos + 1)
+		case 21: // Ctrl-U
+			buf, pos = buf[pos:], 0
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf, pos = append(buf[:start], buf[pos:]...), start
+		case '\t':
+			buf, pos = e.completeAt(buf, pos, prompt)
+		case 27: // escape sequence
+			switch e.readEscape() {
+			case "[A", "OA":
+				recall(histPos - 1)
+			case "[B", "OB":
+				recall(histPos + 1)
+			case "[C", "OC":
+				pos = min(pos+1, len(buf))
+			case "[D", "OD":
+				pos = max(pos-1, 0)
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if r < 32 {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+			pos++
+		}
+		refresh()
+	}
+}
+
+// readEscape reads the rest of an escape sequence after ESC, e.g. "[A".
+func (e *editor) readEscape() string {
+	var seq strings.Builder
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return seq.String()
+		}
+		seq.WriteRune(r)
+		// Sequences end with a letter or '~'; "[" and "O" only introduce them.
+		if seq.Len() > 1 && (r == '~' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return seq.String()
+		}
+		if seq.Len() == 1 && r != '[' && r != 'O' {
+			return seq.String()
+		}
+	}
+}
+
+// completeAt completes the word before pos. A single candidate, or a longer
+// common prefix, is inserted; otherwise the candidates are listed below the
+// line.
+func (e *editor) completeAt(buf []rune, pos int, prompt string) ([]rune, int) {
+	if e.complete == nil {
+		return buf, pos
+	}
+	before := string(buf[:pos])
+	start, candidates := e.complete(before)
+	if len(candidates) == 0 {
+		return buf, pos
+	}
+	word := before[start:]
+	insert := commonPrefix(candidates)[len(word):]
+	if insert == "" && len(candidates) > 1 {
+		fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+		return buf, pos
+	}
+	ins := []rune(insert)
+	buf = append(buf[:pos], append(ins, buf[pos:]...)...)
+	return buf, pos + len(ins)
+}
+
+// remember adds a submitted line to the history, skipping blanks and repeats.
+func (e *editor) remember(line string) {
+	if strings.TrimSpace(line) == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+}
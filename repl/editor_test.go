@@ -0,0 +1,143 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplete(t *testing.T) {
+	env := uexl.DefaultWith(
+		uexl.WithFunctions(uexl.Functions{"discount": func(args ...any) (any, error) { return nil, nil }}),
+		uexl.WithGlobals(map[string]any{"dateFormat": "iso"}),
+	)
+	s := newSession(env, io.Discard)
+	s.vars["delta"] = 1.0
+
+	tests := []struct {
+		line  string
+		start int
+		want  []string
+	}{
+		{"dis", 0, []string{"discount"}},
+		{"1 + d", 4, []string{"dateFormat", "delta", "discount"}},
+		{"graphemeL", 0, []string{"graphemeLen"}},
+		{"xs |fi", 4, []string{"filter", "find"}},
+		{"xs | so", 5, []string{"some", "sort"}},
+		{"xs |map: $it", 9, []string{"$item"}},
+		{"xs |map: $pa", 9, []string{"$parent"}},
+		{":hi", 0, []string{":history"}},
+		{"  :b", 2, []string{":break", ":bytecode"}},
+		{":set x = tr", 9, []string{"true"}},
+		{"nothingmatches", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			start, got := s.complete(tt.line)
+			assert.Equal(t, tt.want, got)
+			if tt.want != nil {
+				assert.Equal(t, tt.start, start)
+			}
+		})
+	}
+}
+
+func TestNeedsMore(t *testing.T) {
+	more := []string{
+		"1 +", "a &&\n", "x |", "xs |map:", "f(1,", "[1,", "(1", `{"a":`, "'abc", "/* note", "a ? b :",
+		"a +\n  // comment\n", ":set x = [1,", ":ast a |", ":time (",
+	}
+	for _, src := range more {
+		assert.True(t, needsMore(src), "needsMore(%q)", src)
+	}
+	done := []string{
+		"", "1 + 2", "1 2", "1 )", "xs |map: $item", "f(1)", ":help", ":load [", ":set x = 1", ":set", "  ",
+	}
+	for _, src := range done {
+		assert.False(t, needsMore(src), "needsMore(%q)", src)
+	}
+}
+
+// testEditor returns an editor that reads keys from input, in a fake raw mode.
+func testEditor(input string, complete func(string) (int, []string)) (*editor, *strings.Builder) {
+	out := &strings.Builder{}
+	return &editor{
+		in:       bufio.NewReader(strings.NewReader(input)),
+		out:      out,
+		rawMode:  func() (func() error, error) { return func() error { return nil }, nil },
+		complete: complete,
+	}, out
+}
+
+func TestEditor_Keys(t *testing.T) {
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"plain", "1 + 2\r", "1 + 2"},
+		{"backspace", "1 + 3\x7f2\r", "1 + 2"},
+		{"left and insert", "12\x1b[D+\r", "1+2"},
+		{"home and end", "b\x01a\x05c\r", "abc"},
+		{"delete", "ab\x01\x1b[3~\r", "b"},
+		{"kill to start", "abc\x1b[Dx\x15\r", "c"},
+		{"kill to end", "abc\x01\x1b[C\x0b\r", "a"},
+		{"delete word", "foo bar\x17baz\r", "foo baz"},
+		{"control keys ignored", "a\x07b\r", "ab"},
+		{"unicode", "'é'\x1b[D\x7f\r", "''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := testEditor(tt.keys, nil)
+			got, err := e.ReadLine("> ")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEditor_History(t *testing.T) {
+	e, _ := testEditor("one\rtwo\r\x1b[A\x1b[A\rthr\x1b[A\x1b[B\x1b[B\r", nil)
+	var lines []string
+	for i := 0; i < 4; i++ {
+		line, err := e.ReadLine("> ")
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+	// Up twice recalls "one"; Up then Down returns to the line being typed.
+	assert.Equal(t, []string{"one", "two", "one", "thr"}, lines)
+	assert.Equal(t, []string{"one", "two", "one", "thr"}, e.history)
+}
+
+func TestEditor_ControlKeys(t *testing.T) {
+	e, out := testEditor("abc\x03\x04", nil)
+	_, err := e.ReadLine("> ")
+	assert.Equal(t, errInterrupt, err)
+	assert.Contains(t, out.String(), "^C")
+	_, err = e.ReadLine("> ")
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestEditor_Complete(t *testing.T) {
+	s := newSession(uexl.Default(), io.Discard)
+
+	e, _ := testEditor("xs |fil\t: $item\r", s.complete)
+	got, err := e.ReadLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "xs |filter: $item", got)
+
+	// Ambiguous: the common prefix is inserted, then the choices are listed.
+	e, out := testEditor("xs |so\t\t\r", s.complete)
+	got, err = e.ReadLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "xs |so", got)
+	assert.Contains(t, out.String(), "some  sort")
+
+	e, _ = testEditor("graphemeS\t(s)\r", s.complete)
+	got, err = e.ReadLine("> ")
+	require.NoError(t, err)
+	assert.Equal(t, "graphemeSubstr(s)", got)
+}
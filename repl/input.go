@@ -0,0 +1,61 @@
+package repl
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/maniartech/uexl/parser"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+)
+
+// needsMore reports whether input is an unfinished expression (or a command
+// with one) that more lines could complete.
+func needsMore(input string) bool {
+	if strings.HasPrefix(strings.TrimSpace(input), ":") {
+		name, args := splitCommand(input)
+		switch name {
+		case "set":
+			_, expr, _ := strings.Cut(args, "=")
+			return incomplete(expr)
+		case "ast", "bytecode", "time", "trace", "debug":
+			return incomplete(args)
+		}
+		return false
+	}
+	return incomplete(input)
+}
+
+// incomplete reports whether src fails to parse only because it ends too
+// early: its first error is an unterminated string or comment, or lies at or
+// past the end of the text, e.g. after a trailing operator, comma or pipe.
+// A pipe without a predicate, `xs |map:`, parses but is taken to continue on
+// the next line; an empty line submits it as it is.
+func incomplete(src string) bool {
+	if strings.TrimSpace(src) == "" {
+		return false
+	}
+	_, err := parser.ParseString(src)
+	if err == nil {
+		return strings.HasSuffix(strings.TrimSpace(src), ":")
+	}
+	list, ok := parsererrors.AsList(err)
+	if !ok || len(list) == 0 {
+		return false
+	}
+	first := list[0]
+	switch first.Code {
+	case parsererrors.ErrUnterminatedQuote, parsererrors.ErrUnterminatedComment:
+		return true
+	}
+	line, col := endPosition(src)
+	return first.Line > line || first.Line == line && first.Column >= col
+}
+
+// endPosition returns the 1-based position just past the last non-space
+// character of src.
+func endPosition(src string) (line, col int) {
+	src = strings.TrimRightFunc(src, unicode.IsSpace)
+	lastLine := src[strings.LastIndexByte(src, '\n')+1:]
+	return strings.Count(src, "\n") + 1, utf8.RuneCountInString(lastLine) + 1
+}
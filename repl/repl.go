@@ -0,0 +1,149 @@
+// Package repl implements an interactive read-eval-print loop for UExL
+// expressions, evaluated against any *uexl.Env.
+//
+// Each input is either an expression, whose result is printed as indented
+// JSON, or a meta-command starting with ':' (see :help). Variables defined
+// with :set or :load persist for the rest of the session. Input that is not
+// yet a complete expression (an open bracket or string, a trailing operator
+// or pipe) continues on the next line; an empty line submits it as is.
+//
+// :trace lists the value of each sub-expression of an evaluation, and :debug
+// steps through one, pausing at every sub-expression or at breakpoints set
+// with :break.
+//
+// When the input is a terminal, lines are edited in place with history
+// (up/down arrows) and tab completion of the env's function and pipe names,
+// session variables and meta-commands.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/maniartech/uexl"
+)
+
+const (
+	prompt     = "uexl> "
+	contPrompt = "  ... "
+)
+
+// errInterrupt is returned by a lineReader when the user discards the current
+// input with Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// lineReader reads one line of input at a time.
+type lineReader interface {
+	// ReadLine shows prompt and returns the next line without its newline,
+	// io.EOF at the end of input, or errInterrupt.
+	ReadLine(prompt string) (string, error)
+}
+
+// Run reads and evaluates input from in until end of input or :quit, writing
+// results and errors to out. Expressions are compiled against env, so its
+// functions, pipes and globals are all available. Errors in the input are
+// reported to out; Run only returns an error when reading in fails.
+func Run(env *uexl.Env, in io.Reader, out io.Writer) error {
+	s := newSession(env, out)
+	var r lineReader
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		r = newEditor(f, out, f.Fd(), s.complete)
+	} else {
+		r = &plainReader{sc: bufio.NewScanner(in), out: out}
+	}
+	return s.loop(r)
+}
+
+// plainReader reads lines from a non-terminal input, echoing nothing.
+type plainReader struct {
+	sc  *bufio.Scanner
+	out io.Writer
+}
+
+func (p *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(p.out, prompt)
+	if !p.sc.Scan() {
+		if err := p.sc.Err(); err != nil {
+			return "", err
+		}
+		fmt.Fprintln(p.out)
+		return "", io.EOF
+	}
+	return p.sc.Text(), nil
+}
+
+// session is the state of one REPL run.
+type session struct {
+	env     *uexl.Env
+	ctx     context.Context
+	vars    map[string]any
+	history []string
+	breaks  map[string]bool // :debug breakpoints
+	in      lineReader
+	out     io.Writer
+}
+
+func newSession(env *uexl.Env, out io.Writer) *session {
+	return &session{env: env, ctx: context.Background(), vars: map[string]any{}, breaks: map[string]bool{}, out: out}
+}
+
+// loop collects lines into complete inputs and executes them.
+func (s *session) loop(r lineReader) error {
+	s.in = r // :debug reads its commands from the same input
+	var lines []string
+	for {
+		p := prompt
+		if len(lines) > 0 {
+			p = contPrompt
+		}
+		line, err := r.ReadLine(p)
+		switch {
+		case err == errInterrupt:
+			lines = nil
+			continue
+		case err == io.EOF:
+			if len(lines) > 0 {
+				s.submit(strings.Join(lines, "\n"))
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+
+		if len(lines) > 0 && strings.TrimSpace(line) == "" {
+			// An empty line submits an incomplete input, to show its error.
+		} else {
+			lines = append(lines, line)
+			if needsMore(strings.Join(lines, "\n")) {
+				continue
+			}
+		}
+		input := strings.Join(lines, "\n")
+		lines = nil
+		if s.submit(input) {
+			return nil
+		}
+	}
+}
+
+// submit records input in the history and executes it. It reports whether
+// the session should end.
+func (s *session) submit(input string) (quit bool) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return false
+	}
+	s.history = append(s.history, input)
+	if strings.HasPrefix(input, ":") {
+		return s.command(input)
+	}
+	if result, ok := s.eval(input); ok {
+		s.print(result)
+	}
+	return false
+}
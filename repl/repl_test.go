@@ -0,0 +1,152 @@
+package repl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/repl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// session runs input through the REPL and returns everything it printed,
+// with the prompts removed.
+func session(t *testing.T, env *uexl.Env, input string) string {
+	t.Helper()
+	var out strings.Builder
+	require.NoError(t, repl.Run(env, strings.NewReader(input), &out))
+	s := strings.ReplaceAll(out.String(), "uexl> ", "")
+	return strings.ReplaceAll(s, "  ... ", "")
+}
+
+func TestREPL_Eval(t *testing.T) {
+	out := session(t, uexl.Default(), "1 + 2\n[1, 2] |map: $item * 10\n{\"a\": \"<b>\"}\n")
+	assert.Equal(t, "3\n[\n  10,\n  20\n]\n{\n  \"a\": \"<b>\"\n}\n\n", out)
+}
+
+func TestREPL_Variables(t *testing.T) {
+	out := session(t, uexl.Default(), strings.Join([]string{
+		":set xs = [1, 2, 3]",
+		":set total = xs |sum: $item",
+		"total * 2",
+		":vars",
+		":unset xs",
+		":vars",
+		":set 1x = 2",
+	}, "\n"))
+	assert.Equal(t, strings.Join([]string{
+		"[\n  1,\n  2,\n  3\n]",
+		"6",
+		"12",
+		"total = 6",
+		"xs = [1,2,3]",
+		"total = 6",
+		"usage: :set NAME = EXPR",
+		"",
+	}, "\n")+"\n", out)
+}
+
+func TestREPL_Load(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vars.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rate: 2\nitems: [1, 2]\n"), 0o644))
+
+	out := session(t, uexl.Default(), ":load "+path+"\nitems |map: $item * rate\n:load missing.json\n")
+	assert.Contains(t, out, "loaded 2 variables: items, rate\n[\n  2,\n  4\n]\n")
+	assert.Contains(t, out, "load error: open missing.json")
+}
+
+func TestREPL_Multiline(t *testing.T) {
+	out := session(t, uexl.Default(), strings.Join([]string{
+		"[1, 2, 3] |filter: $item > 1 |map:",
+		"  $item * 2 +",
+		"  1",
+		":set obj = {",
+		"  \"a\": 'x // y",
+		"  z'",
+		"}",
+		"obj.a",
+		"1 +", // an empty line submits unfinished input
+		"",
+		"2",
+	}, "\n"))
+	assert.Equal(t, strings.Join([]string{
+		"[\n  5,\n  7\n]",
+		"{\n  \"a\": \"x // y\\n  z\"\n}",
+		"\"x // y\\n  z\"",
+		"parse error: [unexpected-token] Line 1, Column 4: unexpected token",
+		"2",
+		"",
+	}, "\n")+"\n", out)
+}
+
+func TestREPL_Errors(t *testing.T) {
+	out := session(t, uexl.Default(), "foo(1)\nx.y\n1 2\n:nope\n")
+	assert.Equal(t, strings.Join([]string{
+		`compile error: unknown function "foo" — not registered in this environment`,
+		"runtime error: cannot access member of nil",
+		"parse error: [unexpected-token] Line 1, Column 3: unexpected token at end (token: 2)",
+		"unknown command :nope (try :help)",
+		"",
+	}, "\n")+"\n", out)
+}
+
+func TestREPL_MetaCommands(t *testing.T) {
+	out := session(t, uexl.Default(), ":ast a + 1\n:bytecode a + 1\n:time 2 * 3\n:history\n:q\n1 + 1\n")
+	assert.Contains(t, out, "BinaryExpression Operator=\"+\" @1:3\n  Left: Identifier Name=\"a\" @1:1\n")
+	assert.Contains(t, out, "=== Instructions ===\n0000 OpContextVar [0]\n")
+	assert.Contains(t, out, "6\ncompile ")
+	assert.Contains(t, out, "   1  :ast a + 1\n   2  :bytecode a + 1\n   3  :time 2 * 3\n   4  :history\n")
+	assert.NotContains(t, out, "\n2\n", ":q ends the session")
+}
+
+func TestREPL_CustomEnv(t *testing.T) {
+	env := uexl.DefaultWith(
+		uexl.WithFunctions(uexl.Functions{"double": func(args ...any) (any, error) { return args[0].(float64) * 2, nil }}),
+		uexl.WithGlobals(map[string]any{"base": 10.0}),
+	)
+	out := session(t, env, "double(base)\n:env\n")
+	assert.Contains(t, out, "20\nEnv:\n")
+	assert.Contains(t, out, "double")
+	assert.Contains(t, out, "Globals (1): base")
+}
+
+func TestREPL_Trace(t *testing.T) {
+	out := session(t, uexl.Default(), ":set price = 30\n:trace price * 4 > 100\n")
+	assert.Equal(t, "30\n"+
+		"1:1   price            30\n"+
+		"1:7   price * 4        120\n"+
+		"1:11  price * 4 > 100  true\n"+
+		"true\n\n", out)
+}
+
+func TestREPL_Debug(t *testing.T) {
+	out := session(t, uexl.Default(), strings.Join([]string{
+		":set x = 1",
+		":set s = 'ab'",
+		":debug x + len(s)",
+		"", // step
+		"p",
+		"c",
+		":break len |map",
+		":break",
+		":debug [1, 2] |map: len(str($item))",
+		"c", // from the first step to the first breakpoint
+		"c",
+		"c",
+		"c",
+		":unbreak",
+		":break",
+		":debug 1 + x",
+		"?",
+		"q",
+	}, "\n"))
+	out = strings.ReplaceAll(out, "debug> ", "")
+	assert.Contains(t, out, "1:1  x = 1\n1:9  s = \"ab\"\n  1  \"ab\"\n  0  1\n3\n")
+	assert.Contains(t, out, "len\n|map\n1:1  [1, 2] = [1,2]\n")
+	assert.Contains(t, out, "call len(\"1\") = 1\ncall len(\"2\") = 1\npipe |map: [1,2] -> [1,1]\n[\n  1,\n  1\n]\n")
+	assert.Contains(t, out, "no breakpoints\n1:5  x = 1\ncommands: step (s or Enter), continue (c), stack (p), quit (q)\nstopped\n")
+}
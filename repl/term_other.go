@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package repl
+
+import "errors"
+
+// isTerminal reports false: line editing is only supported on Unix systems,
+// elsewhere the REPL reads plain lines.
+func isTerminal(fd uintptr) bool { return false }
+
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
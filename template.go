@@ -0,0 +1,616 @@
+package uexl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/maniartech/uexl/internal/source"
+	"github.com/maniartech/uexl/parser"
+	parsererrors "github.com/maniartech/uexl/parser/errors"
+)
+
+// Delims configures the segment delimiters recognized by CompileTemplate.
+// The zero value selects DefaultDelims.
+type Delims struct {
+	Left  string
+	Right string
+}
+
+// DefaultDelims are the delimiters used when Delims is left empty: {{ expr }}.
+var DefaultDelims = Delims{Left: "{{", Right: "}}"}
+
+// Template is an immutable, pre-compiled text document with embedded UExL segments.
+// It is goroutine-safe — Render may be called concurrently.
+//
+// Supported segments (shown with the default delimiters):
+//
+//	{{ expr }}                    output the value of expr
+//	{{#if cond}} … {{/if}}        conditional block; supports {{else if cond}} and {{else}}
+//	{{#each expr}} … {{/each}}    repeat the body for each element ($item, $index in scope)
+//	{{#each expr as $x}} … {{/each}}  same, with the element also bound to $x
+//	{{! comment }}                ignored
+//
+// A leading "- " or trailing " -" inside a segment ({{- expr -}}) trims the adjacent
+// whitespace of the surrounding text.
+type Template struct {
+	nodes    []tmplNode
+	program  *CompiledExpr
+	text     string
+	segments map[parser.Node]segmentNode // the segment of each program node, for runtime errors
+}
+
+// TemplateError reports a template compile or render failure at a position in the template
+// document. Line and Column are 1-based and refer to the template text, not to the segment.
+type TemplateError struct {
+	Line    int
+	Column  int
+	Message string
+	Err     error // underlying parse/compile error, if any
+}
+
+func (e *TemplateError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("template: line %d, column %d: %s: %v", e.Line, e.Column, e.Message, e.Err)
+	}
+	return fmt.Sprintf("template: line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// Unwrap exposes the underlying error so errors.As can reach *ParseErrors.
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// CompileTemplate compiles text against the Default environment.
+func CompileTemplate(text string, delims Delims) (*Template, error) {
+	return Default().CompileTemplate(text, delims)
+}
+
+// CompileTemplate parses text into literal and expression segments, compiles every
+// expression against this Env, and assembles them into a single program.
+// #each blocks require the "map" pipe handler to be registered in the Env.
+func (e *Env) CompileTemplate(text string, delims Delims) (*Template, error) {
+	if delims.Left == "" {
+		delims.Left = DefaultDelims.Left
+	}
+	if delims.Right == "" {
+		delims.Right = DefaultDelims.Right
+	}
+	tp := &templateParser{env: e, src: text, delims: delims, segments: map[parser.Node]segmentNode{}}
+	nodes, err := tp.parse()
+	if err != nil {
+		return nil, err
+	}
+	root := &parser.ArrayLiteral{Elements: bodyExprs(nodes)}
+	program, err := e.CompileNode(root)
+	if err != nil {
+		return nil, &TemplateError{Line: 1, Column: 1, Message: "cannot compile template", Err: err}
+	}
+	inheritSegments(root, tp.segments)
+	return &Template{nodes: nodes, program: program, text: text, segments: tp.segments}, nil
+}
+
+// Render evaluates the template program once against vars and writes the document.
+// vars may be nil. A runtime error is returned as a *TemplateError at the position of
+// the expression that failed.
+func (t *Template) Render(ctx context.Context, vars map[string]any) (string, error) {
+	var failed parser.Node
+	out, err := t.program.eval(ctx, vars, &failed)
+	if err != nil {
+		return "", t.runtimeError(failed, err)
+	}
+	values, _ := out.([]any)
+	var b strings.Builder
+	if err := renderNodes(&b, t.nodes, values); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Variables returns the sorted context variable names referenced anywhere in the template.
+func (t *Template) Variables() []string {
+	return t.program.Variables()
+}
+
+// runtimeError locates err, which the instruction of node failed with, in the
+// document; err is returned unchanged when node is not in a segment.
+func (t *Template) runtimeError(node parser.Node, err error) error {
+	sn, ok := t.segments[node]
+	if !ok {
+		return err
+	}
+	start := source.New(sn.seg.text).Span(sn.node).Start
+	line, col := lineCol(t.text, sn.seg.offset+start)
+	return &TemplateError{Line: line, Column: col, Message: "runtime error", Err: err}
+}
+
+// segment is the text of one embedded expression and its offset in the document.
+type segment struct {
+	text   string
+	offset int
+	root   parser.Node
+}
+
+// segmentNode locates a program node: node is a node of seg, or seg's root for the
+// nodes the template adds around segments.
+type segmentNode struct {
+	seg  *segment
+	node parser.Node
+}
+
+// inheritSegments gives each node the template added around segments (block
+// conditionals, #each pipes, result arrays) the segment of its first segment node,
+// or failing that, of its nearest ancestor.
+func inheritSegments(root parser.Node, segments map[parser.Node]segmentNode) {
+	var open []parser.Node
+	parser.Inspect(root, func(n parser.Node) bool {
+		if n == nil {
+			open = open[:len(open)-1]
+			return true
+		}
+		if sn, ok := segments[n]; ok {
+			for _, a := range open {
+				if _, ok := segments[a]; !ok {
+					segments[a] = segmentNode{seg: sn.seg, node: sn.seg.root}
+				}
+			}
+			return false
+		}
+		open = append(open, n)
+		return true
+	})
+	var located []segmentNode
+	parser.Inspect(root, func(n parser.Node) bool {
+		if n == nil {
+			located = located[:len(located)-1]
+			return true
+		}
+		sn, ok := segments[n]
+		if !ok && len(located) > 0 && located[len(located)-1].seg != nil {
+			sn = located[len(located)-1]
+			segments[n] = sn
+		}
+		located = append(located, sn)
+		return true
+	})
+}
+
+// ── template tree ────────────────────────────────────────────────────────────
+
+// tmplNode is one node of the parsed template. Nodes that need runtime values
+// contribute one element to the program's result array via expr(); render walks
+// the nodes and that array in lockstep.
+type tmplNode interface {
+	expr() parser.Expression
+	render(b *strings.Builder, v any) error
+}
+
+type textNode struct{ text string }
+
+func (n *textNode) expr() parser.Expression { return nil }
+
+func (n *textNode) render(b *strings.Builder, _ any) error {
+	b.WriteString(n.text)
+	return nil
+}
+
+type outputNode struct{ value parser.Expression }
+
+func (n *outputNode) expr() parser.Expression { return n.value }
+
+func (n *outputNode) render(b *strings.Builder, v any) error {
+	b.WriteString(formatTemplateValue(v))
+	return nil
+}
+
+type ifBranch struct {
+	cond parser.Expression // nil for the final {{else}}
+	body []tmplNode
+}
+
+type ifNode struct{ branches []ifBranch }
+
+// expr compiles the branch chain into nested conditionals, each producing
+// [branchIndex, ...bodyValues]; -1 means no branch matched.
+func (n *ifNode) expr() parser.Expression {
+	var result parser.Expression = &parser.ArrayLiteral{Elements: []parser.Expression{&parser.NumberLiteral{Value: -1}}}
+	for i := len(n.branches) - 1; i >= 0; i-- {
+		br := n.branches[i]
+		elems := []parser.Expression{&parser.NumberLiteral{Value: float64(i)}}
+		elems = append(elems, bodyExprs(br.body)...)
+		arm := &parser.ArrayLiteral{Elements: elems}
+		if br.cond == nil {
+			result = arm
+			continue
+		}
+		result = &parser.ConditionalExpression{Condition: br.cond, Consequent: arm, Alternate: result}
+	}
+	return result
+}
+
+func (n *ifNode) render(b *strings.Builder, v any) error {
+	arm, ok := v.([]any)
+	if !ok || len(arm) == 0 {
+		return fmt.Errorf("template: malformed if block result %T", v)
+	}
+	idx, _ := arm[0].(float64)
+	if idx < 0 {
+		return nil
+	}
+	return renderNodes(b, n.branches[int(idx)].body, arm[1:])
+}
+
+type eachNode struct {
+	source parser.Expression
+	alias  string
+	body   []tmplNode
+}
+
+// expr compiles to (source ?? []) |map: [...bodyValues] so null sources render nothing.
+func (n *eachNode) expr() parser.Expression {
+	src := &parser.BinaryExpression{Left: n.source, Operator: "??", Right: &parser.ArrayLiteral{Elements: []parser.Expression{}}}
+	return &parser.ProgramNode{PipeExpressions: []parser.PipeExpression{
+		{Expression: src, PipeType: parser.DefaultPipeType},
+		{Expression: &parser.ArrayLiteral{Elements: bodyExprs(n.body)}, PipeType: "map", Alias: n.alias, Index: 1},
+	}}
+}
+
+func (n *eachNode) render(b *strings.Builder, v any) error {
+	iterations, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("template: malformed each block result %T", v)
+	}
+	for _, it := range iterations {
+		values, _ := it.([]any)
+		if err := renderNodes(b, n.body, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bodyExprs(nodes []tmplNode) []parser.Expression {
+	out := make([]parser.Expression, 0, len(nodes))
+	for _, n := range nodes {
+		if x := n.expr(); x != nil {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func renderNodes(b *strings.Builder, nodes []tmplNode, values []any) error {
+	vi := 0
+	for _, n := range nodes {
+		if _, static := n.(*textNode); static {
+			if err := n.render(b, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if vi >= len(values) {
+			return fmt.Errorf("template: result has %d values, expected more", len(values))
+		}
+		if err := n.render(b, values[vi]); err != nil {
+			return err
+		}
+		vi++
+	}
+	return nil
+}
+
+// formatTemplateValue renders an output value: null is empty, numbers use the
+// shortest exact decimal form, arrays and objects are written as JSON.
+func formatTemplateValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case []any, map[string]any:
+		if data, err := json.Marshal(val); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// ── template parser ─────────────────────────────────────────────────────────
+
+var eachAliasPattern = regexp.MustCompile(`\s+as\s+(\$[A-Za-z_][A-Za-z0-9_]*)\s*$`)
+
+type templateParser struct {
+	env      *Env
+	src      string
+	delims   Delims
+	pos      int
+	segments map[parser.Node]segmentNode
+}
+
+// blockFrame tracks an open {{#if}} / {{#each}} while its body is being parsed.
+type blockFrame struct {
+	kind   string // "if" or "each"
+	line   int
+	column int
+	node   tmplNode
+	body   *[]tmplNode
+	closed bool // {{else}} already seen (if blocks only)
+}
+
+func (tp *templateParser) parse() ([]tmplNode, error) {
+	var root []tmplNode
+	stack := []*blockFrame{}
+	out := &root
+	trimNext := false
+
+	for tp.pos < len(tp.src) {
+		start := strings.Index(tp.src[tp.pos:], tp.delims.Left)
+		if start < 0 {
+			tp.appendText(out, tp.src[tp.pos:], trimNext)
+			tp.pos = len(tp.src)
+			break
+		}
+		text := tp.src[tp.pos : tp.pos+start]
+		tagPos := tp.pos + start
+		innerStart := tagPos + len(tp.delims.Left)
+		innerEnd, ok := tp.findRight(innerStart)
+		if !ok {
+			line, col := tp.lineCol(tagPos)
+			return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unclosed segment, expected %q", tp.delims.Right)}
+		}
+		inner := tp.src[innerStart:innerEnd]
+		tp.pos = innerEnd + len(tp.delims.Right)
+
+		// Whitespace trim markers: "{{- " and " -}}".
+		trimPrev := false
+		if strings.HasPrefix(inner, "- ") || inner == "-" {
+			trimPrev = true
+			inner = inner[1:]
+			innerStart++
+		}
+		trimAfter := false
+		if strings.HasSuffix(inner, " -") {
+			trimAfter = true
+			inner = inner[:len(inner)-1]
+		}
+		if trimPrev {
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+		}
+		tp.appendText(out, text, trimNext)
+		trimNext = trimAfter
+
+		// Locate the first non-space character of the segment for error positions.
+		lead := len(inner) - len(strings.TrimLeftFunc(inner, unicode.IsSpace))
+		body := strings.TrimSpace(inner)
+		bodyOffset := innerStart + lead
+		line, col := tp.lineCol(bodyOffset)
+
+		switch {
+		case body == "":
+			tagLine, tagCol := tp.lineCol(tagPos)
+			return nil, &TemplateError{Line: tagLine, Column: tagCol, Message: "empty segment"}
+		case strings.HasPrefix(body, "!"):
+			// comment
+		case strings.HasPrefix(body, "#if"), strings.HasPrefix(body, "#each"):
+			kind := "if"
+			if strings.HasPrefix(body, "#each") {
+				kind = "each"
+			}
+			rest := body[len(kind)+1:]
+			if rest != "" && !startsWithSpace(rest) {
+				return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unknown block %q", body)}
+			}
+			exprOffset := bodyOffset + len(kind) + 1 + leadingSpace(rest)
+			rest = strings.TrimSpace(rest)
+			if rest == "" {
+				return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("#%s requires an expression", kind)}
+			}
+			frame := &blockFrame{kind: kind, line: line, column: col}
+			if kind == "if" {
+				cond, err := tp.compileSegment(rest, exprOffset)
+				if err != nil {
+					return nil, err
+				}
+				n := &ifNode{branches: []ifBranch{{cond: cond}}}
+				frame.node = n
+				frame.body = &n.branches[0].body
+			} else {
+				alias := ""
+				if m := eachAliasPattern.FindStringSubmatchIndex(rest); m != nil {
+					alias = rest[m[2]:m[3]]
+					rest = rest[:m[0]]
+				}
+				if !tp.env.HasPipe("map") {
+					return nil, &TemplateError{Line: line, Column: col, Message: "#each requires the \"map\" pipe handler in this environment"}
+				}
+				src, err := tp.compileSegment(rest, exprOffset)
+				if err != nil {
+					return nil, err
+				}
+				n := &eachNode{source: src, alias: alias}
+				frame.node = n
+				frame.body = &n.body
+			}
+			*out = append(*out, frame.node)
+			stack = append(stack, frame)
+			out = frame.body
+		case body == "else" || strings.HasPrefix(body, "else "):
+			if len(stack) == 0 || stack[len(stack)-1].kind != "if" {
+				return nil, &TemplateError{Line: line, Column: col, Message: "{{else}} outside of #if block"}
+			}
+			frame := stack[len(stack)-1]
+			if frame.closed {
+				return nil, &TemplateError{Line: line, Column: col, Message: "{{else}} after final {{else}}"}
+			}
+			n := frame.node.(*ifNode)
+			rest := strings.TrimSpace(body[len("else"):])
+			var cond parser.Expression
+			if rest != "" {
+				if !strings.HasPrefix(rest, "if ") {
+					return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unknown block %q", body)}
+				}
+				exprText := strings.TrimSpace(rest[len("if "):])
+				exprOffset := bodyOffset + strings.Index(body, exprText)
+				var err error
+				if cond, err = tp.compileSegment(exprText, exprOffset); err != nil {
+					return nil, err
+				}
+			} else {
+				frame.closed = true
+			}
+			n.branches = append(n.branches, ifBranch{cond: cond})
+			frame.body = &n.branches[len(n.branches)-1].body
+			out = frame.body
+		case body == "/if" || body == "/each":
+			kind := body[1:]
+			if len(stack) == 0 || stack[len(stack)-1].kind != kind {
+				return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unexpected {{%s}}", body)}
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				out = &root
+			} else {
+				out = stack[len(stack)-1].body
+			}
+		case strings.HasPrefix(body, "#") || strings.HasPrefix(body, "/"):
+			return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unknown block %q", body)}
+		default:
+			value, err := tp.compileSegment(body, bodyOffset)
+			if err != nil {
+				return nil, err
+			}
+			*out = append(*out, &outputNode{value: value})
+		}
+	}
+
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return nil, &TemplateError{Line: open.line, Column: open.column, Message: fmt.Sprintf("unclosed #%s block", open.kind)}
+	}
+	return root, nil
+}
+
+func (tp *templateParser) appendText(out *[]tmplNode, text string, trimLeading bool) {
+	if trimLeading {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	}
+	if text != "" {
+		*out = append(*out, &textNode{text: text})
+	}
+}
+
+// findRight returns the offset of the closing delimiter for a segment starting at from.
+// Quoted strings and balanced braces are skipped so object literals and strings
+// containing the delimiter do not end the segment early.
+func (tp *templateParser) findRight(from int) (int, bool) {
+	depth := 0
+	var quote byte
+	for i := from; i < len(tp.src); i++ {
+		c := tp.src[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if depth == 0 && strings.HasPrefix(tp.src[i:], tp.delims.Right) {
+			return i, true
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return 0, false
+}
+
+// compileSegment parses one embedded expression and validates it against the Env,
+// translating any error position from segment-relative to document-relative.
+func (tp *templateParser) compileSegment(src string, offset int) (parser.Expression, error) {
+	line, col := tp.lineCol(offset)
+	node, err := parser.ParseString(src)
+	if err != nil {
+		first, shifted := shiftParseError(err, line, col)
+		return nil, &TemplateError{Line: first.Line, Column: first.Column, Message: "invalid expression", Err: shifted}
+	}
+	if _, err := tp.env.CompileNode(node); err != nil {
+		return nil, &TemplateError{Line: line, Column: col, Message: "invalid expression", Err: err}
+	}
+	expr, ok := node.(parser.Expression)
+	if !ok {
+		return nil, &TemplateError{Line: line, Column: col, Message: fmt.Sprintf("unsupported node %T", node)}
+	}
+	seg := &segment{text: src, offset: offset, root: node}
+	parser.Inspect(node, func(n parser.Node) bool {
+		if n != nil {
+			tp.segments[n] = segmentNode{seg: seg, node: n}
+		}
+		return true
+	})
+	return expr, nil
+}
+
+// lineCol converts a byte offset into a 1-based line and rune column.
+func (tp *templateParser) lineCol(offset int) (int, int) {
+	return lineCol(tp.src, offset)
+}
+
+// lineCol converts a byte offset of src into a 1-based line and rune column.
+func lineCol(src string, offset int) (int, int) {
+	prefix := src[:offset]
+	line := 1 + strings.Count(prefix, "\n")
+	lineStart := strings.LastIndexByte(prefix, '\n') + 1
+	return line, utf8.RuneCountInString(prefix[lineStart:]) + 1
+}
+
+// shiftParseError rebases parser positions onto the template document where the
+// segment starts at (line, col). Returns the first shifted error and the shifted set.
+func shiftParseError(err error, line, col int) (ParserError, error) {
+	shift := func(pe ParserError) ParserError {
+		if pe.Line <= 1 {
+			pe.Column += col - 1
+		}
+		pe.Line += line - 1
+		return pe
+	}
+	switch e := err.(type) {
+	case parsererrors.ParserError:
+		s := shift(e)
+		return s, s
+	case *parsererrors.ParseErrors:
+		shifted := &parsererrors.ParseErrors{Errors: make([]ParserError, len(e.Errors))}
+		for i, pe := range e.Errors {
+			shifted.Errors[i] = shift(pe)
+		}
+		if len(shifted.Errors) == 0 {
+			return ParserError{Line: line, Column: col}, shifted
+		}
+		return shifted.Errors[0], shifted
+	default:
+		return ParserError{Line: line, Column: col}, err
+	}
+}
+
+func startsWithSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+func leadingSpace(s string) int {
+	return len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+}
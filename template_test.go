@@ -0,0 +1,211 @@
+package uexl_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/stretchr/testify/assert"
+)
+
+func renderTemplate(t *testing.T, text string, vars map[string]any) string {
+	t.Helper()
+	tmpl, err := uexl.CompileTemplate(text, uexl.Delims{})
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	out, err := tmpl.Render(bg, vars)
+	if err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	return out
+}
+
+func TestTemplate_textOnly(t *testing.T) {
+	assert.Equal(t, "hello world", renderTemplate(t, "hello world", nil))
+	assert.Equal(t, "", renderTemplate(t, "", nil))
+}
+
+func TestTemplate_outputs(t *testing.T) {
+	vars := map[string]any{"name": "Ada", "qty": 3.0, "price": 2.5, "vip": true, "note": nil}
+	out := renderTemplate(t, "Hi {{ name }}, total {{qty * price}} vip={{vip}} note=[{{note}}]", vars)
+	assert.Equal(t, "Hi Ada, total 7.5 vip=true note=[]", out)
+}
+
+func TestTemplate_integerNumbersHaveNoExponent(t *testing.T) {
+	assert.Equal(t, "n=1000000", renderTemplate(t, "n={{ 1000000 }}", nil))
+}
+
+func TestTemplate_arraysAndObjectsAsJSON(t *testing.T) {
+	out := renderTemplate(t, `{{ [1, "a"] }} {{ {"k": 1} }}`, nil)
+	assert.Equal(t, `[1,"a"] {"k":1}`, out)
+}
+
+func TestTemplate_ifElseChain(t *testing.T) {
+	text := "{{#if score >= 90}}A{{else if score >= 80}}B{{else}}C{{/if}}"
+	assert.Equal(t, "A", renderTemplate(t, text, map[string]any{"score": 95.0}))
+	assert.Equal(t, "B", renderTemplate(t, text, map[string]any{"score": 85.0}))
+	assert.Equal(t, "C", renderTemplate(t, text, map[string]any{"score": 10.0}))
+}
+
+func TestTemplate_ifWithoutElse(t *testing.T) {
+	text := "[{{#if show}}{{ msg }}{{/if}}]"
+	assert.Equal(t, "[hi]", renderTemplate(t, text, map[string]any{"show": true, "msg": "hi"}))
+	assert.Equal(t, "[]", renderTemplate(t, text, map[string]any{"show": false, "msg": "hi"}))
+}
+
+func TestTemplate_each(t *testing.T) {
+	text := "{{#each items}}{{$index}}:{{$item.name}};{{/each}}"
+	vars := map[string]any{"items": []any{
+		map[string]any{"name": "a"},
+		map[string]any{"name": "b"},
+	}}
+	assert.Equal(t, "0:a;1:b;", renderTemplate(t, text, vars))
+}
+
+func TestTemplate_eachNullSourceRendersNothing(t *testing.T) {
+	assert.Equal(t, "<>", renderTemplate(t, "<{{#each items}}x{{/each}}>", map[string]any{"items": nil}))
+}
+
+func TestTemplate_nestedEachWithAlias(t *testing.T) {
+	text := "{{#each groups as $g}}{{$g.name}}=[{{#each $g.items}}{{$item}}{{#if $item != $g.last}},{{/if}}{{/each}}] {{/each}}"
+	vars := map[string]any{"groups": []any{
+		map[string]any{"name": "x", "items": []any{1.0, 2.0}, "last": 2.0},
+		map[string]any{"name": "y", "items": []any{3.0}, "last": 3.0},
+	}}
+	assert.Equal(t, "x=[1,2] y=[3] ", renderTemplate(t, text, vars))
+}
+
+func TestTemplate_trimMarkersAndComments(t *testing.T) {
+	text := "a   {{- 1 -}}   b {{! ignored }}c"
+	assert.Equal(t, "a1b c", renderTemplate(t, text, nil))
+}
+
+func TestTemplate_customDelims(t *testing.T) {
+	tmpl, err := uexl.CompileTemplate("{{literal}} <%= x + 1 %>", uexl.Delims{Left: "<%=", Right: "%>"})
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	out, err := tmpl.Render(bg, map[string]any{"x": 1.0})
+	assert.NoError(t, err)
+	assert.Equal(t, "{{literal}} 2", out)
+}
+
+func TestTemplate_delimiterInsideStringOrObject(t *testing.T) {
+	assert.Equal(t, "a}}b", renderTemplate(t, `{{ "a}}b" }}`, nil))
+	assert.Equal(t, "1", renderTemplate(t, `{{ {"a": {"b": 1}}.a.b }}`, nil))
+}
+
+func TestTemplate_variables(t *testing.T) {
+	tmpl, err := uexl.CompileTemplate("{{b}}{{#if a}}{{c}}{{/if}}", uexl.Delims{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, tmpl.Variables())
+}
+
+func TestTemplate_parseErrorPositionIsDocumentRelative(t *testing.T) {
+	_, err := uexl.CompileTemplate("line one\n  ok {{ 1 + }}", uexl.Delims{})
+	var te *uexl.TemplateError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected *TemplateError, got %T: %v", err, err)
+	}
+	assert.Equal(t, 2, te.Line)
+	assert.True(t, te.Column > 9, "column %d should point inside the segment", te.Column)
+	var pe *uexl.ParseErrors
+	var single uexl.ParserError
+	assert.True(t, errors.As(err, &pe) || errors.As(err, &single), "underlying parse error should be reachable")
+}
+
+func TestTemplate_unknownFunctionReportsSegmentPosition(t *testing.T) {
+	_, err := uexl.CompileTemplate("ab\ncd {{ nope(1) }}", uexl.Delims{})
+	var te *uexl.TemplateError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected *TemplateError, got %T: %v", err, err)
+	}
+	assert.Equal(t, 2, te.Line)
+	assert.Equal(t, 7, te.Column)
+	assert.Contains(t, err.Error(), "unknown function")
+}
+
+func TestTemplate_structureErrors(t *testing.T) {
+	cases := []struct {
+		text, want string
+		line, col  int
+	}{
+		{"{{#if a}}x", "unclosed #if block", 1, 3},
+		{"x\n{{/each}}", "unexpected {{/each}}", 2, 3},
+		{"{{else}}", "outside of #if", 1, 3},
+		{"{{#if a}}{{else}}{{else}}{{/if}}", "after final", 1, 20},
+		{"abc {{ 1", "unclosed segment", 1, 5},
+		{"{{#with a}}{{/with}}", "unknown block", 1, 3},
+		{"x {{ }}", "empty segment", 1, 3},
+	}
+	for _, tc := range cases {
+		_, err := uexl.CompileTemplate(tc.text, uexl.Delims{})
+		var te *uexl.TemplateError
+		if !errors.As(err, &te) {
+			t.Fatalf("%q: expected *TemplateError, got %v", tc.text, err)
+		}
+		assert.True(t, strings.Contains(te.Message, tc.want), "%q: message %q", tc.text, te.Message)
+		assert.Equal(t, tc.line, te.Line, "%q line", tc.text)
+		assert.Equal(t, tc.col, te.Column, "%q column", tc.text)
+	}
+}
+
+func TestTemplate_eachRequiresMapPipe(t *testing.T) {
+	env := uexl.NewEnv()
+	_, err := env.CompileTemplate("{{#each xs}}{{/each}}", uexl.Delims{})
+	assert.ErrorContains(t, err, `"map" pipe`)
+}
+
+func TestTemplate_runtimeError(t *testing.T) {
+	tmpl, err := uexl.CompileTemplate("{{ 1 / x }}", uexl.Delims{})
+	assert.NoError(t, err)
+	_, err = tmpl.Render(bg, map[string]any{"x": 0.0})
+	assert.ErrorContains(t, err, "division by zero")
+}
+
+func TestTemplate_runtimeErrorPosition(t *testing.T) {
+	for _, tc := range []struct {
+		text         string
+		line, column int
+	}{
+		{"a {{ n }}\nb {{ 1 / x }}", 2, 6},
+		{"{{#if ok}}\n  {{ n + 1 }} {{ len(n) }}{{/if}}", 2, 18},
+		{"{{#each xs}}\n{{ $item.a / x }}{{/each}}", 2, 4},
+		{"{{#each n}}x{{/each}}", 1, 9},
+	} {
+		tmpl, err := uexl.CompileTemplate(tc.text, uexl.Delims{})
+		assert.NoError(t, err)
+		_, err = tmpl.Render(bg, map[string]any{"n": 1.0, "x": 0.0, "ok": true, "xs": []any{map[string]any{"a": 1.0}}})
+		var te *uexl.TemplateError
+		if assert.True(t, errors.As(err, &te), "%q: %v", tc.text, err) {
+			assert.Equal(t, []int{tc.line, tc.column}, []int{te.Line, te.Column}, "%q: %v", tc.text, err)
+			assert.Equal(t, "runtime error", te.Message)
+		}
+	}
+}
+
+func TestTemplate_runtimeErrorRendersOnce(t *testing.T) {
+	// flaky fails only on its first call: the error is located without
+	// rendering again.
+	calls := 0
+	env := uexl.Default().Extend(uexl.WithFunctions(uexl.Functions{
+		"flaky": func(args ...any) (any, error) {
+			calls++
+			if calls == 1 {
+				return nil, errors.New("flaky failed")
+			}
+			return "ok", nil
+		},
+	}))
+	tmpl, err := env.CompileTemplate("a {{ 1 }}\n{{ flaky() }}", uexl.Delims{})
+	assert.NoError(t, err)
+	_, err = tmpl.Render(bg, nil)
+	var te *uexl.TemplateError
+	if assert.True(t, errors.As(err, &te), "%v", err) {
+		assert.Equal(t, []int{2, 4}, []int{te.Line, te.Column})
+		assert.ErrorContains(t, te, "flaky failed")
+	}
+	assert.Equal(t, 1, calls)
+}
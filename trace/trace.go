@@ -0,0 +1,255 @@
+// Package trace records UExL evaluations for debugging.
+//
+// A Recorder is a vm.Tracer that keeps the value of every sub-expression, in
+// the order they were computed, along with the function calls and pipe
+// stages of the evaluation. Explain lays them out against the source:
+//
+//	rec := &trace.Recorder{}
+//	result, err := compiled.EvalTrace(ctx, vars, rec)
+//	fmt.Print(rec.Explain())
+//	// 1:1   price              30
+//	// 1:9   qty                4
+//	// 1:7   price * qty        120
+//	// 1:13  price * qty > 100  true
+//
+// Tracers receive each instruction with the source map entry the compiler
+// recorded for it, so a Recorder needs nothing but the compiled expression.
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/vm"
+)
+
+// Kind is what an Event records.
+type Kind int
+
+const (
+	// Value is the value of a sub-expression.
+	Value Kind = iota
+	// Call is a function call that returned.
+	Call
+	// Pipe is a pipe stage that returned.
+	Pipe
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Value:
+		return "value"
+	case Call:
+		return "call"
+	case Pipe:
+		return "pipe"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Event is one recorded step of an evaluation.
+type Event struct {
+	Kind Kind
+	// Depth is 0 in the main expression and one more in each nested pipe
+	// predicate.
+	Depth int
+	// Node is the sub-expression of a Value event.
+	Node parser.Node
+	// Name is the function or pipe of a Call or Pipe event.
+	Name  string
+	Args  []any // arguments of a Call
+	Input any   // input of a Pipe
+	// Value is the value of the sub-expression, the result of the call or
+	// the output of the pipe.
+	Value any
+	Err   error
+}
+
+// Recorder is a vm.Tracer that records an evaluation. It is not safe for
+// concurrent use: record one evaluation at a time, with
+// uexl.CompiledExpr.EvalTrace.
+type Recorder struct {
+	// Limit caps the number of recorded events; 0 means no limit.
+	Limit int
+	// Events are the recorded events in evaluation order.
+	Events []Event
+	// Truncated is set when events were dropped because of Limit.
+	Truncated bool
+
+	depth int // depth of the last instruction, for calls and pipes
+}
+
+var _ vm.Tracer = (*Recorder)(nil)
+
+// Reset discards the recorded events, so that the recorder can be reused.
+func (r *Recorder) Reset() {
+	r.Events = r.Events[:0]
+	r.Truncated = false
+	r.depth = 0
+}
+
+func (r *Recorder) record(e Event) {
+	if r.Limit > 0 && len(r.Events) >= r.Limit {
+		r.Truncated = true
+		return
+	}
+	r.Events = append(r.Events, e)
+}
+
+// OnInstruction records the value of the sub-expression an instruction
+// completes.
+func (r *Recorder) OnInstruction(step vm.Step, stack []any) {
+	r.depth = step.Depth
+	if !step.Source.Result || step.Source.Node == nil || len(stack) == 0 {
+		return
+	}
+	r.record(Event{Kind: Value, Depth: step.Depth, Node: step.Source.Node, Value: stack[len(stack)-1]})
+}
+
+// OnCall records a function call.
+func (r *Recorder) OnCall(name string, args []any, result any, err error) {
+	r.record(Event{Kind: Call, Depth: r.depth, Name: name, Args: args, Value: result, Err: err})
+}
+
+// OnPipe records a pipe stage.
+func (r *Recorder) OnPipe(name string, input, output any, err error) {
+	r.record(Event{Kind: Pipe, Depth: r.depth, Name: name, Input: input, Value: output, Err: err})
+}
+
+// maxExplained is how many values of a sub-expression Explain lists.
+const maxExplained = 5
+
+// Explain lists each sub-expression other than literals with its source
+// position and the values it took, in the order they were first computed.
+// Predicates are indented under their pipe, which lists its output after
+// them.
+func (r *Recorder) Explain() string {
+	type line struct {
+		pos, text string
+		values    []string
+		count     int
+	}
+	var lines []*line
+	byNode := map[parser.Node]*line{}
+	for _, e := range r.Events {
+		if e.Kind != Value || isLiteral(e.Node) {
+			continue
+		}
+		l, ok := byNode[e.Node]
+		if !ok {
+			nl, col := Position(e.Node)
+			if nl == 0 {
+				continue // built by the compiler, not in the source
+			}
+			l = &line{pos: fmt.Sprintf("%d:%d", nl, col), text: strings.Repeat("  ", e.Depth) + Text(e.Node)}
+			byNode[e.Node] = l
+			lines = append(lines, l)
+		}
+		l.count++
+		if len(l.values) < maxExplained {
+			l.values = append(l.values, FormatValue(e.Value))
+		}
+	}
+
+	posWidth, textWidth := 0, 0
+	for _, l := range lines {
+		posWidth = max(posWidth, len(l.pos))
+		textWidth = max(textWidth, utf8.RuneCountInString(l.text))
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		values := strings.Join(l.values, ", ")
+		if l.count > len(l.values) {
+			values += fmt.Sprintf(", … (%d values)", l.count)
+		}
+		fmt.Fprintf(&b, "%-*s  %s%s  %s\n", posWidth, l.pos, l.text,
+			strings.Repeat(" ", textWidth-utf8.RuneCountInString(l.text)), values)
+	}
+	if r.Truncated {
+		fmt.Fprintf(&b, "(trace truncated after %d events)\n", len(r.Events))
+	}
+	return b.String()
+}
+
+// isLiteral reports whether node is a literal, whose value Explain need not
+// repeat.
+func isLiteral(node parser.Node) bool {
+	switch node.(type) {
+	case *parser.NumberLiteral, *parser.StringLiteral, *parser.BooleanLiteral, *parser.NullLiteral:
+		return true
+	}
+	return false
+}
+
+// Position returns the source position of a sub-expression: that of the
+// parser, or for a pipe stage, that of its predicate.
+func Position(node parser.Node) (line, column int) {
+	if stage, ok := node.(*parser.PipeExpression); ok && stage.Expression != nil {
+		return stage.Expression.Position()
+	}
+	return node.Position()
+}
+
+// maxText is the length at which Text shortens sub-expressions.
+const maxText = 40
+
+// Text returns the canonical source of a sub-expression on one line,
+// shortened to maxText characters. A pipe stage reads "|name: predicate".
+func Text(node parser.Node) string {
+	var text string
+	if stage, ok := node.(*parser.PipeExpression); ok {
+		text = "|" + stage.PipeType
+		if stage.Expression != nil {
+			pred := format.Node(stage.Expression, nil)
+			inner := stage.Expression
+			for g, ok := inner.(*parser.GroupedExpression); ok; g, ok = inner.(*parser.GroupedExpression) {
+				inner = g.Expression
+			}
+			if _, chain := inner.(*parser.ProgramNode); chain {
+				pred = "(" + pred + ")" // a nested chain reads as part of this one
+			}
+			text += ": " + pred
+		}
+	} else {
+		text = format.Node(node, nil)
+	}
+	return shorten(strings.Join(strings.Fields(text), " "), maxText)
+}
+
+// maxValue is the length at which FormatValue shortens values.
+const maxValue = 60
+
+// FormatValue returns v as compact JSON, or as fmt prints it when it has no
+// JSON form, shortened to maxValue characters. A range that has not been
+// expanded into an array reads as its range expression.
+func FormatValue(v any) string {
+	if r, ok := v.(*vm.Range); ok && r.Count > 0 {
+		text := fmt.Sprintf("%d..%d", r.Start, r.Start+(r.Count-1)*r.Step)
+		if r.Step != 1 {
+			text += fmt.Sprintf(" step %d", r.Step)
+		}
+		return text
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	text := fmt.Sprint(v)
+	if err := enc.Encode(v); err == nil {
+		text = strings.TrimSuffix(buf.String(), "\n")
+	}
+	return shorten(text, maxValue)
+}
+
+// shorten cuts s to n characters, ending it with "…" when it was longer.
+func shorten(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
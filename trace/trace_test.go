@@ -0,0 +1,107 @@
+package trace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func record(t *testing.T, rec *trace.Recorder, expr string, vars map[string]any) any {
+	t.Helper()
+	compiled, err := uexl.Default().Compile(expr)
+	require.NoError(t, err)
+	result, err := compiled.EvalTrace(context.Background(), vars, rec)
+	require.NoError(t, err)
+	return result
+}
+
+func TestRecorder_Explain(t *testing.T) {
+	rec := &trace.Recorder{}
+	result := record(t, rec, `price * qty > 100 ? "big" : "small"`, map[string]any{"price": 30.0, "qty": 4.0})
+	assert.Equal(t, "big", result)
+	assert.Equal(t, ""+
+		"1:1   price              30\n"+
+		"1:9   qty                4\n"+
+		"1:7   price * qty        120\n"+
+		"1:13  price * qty > 100  true\n", rec.Explain())
+}
+
+func TestRecorder_Pipes(t *testing.T) {
+	rec := &trace.Recorder{}
+	orders := []any{
+		map[string]any{"qty": 1.0, "tags": []any{"a", "b"}},
+		map[string]any{"qty": 3.0, "tags": []any{"b"}},
+	}
+	record(t, rec, `orders |filter: $item.qty > 1 |map: ($item.tags |filter: $item != "b")`, map[string]any{"orders": orders})
+	assert.Equal(t, ""+
+		"1:1   orders                                    [{\"qty\":1,\"tags\":[\"a\",\"b\"]},{\"qty\":3,\"tags\":[\"b\"]}]\n"+
+		"1:17    $item                                   {\"qty\":1,\"tags\":[\"a\",\"b\"]}, {\"qty\":3,\"tags\":[\"b\"]}\n"+
+		"1:22    $item.qty                               1, 3\n"+
+		"1:27    $item.qty > 1                           false, true\n"+
+		"1:27  |filter: $item.qty > 1                    [{\"qty\":3,\"tags\":[\"b\"]}]\n"+
+		"1:38    $item                                   {\"qty\":3,\"tags\":[\"b\"]}\n"+
+		"1:43    $item.tags                              [\"b\"]\n"+
+		"1:58      $item                                 \"b\"\n"+
+		"1:64      $item != \"b\"                          false\n"+
+		"1:64    |filter: $item != \"b\"                   []\n"+
+		"1:37  |map: ($item.tags |filter: $item != \"b\")  [[]]\n", rec.Explain())
+
+	var kinds []string
+	for _, e := range rec.Events {
+		if e.Kind == trace.Pipe {
+			kinds = append(kinds, e.Name)
+		}
+	}
+	assert.Equal(t, []string{"filter", "filter", "map"}, kinds)
+}
+
+func TestRecorder_ManyValues(t *testing.T) {
+	rec := &trace.Recorder{}
+	record(t, rec, `1..8 |map: $item * 2`, nil)
+	assert.Equal(t, ""+
+		"1:2   1..8             1..8\n"+
+		"1:12    $item          1, 2, 3, 4, 5, … (8 values)\n"+
+		"1:18    $item * 2      2, 4, 6, 8, 10, … (8 values)\n"+
+		"1:18  |map: $item * 2  [2,4,6,8,10,12,14,16]\n", rec.Explain())
+}
+
+func TestRecorder_Calls(t *testing.T) {
+	rec := &trace.Recorder{}
+	record(t, rec, `len(str(name))`, map[string]any{"name": "ab"})
+	var calls []trace.Event
+	for _, e := range rec.Events {
+		if e.Kind == trace.Call {
+			calls = append(calls, e)
+		}
+	}
+	require.Len(t, calls, 2)
+	assert.Equal(t, "str", calls[0].Name)
+	assert.Equal(t, []any{"ab"}, calls[0].Args)
+	assert.Equal(t, "ab", calls[0].Value)
+	assert.Equal(t, "len", calls[1].Name)
+	assert.Equal(t, 2.0, calls[1].Value)
+}
+
+func TestRecorder_Limit(t *testing.T) {
+	rec := &trace.Recorder{Limit: 3}
+	record(t, rec, `a + b + c`, map[string]any{"a": 1.0, "b": 2.0, "c": 3.0})
+	assert.Len(t, rec.Events, 3)
+	assert.True(t, rec.Truncated)
+	assert.Contains(t, rec.Explain(), "(trace truncated after 3 events)\n")
+
+	rec.Reset()
+	assert.Empty(t, rec.Events)
+	assert.False(t, rec.Truncated)
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, `{"a":"<b>"}`, trace.FormatValue(map[string]any{"a": "<b>"}))
+	assert.Equal(t, "null", trace.FormatValue(nil))
+	long := trace.FormatValue(make([]any, 40))
+	assert.Equal(t, 60, len([]rune(long)))
+	assert.Equal(t, "…", string([]rune(long)[59:]))
+}
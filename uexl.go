@@ -23,10 +23,64 @@ type PipeHandler = vm.PipeHandler
 // PipeHandlers is a registry mapping pipe names to their handler functions.
 type PipeHandlers = vm.PipeHandlers
 
+// PipeArgSpec describes one argument of a pipe's |name(args): header.
+type PipeArgSpec = vm.PipeArgSpec
+
+// PipeArgSchema lists, in order, the arguments a pipe handler accepts.
+type PipeArgSchema = vm.PipeArgSchema
+
+// PipeArgSchemas is a registry mapping pipe names to their argument schemas.
+type PipeArgSchemas = vm.PipeArgSchemas
+
+// Collator compares two strings for the sort pipe: negative, zero or positive
+// as a sorts before, equal to or after b.
+type Collator = vm.Collator
+
+// Collators is a registry mapping collator names to collators.
+type Collators = vm.Collators
+
+// Stream is a pull-based sequence of values flowing between fused pipe stages.
+type Stream = vm.Stream
+
+// StreamingPipe is implemented by pipes that can run lazily inside a fused pipe chain.
+type StreamingPipe = vm.StreamingPipe
+
+// StreamFunc adapts a function to StreamingPipe.
+type StreamFunc = vm.StreamFunc
+
+// StreamingPipes is a registry mapping pipe names to streaming implementations.
+type StreamingPipes = vm.StreamingPipes
+
+// Tracer observes evaluations instruction by instruction; see WithTracer and
+// CompiledExpr.EvalTrace.
+type Tracer = vm.Tracer
+
+// ErrorTracer is a Tracer that is also told which instruction an evaluation
+// failed in.
+type ErrorTracer = vm.ErrorTracer
+
+// TraceStep identifies an instruction reported to a Tracer.
+type TraceStep = vm.Step
+
+// SortKeyError is returned when the sort pipe meets two keys it cannot order.
+type SortKeyError = vm.SortKeyError
+
 // PipeContext provides pipe handlers with access to predicate evaluation and the
 // evaluation context. See §3.25 of the design spec for full interface semantics.
 type PipeContext = vm.PipeContext
 
+// Control is what PipeContext.EvalItemWithControl reports when a predicate
+// returns stop(), stop(value) or skip().
+type Control = vm.Control
+
+// The Control values; see vm.Control.
+const (
+	ControlContinue = vm.ControlContinue
+	ControlSkip     = vm.ControlSkip
+	ControlStop     = vm.ControlStop
+	ControlStopWith = vm.ControlStopWith
+)
+
 // ParserError is a single structured parse error (Line, Column, Code, Message).
 // Re-exported so callers never need to import github.com/maniartech/uexl/parser/errors.
 type ParserError = parsererrors.ParserError
@@ -61,6 +115,56 @@ func WithPipeHandlers(pipes PipeHandlers) Option {
 	return func(cfg *envConfig) {
 		for k, v := range pipes {
 			cfg.pipeHandlers[k] = v
+			delete(cfg.streamingPipes, k)
+		}
+	}
+}
+
+// WithStreamingPipes returns an Option that registers pipes that can run lazily
+// inside fused pipe chains (e.g. `items |myPipe: ... |find: ...`), where they
+// pull elements one at a time instead of receiving a whole array. Each pipe is
+// also registered as a PipeHandler (via vm.StreamingPipeHandler) for use outside
+// a chain. Later calls for the same key win, including over WithPipeHandlers.
+// Panics if pipes is nil.
+func WithStreamingPipes(pipes StreamingPipes) Option {
+	if pipes == nil {
+		panic("uexl: WithStreamingPipes: pipes must not be nil")
+	}
+	return func(cfg *envConfig) {
+		for k, v := range pipes {
+			cfg.streamingPipes[k] = v
+			cfg.pipeHandlers[k] = vm.StreamingPipeHandler(v)
+		}
+	}
+}
+
+// WithPipeArgSchemas returns an Option that merges schemas into the env's pipe
+// argument schemas. Expressions compiled in the env are checked against them:
+// argument counts and literal argument types at compile time, runtime-evaluated
+// argument types at each dispatch. Later calls for the same key win.
+// Panics if schemas is nil.
+func WithPipeArgSchemas(schemas PipeArgSchemas) Option {
+	if schemas == nil {
+		panic("uexl: WithPipeArgSchemas: schemas must not be nil")
+	}
+	return func(cfg *envConfig) {
+		for k, v := range schemas {
+			cfg.pipeArgs[k] = v
+		}
+	}
+}
+
+// WithCollators returns an Option that merges collators into the env's named
+// string collations, selectable with |sort("name"):. Use it to plug in
+// locale-aware ordering (e.g. golang.org/x/text/collate). Later calls for the
+// same key win. Panics if collators is nil.
+func WithCollators(collators Collators) Option {
+	if collators == nil {
+		panic("uexl: WithCollators: collators must not be nil")
+	}
+	return func(cfg *envConfig) {
+		for k, v := range collators {
+			cfg.collators[k] = v
 		}
 	}
 }
@@ -78,6 +182,54 @@ func WithGlobals(vars map[string]any) Option {
 	}
 }
 
+// WithMaxRangeLength returns an Option that caps how many elements a range value
+// (e.g. `1..n`) may expand to when it is materialized into an array — when it is
+// returned to the host, stored in an array or object literal, or passed to a
+// function or pipe that is not range-aware. Panics if n is not positive.
+// The default is vm.DefaultMaxRangeLength.
+func WithMaxRangeLength(n int) Option {
+	if n <= 0 {
+		panic("uexl: WithMaxRangeLength: n must be positive")
+	}
+	return func(cfg *envConfig) {
+		cfg.maxRangeLength = n
+	}
+}
+
+// WithParallelism returns an Option that caps how many goroutines the parallel
+// pipes (|pmap:, |pfilter:) split their input across; by default they use
+// runtime.GOMAXPROCS(0). n == 1 makes them run sequentially. Panics if n is not
+// positive.
+func WithParallelism(n int) Option {
+	if n <= 0 {
+		panic("uexl: WithParallelism: n must be positive")
+	}
+	return func(cfg *envConfig) {
+		cfg.parallelism = n
+	}
+}
+
+// WithSequentialFunctions returns an Option that marks functions as not safe
+// for concurrent use: a parallel pipe whose predicate calls one of them runs
+// sequentially instead.
+func WithSequentialFunctions(names ...string) Option {
+	return func(cfg *envConfig) {
+		for _, name := range names {
+			cfg.sequentialFuncs[name] = true
+		}
+	}
+}
+
+// WithTracer returns an Option that reports every evaluation in the env to t.
+// Evaluations may run concurrently, so t must be safe for concurrent use; to
+// trace a single evaluation, use CompiledExpr.EvalTrace instead. A nil t
+// removes a tracer inherited through Extend.
+func WithTracer(t Tracer) Option {
+	return func(cfg *envConfig) {
+		cfg.tracer = t
+	}
+}
+
 // WithLib returns an Option that calls lib.Apply during env construction, allowing
 // the lib to register functions, pipe handlers, and globals in a single step.
 // Panics if lib is nil.
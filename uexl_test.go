@@ -9,7 +9,9 @@ import (
 	"testing"
 
 	"github.com/maniartech/uexl"
+	"github.com/maniartech/uexl/parser"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // ── helpers ──────────────────────────────────────────────────────────────────
@@ -112,6 +114,16 @@ func TestEval_nullExpr(t *testing.T) {
 	assert.Nil(t, result)
 }
 
+func TestEval_groupByResultType(t *testing.T) {
+	// groupBy returns an ordinary object: map[string]any of []any groups.
+	result, err := uexl.Eval(`[1, 2, 3] |groupBy: $item > 1 ? "big" : "small"`, nil)
+	require.NoError(t, err)
+	groups, ok := result.(map[string]any)
+	require.True(t, ok, "got %T", result)
+	assert.Equal(t, []any{2.0, 3.0}, groups["big"])
+	assert.Equal(t, []any{1.0}, groups["small"])
+}
+
 // ── Default and NewEnv ───────────────────────────────────────────────────────
 
 func TestDefault_hasBuiltins(t *testing.T) {
@@ -229,11 +241,54 @@ func TestEnv_Compile_unknownFunctionInPipePredicate(t *testing.T) {
 	assert.Contains(t, err.Error(), "secret")
 }
 
+func TestEnv_Compile_errorPosition(t *testing.T) {
+	tests := []struct {
+		expr         string
+		line, column int
+	}{
+		{"score(x)", 1, 1},
+		{"1 +\n  foo(2)", 2, 3},
+		{"xs |map: bar($item)", 1, 10},
+		{"xs |window(\"a\"): $item", 1, 12},
+	}
+	for _, tt := range tests {
+		_, err := uexl.Default().Compile(tt.expr)
+		var ce *uexl.CompileError
+		if assert.ErrorAs(t, err, &ce, tt.expr) {
+			assert.Equal(t, [2]int{tt.line, tt.column}, [2]int{ce.Line, ce.Column}, tt.expr)
+		}
+	}
+}
+
 func TestEnv_Compile_knownFunction(t *testing.T) {
 	_, err := uexl.Default().Compile("len('hello')")
 	assert.NoError(t, err)
 }
 
+func TestEnv_CompileNode_rewritten(t *testing.T) {
+	node, err := parser.ParseString("add(x, rate) |: $last * 2")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	parser.Rewrite(node, func(n parser.Node) parser.Node {
+		if id, ok := n.(*parser.Identifier); ok && id.Name == "rate" {
+			return &parser.NumberLiteral{Value: 0.5}
+		}
+		return n
+	})
+	env := uexl.DefaultWith(uexl.WithFunctions(uexl.Functions{"add": addFn}))
+	ce, err := env.CompileNode(node)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	r, err := ce.Eval(bg, map[string]any{"x": 1.0})
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, r)
+
+	_, err = uexl.NewEnv().CompileNode(node)
+	assert.ErrorContains(t, err, "unknown function")
+}
+
 // ── MustCompile ──────────────────────────────────────────────────────────────
 
 func TestMustCompile_packageLevel(t *testing.T) {
@@ -505,6 +560,124 @@ func TestWithGlobals_inheritedByExtend(t *testing.T) {
 	assert.Equal(t, "global", result)
 }
 
+func TestWithMaxRangeLength_limitsMaterialization(t *testing.T) {
+	env := uexl.Default().Extend(uexl.WithMaxRangeLength(5))
+	result, err := env.Eval(bg, "1..5", nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{1.0, 2.0, 3.0, 4.0, 5.0}, result)
+
+	_, err = env.Eval(bg, "1..6", nil)
+	assert.ErrorContains(t, err, "exceeds maximum materialized length 5")
+
+	// Lazy operations never materialize, so the limit does not apply.
+	result, err = env.Eval(bg, "len(1..100)", nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 100.0, result)
+}
+
+func TestWithMaxRangeLength_inheritedByExtend(t *testing.T) {
+	child := uexl.Default().Extend(uexl.WithMaxRangeLength(2)).Extend()
+	_, err := child.Eval(bg, "1..3", nil)
+	assert.ErrorContains(t, err, "exceeds maximum materialized length 2")
+}
+
+func TestPipeArgs_runtimeExpression(t *testing.T) {
+	result, err := uexl.Default().Eval(bg, "[1, 2, 3, 4, 5] |chunk(config.batch): len($chunk)",
+		map[string]any{"config": map[string]any{"batch": 2.0}})
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{2.0, 2.0, 1.0}, result)
+}
+
+func TestPipeArgSchemas_compileTime(t *testing.T) {
+	env := uexl.Default()
+	_, err := env.Compile(`[1, 2, 3] |window("3"): $window`)
+	assert.EqualError(t, err, `compile error: pipe window argument "size" must be number, got string`)
+
+	_, err = env.Compile(`[1, 2, 3] |window(3, 4): $window`)
+	assert.EqualError(t, err, "compile error: pipe window expects at most 1 argument(s), got 2")
+
+	// Runtime args are counted at compile time but type-checked at eval time.
+	_, err = env.Compile(`[1, 2, 3] |window(n, m): $window`)
+	assert.EqualError(t, err, "compile error: pipe window expects at most 1 argument(s), got 2")
+	_, err = env.Eval(bg, `[1, 2, 3] |window(n): $window`, map[string]any{"n": true})
+	assert.EqualError(t, err, `pipe window argument "size" must be number, got boolean`)
+}
+
+func TestWithPipeArgSchemas_custom(t *testing.T) {
+	page := func(ctx uexl.PipeContext, input any) (any, error) {
+		args := ctx.Args()
+		arr := input.([]any)
+		size, offset := int(args[0].(float64)), 0
+		if len(args) > 1 {
+			offset = int(args[1].(float64))
+		}
+		end := offset + size
+		if end > len(arr) {
+			end = len(arr)
+		}
+		return arr[offset:end], nil
+	}
+	env := uexl.Default().Extend(
+		uexl.WithPipeHandlers(uexl.PipeHandlers{"page": page}),
+		uexl.WithPipeArgSchemas(uexl.PipeArgSchemas{"page": {
+			{Name: "size", Type: "number"},
+			{Name: "offset", Type: "number", Optional: true},
+		}}),
+	)
+
+	result, err := env.Eval(bg, "[1, 2, 3, 4, 5] |page(pageSize, 2): $item", map[string]any{"pageSize": 2.0})
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{3.0, 4.0}, result)
+
+	_, err = env.Compile("[1, 2] |page: $item")
+	assert.EqualError(t, err, "compile error: pipe page expects at least 1 argument(s), got 0")
+
+	// Schemas are inherited by Extend.
+	_, err = env.Extend().Compile(`[1, 2] |page("2"): $item`)
+	assert.EqualError(t, err, `compile error: pipe page argument "size" must be number, got string`)
+}
+
+// A custom pipe may be used without a predicate and decides what that means.
+func TestPipeHandler_hasPredicate(t *testing.T) {
+	first := func(ctx uexl.PipeContext, input any) (any, error) {
+		arr := input.([]any)
+		if !ctx.HasPredicate() {
+			return arr[0], nil
+		}
+		for i, item := range arr {
+			ok, err := ctx.EvalItem(item, i)
+			if err != nil || ok == true {
+				return item, err
+			}
+		}
+		return nil, nil
+	}
+	env := uexl.Default().Extend(uexl.WithPipeHandlers(uexl.PipeHandlers{"first": first}))
+
+	for expr, want := range map[string]any{
+		"[1, 2, 3] |first:":           1.0,
+		"[1, 2, 3] |first: $item > 1": 2.0,
+		"[[1, 2], [3]] |first: |sum:": 3.0,
+	} {
+		got, err := env.Eval(bg, expr, nil)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, got, expr)
+	}
+}
+
+func TestWithPipeArgSchemas_nil_panics(t *testing.T) {
+	assert.PanicsWithValue(t, "uexl: WithPipeArgSchemas: schemas must not be nil",
+		func() { uexl.WithPipeArgSchemas(nil) })
+}
+
 // ── Introspection ─────────────────────────────────────────────────────────────
 
 func TestEnv_HasFunction_true(t *testing.T) {
@@ -682,6 +855,11 @@ func TestWithGlobals_nil_panics(t *testing.T) {
 		func() { uexl.WithGlobals(nil) })
 }
 
+func TestWithMaxRangeLength_nonPositive_panics(t *testing.T) {
+	assert.PanicsWithValue(t, "uexl: WithMaxRangeLength: n must be positive",
+		func() { uexl.WithMaxRangeLength(0) })
+}
+
 func TestEnvConfig_AddFunctions_nil_panics(t *testing.T) {
 	assert.Panics(t, func() {
 		uexl.NewEnv(uexl.WithLib(panicOnApplyLib{fn: func(cfg *uexl.EnvConfig) {
@@ -1017,3 +1195,328 @@ func TestEnvConfig_AddGlobals_valid(t *testing.T) {
 	env := uexl.NewEnv(uexl.WithLib(lib))
 	assert.True(t, env.HasGlobal("libGlobal"))
 }
+
+func TestWithCollators_sort(t *testing.T) {
+	reverse := func(a, b string) int { return strings.Compare(b, a) }
+	env := uexl.Default().Extend(uexl.WithCollators(uexl.Collators{"reverse": reverse}))
+
+	result, err := env.Eval(bg, `["a", "c", "b"] |sort("reverse"): $item`, nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{"c", "b", "a"}, result)
+
+	// Collators are inherited by Extend but unknown to other envs.
+	result, err = env.Extend().Eval(bg, `["a", "c"] |sort("reverse", "desc"): $item`, nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{"a", "c"}, result)
+
+	_, err = uexl.Default().Eval(bg, `["a"] |sort("reverse"): $item`, nil)
+	assert.EqualError(t, err, `sort pipe: unknown option or collator "reverse"`)
+}
+
+func TestWithCollators_nil_panics(t *testing.T) {
+	assert.PanicsWithValue(t, "uexl: WithCollators: collators must not be nil", func() {
+		uexl.WithCollators(nil)
+	})
+}
+
+func TestSortKeyError_typed(t *testing.T) {
+	_, err := uexl.Default().Eval(bg, `[1, "a"] |sort: $item`, nil)
+	var keyErr *uexl.SortKeyError
+	if !errors.As(err, &keyErr) {
+		t.Fatalf("expected *uexl.SortKeyError, got %T: %v", err, err)
+	}
+	assert.Equal(t, 1.0, keyErr.Left)
+	assert.Equal(t, "a", keyErr.Right)
+}
+
+func TestPipeArgSchemas_sortOptions(t *testing.T) {
+	_, err := uexl.Default().Compile(`[1] |sort(1): $item`)
+	assert.EqualError(t, err, `compile error: pipe sort argument "option" must be string, got number`)
+}
+
+func TestDefault_aggregationPipes(t *testing.T) {
+	vars := map[string]any{"orders": []any{
+		map[string]any{"id": 1.0, "total": 12.5},
+		map[string]any{"id": 2.0, "total": 30.0},
+	}}
+	for expr, want := range map[string]any{
+		`orders |sum: $item.total`:               42.5,
+		`orders |maxBy: $item.total |: $last.id`: 2.0,
+		`[] |avg: $item`:                         nil,
+		`orders |count: $item.total > 20`:        1.0,
+	} {
+		result, err := uexl.Default().Eval(bg, expr, vars)
+		if err != nil {
+			t.Fatalf("%s: eval error: %v", expr, err)
+		}
+		assert.Equal(t, want, result, expr)
+	}
+}
+
+func TestReduce_initialArgument(t *testing.T) {
+	env := uexl.Default()
+	result, err := env.Eval(bg, "items |reduce(0): $acc + $item.qty", map[string]any{"items": []any{}})
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 0.0, result)
+
+	_, err = env.Compile("[1] |reduce(0, 1): $acc + $item")
+	assert.EqualError(t, err, "compile error: pipe reduce expects at most 1 argument(s), got 2")
+}
+
+func TestDefault_objectPipes(t *testing.T) {
+	vars := map[string]any{"stock": map[string]any{"pear": 0.0, "apple": 3.0, "fig": 5.0}}
+	for expr, want := range map[string]any{
+		`stock |filter: $value > 0`:                  map[string]any{"apple": 3.0, "fig": 5.0},
+		`stock |map: $value * 2 |keys: $key`:         []any{"apple", "fig", "pear"},
+		`stock |entries: $value |fromEntries: $item`: map[string]any{"pear": 0.0, "apple": 3.0, "fig": 5.0},
+		`stock |reduce(""): $acc + $key`:             "applefigpear",
+		`stock |values: $value |sum: $item`:          8.0,
+	} {
+		result, err := uexl.Default().Eval(bg, expr, vars)
+		if err != nil {
+			t.Fatalf("%s: eval error: %v", expr, err)
+		}
+		assert.Equal(t, want, result, expr)
+	}
+}
+
+func TestDefault_shapingPipes(t *testing.T) {
+	env := uexl.Default()
+	vars := map[string]any{"rows": []any{"h", "h", 1.0, 2.0, 3.0}}
+	for expr, want := range map[string]any{
+		`rows |skipWhile: typeof($item) == "string" |take(2): $item`: []any{1.0, 2.0},
+		`[1, 2, 3] |partition: $item > 1`:                            []any{[]any{2.0, 3.0}, []any{1.0}},
+		`rows |countBy: typeof($item)`:                               map[string]any{"string": 2.0, "number": 3.0},
+	} {
+		result, err := env.Eval(bg, expr, vars)
+		if err != nil {
+			t.Fatalf("%s: eval error: %v", expr, err)
+		}
+		assert.Equal(t, want, result, expr)
+	}
+
+	_, err := env.Compile("rows |take: $item")
+	assert.EqualError(t, err, "compile error: pipe take expects 1 argument(s), got 0")
+	_, err = env.Compile(`rows |skip("2"): $item`)
+	assert.EqualError(t, err, `compile error: pipe skip argument "count" must be number, got string`)
+}
+
+// evens is a streaming pipe that keeps the even numbers of its input, pulling
+// only as many elements as its consumer asks for.
+type evens struct{ in uexl.Stream }
+
+func (e evens) Next() (any, bool, error) {
+	for {
+		v, ok, err := e.in.Next()
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		if f, isNum := v.(float64); isNum && int(f)%2 == 0 {
+			return v, true, nil
+		}
+	}
+}
+
+func TestWithStreamingPipes(t *testing.T) {
+	pipes := uexl.StreamingPipes{"evens": uexl.StreamFunc(func(ctx uexl.PipeContext, in uexl.Stream) (uexl.Stream, error) {
+		return evens{in}, nil
+	})}
+	env := uexl.Default().Extend(uexl.WithStreamingPipes(pipes))
+
+	for expr, want := range map[string]any{
+		`[1, 2, 3, 4] |evens: $item`:                                    []any{2.0, 4.0},
+		`0..<1000000000 |evens: $item |take(3): $item`:                  []any{0.0, 2.0, 4.0},
+		`1..1000000000 |map: $item * 3 |evens: $item |find: $item > 10`: 12.0,
+	} {
+		result, err := env.Eval(bg, expr, nil)
+		if err != nil {
+			t.Fatalf("%s: eval error: %v", expr, err)
+		}
+		assert.Equal(t, want, result, expr)
+	}
+
+	// A plain handler registered later replaces the streaming pipe.
+	replaced := env.Extend(uexl.WithPipeHandlers(uexl.PipeHandlers{
+		"evens": func(ctx uexl.PipeContext, input any) (any, error) { return "handler", nil },
+	}))
+	result, err := replaced.Eval(bg, `[1, 2] |evens: $item |: $last`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "handler", result)
+}
+
+func TestWithStreamingPipes_nil_panics(t *testing.T) {
+	assert.PanicsWithValue(t, "uexl: WithStreamingPipes: pipes must not be nil", func() {
+		uexl.WithStreamingPipes(nil)
+	})
+}
+
+func TestParallelPipes(t *testing.T) {
+	env := uexl.Default().Extend(uexl.WithParallelism(4))
+	scores := make([]any, 10000)
+	for i := range scores {
+		scores[i] = map[string]any{"base": float64(i), "bonus": float64(i % 3)}
+	}
+	vars := map[string]any{"scores": scores, "weight": 2.0}
+
+	result, err := env.Eval(bg, `scores |pmap: $item.base * weight + $item.bonus |sum: $item`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 99999999.0, result)
+
+	result, err = env.Eval(bg, `scores |pfilter: $item.base >= 9998 |pmap: $index`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{0.0, 1.0}, result)
+
+	// An expired deadline stops the workers.
+	ctx, cancel := context.WithTimeout(bg, 0)
+	defer cancel()
+	_, err = env.Eval(ctx, `0..<1000000 |pmap: $item`, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWithSequentialFunctions(t *testing.T) {
+	calls := 0 // not synchronized: safe only if lookup is never called concurrently
+	env := uexl.Default().Extend(
+		uexl.WithFunctions(uexl.Functions{"lookup": func(args ...any) (any, error) {
+			calls++
+			return args[0], nil
+		}}),
+		uexl.WithParallelism(8),
+		uexl.WithSequentialFunctions("lookup"),
+	).Extend()
+
+	result, err := env.Eval(bg, `0..<5000 |pmap: lookup($item) |count: $item`, nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 5000.0, result)
+	assert.Equal(t, 5000, calls)
+}
+
+func TestWithParallelism_invalid_panics(t *testing.T) {
+	assert.PanicsWithValue(t, "uexl: WithParallelism: n must be positive", func() {
+		uexl.WithParallelism(0)
+	})
+}
+
+func TestPipeControl(t *testing.T) {
+	vars := map[string]any{"txns": []any{40.0, 35.0, 50.0, 20.0}, "limit": 100.0}
+	// accumulate until a threshold
+	result, err := uexl.Default().Eval(bg, `txns |reduce(0): $acc + $item > limit ? stop($acc) : $acc + $item`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 75.0, result)
+
+	result, err = uexl.Default().Eval(bg, `txns |map: $item < 30 ? stop() : $item >= 50 ? skip() : $item`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{40.0, 35.0}, result)
+
+	// a custom handler learns about the signals through EvalItemWithControl
+	firstN := func(ctx uexl.PipeContext, input any) (any, error) {
+		n := 0
+		for i, elem := range input.([]any) {
+			_, ctl, err := ctx.EvalItemWithControl(elem, i)
+			if err != nil {
+				return nil, err
+			}
+			if ctl == uexl.ControlStop {
+				break
+			}
+			n++
+		}
+		return float64(n), nil
+	}
+	env := uexl.Default().Extend(uexl.WithPipeHandlers(uexl.PipeHandlers{"countUntil": firstN}))
+	result, err = env.Eval(bg, `txns |countUntil: $item > 45 ? stop() : true`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 2.0, result)
+
+	_, err = uexl.Default().Eval(bg, `txns |sort: stop()`, vars)
+	assert.EqualError(t, err, "stop() and skip() cannot be used in a |sort: predicate")
+}
+
+func TestNestedPipes(t *testing.T) {
+	vars := map[string]any{"orders": []any{
+		map[string]any{"sku": "a", "lines": []any{
+			map[string]any{"sku": "a", "qty": 2.0},
+			map[string]any{"sku": "b", "qty": 1.0},
+		}},
+		map[string]any{"sku": "b", "lines": []any{
+			map[string]any{"sku": "b", "qty": 4.0},
+			map[string]any{"sku": "b", "qty": 3.0},
+		}},
+	}}
+	// the outer element is reachable through the alias...
+	result, err := uexl.Default().Eval(bg, `orders |map as $o: ($o.lines |filter: $item.sku == $o.sku |sum: $item.qty)`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{2.0, 7.0}, result)
+
+	// ...or $parent
+	result, err = uexl.Default().Eval(bg, `orders |map: ($item.lines |count: $item.sku == $parent.sku)`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{1.0, 2.0}, result)
+
+	// and $item is the outer element again once the inner pipe returns
+	result, err = uexl.Default().Eval(bg, `orders |map: [($item.lines |max: $item.qty), $item.sku]`, vars)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{[]any{2.0, "a"}, []any{4.0, "b"}}, result)
+}
+
+// countTracer counts the calls and pipe stages it sees.
+type countTracer struct{ calls, pipes int }
+
+func (c *countTracer) OnInstruction(uexl.TraceStep, []any)        {}
+func (c *countTracer) OnCall(string, []any, any, error)           { c.calls++ }
+func (c *countTracer) OnPipe(name string, in, out any, err error) { c.pipes++ }
+
+func TestTracer(t *testing.T) {
+	envTracer := &countTracer{}
+	env := uexl.DefaultWith(uexl.WithTracer(envTracer))
+	compiled, err := env.Compile(`[1, 2] |map: len(str($item)) |filter: $item > 0`)
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	result, err := compiled.Eval(bg, nil)
+	if err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, []any{1.0, 1.0}, result)
+	assert.Equal(t, countTracer{calls: 4, pipes: 2}, *envTracer)
+
+	// EvalTrace replaces the env's tracer for one evaluation
+	evalTracer := &countTracer{}
+	if _, err := compiled.EvalTrace(bg, nil, evalTracer); err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, countTracer{calls: 4, pipes: 2}, *evalTracer)
+	assert.Equal(t, countTracer{calls: 4, pipes: 2}, *envTracer)
+
+	// Extend inherits the tracer; WithTracer(nil) removes it
+	if _, err := env.Extend(uexl.WithTracer(nil)).Eval(bg, `len("a")`, nil); err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	if _, err := env.Extend().Eval(bg, `len("a")`, nil); err != nil {
+		t.Fatalf("eval error: %v", err)
+	}
+	assert.Equal(t, 5, envTracer.calls)
+}
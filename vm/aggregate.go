@@ -0,0 +1,199 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/maniartech/uexl/code"
+)
+
+// Aggregation pipes reduce an array to a single value. Their predicate is a
+// projection of each element (`orders |sum: $item.total`); `$item` projects the
+// element itself, and is what an omitted predicate compiles to (`prices |sum:`).
+// Null projections are skipped, so missing fields do not poison a result, and
+// each pipe has a defined result for empty input:
+//
+//	sum     0               avg    null
+//	min     null            max    null
+//	count   0               minBy  null     maxBy  null
+//
+// NaN propagates through sum, avg, min and max (any NaN value makes the result
+// NaN, per numeric-semantics.md). minBy and maxBy order keys like |sort:, where
+// NaN ranks after every number.
+
+// projector evaluates a pipe predicate as a projection of each element. When
+// the predicate is just `$item` (or the pipe's alias) the element is used as is
+// and the predicate is never run.
+type projector struct {
+	ctx      PipeContext
+	identity bool
+}
+
+func newProjector(ctx PipeContext) projector {
+	p := projector{ctx: ctx}
+	if pctx, ok := ctx.(*pipeContextImpl); ok {
+		p.identity = pctx.isIdentity()
+	}
+	return p
+}
+
+func (p projector) project(elem any, index int) (any, error) {
+	if p.identity {
+		return elem, nil
+	}
+	return p.ctx.EvalItem(elem, index)
+}
+
+// isIdentity reports whether the predicate is a bare `$item` or alias reference.
+func (p *pipeContextImpl) isIdentity() bool {
+	return p.predicateVar() == "$item"
+}
+
+// predicateVar returns the pipe variable the predicate consists of when it is a
+// bare reference such as `$key` (an alias reference reports "$item"), and ""
+// for any other predicate.
+func (p *pipeContextImpl) predicateVar() string {
+	if p.block == nil {
+		return ""
+	}
+	ins := p.block.Instructions
+	if len(ins) != 3 || code.Opcode(ins[0]) != code.OpIdentifier {
+		return ""
+	}
+	name, _ := p.vm.systemVars[code.ReadUint16(ins[1:3])].(string)
+	if p.alias != "" && name == p.alias {
+		return "$item"
+	}
+	return name
+}
+
+// eachNumber calls fn with every non-null projected value of input, which
+// must be numbers. It returns how many values were passed to fn.
+func eachNumber(pipe string, ctx PipeContext, input any, fn func(float64)) (int, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return 0, fmt.Errorf("%s pipe expects array input", pipe)
+	}
+	proj := newProjector(ctx)
+	n := 0
+	for i := 0; i < seq.Len(); i++ {
+		v, err := proj.project(seq.At(i), i)
+		if err != nil {
+			return 0, err
+		}
+		switch v := v.(type) {
+		case float64:
+			fn(v)
+			n++
+		case nil:
+		default:
+			return 0, fmt.Errorf("%s pipe expects number values, got %s for element %d", pipe, typeName(v), i)
+		}
+	}
+	return n, nil
+}
+
+func SumPipeHandler(ctx PipeContext, input any) (any, error) {
+	sum := 0.0
+	if _, err := eachNumber("sum", ctx, input, func(f float64) { sum += f }); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+func AvgPipeHandler(ctx PipeContext, input any) (any, error) {
+	sum := 0.0
+	n, err := eachNumber("avg", ctx, input, func(f float64) { sum += f })
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return sum / float64(n), nil
+}
+
+// CountPipeHandler counts the elements whose projection is neither null nor
+// false, so both `|count: $item.email` and `|count: $item.age >= 18` work.
+func CountPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("count pipe expects array input")
+	}
+	proj := newProjector(ctx)
+	n := 0
+	for i := 0; i < seq.Len(); i++ {
+		v, err := proj.project(seq.At(i), i)
+		if err != nil {
+			return nil, err
+		}
+		if b, isBool := v.(bool); v == nil || (isBool && !b) {
+			continue
+		}
+		n++
+	}
+	return float64(n), nil
+}
+
+func MinPipeHandler(ctx PipeContext, input any) (any, error) {
+	return extreme("min", ctx, input, false, true)
+}
+
+func MaxPipeHandler(ctx PipeContext, input any) (any, error) {
+	return extreme("max", ctx, input, true, true)
+}
+
+func MinByPipeHandler(ctx PipeContext, input any) (any, error) {
+	return extreme("minBy", ctx, input, false, false)
+}
+
+func MaxByPipeHandler(ctx PipeContext, input any) (any, error) {
+	return extreme("maxBy", ctx, input, true, false)
+}
+
+// extreme finds the least (or greatest) non-null projected key of input under
+// the |sort: ordering, returning the key itself when returnKey is set and the
+// first element holding it otherwise. A NaN key makes a returned key NaN.
+// Incomparable keys produce a *SortKeyError.
+func extreme(pipe string, ctx PipeContext, input any, greatest, returnKey bool) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("%s pipe expects array input", pipe)
+	}
+	proj := newProjector(ctx)
+	var opts sortOptions
+	var bestKey, bestElem any
+	bestIndex := -1
+	sawNaN := false
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		key, err := proj.project(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		if f, isNum := key.(float64); isNum && returnKey && math.IsNaN(f) {
+			sawNaN = true
+		}
+		if bestIndex < 0 {
+			bestKey, bestElem, bestIndex = key, elem, i
+			continue
+		}
+		c, l, r, ok := opts.compare(key, bestKey)
+		if !ok {
+			return nil, &SortKeyError{Pipe: pipe, Left: r, Right: l, LeftIndex: bestIndex, RightIndex: i}
+		}
+		if (greatest && c > 0) || (!greatest && c < 0) {
+			bestKey, bestElem, bestIndex = key, elem, i
+		}
+	}
+	switch {
+	case !returnKey:
+		return bestElem, nil
+	case sawNaN:
+		return math.NaN(), nil
+	}
+	return bestKey, nil
+}
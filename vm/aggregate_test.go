@@ -0,0 +1,109 @@
+package vm_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/maniartech/uexl/vm"
+)
+
+var aggregateOrders = map[string]any{
+	"orders": []any{
+		map[string]any{"id": "a", "total": 10.0, "user": map[string]any{"age": 30.0}},
+		map[string]any{"id": "b", "total": 25.0, "user": map[string]any{"age": 41.0}},
+		map[string]any{"id": "c", "total": 5.0, "user": map[string]any{"age": 41.0}},
+		map[string]any{"id": "d", "total": nil, "user": map[string]any{"age": 19.0}},
+	},
+}
+
+func TestAggregationPipes(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3] |sum: $item`, 6.0},
+		{`orders |sum: $item.total`, 40.0},
+		{`[] |sum: $item`, 0.0},
+		{`[null, null] |sum: $item`, 0.0},
+		{`1..100 |sum: $item`, 5050.0},
+
+		{`[1, 2, 3, 4] |avg: $item`, 2.5},
+		{`orders |avg: $item.total`, 40.0 / 3},
+		{`[] |avg: $item`, nil},
+		{`[null] |avg: $item`, nil},
+
+		{`[3, 1, 2] |min: $item`, 1.0},
+		{`[3, 1, 2] |max: $item`, 3.0},
+		{`["pear", "apple"] |min: $item`, "apple"},
+		{`orders |max: $item.total`, 25.0},
+		{`orders |min: $item.user.age`, 19.0},
+		{`[] |min: $item`, nil},
+		{`[] |max: $item`, nil},
+		{`[[1, 2], [1, 3]] |max: $item`, []any{1.0, 3.0}},
+
+		{`[1, null, 0, false, true, ""] |count: $item`, 4.0},
+		{`orders |count: $item.total`, 3.0},
+		{`orders |count: $item.user.age > 25`, 3.0},
+		{`[] |count: $item`, 0.0},
+		{`0..<1000 |count: $item < 3`, 3.0},
+
+		// The projection is optional.
+		{`[1, 2, null, 4] |sum:`, 7.0},
+		{`[1, 2, 3, 4] |avg:`, 2.5},
+		{`([3, 1, 2] |min:) + ([3, 1, 2] |max:)`, 4.0},
+		{`[[1, 2] |count:, 0]`, []any{2.0, 0.0}},
+		{`{"total": [1, 2] |sum:}`, map[string]any{"total": 3.0}},
+
+		{`orders |maxBy: $item.total |: $last.id`, "b"},
+		{`orders |minBy: $item.total |: $last.id`, "c"},
+		{`orders |maxBy: $item.user.age |: $last.id`, "b"}, // ties keep the first element
+		{`orders |minBy: [-$item.user.age, $item.total] |: $last.id`, "c"},
+		{`[] |maxBy: $item`, nil},
+		{`[null] |minBy: $item`, nil},
+	}
+	runVmTests(t, tests, aggregateOrders)
+}
+
+func TestAggregationPipes_NaN(t *testing.T) {
+	for _, input := range []string{
+		`[1, NaN, 2] |sum: $item`,
+		`[1, NaN, 2] |avg: $item`,
+		`[1, NaN, 2] |min: $item`,
+		`[1, NaN, 2] |max: $item`,
+		`[Inf, -Inf] |sum: $item`,
+	} {
+		out, err := runSort(input, vm.LibContext{})
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if f, ok := out.(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("%s: expected NaN, got %v", input, out)
+		}
+	}
+
+	// minBy/maxBy rank NaN keys after every number, as |sort: does.
+	out, err := runSort(`[1, NaN, 2] |maxBy: $item`, vm.LibContext{})
+	if f, ok := out.(float64); err != nil || !ok || !math.IsNaN(f) {
+		t.Errorf("maxBy: expected NaN element, got %v (%v)", out, err)
+	}
+	out, err = runSort(`[1, NaN, 2] |minBy: $item`, vm.LibContext{})
+	if err != nil || out != 1.0 {
+		t.Errorf("minBy: expected 1, got %v (%v)", out, err)
+	}
+}
+
+func TestAggregationPipes_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, "2"] |sum: $item`, "sum pipe expects number values, got string for element 1"},
+		{`[true] |avg: $item`, "avg pipe expects number values, got boolean for element 0"},
+		{`5 |sum: $item`, "sum pipe expects array input"},
+		{`"abc" |count: $item`, "count pipe expects array input"},
+		{`[1, "a"] |max: $item`, "max pipe cannot compare number key of element 0 with string key of element 1"},
+		{`[{"a": 1}, {"a": 2}] |minBy: $item`, "minBy pipe cannot compare object key of element 0 with object key of element 1"},
+	}
+	runVmErrorTests(t, tests)
+
+	_, err := runSort(`[1, null, "a"] |maxBy: $item`, vm.LibContext{})
+	var keyErr *vm.SortKeyError
+	if !errors.As(err, &keyErr) || keyErr.Pipe != "maxBy" || keyErr.LeftIndex != 0 || keyErr.RightIndex != 2 {
+		t.Fatalf("expected *vm.SortKeyError for maxBy, got %#v", err)
+	}
+}
@@ -30,6 +30,16 @@ var Builtins = VMFunctions{
 
 	// Reassemble
 	"join": builtinJoin,
+
+	// Type inspection
+	"typeof":    builtinTypeof,
+	"isNullish": builtinIsNullish,
+	"isTruthy":  builtinIsTruthy,
+	"isFalsy":   builtinIsFalsy,
+
+	// Pipe control
+	"stop": builtinStop,
+	"skip": builtinSkip,
 }
 
 // len("abc") or len([1,2,3])
@@ -42,6 +52,8 @@ func builtinLen(args ...any) (any, error) {
 		return float64(len(v)), nil
 	case []any:
 		return float64(len(v)), nil
+	case *Range:
+		return float64(v.Len()), nil
 	default:
 		return nil, fmt.Errorf("len: unsupported type %T", args[0])
 	}
@@ -121,6 +133,38 @@ func builtinStr(args ...any) (any, error) {
 	return fmt.Sprintf("%v", args[0]), nil
 }
 
+// typeof(x) => "number" | "string" | "boolean" | "null" | "array" | "object"
+func builtinTypeof(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("typeof expects 1 argument")
+	}
+	return typeName(args[0]), nil
+}
+
+// isNullish(x) => true only for null
+func builtinIsNullish(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("isNullish expects 1 argument")
+	}
+	return isNullish(args[0]), nil
+}
+
+// isTruthy(x) => the truthiness used by &&, || and conditions
+func builtinIsTruthy(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("isTruthy expects 1 argument")
+	}
+	return isTruthy(args[0]), nil
+}
+
+// isFalsy(x) => !isTruthy(x)
+func builtinIsFalsy(args ...any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("isFalsy expects 1 argument")
+	}
+	return !isTruthy(args[0]), nil
+}
+
 // ---- helpers ----------------------------------------------------------------
 
 func requireOneString(name string, args []any) (string, error) {
@@ -0,0 +1,170 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// A pipe predicate can steer the pipe evaluating it by returning the result of
+// stop() or skip():
+//
+//	orders |map: $item.total > 100 ? stop() : $item.id        // ids up to the first big order
+//	rows   |filter: $item.header ? skip() : $item.valid        // ignore header rows
+//	nums   |reduce(0): $acc > 100 ? stop($acc) : $acc + $item  // accumulate until a threshold
+//
+// map, filter, flatMap and reduce honour these signals, in fused chains too;
+// custom handlers see them through PipeContext.EvalItemWithControl. Every
+// other pipe reports an error rather than treat the signal as a value, and so
+// does storing a signal in an array, object or local, or passing it to a
+// function.
+
+// Control tells a pipe handler how to continue after evaluating its predicate
+// for an element.
+type Control int
+
+const (
+	// ControlContinue: the predicate returned an ordinary value.
+	ControlContinue Control = iota
+	// ControlSkip: the predicate returned skip(); the element contributes
+	// nothing and iteration continues.
+	ControlSkip
+	// ControlStop: the predicate returned stop(); iteration ends before the
+	// element, which contributes nothing.
+	ControlStop
+	// ControlStopWith: the predicate returned stop(value); value is the
+	// element's result and iteration ends after it.
+	ControlStopWith
+)
+
+// keeps reports whether the element's result should be used.
+func (c Control) keeps() bool { return c == ControlContinue || c == ControlStopWith }
+
+// stops reports whether iteration should end.
+func (c Control) stops() bool { return c == ControlStop || c == ControlStopWith }
+
+func (c Control) String() string {
+	switch c {
+	case ControlSkip:
+		return "skip"
+	case ControlStop:
+		return "stop"
+	case ControlStopWith:
+		return "stopWith"
+	}
+	return "continue"
+}
+
+// controlSignal is the value of stop(...) and skip(). It only means something
+// as the result of a pipe predicate.
+type controlSignal struct {
+	control Control
+	value   any
+}
+
+var (
+	skipSignal = &controlSignal{control: ControlSkip}
+	stopSignal = &controlSignal{control: ControlStop}
+)
+
+// errMisplacedControl reports a stop() or skip() whose value would outlive
+// the predicate it steers: returned from the expression, stored in an array,
+// an object or a statement's local, or passed to a function.
+var errMisplacedControl = errors.New("stop() and skip() can only be used as the result of a pipe predicate")
+
+// isControl reports whether v is the value of stop(...) or skip().
+func isControl(v any) bool {
+	_, ok := v.(*controlSignal)
+	return ok
+}
+
+// stop() or stop(value)
+func builtinStop(args ...any) (any, error) {
+	switch len(args) {
+	case 0:
+		return stopSignal, nil
+	case 1:
+		return &controlSignal{control: ControlStopWith, value: args[0]}, nil
+	}
+	return nil, fmt.Errorf("stop expects at most 1 argument")
+}
+
+// skip()
+func builtinSkip(args ...any) (any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("skip expects no arguments")
+	}
+	return skipSignal, nil
+}
+
+// controlOf splits a predicate result into its value and control signal.
+func controlOf(v any) (any, Control) {
+	if sig, ok := v.(*controlSignal); ok {
+		return sig.value, sig.control
+	}
+	return v, ControlContinue
+}
+
+// EvalItemWithControl is EvalItem for handlers that honour stop() and skip():
+// the signal is returned as ctl instead of being reported as an error.
+func (p *pipeContextImpl) EvalItemWithControl(item any, index int) (any, Control, error) {
+	res, err := p.evalItem(item, index)
+	if err != nil {
+		return nil, ControlContinue, err
+	}
+	v, ctl := controlOf(res)
+	return v, ctl, nil
+}
+
+// evalWithControl is EvalWith honouring stop() and skip().
+func evalWithControl(ctx PipeContext, scopeVars map[string]any) (any, Control, error) {
+	var res any
+	var err error
+	if p, ok := ctx.(*pipeContextImpl); ok {
+		res, err = p.evalWith(scopeVars)
+	} else {
+		res, err = ctx.EvalWith(scopeVars)
+	}
+	if err != nil {
+		return nil, ControlContinue, err
+	}
+	v, ctl := controlOf(res)
+	return v, ctl, nil
+}
+
+// evalEntryWithControl is evalEntry honouring stop() and skip().
+func evalEntryWithControl(ctx PipeContext, key string, value any, index int) (any, Control, error) {
+	var res any
+	var err error
+	if p, ok := ctx.(*pipeContextImpl); ok {
+		res, err = p.evalEntryRaw(key, value, index)
+	} else {
+		res, err = ctx.EvalWith(map[string]any{"$item": value, "$key": key, "$value": value, "$index": index})
+	}
+	if err != nil {
+		return nil, ControlContinue, err
+	}
+	v, ctl := controlOf(res)
+	return v, ctl, nil
+}
+
+// rejectControl reports a stop() or skip() returned to a handler that does
+// not honour them.
+func (p *pipeContextImpl) rejectControl(v any, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(*controlSignal); ok {
+		return nil, fmt.Errorf("stop() and skip() cannot be used in a %s predicate", pipeLabel(p.name))
+	}
+	return v, nil
+}
+
+// pipeLabel returns how a pipe is written in an expression, e.g. "|map:".
+func pipeLabel(name string) string {
+	if name == constants.DefaultPipeType {
+		return "|:"
+	}
+	return "|" + name + ":"
+}
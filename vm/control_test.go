@@ -0,0 +1,137 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/maniartech/uexl/vm"
+)
+
+func TestPipeControl_MapFilterFlatMap(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3, 4] |map: $item > 2 ? stop() : $item * 10`, []any{10.0, 20.0}},
+		{`[1, 2, 3, 4] |map: $item == 2 ? stop("x") : $item`, []any{1.0, "x"}},
+		{`[1, 2, 3, 4] |map: $item % 2 == 0 ? skip() : $item`, []any{1.0, 3.0}},
+		{`{"a": 1, "b": 2, "c": 3} |map: $key == "b" ? skip() : $value`, map[string]any{"a": 1.0, "c": 3.0}},
+		{`[1, 2, 3, 4, 5] |filter: $item > 3 ? stop() : $item % 2 == 1`, []any{1.0, 3.0}},
+		{`[1, 2, 3] |filter: $item == 2 ? stop(true) : true`, []any{1.0, 2.0}},
+		{`[1, 2, 3] |filter: $item == 2 ? skip() : true`, []any{1.0, 3.0}},
+		{`{"a": 1, "b": 2} |filter: $key == "a" ? stop() : true`, map[string]any{}},
+		{`1..10 |filter: $item > 4 ? stop() : true`, []any{1.0, 2.0, 3.0, 4.0}},
+		{`[[1, 2], [3], [4]] |flatMap: len($item) == 1 ? stop($item) : $item`, []any{1.0, 2.0, 3.0}},
+		{`[[1], [2], [3]] |flatMap: $index == 1 ? skip() : $item`, []any{1.0, 3.0}},
+
+		// stop() ends the iteration: later elements are never evaluated
+		{`[1, 2, "x"] |map: $item == 2 ? stop() : $item`, []any{1.0}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPipeControl_Reduce(t *testing.T) {
+	tests := []vmTestCase{
+		// accumulate until a threshold
+		{`[10, 20, 30, 40] |reduce(0): $acc >= 30 ? stop() : $acc + $item`, 30.0},
+		{`[1, 2, 3] |reduce(0): $item == 2 ? stop(-1) : $acc + $item`, -1.0},
+		{`[1, 2, 3, 4] |reduce(0): $item % 2 == 0 ? skip() : $acc + $item`, 4.0},
+		{`[5, 1, 2] |reduce: $index == 0 ? stop() : $acc + $item`, nil},
+		{`{"a": 1, "b": 2, "c": 3} |reduce(0): $key == "c" ? stop() : $acc + $value`, 3.0},
+		{`{"a": 1, "b": 2} |reduce(0): $key == "a" ? skip() : $acc + $value`, 2.0},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPipeControl_Chains(t *testing.T) {
+	tests := []vmTestCase{
+		// fused chains honour the signals and stop pulling upstream
+		{`0..<1000000000 |map: $item > 2 ? stop() : $item |map: $item * 2`, []any{0.0, 2.0, 4.0}},
+		{`[1, 2, "x"] |map: $item == 2 ? stop() : $item |filter: true`, []any{1.0}},
+		{`[1, 2, 3, 4] |filter: $item == 2 ? skip() : true |map: $item == 4 ? stop() : $item`, []any{1.0, 3.0}},
+		{`[[1, 2], [3]] |flatMap: $index == 1 ? stop() : $item |map: $item + 1`, []any{2.0, 3.0}},
+		{`0..<1000000000 |filter: $item == 5 ? stop(true) : $item % 2 == 1 |find: $item > 4`, 5.0},
+		// and so do stages dispatched one by one
+		{`[3, 1, 2] |sort: $item |map: $item > 1 ? stop() : $item`, []any{1.0}},
+		// parallel pipes run sequentially when the predicate uses stop or skip
+		{`0..<1000 |pmap: $item == 3 ? stop() : $item`, []any{0.0, 1.0, 2.0}},
+		{`0..<1000 |pfilter: $item > 1 ? stop() : true`, []any{0.0, 1.0}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPipeControl_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2] |sort: stop()`, "stop() and skip() cannot be used in a |sort: predicate"},
+		{`[1, 2] |map: $item |find: skip()`, "stop() and skip() cannot be used in a |find: predicate"},
+		{`[1, 2] |take(1): skip()`, "stop() and skip() cannot be used in a |take: predicate"},
+		{`5 |: stop($last)`, "stop() and skip() cannot be used in a |: predicate"},
+		{`stop(1)`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`[1] |map: stop(1, 2)`, "error calling function stop: stop expects at most 1 argument"},
+		{`[1] |map: skip($item)`, "error calling function skip: skip expects no arguments"},
+
+		// a signal only steers a pipe as the predicate's own result
+		{`[stop(1)]`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`{"a": skip()}`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`[1, 2] |map: [stop(1)]`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`[1, 2] |map: {"v": $item > 1 ? skip() : $item}`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`len([skip()])`, "stop() and skip() can only be used as the result of a pipe predicate"},
+		{`[1, 2] |map: str(stop())`, "error calling function str: stop() and skip() can only be used as the result of a pipe predicate"},
+		{`[1] |map: stop(skip())`, "error calling function stop: stop() and skip() can only be used as the result of a pipe predicate"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+// runningSum is a custom scan honouring stop() and skip(): it emits the running
+// total of the projected values.
+func runningSum(ctx vm.PipeContext, input any) (any, error) {
+	arr, _ := input.([]any)
+	result := make([]any, 0, len(arr))
+	total := 0.0
+	for i, elem := range arr {
+		v, ctl, err := ctx.EvalItemWithControl(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		switch ctl {
+		case vm.ControlStop:
+			return result, nil
+		case vm.ControlSkip:
+			continue
+		}
+		total += v.(float64)
+		result = append(result, total)
+		if ctl == vm.ControlStopWith {
+			break
+		}
+	}
+	return result, nil
+}
+
+func TestPipeControl_CustomHandler(t *testing.T) {
+	handlers := vm.PipeHandlers{"runningSum": runningSum}
+	for name, h := range vm.DefaultPipeHandlers {
+		handlers[name] = h
+	}
+	lib := vm.LibContext{PipeHandlers: handlers}
+	for expr, want := range map[string]any{
+		`[1, 2, 3, 4] |runningSum: $item`:                                   []any{1.0, 3.0, 6.0, 10.0},
+		`[1, 2, 3, 4] |runningSum: $item == 3 ? stop() : $item`:             []any{1.0, 3.0},
+		`[1, 2, 3, 4] |runningSum: $item == 3 ? stop(100) : $item`:          []any{1.0, 3.0, 103.0},
+		`[1, 2, 3, 4] |runningSum: $item % 2 == 0 ? skip() : $item * 10`:    []any{10.0, 40.0},
+		`[1, 2, 3] |map: $item * 2 |runningSum: $item > 4 ? stop() : $item`: []any{2.0, 6.0},
+	} {
+		if err := testExpectedObject(t, want, runChain(t, expr, lib)); err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+	}
+}
+
+func TestControl_String(t *testing.T) {
+	for ctl, want := range map[vm.Control]string{
+		vm.ControlContinue: "continue",
+		vm.ControlSkip:     "skip",
+		vm.ControlStop:     "stop",
+		vm.ControlStopWith: "stopWith",
+	} {
+		if ctl.String() != want {
+			t.Errorf("Control(%d).String() = %q, want %q", int(ctl), ctl.String(), want)
+		}
+	}
+}
@@ -17,6 +17,8 @@ func (vm *VM) executeIndexExpression(left, index any, optional bool) error {
 	switch typedLeft := left.(type) {
 	case []any:
 		return vm.executeArrayIndex(typedLeft, index)
+	case *Range:
+		return vm.executeRangeIndex(typedLeft, index)
 	case map[string]any:
 		return vm.executeObjectKey(typedLeft, index)
 	case string:
@@ -49,6 +51,29 @@ func (vm *VM) executeArrayIndex(array []any, index any) error {
 	return vm.Push(array[intIdx])
 }
 
+func (vm *VM) executeRangeIndex(r *Range, index any) error {
+	idxVal, ok := index.(float64)
+	if !ok {
+		return fmt.Errorf("array index must be a number, got %s", reflect.TypeOf(index).String())
+	}
+
+	intIdx := int(idxVal)
+	if float64(intIdx) != idxVal {
+		return fmt.Errorf("array index must be an integer, got %f", idxVal)
+	}
+
+	max := r.Len()
+	if intIdx < 0 {
+		intIdx = max + intIdx
+	}
+
+	if intIdx < 0 || intIdx >= max {
+		return fmt.Errorf("array index out of bounds: %d", intIdx)
+	}
+
+	return vm.Push(r.At(intIdx))
+}
+
 func (vm *VM) executeObjectKey(obj map[string]any, key any) error {
 	var keyStr string
 	switch v := key.(type) {
@@ -0,0 +1,86 @@
+package vm_test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNestedPipes_OuterScope(t *testing.T) {
+	tests := []vmTestCase{
+		// the outer $item and $index survive an inner pipe
+		{`[1, 2] |map: [([10, 20] |map: $item), $item, $index]`, []any{
+			[]any{[]any{10.0, 20.0}, 1.0, 0.0},
+			[]any{[]any{10.0, 20.0}, 2.0, 1.0},
+		}},
+		{`[[1, 2], [3]] |map: [($item |filter: $item > 1), $item]`, []any{
+			[]any{[]any{2.0}, []any{1.0, 2.0}},
+			[]any{[]any{3.0}, []any{3.0}},
+		}},
+		{`[[1, 2], [3]] |reduce(0): $acc + ($item |sum: $item)`, 6.0},
+		{`{"a": [1, 2], "b": [3]} |map: [$key, ($value |map: $item * 10), $key]`, map[string]any{
+			"a": []any{"a", []any{10.0, 20.0}, "a"},
+			"b": []any{"b", []any{30.0}, "b"},
+		}},
+		// outer variables an inner pipe does not set stay visible in it
+		{`[[1, 2], [3]] |reduce(100): $acc + ($item |map: $acc)[0]`, 400.0},
+		// fused inner chains too
+		{`[1, 2] |map: [(0..<10 |map: $item * $parent |filter: $item > 2 |find: true), $item]`, []any{
+			[]any{3.0, 1.0},
+			[]any{4.0, 2.0},
+		}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestNestedPipes_Aliases(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2] |map as $o: ([10, 20] |map: $o + $item)`, []any{[]any{11.0, 21.0}, []any{12.0, 22.0}}},
+		{`[1, 2] |map: $item * 2 as $x`, []any{2.0, 4.0}},
+		{`[[1, 2], [3]] |map as $xs: ($xs |map as $x: $x / len($xs))`, []any{[]any{0.5, 1.0}, []any{3.0}}},
+		// inner aliases shadow outer ones and end with their pipe
+		{`[1, 2] |map as $x: [([10] |map as $x: $x), $x]`, []any{[]any{[]any{10.0}, 1.0}, []any{[]any{10.0}, 2.0}}},
+		// a stored value is visible to the pipe that follows
+		{`[1, 2] as $xs |map: len($xs) + $item`, []any{3.0, 4.0}},
+		{`[[1, 2], [3]] |map: ($item as $row |map: len($row))`, []any{[]any{2.0, 2.0}, []any{1.0}}},
+		{`[1, 2, 3] |reduce(0) as $n: $acc + $n`, 6.0},
+	}
+	runVmTests(t, tests)
+}
+
+func TestNestedPipes_Parent(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2] |map: ([10, 20] |map: [$parent, $item])`, []any{
+			[]any{[]any{1.0, 10.0}, []any{1.0, 20.0}},
+			[]any{[]any{2.0, 10.0}, []any{2.0, 20.0}},
+		}},
+		// $parent is one level up
+		{`[1] |map: ([2] |map: ([3] |map: [$parent, $item]))`, []any{[]any{[]any{[]any{2.0, 3.0}}}}},
+		{`[[1, 5], [3]] |filter: ($item |some: $item > 4 && len($parent) == 2)`, []any{[]any{1.0, 5.0}}},
+	}
+	runVmTests(t, tests)
+
+	const undefinedParent = "undefined pipe variable: $parent (it is the $item of the enclosing pipe, so it is only set in a pipe nested in another pipe's predicate)"
+	runVmErrorTests(t, []vmTestCase{
+		{`[1, 2] |map: $parent`, undefinedParent},
+		{`[1] |map: ([2] |map: $item) |map: $parent`, undefinedParent},
+		{`$parent`, undefinedParent},
+	})
+}
+
+func TestNestedPipes_Parallel(t *testing.T) {
+	lib, _ := parallelLib(nil)
+	got, err := evalParallel(context.Background(), `[1, 2] |map: (0..<1000 |pmap: $item + $parent |sum: $item)`, lib, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testExpectedObject(t, []any{500500.0, 501500.0}, got); err != nil {
+		t.Fatal(err)
+	}
+	got, err = evalParallel(context.Background(), `0..<1000 |pmap: [$item, ([1, 2] |map: $parent + $item)[1], $item] |filter: $item[0] + 2 != $item[1] || $item[0] != $item[2]`, lib, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testExpectedObject(t, []any{}, got); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+package vm
+
+import "fmt"
+
+// Object pipes convert between objects and arrays. Entries are visited in key
+// order and exposed as $key, $value (also $item) and $index; an entry is
+// represented as a [key, value] array.
+//
+// The predicate projects what each entry contributes, so the plain forms are
+//
+//	obj |keys: $key          // ["a", "b"]
+//	obj |values: $value      // [1, 2]
+//	obj |entries: $value     // [["a", 1], ["b", 2]]
+//	pairs |fromEntries: $item
+//
+// and these bare references are read directly without running the predicate.
+// The predicate may also be omitted: `obj |keys:` is `obj |keys: $key`.
+
+// entryProjection evaluates the predicate for one object entry unless it is
+// omitted or a bare reference to one of direct, in which case v is returned as
+// is.
+type entryProjection struct {
+	ctx    PipeContext
+	direct bool
+}
+
+func newEntryProjection(ctx PipeContext, direct ...string) entryProjection {
+	p := entryProjection{ctx: ctx, direct: !ctx.HasPredicate()}
+	if pctx, ok := ctx.(*pipeContextImpl); ok {
+		name := pctx.predicateVar()
+		for _, d := range direct {
+			if name == d {
+				p.direct = true
+			}
+		}
+	}
+	return p
+}
+
+func (p entryProjection) project(key string, value any, index int, v any) (any, error) {
+	if p.direct {
+		return v, nil
+	}
+	return evalEntry(p.ctx, key, value, index)
+}
+
+func objectInput(pipe string, input any) (map[string]any, error) {
+	obj, ok := input.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s pipe expects object input", pipe)
+	}
+	return obj, nil
+}
+
+// KeysPipeHandler returns the projection of every entry of an object; without
+// a predicate or with `$key`, its sorted keys.
+func KeysPipeHandler(ctx PipeContext, input any) (any, error) {
+	obj, err := objectInput("keys", input)
+	if err != nil {
+		return nil, err
+	}
+	proj := newEntryProjection(ctx, "$key")
+	keys := objectKeys(obj)
+	result := make([]any, len(keys))
+	for i, k := range keys {
+		if result[i], err = proj.project(k, obj[k], i, k); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ValuesPipeHandler returns the projection of every entry of an object;
+// without a predicate or with `$value`, its values in key order.
+func ValuesPipeHandler(ctx PipeContext, input any) (any, error) {
+	obj, err := objectInput("values", input)
+	if err != nil {
+		return nil, err
+	}
+	proj := newEntryProjection(ctx, "$value", "$item")
+	keys := objectKeys(obj)
+	result := make([]any, len(keys))
+	for i, k := range keys {
+		if result[i], err = proj.project(k, obj[k], i, obj[k]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// EntriesPipeHandler returns a [key, projection] pair for every entry of an
+// object; without a predicate or with `$value`, its [key, value] entries.
+func EntriesPipeHandler(ctx PipeContext, input any) (any, error) {
+	obj, err := objectInput("entries", input)
+	if err != nil {
+		return nil, err
+	}
+	proj := newEntryProjection(ctx, "$value", "$item")
+	keys := objectKeys(obj)
+	result := make([]any, len(keys))
+	for i, k := range keys {
+		v, err := proj.project(k, obj[k], i, obj[k])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = []any{k, v}
+	}
+	return result, nil
+}
+
+// FromEntriesPipeHandler builds an object from an array. The predicate projects
+// each element to an entry: a [key, value] array or a {"key": ..., "value": ...}
+// object with a string key. Later entries win on duplicate keys.
+func FromEntriesPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("fromEntries pipe expects array input")
+	}
+	proj := newProjector(ctx)
+	result := make(map[string]any, seq.Len())
+	for i := 0; i < seq.Len(); i++ {
+		entry, err := proj.project(seq.At(i), i)
+		if err != nil {
+			return nil, err
+		}
+		var key, value any
+		switch e := entry.(type) {
+		case []any:
+			if len(e) != 2 {
+				return nil, fmt.Errorf("fromEntries pipe expects [key, value] pairs, got an array of %d elements for element %d", len(e), i)
+			}
+			key, value = e[0], e[1]
+		case map[string]any:
+			key, value = e["key"], e["value"]
+		default:
+			return nil, fmt.Errorf("fromEntries pipe expects [key, value] pairs, got %s for element %d", typeName(entry), i)
+		}
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("fromEntries pipe expects string keys, got %s for element %d", typeName(key), i)
+		}
+		result[k] = value
+	}
+	return result, nil
+}
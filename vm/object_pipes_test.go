@@ -0,0 +1,86 @@
+package vm_test
+
+import (
+	"testing"
+)
+
+var objectPipeVars = map[string]any{
+	"prices": map[string]any{"pear": 2.0, "apple": 1.0, "fig": 4.0},
+	"empty":  map[string]any{},
+}
+
+func TestObjectPipes_Iteration(t *testing.T) {
+	tests := []vmTestCase{
+		// map and filter on objects return objects
+		{`prices |map: $value * 10`, map[string]any{"pear": 20.0, "apple": 10.0, "fig": 40.0}},
+		{`prices |map: $key + ":" + str($item)`, map[string]any{"pear": "pear:2", "apple": "apple:1", "fig": "fig:4"}},
+		{`prices |map: $index`, map[string]any{"apple": 0.0, "fig": 1.0, "pear": 2.0}},
+		{`prices |filter: $value > 1`, map[string]any{"pear": 2.0, "fig": 4.0}},
+		{`prices |filter: $key == "fig"`, map[string]any{"fig": 4.0}},
+		{`empty |map: $value`, map[string]any{}},
+		{`prices |filter: false`, map[string]any{}},
+
+		// find returns the first matching value in key order
+		{`prices |find: $value > 1`, 4.0},
+		{`prices |find: $value > 10`, nil},
+		{`prices |some: $key == "pear"`, true},
+		{`prices |some: $value > 10`, false},
+		{`prices |every: $value > 0`, true},
+		{`empty |every: false`, true},
+
+		// reduce and sort
+		{`prices |reduce(0): $acc + $value`, 7.0},
+		{`prices |sort: $value`, []any{[]any{"apple", 1.0}, []any{"pear", 2.0}, []any{"fig", 4.0}}},
+		{`prices |sort("desc"): $key |map: $item[0]`, []any{"pear", "fig", "apple"}},
+
+		// objects compose with further pipes and property access
+		{`prices |map: $value * 2 |filter: $value > 3`, map[string]any{"pear": 4.0, "fig": 8.0}},
+		{`(prices |map: $value + 1).fig`, 5.0},
+		{`[1, 2, 3, 4] |groupBy: $item % 2 == 0 ? "even" : "odd" |map: len($value)`,
+			map[string]any{"even": 2.0, "odd": 2.0}},
+		{`([1, 2, 3] |groupBy: $item > 1)["true"]`, []any{2.0, 3.0}},
+		{`{"a": [1, 2], "b": [3]} |map: len($value) |values: $value`, []any{2.0, 1.0}},
+	}
+	runVmTests(t, tests, objectPipeVars)
+}
+
+func TestObjectPipes_Conversion(t *testing.T) {
+	tests := []vmTestCase{
+		{`prices |keys: $key`, []any{"apple", "fig", "pear"}},
+		{`prices |keys: $key + "!"`, []any{"apple!", "fig!", "pear!"}},
+		{`prices |values: $value`, []any{1.0, 4.0, 2.0}},
+		{`prices |values: $item`, []any{1.0, 4.0, 2.0}},
+		{`prices |values: $value * 2`, []any{2.0, 8.0, 4.0}},
+		{`prices |entries: $value`, []any{[]any{"apple", 1.0}, []any{"fig", 4.0}, []any{"pear", 2.0}}},
+		{`prices |entries: $value > 1`, []any{[]any{"apple", false}, []any{"fig", true}, []any{"pear", true}}},
+		{`empty |keys: $key`, []any{}},
+
+		{`[["a", 1], ["b", 2]] |fromEntries: $item`, map[string]any{"a": 1.0, "b": 2.0}},
+		{`[{"key": "a", "value": 1}] |fromEntries: $item`, map[string]any{"a": 1.0}},
+		{`[["a", 1], ["a", 2]] |fromEntries: $item`, map[string]any{"a": 2.0}},
+		{`[{"id": "x", "n": 1}, {"id": "y", "n": 2}] |fromEntries: [$item.id, $item.n]`,
+			map[string]any{"x": 1.0, "y": 2.0}},
+		{`[] |fromEntries: $item`, map[string]any{}},
+
+		// round trip
+		{`prices |entries: $value |fromEntries: $item`, map[string]any{"pear": 2.0, "apple": 1.0, "fig": 4.0}},
+		{`prices |entries: $value |filter: $item[1] < 4 |fromEntries: $item`, map[string]any{"pear": 2.0, "apple": 1.0}},
+	}
+	runVmTests(t, tests, objectPipeVars)
+}
+
+func TestObjectPipes_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1] |keys: $key`, "keys pipe expects object input"},
+		{`"x" |values: $value`, "values pipe expects object input"},
+		{`5 |entries: $value`, "entries pipe expects object input"},
+		{`{"a": 1} |fromEntries: $item`, "fromEntries pipe expects array input"},
+		{`[["a"]] |fromEntries: $item`, "fromEntries pipe expects [key, value] pairs, got an array of 1 elements for element 0"},
+		{`[1] |fromEntries: $item`, "fromEntries pipe expects [key, value] pairs, got number for element 0"},
+		{`[[1, 2]] |fromEntries: $item`, "fromEntries pipe expects string keys, got number for element 0"},
+		{`5 |map: $item`, "map pipe expects array or object input"},
+		{`"abc" |sort: $item`, "sort pipe expects array or object input"},
+		{`{"a": 1, "b": "x"} |sort: $value`, "sort pipe cannot compare number key of element 0 with string key of element 1"},
+	}
+	runVmErrorTests(t, tests)
+}
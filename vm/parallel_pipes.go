@@ -0,0 +1,248 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+)
+
+// Parallel pipes split their input into contiguous chunks and evaluate the
+// predicate for each chunk on its own goroutine and VM. They return exactly
+// what |map: and |filter: return, in the same order:
+//
+//	scores |pmap: $item.base * weight   // like |map:, on up to GOMAXPROCS goroutines
+//	rows   |pfilter: $item.total > 100  // like |filter:
+//
+// They fall back to running sequentially on the calling VM when the input is an
+// object, when it is too short to give every goroutine parallelMinChunk
+// elements, or when the predicate calls a function that is not safe for
+// concurrent use (LibContext.SequentialFunctions, or the built-in set, which
+// modifies its argument) or that controls iteration with stop() or skip(), and
+// while a Tracer is installed.
+
+// parallelMinChunk is the fewest elements worth handing to a goroutine; below
+// it the cost of borrowing a VM outweighs the work.
+const parallelMinChunk = 64
+
+// VMPool supplies the worker VMs of parallel pipes, e.g. from an Env's
+// sync.Pool. Workers are configured like the VM that runs the pipe.
+type VMPool interface {
+	Get() *VM
+	Put(*VM)
+}
+
+// sequentialBuiltins are the built-in functions that must not run
+// concurrently, recognized by code pointer under any registered name. stop and
+// skip depend on the order in which elements are evaluated.
+var sequentialBuiltins = funcPointers(builtinSet, builtinStop, builtinSkip)
+
+// ParallelMapPipeHandler is |map: evaluated across goroutines.
+func ParallelMapPipeHandler(ctx PipeContext, input any) (any, error) {
+	if err := checkParallelInput("pmap", input); err != nil {
+		return nil, err
+	}
+	pctx, seq, workers := parallelPlan(ctx, input)
+	if workers < 2 {
+		return MapPipeHandler(ctx, input)
+	}
+	result := make([]any, seq.Len())
+	err := pctx.vm.runParallel(pctx, seq, workers, func(i int, v any) { result[i] = v })
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ParallelFilterPipeHandler is |filter: evaluated across goroutines.
+func ParallelFilterPipeHandler(ctx PipeContext, input any) (any, error) {
+	if err := checkParallelInput("pfilter", input); err != nil {
+		return nil, err
+	}
+	pctx, seq, workers := parallelPlan(ctx, input)
+	if workers < 2 {
+		return FilterPipeHandler(ctx, input)
+	}
+	keep := make([]bool, seq.Len())
+	err := pctx.vm.runParallel(pctx, seq, workers, func(i int, v any) {
+		b, ok := v.(bool)
+		keep[i] = ok && b
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]any, 0)
+	for i, k := range keep {
+		if k {
+			result = append(result, seq.At(i))
+		}
+	}
+	return result, nil
+}
+
+func checkParallelInput(pipe string, input any) error {
+	if _, ok := input.(map[string]any); ok {
+		return nil
+	}
+	if _, ok := asSequence(input); !ok {
+		return fmt.Errorf("%s pipe expects array or object input", pipe)
+	}
+	return nil
+}
+
+// parallelPlan decides how many goroutines a parallel pipe should use; fewer
+// than two means it runs sequentially.
+func parallelPlan(ctx PipeContext, input any) (*pipeContextImpl, sequence, int) {
+	pctx, ok := ctx.(*pipeContextImpl)
+	if !ok || pctx.block == nil {
+		return nil, nil, 0
+	}
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, nil, 0
+	}
+	workers := pctx.vm.parallelism
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if limit := seq.Len() / parallelMinChunk; workers > limit {
+		workers = limit
+	}
+	if workers < 2 || pctx.vm.tracer != nil || pctx.vm.callsSequential(pctx.block.Instructions) {
+		return nil, nil, 0
+	}
+	return pctx, seq, workers
+}
+
+// callsSequential reports whether ins, or a pipe predicate or argument block
+// nested in it, calls a function that must not run concurrently.
+func (vm *VM) callsSequential(ins code.Instructions) bool {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return true // unreadable bytecode: stay on the safe side
+		}
+		switch code.Opcode(ins[i]) {
+		case code.OpCallFunction:
+			name, _ := vm.constants[code.ReadUint16(ins[i+1:i+3])].AsString()
+			if vm.sequentialFuncs[name] {
+				return true
+			}
+			if fn, ok := vm.functionContext[name]; ok && sequentialBuiltins[reflect.ValueOf(fn).Pointer()] {
+				return true
+			}
+		case code.OpPipe:
+			st := vm.decodePipe(ins[i:])
+			if st.block != nil && vm.callsSequential(st.block.Instructions) {
+				return true
+			}
+			if st.argsIdx != 0xFFFF {
+				if a, ok := vm.constants[st.argsIdx].ToAny().(*compiler.ArgsBlock); ok && vm.callsSequential(a.Instructions) {
+					return true
+				}
+			}
+		}
+		i++
+		for _, w := range def.OperandWidths {
+			i += w
+		}
+	}
+	return false
+}
+
+// runParallel evaluates the predicate of pctx for every element of seq on
+// workers goroutines and passes each result to store along with the element's
+// index. The first error in input order among those raised is returned; it
+// cancels the remaining workers, as does cancelling the evaluation context.
+func (vm *VM) runParallel(pctx *pipeContextImpl, seq sequence, workers int, store func(int, any)) error {
+	ctx, cancel := context.WithCancel(vm.ctx)
+	defer cancel()
+
+	n := seq.Len()
+	size := (n + workers - 1) / workers
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w*size < n; w++ {
+		from, to := w*size, min((w+1)*size, n)
+		wg.Add(1)
+		go func(w, from, to int) {
+			defer wg.Done()
+			worker := vm.borrowWorker(ctx)
+			defer vm.releaseWorker(worker)
+			wctx := &pipeContextImpl{vm: worker, block: pctx.block, name: pctx.name, alias: pctx.alias, args: pctx.args}
+			for i := from; i < to; i++ {
+				v, err := wctx.EvalItem(seq.At(i), i)
+				if err != nil {
+					if err != ctx.Err() { // not merely cut short by another worker or the caller
+						errs[w] = err
+					}
+					cancel()
+					return
+				}
+				store(i, v)
+			}
+		}(w, from, to)
+	}
+	wg.Wait()
+
+	if err := vm.ctx.Err(); err != nil {
+		return err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// borrowWorker returns a VM that evaluates predicates of the running program
+// in the current pipe scope. Alias and store scopes are cloned so that workers
+// never write to maps they share.
+func (vm *VM) borrowWorker(ctx context.Context) *VM {
+	var w *VM
+	if vm.workers != nil {
+		w = vm.workers.Get()
+	} else {
+		w = New(vm.libContext())
+	}
+	w.ctx = ctx
+	w.constants = vm.constants
+	w.systemVars = vm.systemVars
+	w.contextVars = vm.contextVars
+	w.contextVarsValues = vm.contextVarsValues
+	w.contextVarCache = vm.contextVarCache
+	w.locals = vm.locals
+	w.sp, w.framesIdx = 0, 1
+	for _, scope := range vm.pipeScopes {
+		w.pipeScopes = append(w.pipeScopes, maps.Clone(scope))
+	}
+	w.pipeFastScope = vm.pipeFastScope
+	w.pipeFastScopeActive = vm.pipeFastScopeActive
+	w.outerPipeScopes = append(w.outerPipeScopes, vm.outerPipeScopes...)
+	return w
+}
+
+// releaseWorker drops everything a worker borrowed, so that a pooled VM never
+// pins or (when it next runs a program) overwrites the caller's state, and
+// returns it to the pool.
+func (vm *VM) releaseWorker(w *VM) {
+	w.ctx = context.Background()
+	w.constants, w.systemVars, w.contextVars = nil, nil, nil
+	w.contextVarsValues, w.contextVarCache, w.locals = nil, nil, nil
+	w.lastContextValues, w.lastContextVars = nil, nil
+	clear(w.pipeScopes)
+	w.pipeScopes = w.pipeScopes[:0]
+	w.pipeFastScope = pipeFastScope{}
+	w.pipeFastScopeActive = false
+	clear(w.outerPipeScopes)
+	w.outerPipeScopes = w.outerPipeScopes[:0]
+	if vm.workers != nil {
+		vm.workers.Put(w)
+	}
+}
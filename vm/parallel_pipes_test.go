@@ -0,0 +1,165 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/vm"
+)
+
+// countingPool is a VMPool that counts the workers it lends out.
+type countingPool struct {
+	pool sync.Pool
+	lent atomic.Int32
+}
+
+func (p *countingPool) Get() *vm.VM  { p.lent.Add(1); return p.pool.Get().(*vm.VM) }
+func (p *countingPool) Put(m *vm.VM) { p.pool.Put(m) }
+
+// parallelLib returns a LibContext whose parallel pipes use four goroutines,
+// borrowing their VMs from the returned pool.
+func parallelLib(fns vm.VMFunctions) (vm.LibContext, *countingPool) {
+	functions := vm.VMFunctions{}
+	for name, fn := range vm.Builtins {
+		functions[name] = fn
+	}
+	for name, fn := range fns {
+		functions[name] = fn
+	}
+	lib := vm.LibContext{Functions: functions, PipeHandlers: vm.DefaultPipeHandlers, Parallelism: 4}
+	pool := &countingPool{}
+	pool.pool.New = func() any { return vm.New(lib) }
+	lib.Workers = pool
+	return lib, pool
+}
+
+func evalParallel(ctx context.Context, input string, lib vm.LibContext, vars map[string]any) (any, error) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+	machine := vm.New(lib)
+	machine.SetContext(ctx)
+	return machine.Run(comp.ByteCode(), vars)
+}
+
+func TestParallelPipes_MatchSequential(t *testing.T) {
+	nums := make([]any, 1000)
+	for i := range nums {
+		nums[i] = float64(i)
+	}
+	vars := map[string]any{"nums": nums, "factor": 3.0}
+	pairs := [][2]string{
+		{`nums |pmap: $item * factor`, `nums |map: $item * factor`},
+		{`nums |pfilter: $item % 7 == 0`, `nums |filter: $item % 7 == 0`},
+		{`0..<5000 |pmap: $index`, `0..<5000 |map: $index`},
+		{`0..<5000 |pfilter: $item % 3 == 1`, `0..<5000 |filter: $item % 3 == 1`},
+		{`nums |pmap: [$item, $index, factor]`, `nums |map: [$item, $index, factor]`},
+		{`nums |pfilter: $item > 990 |pmap: str($item)`, `nums |filter: $item > 990 |map: str($item)`},
+		{`nums |map: $item + 1 |pmap: $item * 2 |sum: $item`, `nums |map: $item + 1 |map: $item * 2 |sum: $item`},
+		// objects and short inputs run sequentially
+		{`{"a": 1, "b": 2} |pmap: $value * 10`, `{"a": 1, "b": 2} |map: $value * 10`},
+		{`{"a": 1, "b": 2} |pfilter: $key == "b"`, `{"a": 1, "b": 2} |filter: $key == "b"`},
+		{`[1, 2, 3] |pmap: $item * 2`, `[1, 2, 3] |map: $item * 2`},
+		{`[] |pfilter: true`, `[] |filter: true`},
+	}
+	lib, pool := parallelLib(nil)
+	for _, p := range pairs {
+		got, err := evalParallel(context.Background(), p[0], lib, vars)
+		if err != nil {
+			t.Fatalf("%s: %v", p[0], err)
+		}
+		want, err := evalParallel(context.Background(), p[1], lib, vars)
+		if err != nil {
+			t.Fatalf("%s: %v", p[1], err)
+		}
+		if err := testExpectedObject(t, want, got); err != nil {
+			t.Fatalf("%s: %v", p[0], err)
+		}
+	}
+	if pool.lent.Load() == 0 {
+		t.Fatal("no worker VM was borrowed from the pool")
+	}
+}
+
+func TestParallelPipes_DefaultHandlers(t *testing.T) {
+	tests := []vmTestCase{
+		{`0..<1000 |pmap: $item * 2 |sum: $item`, 999000.0},
+		{`0..<1000 |pfilter: $item < 3`, []any{0.0, 1.0, 2.0}},
+		{`[1, 2] |pmap: $item + 1`, []any{2.0, 3.0}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestParallelPipes_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`5 |pmap: $item`, "pmap pipe expects array or object input"},
+		{`"x" |pfilter: true`, "pfilter pipe expects array or object input"},
+	}
+	runVmErrorTests(t, tests)
+
+	lib, _ := parallelLib(nil)
+	// the first failing element in input order is reported
+	items := make([]any, 1000)
+	for i := range items {
+		items[i] = float64(i)
+	}
+	items[600], items[900] = "a", "b"
+	_, err := evalParallel(context.Background(), `items |pmap: $item * 2`, lib, map[string]any{"items": items})
+	if err == nil || err.Error() != "expected string, got float64" {
+		t.Fatalf("got %v, want the multiplication error", err)
+	}
+}
+
+func TestParallelPipes_Cancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lib, _ := parallelLib(vm.VMFunctions{
+		"cancelAt": func(args ...any) (any, error) {
+			if args[0].(float64) == 1500 {
+				cancel()
+			}
+			return args[0], nil
+		},
+	})
+	_, err := evalParallel(ctx, `0..<100000 |pmap: cancelAt($item)`, lib, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestParallelPipes_SequentialFunctions(t *testing.T) {
+	calls := 0 // unsynchronized on purpose: must only be touched by one goroutine
+	fns := vm.VMFunctions{
+		"tally": func(args ...any) (any, error) {
+			calls++
+			return args[0], nil
+		},
+	}
+	lib, pool := parallelLib(fns)
+	lib.SequentialFunctions = map[string]bool{"tally": true}
+
+	out, err := evalParallel(context.Background(), `0..<2000 |pmap: tally($item) |sum: $item`, lib, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 1999000.0 || calls != 2000 {
+		t.Fatalf("got %v after %d calls, want 1999000 after 2000", out, calls)
+	}
+	if n := pool.lent.Load(); n != 0 {
+		t.Fatalf("borrowed %d workers for a predicate calling a sequential function", n)
+	}
+
+	// the built-in set modifies its argument, so it never runs concurrently
+	out, err = evalParallel(context.Background(), `0..<2000 |pmap: set(acc, str($item), true) |: len($last)`, lib, map[string]any{"acc": map[string]any{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 2000.0 || pool.lent.Load() != 0 {
+		t.Fatalf("got %v with %d workers borrowed, want 2000 with none", out, pool.lent.Load())
+	}
+}
@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// PipeArgSpec describes one argument of a pipe's |name(args): header.
+type PipeArgSpec struct {
+	Name     string // used in error messages
+	Type     string // a typeof() name ("number", "string", "boolean", "array", "object", "null"); "" accepts any value
+	Optional bool   // the argument may be omitted; optional arguments must come last
+}
+
+// PipeArgSchema lists, in order, the arguments a pipe handler accepts. A pipe
+// without a schema accepts any arguments.
+//
+// Schemas are checked when an expression is compiled in an Env: the number of
+// arguments always, and the type of every literal argument. Arguments computed
+// at runtime are type-checked once per pipe dispatch, before the handler runs.
+type PipeArgSchema []PipeArgSpec
+
+// PipeArgSchemas is a registry mapping pipe names to their argument schemas.
+type PipeArgSchemas map[string]PipeArgSchema
+
+// DefaultPipeArgSchemas declares the arguments of the DefaultPipeHandlers.
+var DefaultPipeArgSchemas = PipeArgSchemas{
+	"reduce": {{Name: "initial", Optional: true}},
+	"window": {{Name: "size", Type: constants.TypeNameNumber, Optional: true}},
+	"chunk":  {{Name: "size", Type: constants.TypeNameNumber, Optional: true}},
+	"take":   {{Name: "count", Type: constants.TypeNameNumber}},
+	"skip":   {{Name: "count", Type: constants.TypeNameNumber}},
+	"sort": {
+		{Name: "option", Type: constants.TypeNameString, Optional: true},
+		{Name: "option", Type: constants.TypeNameString, Optional: true},
+		{Name: "option", Type: constants.TypeNameString, Optional: true},
+		{Name: "option", Type: constants.TypeNameString, Optional: true},
+	},
+}
+
+// CheckArity reports whether n arguments satisfy the schema of the named pipe.
+func (s PipeArgSchema) CheckArity(pipe string, n int) error {
+	required := 0
+	for _, spec := range s {
+		if !spec.Optional {
+			required++
+		}
+	}
+	switch {
+	case n < required && required == len(s):
+		return fmt.Errorf("pipe %s expects %d argument(s), got %d", pipe, required, n)
+	case n < required:
+		return fmt.Errorf("pipe %s expects at least %d argument(s), got %d", pipe, required, n)
+	case n > len(s):
+		return fmt.Errorf("pipe %s expects at most %d argument(s), got %d", pipe, len(s), n)
+	}
+	return nil
+}
+
+// CheckArg reports whether v is an acceptable value for the i-th argument.
+func (s PipeArgSchema) CheckArg(pipe string, i int, v any) error {
+	if i >= len(s) || s[i].Type == "" {
+		return nil
+	}
+	if got := typeName(v); got != s[i].Type {
+		return fmt.Errorf("pipe %s argument %q must be %s, got %s", pipe, s[i].Name, s[i].Type, got)
+	}
+	return nil
+}
+
+// Validate checks both the number and the types of args.
+func (s PipeArgSchema) Validate(pipe string, args []any) error {
+	if err := s.CheckArity(pipe, len(args)); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if err := s.CheckArg(pipe, i, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalPipeArgs runs a runtime argument block in the enclosing scope and
+// returns the resulting argument values.
+func (vm *VM) evalPipeArgs(pipe string, blk *compiler.ArgsBlock) ([]any, error) {
+	frame := NewFrame(blk.Instructions, vm.sp)
+	frame.sourceMap = blk.SourceMap
+	vm.pushFrame(frame)
+	err := vm.run()
+	if err != nil {
+		vm.popFrame()
+		return nil, err
+	}
+	args, _ := vm.Pop().([]any)
+	vm.popFrame()
+	if schema, ok := vm.pipeArgSchemas[pipe]; ok {
+		for i, arg := range args {
+			if err := schema.CheckArg(pipe, i, arg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return args, nil
+}
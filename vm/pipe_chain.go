@@ -0,0 +1,181 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+)
+
+// pipeInstructionLen is the size of an OpPipe instruction: opcode + 4 operands.
+const pipeInstructionLen = 9
+
+// pipeStage is a decoded OpPipe instruction.
+type pipeStage struct {
+	name    string
+	alias   string
+	block   *compiler.InstructionBlock
+	argsIdx uint16
+}
+
+// decodePipe reads the OpPipe instruction at the start of ins.
+func (vm *VM) decodePipe(ins []byte) pipeStage {
+	pipeTypeIdx := code.ReadUint16(ins[1:3])
+	aliasIdx := code.ReadUint16(ins[3:5])
+	blockIdx := code.ReadUint16(ins[5:7])
+	name, _ := vm.constants[pipeTypeIdx].AsString()
+	blk, _ := vm.constants[blockIdx].ToAny().(*compiler.InstructionBlock)
+	return pipeStage{
+		name:    name,
+		alias:   vm.systemVars[aliasIdx].(string),
+		block:   blk,
+		argsIdx: code.ReadUint16(ins[7:9]),
+	}
+}
+
+// pipeArgs resolves the arguments of a stage: nil when sentinel 0xFFFF, a []any
+// constant when all are literals, otherwise an *ArgsBlock evaluated here in the
+// enclosing scope.
+func (vm *VM) pipeArgs(st pipeStage) ([]any, error) {
+	if st.argsIdx == 0xFFFF {
+		return nil, nil
+	}
+	switch a := vm.constants[st.argsIdx].ToAny().(type) {
+	case []any:
+		return a, nil
+	case *compiler.ArgsBlock:
+		return vm.evalPipeArgs(st.name, a)
+	}
+	return nil, nil
+}
+
+// dispatchPipe runs one pipe stage over input with its registered handler.
+func (vm *VM) dispatchPipe(st pipeStage, input any) (any, error) {
+	pipeArgs, err := vm.pipeArgs(st)
+	if err != nil {
+		return nil, err
+	}
+	handler, ok := vm.pipeHandlers[st.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pipe type: %s", st.name)
+	}
+	if _, isRange := input.(*Range); isRange && !rangeAwarePipes[reflect.ValueOf(handler).Pointer()] {
+		if input, err = vm.materialize(input); err != nil {
+			return nil, err
+		}
+	}
+	pctx := &pipeContextImpl{vm: vm, block: st.block, name: st.name, alias: st.alias, args: pipeArgs}
+	vm.pushPipeScope()
+	result, err := handler(pctx, input)
+	vm.popPipeScope()
+	if vm.tracer != nil {
+		vm.tracer.OnPipe(st.name, input, result, err)
+	}
+	return result, err
+}
+
+// streamFor returns the streaming implementation of a stage, or nil when its
+// handler can only run over a materialized input.
+func (vm *VM) streamFor(name string) StreamingPipe {
+	if s, ok := vm.streamingPipes[name]; ok {
+		return s
+	}
+	if handler, ok := vm.pipeHandlers[name]; ok {
+		if s, ok := builtinStreams[reflect.ValueOf(handler).Pointer()]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// sinkFor returns the lazy implementation of a short-circuiting terminal
+// stage (find, some, every), or nil.
+func (vm *VM) sinkFor(name string) streamSink {
+	if _, custom := vm.streamingPipes[name]; custom {
+		return nil
+	}
+	if handler, ok := vm.pipeHandlers[name]; ok {
+		return builtinSinks[reflect.ValueOf(handler).Pointer()]
+	}
+	return nil
+}
+
+// runPipeChain executes the n consecutive OpPipe instructions in ins over
+// input. Runs of streaming stages, optionally ended by a short-circuiting
+// sink, are fused into a single pull-based pass: no intermediate arrays are
+// built and upstream predicates only run for the elements the downstream
+// stages actually pull. Every other stage is dispatched as a plain OpPipe.
+func (vm *VM) runPipeChain(ins []byte, n int, input any) (any, error) {
+	stage := func(i int) pipeStage { return vm.decodePipe(ins[i*pipeInstructionLen:]) }
+	var err error
+	for i := 0; i < n; {
+		j := i
+		for j < n && vm.streamFor(stage(j).name) != nil {
+			j++
+		}
+		sink := j < n && vm.sinkFor(stage(j).name) != nil
+		fused := j - i
+		if sink {
+			fused++
+		}
+		seq, isSeq := asSequence(input)
+		if fused < 2 || !isSeq {
+			if input, err = vm.dispatchPipe(stage(i), input); err != nil {
+				return nil, err
+			}
+			i++
+			continue
+		}
+		end := j
+		if sink {
+			end++
+		}
+		if input, err = vm.fusePipes(stage, i, j, sink, seq); err != nil {
+			return nil, err
+		}
+		i = end
+	}
+	return input, nil
+}
+
+// fusePipes streams seq through the streaming stages [from, to) and, when
+// sink is set, into the terminal stage at to; otherwise it collects the
+// output into an array. The stages share one pipe scope, in which each
+// installs its own variables while its predicate runs.
+func (vm *VM) fusePipes(stage func(int) pipeStage, from, to int, sink bool, seq sequence) (any, error) {
+	vm.pushPipeScope()
+	defer vm.popPipeScope()
+
+	var s Stream = &sequenceStream{seq: seq}
+	for k := from; k < to; k++ {
+		st := stage(k)
+		pctx, err := vm.stageContext(st)
+		if err != nil {
+			return nil, err
+		}
+		if s, err = vm.streamFor(st.name).Stream(pctx, s); err != nil {
+			return nil, err
+		}
+	}
+	if !sink {
+		return CollectStream(s)
+	}
+	st := stage(to)
+	pctx, err := vm.stageContext(st)
+	if err != nil {
+		return nil, err
+	}
+	return vm.sinkFor(st.name)(pctx, s)
+}
+
+func (vm *VM) stageContext(st pipeStage) (*pipeContextImpl, error) {
+	pipeArgs, err := vm.pipeArgs(st)
+	if err != nil {
+		return nil, err
+	}
+	return &pipeContextImpl{
+		vm: vm, block: st.block, name: st.name, alias: st.alias, args: pipeArgs,
+		scope: map[string]any{}, scopeSlot: len(vm.pipeScopes) - 1,
+	}, nil
+}
@@ -2,6 +2,9 @@ package vm_test
 
 import (
 	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/vm"
 )
 
 // TestPipeParams_Window exercises |window(n): and the backward-compatible |window: form.
@@ -87,3 +90,88 @@ func TestPipeParams_Chain(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+// TestPipeParams_Reduce exercises |reduce(init): and the backward-compatible |reduce: form.
+func TestPipeParams_Reduce(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1,2,3,4] |reduce(0): $acc + $item", 10.0},
+		{"[1,2,3,4] |reduce(1): $acc * $item", 24.0},
+		{"[1,2,3,4] |reduce(100): $acc - $item", 90.0},
+		{`["a", "", "c"] |reduce(""): $acc + $item`, "ac"},
+		{"[1,2] |reduce({}): set($acc, $index, $item)", map[string]any{"0": 1.0, "1": 2.0}},
+		{"[3,4] |reduce([]): $acc", []any{}},
+		{"[true, false] |reduce(true): $acc && $item", false},
+		// runtime initializer, evaluated in the enclosing scope
+		{"[1,2] |reduce(start): $acc + $item", 13.0},
+		{"[1,2] |reduce(start * 2): $acc + $item", 23.0},
+		// falsy accumulators survive, unlike the ($acc || x) idiom
+		{"[0, 5] |reduce(0): $acc * $item", 0.0},
+		// empty input returns the initializer unchanged
+		{"[] |reduce(0): $acc + $item", 0.0},
+		{"[] |reduce(null): $acc + $item", nil},
+		{"[] |reduce({}): set($acc, 'x', $item)", map[string]any{}},
+		{"1..<1 |reduce(7): $acc + $item", 7.0},
+		{"1..10 |reduce(0): $acc + $item", 55.0},
+
+		// objects reduce over their entries in key order
+		{`{"b": 2, "a": 1, "c": 3} |reduce(0): $acc + $value`, 6.0},
+		{`{"b": 2, "a": 1} |reduce(""): $acc + $key + "=" + str($item) + ";"`, "a=1;b=2;"},
+		{`{"y": 20, "x": 10} |reduce(""): $acc + str($index) + $key`, "0x1y"},
+		{`{} |reduce(0): $acc + $value`, 0.0},
+		{`{"a": 1, "b": 2} |reduce: ($acc ?? 0) + $value`, 3.0},
+
+		// backward compat: no args → $acc starts as null
+		{"[1,2,3,4] |reduce: ($acc ?? 0) + $item", 10.0},
+		{"[5] |reduce: $acc", nil},
+	}
+	runVmTests(t, tests, map[string]any{"start": 10.0})
+}
+
+func TestPipeParams_ReduceErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"[] |reduce: ($acc ?? 0) + $item", "reduce pipe cannot operate on empty array"},
+		{"{} |reduce: ($acc ?? 0) + $item", "reduce pipe cannot operate on empty object"},
+		{`"abc" |reduce(0): $acc`, "reduce pipe expects array or object input"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+// TestPipeParams_RuntimeArgs verifies that non-literal args are evaluated in the
+// enclosing scope before the handler runs.
+func TestPipeParams_RuntimeArgs(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1,2,3,4,5] |chunk(config.batch): $chunk", []any{
+			[]any{1.0, 2.0, 3.0},
+			[]any{4.0, 5.0},
+		}},
+		{"len([1,2,3,4,5] |window(size): $window)", 3.0},
+		{"len([1,2,3,4,5] |window(size + 1): $window)", 2.0},
+		{"len([1,2,3,4,5] |window(config.missing ?? 2): $window)", 4.0},
+		// args see the enclosing pipe's $item, not the inner pipe's
+		{"[2,4] |map: len([1,2,3,4] |chunk($item): $chunk)", []any{2.0, 1.0}},
+		// args are evaluated once per dispatch, not per item
+		{"[[1,2,3],[4,5,6]] |map: len($item |chunk(size - 1): $chunk)", []any{2.0, 2.0}},
+	}
+	runVmTests(t, tests, map[string]any{"size": 3.0, "config": map[string]any{"batch": 3.0}})
+}
+
+// TestPipeParams_RuntimeArgSchema verifies that runtime args are type-checked
+// against LibContext.PipeArgSchemas at dispatch.
+func TestPipeParams_RuntimeArgSchema(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`[1,2,3] |window(size): $window`)); err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New(vm.LibContext{
+		Functions:      vm.Builtins,
+		PipeHandlers:   vm.DefaultPipeHandlers,
+		PipeArgSchemas: vm.DefaultPipeArgSchemas,
+	})
+	if _, err := machine.Run(comp.ByteCode(), map[string]any{"size": 2.0}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := machine.Run(comp.ByteCode(), map[string]any{"size": "2"})
+	if err == nil || err.Error() != `pipe window argument "size" must be number, got string` {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
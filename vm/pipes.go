@@ -22,11 +22,35 @@ var DefaultPipeHandlers = PipeHandlers{
 	"window":  WindowPipeHandler,
 	"chunk":   ChunkPipeHandler,
 	"flatMap": FlatMapPipeHandler,
+	"sum":     SumPipeHandler,
+	"avg":     AvgPipeHandler,
+	"min":     MinPipeHandler,
+	"max":     MaxPipeHandler,
+	"count":   CountPipeHandler,
+	"minBy":   MinByPipeHandler,
+	"maxBy":   MaxByPipeHandler,
+
+	"entries":     EntriesPipeHandler,
+	"fromEntries": FromEntriesPipeHandler,
+	"keys":        KeysPipeHandler,
+	"values":      ValuesPipeHandler,
+
+	"zip":        ZipPipeHandler,
+	"partition":  PartitionPipeHandler,
+	"distinctBy": DistinctByPipeHandler,
+	"indexBy":    IndexByPipeHandler,
+	"countBy":    CountByPipeHandler,
+	"take":       TakePipeHandler,
+	"skip":       SkipPipeHandler,
+	"takeWhile":  TakeWhilePipeHandler,
+	"skipWhile":  SkipWhilePipeHandler,
+	"pmap":       ParallelMapPipeHandler,
+	"pfilter":    ParallelFilterPipeHandler,
 }
 
 // pipeContextImpl is the internal implementation of PipeContext.
 // One instance is created per OpPipe dispatch; it holds the predicate block,
-// the alias name, compile-time args, and a back-pointer to the executing VM.
+// the alias name, evaluated args, and a back-pointer to the executing VM.
 //
 // Frame reuse: the *Frame is created lazily on the first EvalItem/EvalWith call
 // and then reused across all iterations by resetting ip and basePointer only.
@@ -34,14 +58,25 @@ var DefaultPipeHandlers = PipeHandlers{
 type pipeContextImpl struct {
 	vm    *VM
 	block *compiler.InstructionBlock
+	name  string // pipe name, for error messages
 	alias string
-	args  []any  // compile-time literal args; nil when no args provided (0xFFFF sentinel)
+	args  []any  // evaluated pipe args; nil when no args provided (0xFFFF sentinel)
 	frame *Frame // lazily created, reused across iterations
+
+	// scope holds the stage's pipe variables when it shares the pipe scope at
+	// scopeSlot with the other stages of a fused chain; nil otherwise.
+	scope     map[string]any
+	scopeSlot int
 }
 
 // EvalItem sets $item, $index (and the alias if declared), then runs the predicate.
 // Zero-allocation hot path for map / filter / find / some / every / sort / groupBy / flatMap.
 func (p *pipeContextImpl) EvalItem(item any, index int) (any, error) {
+	return p.rejectControl(p.evalItem(item, index))
+}
+
+func (p *pipeContextImpl) evalItem(item any, index int) (any, error) {
+	p.enterScope()
 	if p.alias != "" {
 		p.vm.setPipeVar(p.alias, item)
 	}
@@ -50,16 +85,74 @@ func (p *pipeContextImpl) EvalItem(item any, index int) (any, error) {
 	return p.runFrame()
 }
 
-// EvalWith sets arbitrary scope variables, then runs the predicate.
+// evalEntry sets $key, $value, $item (the value), $index and the alias for one
+// object entry, then runs the predicate. Like EvalItem, it does not allocate.
+func (p *pipeContextImpl) evalEntry(key string, value any, index int) (any, error) {
+	return p.rejectControl(p.evalEntryRaw(key, value, index))
+}
+
+func (p *pipeContextImpl) evalEntryRaw(key string, value any, index int) (any, error) {
+	p.enterScope()
+	if p.alias != "" {
+		p.vm.setPipeVar(p.alias, value)
+	}
+	p.vm.setPipeVar("$item", value)
+	p.vm.setPipeVar("$key", key)
+	p.vm.setPipeVar("$value", value)
+	p.vm.setPipeVar("$index", index)
+	return p.runFrame()
+}
+
+// evalEntry evaluates the pipe predicate for one object entry, using the
+// allocation-free path when ctx is the VM's own PipeContext.
+func evalEntry(ctx PipeContext, key string, value any, index int) (any, error) {
+	if p, ok := ctx.(*pipeContextImpl); ok {
+		return p.evalEntry(key, value, index)
+	}
+	return ctx.EvalWith(map[string]any{"$item": value, "$key": key, "$value": value, "$index": index})
+}
+
+// objectKeys returns the keys of obj in sorted order; object iteration in pipes
+// is always in key order so that results are deterministic.
+func objectKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// EvalWith sets arbitrary scope variables (and the alias, when they include
+// $item), then runs the predicate.
 // For reduce/window/chunk: allocate the map once outside the loop and reuse it.
 func (p *pipeContextImpl) EvalWith(scopeVars map[string]any) (any, error) {
+	return p.rejectControl(p.evalWith(scopeVars))
+}
+
+func (p *pipeContextImpl) evalWith(scopeVars map[string]any) (any, error) {
+	p.enterScope()
 	for k, v := range scopeVars {
 		p.vm.setPipeVar(k, v)
 	}
+	if p.alias != "" {
+		if item, ok := scopeVars["$item"]; ok {
+			p.vm.setPipeVar(p.alias, item)
+		}
+	}
 	return p.runFrame()
 }
 
-// Args returns the compile-time literal arguments declared in the pipe header.
+// enterScope installs the stage's own pipe variables in a fused chain, so that
+// an alias declared by one stage is not visible in the next, as when the
+// stages run one at a time.
+func (p *pipeContextImpl) enterScope() {
+	if p.scope != nil {
+		p.vm.pipeScopes[p.scopeSlot] = p.scope
+	}
+}
+
+// Args returns the arguments declared in the pipe header, already evaluated.
 // Returns nil when no args were provided (the common case).
 func (p *pipeContextImpl) Args() []any { return p.args }
 
@@ -67,6 +160,12 @@ func (p *pipeContextImpl) Args() []any { return p.args }
 // or empty string when none was declared.
 func (p *pipeContextImpl) Alias() string { return p.alias }
 
+// HasPredicate reports whether the pipe declared a predicate; an omitted one
+// is compiled as $item.
+func (p *pipeContextImpl) HasPredicate() bool {
+	return p.block != nil && p.block.Instructions != nil && !p.block.Implicit
+}
+
 // Context returns the evaluation context for cancellation and deadline checks.
 func (p *pipeContextImpl) Context() context.Context { return p.vm.ctx }
 
@@ -78,6 +177,7 @@ func (p *pipeContextImpl) runFrame() (any, error) {
 	}
 	if p.frame == nil {
 		p.frame = NewFrame(p.block.Instructions, 0)
+		p.frame.sourceMap = p.block.SourceMap
 	}
 	p.frame.ip = 0
 	p.frame.basePointer = p.vm.sp
@@ -89,81 +189,197 @@ func (p *pipeContextImpl) runFrame() (any, error) {
 	}
 	res := p.vm.Pop()
 	p.vm.popFrame()
-	return res, nil
+	return p.vm.materialize(res)
 }
 
 func DefaultPipeHandler(ctx PipeContext, input any) (any, error) {
-	pctx := ctx.(*pipeContextImpl)
-	if pctx.block == nil || pctx.block.Instructions == nil {
-		return input, nil
+	if !ctx.HasPredicate() {
+		return nil, errMissingPredicate("|:")
 	}
 	return ctx.EvalWith(map[string]any{"$last": input})
 }
 
+// MapPipeHandler transforms every element. An object input maps each value and
+// returns an object with the same keys. skip() drops an element and stop()
+// ends the map early.
 func MapPipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if obj, ok := input.(map[string]any); ok {
+		result := make(map[string]any, len(obj))
+		for i, k := range objectKeys(obj) {
+			val, ctl, err := evalEntryWithControl(ctx, k, obj[k], i)
+			if err != nil {
+				return nil, err
+			}
+			if ctl.keeps() {
+				result[k] = val
+			}
+			if ctl.stops() {
+				break
+			}
+		}
+		return result, nil
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("map pipe expects array input")
+		return nil, fmt.Errorf("map pipe expects array or object input")
 	}
-	result := make([]any, len(arr))
-	for i, elem := range arr {
-		val, err := ctx.EvalItem(elem, i)
+	result := make([]any, 0, seq.Len())
+	for i := 0; i < seq.Len(); i++ {
+		val, ctl, err := ctx.EvalItemWithControl(seq.At(i), i)
 		if err != nil {
 			return nil, err
 		}
-		result[i] = val
+		if ctl.keeps() {
+			result = append(result, val)
+		}
+		if ctl.stops() {
+			break
+		}
 	}
 	return result, nil
 }
 
+// FilterPipeHandler keeps the elements for which the predicate is true. An
+// object input returns an object with the matching entries. skip() drops an
+// element and stop() ends the filter early; stop(true) keeps the element first.
 func FilterPipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if obj, ok := input.(map[string]any); ok {
+		result := make(map[string]any)
+		for i, k := range objectKeys(obj) {
+			keep, ctl, err := evalEntryWithControl(ctx, k, obj[k], i)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := keep.(bool); ok && b && ctl.keeps() {
+				result[k] = obj[k]
+			}
+			if ctl.stops() {
+				break
+			}
+		}
+		return result, nil
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("filter pipe expects array input")
+		return nil, fmt.Errorf("filter pipe expects array or object input")
 	}
-	var result []any
-	for i, elem := range arr {
-		keep, err := ctx.EvalItem(elem, i)
+	result := make([]any, 0)
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		keep, ctl, err := ctx.EvalItemWithControl(elem, i)
 		if err != nil {
 			return nil, err
 		}
-		if b, ok := keep.(bool); ok && b {
+		if b, ok := keep.(bool); ok && b && ctl.keeps() {
 			result = append(result, elem)
 		}
+		if ctl.stops() {
+			break
+		}
 	}
 	return result, nil
 }
 
+// ReducePipeHandler folds the input into $acc. With |reduce(init):, $acc starts
+// as init and empty input yields init unchanged; without it $acc starts as null
+// and empty input is an error. Objects are reduced over their entries in key
+// order, exposing $key, $value (also $item) and $index. skip() leaves $acc
+// unchanged; stop() ends the fold with the current $acc, stop(value) with value.
 func ReducePipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if !ctx.HasPredicate() {
+		return nil, errMissingPredicate("reduce")
+	}
+	args := ctx.Args()
+	hasInit := len(args) > 0
+	var acc any
+	if hasInit {
+		acc = args[0]
+	}
+	if obj, ok := input.(map[string]any); ok {
+		return reduceObject(ctx, obj, acc, hasInit)
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("reduce pipe expects array input")
+		return nil, fmt.Errorf("reduce pipe expects array or object input")
 	}
-	if len(arr) == 0 {
+	if seq.Len() == 0 {
+		if hasInit {
+			return acc, nil
+		}
 		return nil, fmt.Errorf("reduce pipe cannot operate on empty array")
 	}
-	var acc any
 	// Allocate scope map once and reuse across iterations — avoids per-iteration allocation.
 	scope := make(map[string]any, 3)
-	for i, elem := range arr {
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
 		scope["$acc"] = acc
 		scope["$item"] = elem
 		scope["$index"] = i
+		next, ctl, err := evalWithControl(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		if ctl.keeps() {
+			acc = next
+		}
+		if ctl.stops() {
+			break
+		}
+	}
+	return acc, nil
+}
+
+// reduceObject folds the entries of obj in sorted key order.
+func reduceObject(ctx PipeContext, obj map[string]any, acc any, hasInit bool) (any, error) {
+	if len(obj) == 0 {
+		if hasInit {
+			return acc, nil
+		}
+		return nil, fmt.Errorf("reduce pipe cannot operate on empty object")
+	}
+	pctx, fast := ctx.(*pipeContextImpl)
+	for i, k := range objectKeys(obj) {
+		var next any
+		var ctl Control
 		var err error
-		acc, err = ctx.EvalWith(scope)
+		if fast {
+			pctx.vm.setPipeVar("$acc", acc)
+			next, ctl, err = evalEntryWithControl(pctx, k, obj[k], i)
+		} else {
+			next, ctl, err = evalWithControl(ctx, map[string]any{"$acc": acc, "$key": k, "$value": obj[k], "$item": obj[k], "$index": i})
+		}
 		if err != nil {
 			return nil, err
 		}
+		if ctl.keeps() {
+			acc = next
+		}
+		if ctl.stops() {
+			break
+		}
 	}
 	return acc, nil
 }
 
 func FindPipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if obj, ok := input.(map[string]any); ok {
+		for i, k := range objectKeys(obj) {
+			matched, err := evalEntry(ctx, k, obj[k], i)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := matched.(bool); ok && b {
+				return obj[k], nil
+			}
+		}
+		return nil, nil
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("find pipe expects array input")
+		return nil, fmt.Errorf("find pipe expects array or object input")
 	}
-	for i, elem := range arr {
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
 		matched, err := ctx.EvalItem(elem, i)
 		if err != nil {
 			return nil, err
@@ -176,11 +392,24 @@ func FindPipeHandler(ctx PipeContext, input any) (any, error) {
 }
 
 func SomePipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if obj, ok := input.(map[string]any); ok {
+		for i, k := range objectKeys(obj) {
+			matched, err := evalEntry(ctx, k, obj[k], i)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := matched.(bool); ok && b {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("some pipe expects array input")
+		return nil, fmt.Errorf("some pipe expects array or object input")
 	}
-	for i, elem := range arr {
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
 		matched, err := ctx.EvalItem(elem, i)
 		if err != nil {
 			return nil, err
@@ -193,11 +422,24 @@ func SomePipeHandler(ctx PipeContext, input any) (any, error) {
 }
 
 func EveryPipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
+	if obj, ok := input.(map[string]any); ok {
+		for i, k := range objectKeys(obj) {
+			matched, err := evalEntry(ctx, k, obj[k], i)
+			if err != nil {
+				return nil, err
+			}
+			if b, ok := matched.(bool); !ok || !b {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	seq, ok := asSequence(input)
 	if !ok {
-		return nil, fmt.Errorf("every pipe expects array input")
+		return nil, fmt.Errorf("every pipe expects array or object input")
 	}
-	for i, elem := range arr {
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
 		matched, err := ctx.EvalItem(elem, i)
 		if err != nil {
 			return nil, err
@@ -226,61 +468,30 @@ func UniquePipeHandler(ctx PipeContext, input any) (any, error) {
 	return result, nil
 }
 
-func SortPipeHandler(ctx PipeContext, input any) (any, error) {
-	arr, ok := input.([]any)
-	if !ok {
-		return nil, fmt.Errorf("sort pipe expects array input")
-	}
-	type sortableElem struct {
-		key any
-		val any
-	}
-	sortable := make([]sortableElem, len(arr))
-	for i, elem := range arr {
-		key, err := ctx.EvalItem(elem, i)
-		if err != nil {
-			return nil, err
-		}
-		sortable[i] = sortableElem{key, elem}
-	}
-	sort.SliceStable(sortable, func(i, j int) bool {
-		ki, kiNum := sortable[i].key.(float64)
-		kj, kjNum := sortable[j].key.(float64)
-		if kiNum && kjNum {
-			return ki < kj
-		}
-		si, siStr := sortable[i].key.(string)
-		sj, sjStr := sortable[j].key.(string)
-		if siStr && sjStr {
-			return si < sj
-		}
-		return false
-	})
-	result := make([]any, len(arr))
-	for i, se := range sortable {
-		result[i] = se.val
-	}
-	return result, nil
-}
-
 func GroupByPipeHandler(ctx PipeContext, input any) (any, error) {
 	arr, ok := input.([]any)
 	if !ok {
 		return nil, fmt.Errorf("groupBy pipe expects array input")
 	}
-	groups := make(map[string][]any)
+	// Groups are stored as map[string]any so the result is an ordinary object
+	// that property access and the object-aware pipes understand.
+	groups := make(map[string]any)
 	for i, elem := range arr {
 		key, err := ctx.EvalItem(elem, i)
 		if err != nil {
 			return nil, err
 		}
 		keyStr := fmt.Sprintf("%v", key)
-		groups[keyStr] = append(groups[keyStr], elem)
+		group, _ := groups[keyStr].([]any)
+		groups[keyStr] = append(group, elem)
 	}
 	return groups, nil
 }
 
 func WindowPipeHandler(ctx PipeContext, input any) (any, error) {
+	if !ctx.HasPredicate() {
+		return nil, errMissingPredicate("window")
+	}
 	arr, ok := input.([]any)
 	if !ok {
 		return nil, fmt.Errorf("window pipe expects array input")
@@ -306,6 +517,9 @@ func WindowPipeHandler(ctx PipeContext, input any) (any, error) {
 }
 
 func ChunkPipeHandler(ctx PipeContext, input any) (any, error) {
+	if !ctx.HasPredicate() {
+		return nil, errMissingPredicate("chunk")
+	}
 	arr, ok := input.([]any)
 	if !ok {
 		return nil, fmt.Errorf("chunk pipe expects array input")
@@ -334,22 +548,33 @@ func ChunkPipeHandler(ctx PipeContext, input any) (any, error) {
 	return result, nil
 }
 
+// errMissingPredicate is returned by the handlers of pipes whose predicate
+// does not read $item, so that omitting it is a mistake.
+func errMissingPredicate(pipe string) error {
+	return fmt.Errorf("%s pipe requires a predicate", pipe)
+}
+
 // FlatMapPipeHandler maps each element and flattens results in one operation
 func FlatMapPipeHandler(ctx PipeContext, input any) (any, error) {
 	arr, ok := input.([]any)
 	if !ok {
 		return nil, fmt.Errorf("flatMap pipe expects array input")
 	}
-	var result []any
+	result := make([]any, 0)
 	for i, elem := range arr {
-		res, err := ctx.EvalItem(elem, i)
+		res, ctl, err := ctx.EvalItemWithControl(elem, i)
 		if err != nil {
 			return nil, err
 		}
-		if resArr, ok := res.([]any); ok {
-			result = append(result, resArr...)
-		} else {
-			result = append(result, res)
+		if ctl.keeps() {
+			if resArr, ok := res.([]any); ok {
+				result = append(result, resArr...)
+			} else {
+				result = append(result, res)
+			}
+		}
+		if ctl.stops() {
+			break
 		}
 	}
 	return result, nil
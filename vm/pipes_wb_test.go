@@ -2,6 +2,9 @@ package vm
 
 import (
 	"testing"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
 )
 
 // Compile-time check: *pipeContextImpl satisfies PipeContext.
@@ -32,11 +35,14 @@ func TestPipeContextImpl_Args_returnsSetSlice(t *testing.T) {
 	}
 }
 
-// WindowPipeHandler: explicit size 3 from args — input len=2 < windowSize=3 → no iterations,
-// no EvalWith called, no nil-block error. This proves windowSize=3 was used instead of default 2.
+// trueBlock is a predicate block that evaluates to true.
+var trueBlock = &compiler.InstructionBlock{Instructions: code.Make(code.OpTrue)}
+
+// WindowPipeHandler: explicit size 3 from args — input len=2 < windowSize=3 → no iterations.
+// This proves windowSize=3 was used instead of default 2.
 func TestWindowPipeHandler_argsSize3_shortInput(t *testing.T) {
 	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil, args: []any{float64(3)}}
+	pctx := &pipeContextImpl{vm: machine, block: trueBlock, args: []any{float64(3)}}
 	res, err := WindowPipeHandler(pctx, []any{1.0, 2.0})
 	if err != nil {
 		t.Errorf("expected no error (no iterations for size=3 with len=2 input), got %v", err)
@@ -47,46 +53,38 @@ func TestWindowPipeHandler_argsSize3_shortInput(t *testing.T) {
 	}
 }
 
-// WindowPipeHandler: arg below minimum (n=1) falls back to size 2,
-// which triggers EvalWith on a 2-element input → nil block error proves fallback occurred.
-func TestWindowPipeHandler_argsBelowMin_fallsBackTo2(t *testing.T) {
+// WindowPipeHandler: arg below minimum (n=1), of the wrong type or missing falls
+// back to size 2, which gives one window over a 2-element input.
+func TestWindowPipeHandler_argsFallBackTo2(t *testing.T) {
 	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil, args: []any{float64(1)}}
-	_, err := WindowPipeHandler(pctx, []any{1.0, 2.0})
-	if err == nil {
-		t.Error("expected error from nil block when fallback size 2 triggers iteration")
+	for name, args := range map[string][]any{"below minimum": {float64(1)}, "invalid type": {"bad"}, "empty": {}} {
+		pctx := &pipeContextImpl{vm: machine, block: trueBlock, args: args}
+		res, err := WindowPipeHandler(pctx, []any{1.0, 2.0})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if arr, _ := res.([]any); len(arr) != 1 {
+			t.Errorf("%s: expected one window of size 2, got %v", name, res)
+		}
 	}
 }
 
-// WindowPipeHandler: non-float64 arg falls back to size 2 → same observable behaviour.
-func TestWindowPipeHandler_argsInvalidType_fallsBackTo2(t *testing.T) {
+// Pipes that do not read $item reject an omitted predicate.
+func TestPipeHandlers_missingPredicate(t *testing.T) {
 	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil, args: []any{"bad"}}
-	_, err := WindowPipeHandler(pctx, []any{1.0, 2.0})
-	if err == nil {
-		t.Error("expected error from nil block when invalid arg type falls back to size 2")
-	}
-}
-
-// WindowPipeHandler: empty args slice falls back to size 2.
-func TestWindowPipeHandler_argsEmpty_fallsBackTo2(t *testing.T) {
-	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil, args: []any{}}
-	_, err := WindowPipeHandler(pctx, []any{1.0, 2.0})
-	if err == nil {
-		t.Error("expected error from nil block when empty args falls back to size 2")
-	}
-}
-
-func TestDefaultPipeHandler_NilBlock(t *testing.T) {
-	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil}
-	res, err := DefaultPipeHandler(pctx, 1)
-	if err != nil {
-		t.Errorf("expected no error, got %v", err)
-	}
-	if res != 1 {
-		t.Errorf("expected input to be returned, got %v", res)
+	implicit := &compiler.InstructionBlock{Instructions: code.Make(code.OpTrue), Implicit: true}
+	handlers := map[string]PipeHandler{"|:": DefaultPipeHandler, "reduce": ReducePipeHandler, "window": WindowPipeHandler, "chunk": ChunkPipeHandler}
+	for name, handler := range handlers {
+		for _, block := range []*compiler.InstructionBlock{nil, implicit} {
+			pctx := &pipeContextImpl{vm: machine, block: block}
+			_, err := handler(pctx, []any{1.0, 2.0})
+			if want := name + " pipe requires a predicate"; err == nil || err.Error() != want {
+				t.Errorf("%s: expected %q, got %v", name, want, err)
+			}
+		}
+	}
+	if (&pipeContextImpl{block: trueBlock}).HasPredicate() != true {
+		t.Error("expected HasPredicate for a declared predicate")
 	}
 }
 
@@ -110,7 +108,7 @@ func TestGroupByPipeHandler_nilBlock(t *testing.T) {
 
 func TestChunkPipeHandler_nonArray(t *testing.T) {
 	machine := New(LibContext{})
-	pctx := &pipeContextImpl{vm: machine, block: nil}
+	pctx := &pipeContextImpl{vm: machine, block: trueBlock}
 	_, err := ChunkPipeHandler(pctx, "not an array")
 	if err == nil {
 		t.Error("expected error for non-array input")
@@ -125,3 +123,34 @@ func TestChunkPipeHandler_invalidSize(t *testing.T) {
 		t.Error("expected error for nil block")
 	}
 }
+
+// isIdentity recognizes bare $item / alias predicates so aggregation pipes can
+// skip running the VM per element.
+func TestPipeContextImpl_isIdentity(t *testing.T) {
+	machine := New(LibContext{})
+	machine.systemVars = []any{"$item", "$x", "$index"}
+	block := func(ins ...[]byte) *compiler.InstructionBlock {
+		var all code.Instructions
+		for _, i := range ins {
+			all = append(all, i...)
+		}
+		return &compiler.InstructionBlock{Instructions: all}
+	}
+	tests := []struct {
+		name     string
+		pctx     *pipeContextImpl
+		identity bool
+	}{
+		{"nil block", &pipeContextImpl{vm: machine}, false},
+		{"$item", &pipeContextImpl{vm: machine, block: block(code.Make(code.OpIdentifier, 0))}, true},
+		{"alias", &pipeContextImpl{vm: machine, alias: "$x", block: block(code.Make(code.OpIdentifier, 1))}, true},
+		{"undeclared alias", &pipeContextImpl{vm: machine, block: block(code.Make(code.OpIdentifier, 1))}, false},
+		{"$index", &pipeContextImpl{vm: machine, block: block(code.Make(code.OpIdentifier, 2))}, false},
+		{"expression", &pipeContextImpl{vm: machine, block: block(code.Make(code.OpIdentifier, 0), code.Make(code.OpMinus))}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.pctx.isIdentity(); got != tt.identity {
+			t.Errorf("%s: isIdentity() = %v, want %v", tt.name, got, tt.identity)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// DefaultMaxRangeLength is the largest range that is materialized into a
+// []any when LibContext.MaxRangeLength is zero.
+const DefaultMaxRangeLength = 1_000_000
+
+// Range is the lazy runtime value of a range literal (`1..10`, `0..<n`,
+// `0..10 step 2`). It is an arithmetic sequence of integers described by its
+// first element, step and length; elements are computed on access.
+//
+// Range-aware operations (len, indexing, slicing and the map, filter, reduce,
+// find, some and every pipes) iterate it without allocating. Everywhere else
+// — array and object literals, function arguments, other pipes and the final
+// result handed to the host — it is materialized into a []any, subject to
+// the VM's maximum range length.
+type Range struct {
+	Start int
+	Step  int
+	Count int
+}
+
+// newRange builds the Range for start..end (or start..<end when exclusive)
+// with the given step (null means 1). Bounds and step must be finite
+// integers and the step must not be zero. A range whose end lies behind its
+// start in the direction of the step is empty: `10..1` is empty while
+// `10..1 step -1` counts down.
+func newRange(start, end, step Value, exclusive bool) (*Range, error) {
+	s, err := rangeBound(start, "start")
+	if err != nil {
+		return nil, err
+	}
+	e, err := rangeBound(end, "end")
+	if err != nil {
+		return nil, err
+	}
+	st := 1
+	if !step.IsNull() {
+		if st, err = rangeBound(step, "step"); err != nil {
+			return nil, err
+		}
+		if st == 0 {
+			return nil, fmt.Errorf("range step cannot be zero")
+		}
+	}
+
+	if exclusive {
+		// Convert to the equivalent inclusive end, one step short of e.
+		if st > 0 {
+			e--
+		} else {
+			e++
+		}
+	}
+
+	count := 0
+	if st > 0 && e >= s {
+		count = (e-s)/st + 1
+	} else if st < 0 && e <= s {
+		count = (s-e)/(-st) + 1
+	}
+	return &Range{Start: s, Step: st, Count: count}, nil
+}
+
+// rangeBound converts a range operand to an int.
+func rangeBound(v Value, what string) (int, error) {
+	if v.Typ != TypeFloat {
+		return 0, fmt.Errorf("range %s must be a number, got %s", what, typeNameValue(v))
+	}
+	f := v.FloatVal
+	if math.IsNaN(f) || math.IsInf(f, 0) || f != math.Trunc(f) {
+		return 0, fmt.Errorf("range %s must be a finite integer, got %v", what, f)
+	}
+	if math.Abs(f) > 1<<53 {
+		return 0, fmt.Errorf("range %s out of range: %v", what, f)
+	}
+	return int(f), nil
+}
+
+// Len returns the number of elements in the range.
+func (r *Range) Len() int { return r.Count }
+
+// At returns the i-th element (0 <= i < Len) as a UExL number.
+func (r *Range) At(i int) any { return float64(r.Start + i*r.Step) }
+
+// Materialize returns the elements of the range as a []any. It fails when the
+// range is longer than max.
+func (r *Range) Materialize(max int) ([]any, error) {
+	if r.Count > max {
+		return nil, fmt.Errorf("range of %d elements exceeds maximum materialized length %d", r.Count, max)
+	}
+	out := make([]any, r.Count)
+	for i := range out {
+		out[i] = r.At(i)
+	}
+	return out, nil
+}
+
+// slice returns the lazy sub-range selected by the already-normalized slice
+// bounds s and e with step st (the same arithmetic sliceArray uses).
+func (r *Range) slice(s, e, st int) *Range {
+	count := 0
+	if st > 0 && s < e {
+		count = (e - s + st - 1) / st
+	} else if st < 0 && s > e {
+		count = (s - e - st - 1) / (-st)
+	}
+	return &Range{Start: r.Start + s*r.Step, Step: r.Step * st, Count: count}
+}
+
+// sequence is the indexed view the range-aware pipes iterate over.
+type sequence interface {
+	Len() int
+	At(i int) any
+}
+
+// anySlice adapts a []any to sequence.
+type anySlice []any
+
+func (a anySlice) Len() int     { return len(a) }
+func (a anySlice) At(i int) any { return a[i] }
+
+// asSequence returns input as a sequence when it is an array or a range.
+func asSequence(input any) (sequence, bool) {
+	switch v := input.(type) {
+	case []any:
+		return anySlice(v), true
+	case *Range:
+		return v, true
+	}
+	return nil, false
+}
+
+// materialize expands a *Range into a []any (bounded by the VM's maximum
+// range length); every other value is returned unchanged.
+func (vm *VM) materialize(v any) (any, error) {
+	if r, ok := v.(*Range); ok {
+		return r.Materialize(vm.maxRangeLen)
+	}
+	return v, nil
+}
+
+// rangeAwarePipes are the built-in pipe handlers that accept a *Range input
+// directly; every other handler receives a materialized []any. It is filled in
+// init because the handlers themselves (indirectly) refer to it.
+var rangeAwarePipes map[uintptr]bool
+
+func init() {
+	rangeAwarePipes = funcPointers(
+		MapPipeHandler, FilterPipeHandler, ReducePipeHandler,
+		FindPipeHandler, SomePipeHandler, EveryPipeHandler,
+		SumPipeHandler, AvgPipeHandler, MinPipeHandler, MaxPipeHandler,
+		CountPipeHandler, MinByPipeHandler, MaxByPipeHandler,
+		PartitionPipeHandler, DistinctByPipeHandler,
+		IndexByPipeHandler, CountByPipeHandler, TakePipeHandler, SkipPipeHandler,
+		TakeWhilePipeHandler, SkipWhilePipeHandler,
+		ParallelMapPipeHandler, ParallelFilterPipeHandler,
+		// Every handler built by StreamingPipeHandler shares one code pointer.
+		StreamingPipeHandler(nil),
+	)
+}
+
+// rangeAwareFunctions are the built-in functions that accept *Range
+// arguments directly; every other function receives materialized arrays.
+var rangeAwareFunctions = funcPointers(builtinLen)
+
+// funcPointers indexes functions by code pointer so that handlers registered
+// under any name (or re-registered via an Env) are still recognized.
+func funcPointers(fns ...any) map[uintptr]bool {
+	m := make(map[uintptr]bool, len(fns))
+	for _, fn := range fns {
+		m[reflect.ValueOf(fn).Pointer()] = true
+	}
+	return m
+}
@@ -0,0 +1,107 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/vm"
+)
+
+func TestRangeLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`1..5`, []any{1.0, 2.0, 3.0, 4.0, 5.0}},
+		{`0..<4`, []any{0.0, 1.0, 2.0, 3.0}},
+		{`0..10 step 5`, []any{0.0, 5.0, 10.0}},
+		{`0..<10 step 5`, []any{0.0, 5.0}},
+		{`5..1 step -2`, []any{5.0, 3.0, 1.0}},
+		{`5..<1 step -2`, []any{5.0, 3.0}},
+		{`3..1`, []any{}},
+		{`0..<0`, []any{}},
+		{`-2..0`, []any{-2.0, -1.0, 0.0}},
+		{`1..n`, []any{1.0, 2.0, 3.0}},
+		{`[1..2, 0..<1]`, []any{[]any{1.0, 2.0}, []any{0.0}}},
+		{`{"r": 1..2}`, map[string]any{"r": []any{1.0, 2.0}}},
+	}
+	runVmTests(t, tests, map[string]any{"n": 3.0})
+}
+
+func TestRangeLazyOperations(t *testing.T) {
+	tests := []vmTestCase{
+		{`len(1..10)`, 10.0},
+		{`len(0..<1e9)`, 1e9},
+		{`(0..<1e9)[5]`, 5.0},
+		{`(0..<1e9)[-1]`, 999999999.0},
+		{`(0..10 step 2)[2]`, 4.0},
+		{`(0..<1e9)[2:5]`, []any{2.0, 3.0, 4.0}},
+		{`(1..10)[::3]`, []any{1.0, 4.0, 7.0, 10.0}},
+		{`(1..5)[::-1]`, []any{5.0, 4.0, 3.0, 2.0, 1.0}},
+		{`len((0..<1e9)[10:])`, 999999990.0},
+		{`1..4 |map: $item * $item`, []any{1.0, 4.0, 9.0, 16.0}},
+		{`1..10 |filter: $item % 3 == 0`, []any{3.0, 6.0, 9.0}},
+		{`1..100 |reduce: ($acc ?? 0) + $item`, 5050.0},
+		{`0..<1e9 |find: $item > 3`, 4.0},
+		{`0..<1e9 |some: $item == 7`, true},
+		{`0..<1e9 |every: $item < 5`, false},
+		{`1..3 |map: 1..$item`, []any{[]any{1.0}, []any{1.0, 2.0}, []any{1.0, 2.0, 3.0}}},
+		{`1..3 |sort: -$item`, []any{3.0, 2.0, 1.0}},
+		{`typeof(1..3)`, "array"},
+		{`1..3 is array`, true},
+		{`(3..1) ? "y" : "n"`, "n"},
+		{`set({}, "r", 1..2)`, map[string]any{"r": []any{1.0, 2.0}}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRangeEquality(t *testing.T) {
+	tests := []vmTestCase{
+		{`1..3 == [1, 2, 3]`, true},
+		{`[1, 2, 3] == 1..3`, true},
+		{`1..3 != [1, 2, 3]`, false},
+		{`1..3 == [1, 2]`, false},
+		{`1..3 != [3, 2, 1]`, true},
+		{`0..<0 == []`, true},
+		{`1..3 == 3..1 step -1`, false},
+		{`5..1 step -2 == [5, 3, 1]`, true},
+		{`(0..<1e9)[2:4] == [2, 3]`, true},
+		{`[1..2, "a"] == [[1, 2], "a"]`, true},
+		{`{"r": 1..2} == {"r": [1, 2]}`, true},
+		{`{"r": 1..2} != {"r": [1, 2], "s": 1}`, true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestRangeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`1..5 step 0`, "range step cannot be zero"},
+		{`1.5..3`, "range start must be a finite integer, got 1.5"},
+		{`1.."a"`, "range end must be a number, got string"},
+		{`0..Inf`, "range end must be a finite integer, got +Inf"},
+		{`0..<1e9`, "range of 1000000000 elements exceeds maximum materialized length 1000000"},
+		{`[0..<2e6]`, "range of 2000000 elements exceeds maximum materialized length 1000000"},
+		{`1..3 > [1]`, "array values can only be compared with == and !="},
+		{`{} < {}`, "object values can only be compared with == and !="},
+	}
+	runVmErrorTests(t, tests)
+}
+
+func TestRangeMaxLength(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`1..n`)); err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New(vm.LibContext{MaxRangeLength: 3})
+
+	out, err := machine.Run(comp.ByteCode(), map[string]any{"n": 3.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testExpectedObject(t, []any{1.0, 2.0, 3.0}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = machine.Run(comp.ByteCode(), map[string]any{"n": 4.0})
+	if err == nil || !strings.Contains(err.Error(), "exceeds maximum materialized length 3") {
+		t.Fatalf("expected max length error, got %v", err)
+	}
+}
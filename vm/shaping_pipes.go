@@ -0,0 +1,284 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Shaping pipes slice, split, de-duplicate and index arrays. Like |filter:,
+// the condition pipes (partition, takeWhile, skipWhile) treat only `true` as a
+// match; the keyed pipes (distinctBy, indexBy, countBy) use the predicate as a
+// key projection, so `$item` keys each element by itself.
+//
+//	users |partition: $item.active     // [[active...], [inactive...]]
+//	users |distinctBy: $item.email     // first user per email
+//	users |indexBy: $item.id           // {"1": user1, "2": user2}
+//	users |countBy: $item.role         // {"admin": 2, "user": 7}
+//	rows  |take(10): $item             // the first 10 rows
+//	rows  |skipWhile: $item.header     // everything after the header rows
+//	[names, ages] |zip: $item          // [[name0, age0], [name1, age1], ...]
+
+// PartitionPipeHandler splits the input into [matched, rest], preserving order.
+func PartitionPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("partition pipe expects array input")
+	}
+	matched, rest := make([]any, 0), make([]any, 0)
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		res, err := ctx.EvalItem(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := res.(bool); ok && b {
+			matched = append(matched, elem)
+		} else {
+			rest = append(rest, elem)
+		}
+	}
+	return []any{matched, rest}, nil
+}
+
+// DistinctByPipeHandler keeps the first element for each distinct key. Unlike
+// |unique:, keys are compared by value and type, so 1 and "1" are different.
+func DistinctByPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("distinctBy pipe expects array input")
+	}
+	proj := newProjector(ctx)
+	seen := make(map[any]struct{})
+	result := make([]any, 0)
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		key, err := proj.project(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		k := hashKey(key)
+		if _, dup := seen[k]; dup {
+			continue
+		}
+		seen[k] = struct{}{}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+// compositeKey stands in for an array or object key in a Go map. It is a
+// distinct type so that it never collides with a string key.
+type compositeKey struct{ repr string }
+
+// hashKey returns a comparable stand-in for a key value: scalars are used as
+// is, arrays and objects by their printed form.
+func hashKey(key any) any {
+	switch k := key.(type) {
+	case nil, bool, string:
+		return k
+	case float64:
+		if math.IsNaN(k) {
+			return compositeKey{"NaN"} // NaN != NaN would make every NaN distinct
+		}
+		return k
+	}
+	return compositeKey{fmt.Sprintf("%T:%v", key, key)}
+}
+
+// IndexByPipeHandler builds an object mapping each element's key to the
+// element; when several elements share a key the last one wins.
+func IndexByPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("indexBy pipe expects array input")
+	}
+	proj := newProjector(ctx)
+	result := make(map[string]any)
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		key, err := proj.project(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		result[fmt.Sprintf("%v", key)] = elem
+	}
+	return result, nil
+}
+
+// CountByPipeHandler builds an object mapping each key to the number of
+// elements that produce it.
+func CountByPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("countBy pipe expects array input")
+	}
+	proj := newProjector(ctx)
+	result := make(map[string]any)
+	for i := 0; i < seq.Len(); i++ {
+		key, err := proj.project(seq.At(i), i)
+		if err != nil {
+			return nil, err
+		}
+		keyStr := fmt.Sprintf("%v", key)
+		n, _ := result[keyStr].(float64)
+		result[keyStr] = n + 1
+	}
+	return result, nil
+}
+
+// TakePipeHandler returns the projections of the first n elements, given as
+// |take(n):, or the elements themselves without a predicate. Only those
+// elements are evaluated, so taking from a large range is cheap.
+func TakePipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, n, err := countedInput("take", ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if n > seq.Len() {
+		n = seq.Len()
+	}
+	return projectRange(ctx, seq, 0, n)
+}
+
+// SkipPipeHandler returns the projections of all but the first n elements,
+// given as |skip(n):, or the elements themselves without a predicate.
+func SkipPipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, n, err := countedInput("skip", ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if n > seq.Len() {
+		n = seq.Len()
+	}
+	return projectRange(ctx, seq, n, seq.Len())
+}
+
+// countedInput validates the input and the count argument of take and skip.
+func countedInput(pipe string, ctx PipeContext, input any) (sequence, int, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, 0, fmt.Errorf("%s pipe expects array input", pipe)
+	}
+	n, err := pipeCount(pipe, ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return seq, n, nil
+}
+
+// pipeCount reads the count argument of take and skip.
+func pipeCount(pipe string, ctx PipeContext) (int, error) {
+	args := ctx.Args()
+	if len(args) == 0 {
+		return 0, fmt.Errorf("%s pipe expects a count argument, e.g. |%s(3):", pipe, pipe)
+	}
+	f, ok := args[0].(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s pipe count must be a non-negative integer, got %v", pipe, args[0])
+	}
+	if f > math.MaxInt32 {
+		f = math.MaxInt32
+	}
+	return int(f), nil
+}
+
+// projectRange returns the projections of the elements of seq in [from, to).
+func projectRange(ctx PipeContext, seq sequence, from, to int) (any, error) {
+	proj := newProjector(ctx)
+	result := make([]any, 0, to-from)
+	for i := from; i < to; i++ {
+		v, err := proj.project(seq.At(i), i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// TakeWhilePipeHandler returns the leading elements for which the predicate is
+// true. It stops evaluating at the first element that fails.
+func TakeWhilePipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("takeWhile pipe expects array input")
+	}
+	result := make([]any, 0)
+	for i := 0; i < seq.Len(); i++ {
+		elem := seq.At(i)
+		res, err := ctx.EvalItem(elem, i)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := res.(bool); !ok || !b {
+			break
+		}
+		result = append(result, elem)
+	}
+	return result, nil
+}
+
+// SkipWhilePipeHandler drops the leading elements for which the predicate is
+// true and returns the rest. The predicate is not evaluated past the first
+// element that fails.
+func SkipWhilePipeHandler(ctx PipeContext, input any) (any, error) {
+	seq, ok := asSequence(input)
+	if !ok {
+		return nil, fmt.Errorf("skipWhile pipe expects array input")
+	}
+	start := seq.Len()
+	for i := 0; i < seq.Len(); i++ {
+		res, err := ctx.EvalItem(seq.At(i), i)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := res.(bool); !ok || !b {
+			start = i
+			break
+		}
+	}
+	result := make([]any, 0, seq.Len()-start)
+	for i := start; i < seq.Len(); i++ {
+		result = append(result, seq.At(i))
+	}
+	return result, nil
+}
+
+// ZipPipeHandler combines an array of arrays element-wise into tuples,
+// truncating to the shortest array, and returns the projection of each tuple
+// ($item is the tuple).
+func ZipPipeHandler(ctx PipeContext, input any) (any, error) {
+	arr, ok := input.([]any)
+	if !ok {
+		return nil, fmt.Errorf("zip pipe expects an array of arrays")
+	}
+	seqs := make([]sequence, len(arr))
+	n := -1
+	for i, v := range arr {
+		seq, ok := asSequence(v)
+		if !ok {
+			return nil, fmt.Errorf("zip pipe expects an array of arrays, got %s for element %d", typeName(v), i)
+		}
+		seqs[i] = seq
+		if n < 0 || seq.Len() < n {
+			n = seq.Len()
+		}
+	}
+	if n < 0 {
+		n = 0
+	}
+	proj := newProjector(ctx)
+	result := make([]any, n)
+	for i := 0; i < n; i++ {
+		tuple := make([]any, len(seqs))
+		for j, seq := range seqs {
+			tuple[j] = seq.At(i)
+		}
+		v, err := proj.project(tuple, i)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package vm_test
+
+import (
+	"testing"
+)
+
+var shapingPipeVars = map[string]any{
+	"users": []any{
+		map[string]any{"id": 1.0, "role": "admin", "active": true},
+		map[string]any{"id": 2.0, "role": "user", "active": false},
+		map[string]any{"id": 3.0, "role": "user", "active": true},
+	},
+	"limit": 2.0,
+}
+
+func TestShapingPipes_PartitionAndDistinct(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3, 4, 5] |partition: $item % 2 == 0`, []any{[]any{2.0, 4.0}, []any{1.0, 3.0, 5.0}}},
+		{`users |partition: $item.active |map: len($item)`, []any{2.0, 1.0}},
+		{`[1, 2] |partition: $item`, []any{[]any{}, []any{1.0, 2.0}}},
+		{`[] |partition: true`, []any{[]any{}, []any{}}},
+		{`1..5 |partition: $item > 3`, []any{[]any{4.0, 5.0}, []any{1.0, 2.0, 3.0}}},
+
+		{`users |distinctBy: $item.role |map: $item.id`, []any{1.0, 2.0}},
+		{`[1, "1", 1, true, "1", null, null] |distinctBy: $item`, []any{1.0, "1", true, nil}},
+		{`[[1, 2], [1, 2], [2, 1]] |distinctBy: $item`, []any{[]any{1.0, 2.0}, []any{2.0, 1.0}}},
+		{`[NaN, NaN, 1] |distinctBy: $item |map: $index`, []any{0.0, 1.0}},
+		{`[3, 1, 4, 1, 5, 9, 2, 6] |distinctBy: $item % 3`, []any{3.0, 1.0, 5.0}},
+	}
+	runVmTests(t, tests, shapingPipeVars)
+}
+
+func TestShapingPipes_IndexAndCount(t *testing.T) {
+	tests := []vmTestCase{
+		{`users |indexBy: $item.id |keys: $key`, []any{"1", "2", "3"}},
+		{`(users |indexBy: $item.role)["user"].id`, 3.0},
+		{`["a", "b"] |indexBy: $item`, map[string]any{"a": "a", "b": "b"}},
+		{`[] |indexBy: $item`, map[string]any{}},
+
+		{`users |countBy: $item.role`, map[string]any{"admin": 1.0, "user": 2.0}},
+		{`[1, 2, 3, 4] |countBy: $item > 2`, map[string]any{"true": 2.0, "false": 2.0}},
+		{`0..<10 |countBy: $item % 3`, map[string]any{"0": 4.0, "1": 3.0, "2": 3.0}},
+		{`[] |countBy: $item`, map[string]any{}},
+	}
+	runVmTests(t, tests, shapingPipeVars)
+}
+
+func TestShapingPipes_TakeAndSkip(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3, 4] |take(2): $item`, []any{1.0, 2.0}},
+		{`[1, 2, 3, 4] |take(2): $item * 10`, []any{10.0, 20.0}},
+		{`[1, 2] |take(5): $item`, []any{1.0, 2.0}},
+		{`[1, 2] |take(0): $item`, []any{}},
+		{`users |take(limit): $item.id`, []any{1.0, 2.0}},
+		{`0..<1000000000 |take(3): $item`, []any{0.0, 1.0, 2.0}},
+
+		{`[1, 2, 3, 4] |skip(2): $item`, []any{3.0, 4.0}},
+		{`[1, 2, 3, 4] |skip(1): $index`, []any{1.0, 2.0, 3.0}},
+		{`[1, 2] |skip(5): $item`, []any{}},
+		{`1..10 |skip(8): $item`, []any{9.0, 10.0}},
+
+		// without a predicate the kept elements are returned as they are
+		{`[1, 2, 3, 4] |take(2)`, []any{1.0, 2.0}},
+		{`[1, 2, 3, 4] |skip(2)`, []any{3.0, 4.0}},
+		{`[1, 2, 3, 4] |take(3): |skip(1)`, []any{2.0, 3.0}},
+		{`1..10 |skip(limit) |take(2) |map: $item * 10`, []any{30.0, 40.0}},
+		{`[users |take(1) |map: $item.id, 2]`, []any{[]any{1.0}, 2.0}},
+
+		{`[1, 2, 5, 1, 2] |takeWhile: $item < 3`, []any{1.0, 2.0}},
+		{`[1, 2, 5, 1, 2] |skipWhile: $item < 3`, []any{5.0, 1.0, 2.0}},
+		{`[1, 2] |takeWhile: true`, []any{1.0, 2.0}},
+		{`[1, 2] |skipWhile: true`, []any{}},
+		{`[1, 2] |takeWhile: $item`, []any{}},
+		{`[1, 2] |skipWhile: $item`, []any{1.0, 2.0}},
+		// short-circuit: the predicate is not evaluated past the first failure,
+		// so the error for the string element is never raised
+		{`[1, 5, "x"] |takeWhile: $item < 3`, []any{1.0}},
+		{`[1, 5, "x"] |skipWhile: $item < 3`, []any{5.0, "x"}},
+		{`0..<1000000000 |takeWhile: $item < 3`, []any{0.0, 1.0, 2.0}},
+	}
+	runVmTests(t, tests, shapingPipeVars)
+}
+
+func TestShapingPipes_Zip(t *testing.T) {
+	tests := []vmTestCase{
+		{`[[1, 2, 3], ["a", "b", "c"]] |zip: $item`, []any{[]any{1.0, "a"}, []any{2.0, "b"}, []any{3.0, "c"}}},
+		{`[[1, 2, 3], ["a"]] |zip: $item`, []any{[]any{1.0, "a"}}},
+		{`[[1, 2], [10, 20]] |zip: $item[0] + $item[1]`, []any{11.0, 22.0}},
+		{`[[1, 2], [3, 4], [5, 6]] |zip: $item`, []any{[]any{1.0, 3.0, 5.0}, []any{2.0, 4.0, 6.0}}},
+		{`[] |zip: $item`, []any{}},
+		{`[[], [1]] |zip: $item`, []any{}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestShapingPipes_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`5 |partition: true`, "partition pipe expects array input"},
+		{`{"a": 1} |distinctBy: $item`, "distinctBy pipe expects array input"},
+		{`"x" |indexBy: $item`, "indexBy pipe expects array input"},
+		{`null |countBy: $item`, "countBy pipe expects array input"},
+		{`[1] |take: $item`, "take pipe expects a count argument, e.g. |take(3):"},
+		{`[1] |skip(-1): $item`, "skip pipe count must be a non-negative integer, got -1"},
+		{`[1] |take(1.5): $item`, "take pipe count must be a non-negative integer, got 1.5"},
+		{`5 |takeWhile: true`, "takeWhile pipe expects array input"},
+		{`5 |skipWhile: true`, "skipWhile pipe expects array input"},
+		{`5 |zip: $item`, "zip pipe expects an array of arrays"},
+		{`[[1], 2] |zip: $item`, "zip pipe expects an array of arrays, got number for element 1"},
+	}
+	runVmErrorTests(t, tests)
+}
@@ -16,6 +16,8 @@ func (vm *VM) executeSliceExpression(target, start, end, step any, optional bool
 	switch typedTarget := target.(type) {
 	case []any:
 		return vm.sliceArray(typedTarget, start, end, step)
+	case *Range:
+		return vm.sliceRange(typedTarget, start, end, step)
 	case string:
 		return vm.sliceString(typedTarget, start, end, step)
 	default:
@@ -76,6 +78,45 @@ func (vm *VM) sliceArray(arr []any, start, end, step any) error {
 	return vm.Push(result)
 }
 
+// sliceRange slices a range with the same index rules as sliceArray; the
+// result is another lazy range rather than a materialized array.
+func (vm *VM) sliceRange(r *Range, start, end, step any) error {
+	st, err := vm.parseSliceStep(step)
+	if err != nil {
+		return err
+	}
+
+	n := r.Len()
+	var defaultStart, defaultEnd int
+	if st > 0 {
+		defaultStart = 0
+		defaultEnd = n
+	} else {
+		defaultStart = n - 1
+		defaultEnd = -1
+	}
+
+	s, err := vm.parseSliceIndex(start, defaultStart)
+	if err != nil {
+		return err
+	}
+
+	e, err := vm.parseSliceIndex(end, defaultEnd)
+	if err != nil {
+		return err
+	}
+
+	s = vm.adjustSliceIndex(s, n)
+	if st > 0 || e != -1 {
+		e = vm.adjustSliceIndex(e, n)
+	}
+	if st < 0 && s >= n {
+		s = n - 1
+	}
+
+	return vm.Push(r.slice(s, e, st))
+}
+
 func (vm *VM) sliceString(str string, start, end, step any) error {
 	b := []byte(str)
 	st, err := vm.parseSliceStep(step)
@@ -0,0 +1,267 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Sort options accepted as |sort(...): arguments, in any order and combination.
+// Any other string names a collator registered via LibContext.Collators.
+const (
+	SortAsc        = "asc"        // ascending order (default)
+	SortDesc       = "desc"       // descending order
+	SortNullsFirst = "nullsFirst" // null keys before all others, in either direction
+	SortNullsLast  = "nullsLast"  // null keys after all others, in either direction (default)
+	SortCaseFold   = "ci"         // compare strings case-insensitively
+)
+
+// Collator compares two strings, returning a negative number, zero or a
+// positive number as a sorts before, equal to or after b. Hosts register
+// collators by name (e.g. a locale-aware comparison from golang.org/x/text/collate)
+// and select them with |sort("name"):.
+type Collator func(a, b string) int
+
+// Collators is a registry mapping collator names to collators.
+type Collators map[string]Collator
+
+// SortKeyError is returned by the ordering pipes (sort, min, max, minBy,
+// maxBy) when two keys cannot be ordered relative to each other, e.g. a number
+// and a string, or two objects. Pipe names the failing pipe; Left and Right
+// are the offending key values (the components that differ, for composite
+// keys); LeftIndex and RightIndex are the positions of the elements that
+// produced them in the input array.
+type SortKeyError struct {
+	Pipe                  string
+	Left, Right           any
+	LeftIndex, RightIndex int
+}
+
+func (e *SortKeyError) Error() string {
+	return fmt.Sprintf("%s pipe cannot compare %s key of element %d with %s key of element %d",
+		e.Pipe, typeName(e.Left), e.LeftIndex, typeName(e.Right), e.RightIndex)
+}
+
+type sortOptions struct {
+	desc       bool
+	nullsFirst bool
+	caseFold   bool
+	collate    Collator // nil => byte-wise string comparison
+}
+
+// parseSortOptions interprets the |sort(...): arguments.
+func parseSortOptions(ctx PipeContext) (sortOptions, error) {
+	var opts sortOptions
+	for _, arg := range ctx.Args() {
+		name, ok := arg.(string)
+		if !ok {
+			return opts, fmt.Errorf("sort pipe options must be strings, got %s", typeName(arg))
+		}
+		switch name {
+		case SortAsc:
+			opts.desc = false
+		case SortDesc:
+			opts.desc = true
+		case SortNullsFirst:
+			opts.nullsFirst = true
+		case SortNullsLast:
+			opts.nullsFirst = false
+		case SortCaseFold:
+			opts.caseFold = true
+		default:
+			var collator Collator
+			if pctx, ok := ctx.(*pipeContextImpl); ok {
+				collator = pctx.vm.collators[name]
+			}
+			if collator == nil {
+				return opts, fmt.Errorf("sort pipe: unknown option or collator %q", name)
+			}
+			opts.collate = collator
+		}
+	}
+	return opts, nil
+}
+
+// SortPipeHandler orders the input by the key the predicate returns for each
+// element. The predicate is evaluated once per element and the sort is stable.
+//
+// Keys may be numbers, strings, booleans (false < true), null, or arrays of
+// those, which are compared element by element (composite keys; a shorter
+// array sorts before a longer one it prefixes). NaN sorts after every other
+// number. Keys of different types, and object keys, are incomparable and
+// produce a *SortKeyError. See the Sort* constants for the accepted options.
+// An object input is sorted as its [key, value] entries.
+func SortPipeHandler(ctx PipeContext, input any) (any, error) {
+	opts, err := parseSortOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	type sortableElem struct {
+		key   any
+		val   any
+		index int
+	}
+	var sortable []sortableElem
+	switch in := input.(type) {
+	case []any:
+		sortable = make([]sortableElem, len(in))
+		for i, elem := range in {
+			key, err := ctx.EvalItem(elem, i)
+			if err != nil {
+				return nil, err
+			}
+			sortable[i] = sortableElem{key, elem, i}
+		}
+	case map[string]any:
+		// Objects have no order of their own: sort their [key, value] entries.
+		keys := objectKeys(in)
+		sortable = make([]sortableElem, len(keys))
+		for i, k := range keys {
+			key, err := evalEntry(ctx, k, in[k], i)
+			if err != nil {
+				return nil, err
+			}
+			sortable[i] = sortableElem{key, []any{k, in[k]}, i}
+		}
+	default:
+		return nil, fmt.Errorf("sort pipe expects array or object input")
+	}
+	if opts.caseFold {
+		for i := range sortable {
+			sortable[i].key = foldSortKey(sortable[i].key)
+		}
+	}
+
+	var keyErr *SortKeyError
+	sort.SliceStable(sortable, func(i, j int) bool {
+		if keyErr != nil {
+			return false
+		}
+		c, l, r, ok := opts.compare(sortable[i].key, sortable[j].key)
+		if !ok {
+			li, ri := sortable[i].index, sortable[j].index
+			if li > ri {
+				l, r, li, ri = r, l, ri, li
+			}
+			keyErr = &SortKeyError{Pipe: "sort", Left: l, Right: r, LeftIndex: li, RightIndex: ri}
+			return false
+		}
+		return c < 0
+	})
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	result := make([]any, len(sortable))
+	for i, se := range sortable {
+		result[i] = se.val
+	}
+	return result, nil
+}
+
+// compare orders two sort keys under opts. When the keys are incomparable it
+// returns ok == false along with the offending (component) values.
+func (opts *sortOptions) compare(a, b any) (c int, l, r any, ok bool) {
+	// Null placement is independent of the sort direction.
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0, nil, nil, true
+		case (a == nil) == opts.nullsFirst:
+			return -1, nil, nil, true
+		default:
+			return 1, nil, nil, true
+		}
+	}
+
+	switch av := a.(type) {
+	case float64:
+		if bv, isNum := b.(float64); isNum {
+			c = compareFloats(av, bv)
+			break
+		}
+		return 0, a, b, false
+	case string:
+		if bv, isStr := b.(string); isStr {
+			if opts.collate != nil {
+				c = opts.collate(av, bv)
+			} else {
+				c = strings.Compare(av, bv)
+			}
+			break
+		}
+		return 0, a, b, false
+	case bool:
+		if bv, isBool := b.(bool); isBool {
+			switch {
+			case av == bv:
+				c = 0
+			case !av:
+				c = -1
+			default:
+				c = 1
+			}
+			break
+		}
+		return 0, a, b, false
+	case []any:
+		bv, isArr := b.([]any)
+		if !isArr {
+			return 0, a, b, false
+		}
+		// Composite key: elements already carry the direction, so return directly.
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c, l, r, ok = opts.compare(av[i], bv[i]); !ok || c != 0 {
+				return c, l, r, ok
+			}
+		}
+		c = len(av) - len(bv)
+		if opts.desc {
+			c = -c
+		}
+		return c, nil, nil, true
+	default:
+		return 0, a, b, false
+	}
+	if opts.desc {
+		c = -c
+	}
+	return c, nil, nil, true
+}
+
+// compareFloats orders numbers ascending with NaN after every other number.
+func compareFloats(a, b float64) int {
+	aNaN, bNaN := math.IsNaN(a), math.IsNaN(b)
+	switch {
+	case aNaN || bNaN:
+		if aNaN && bNaN {
+			return 0
+		}
+		if aNaN {
+			return 1
+		}
+		return -1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// foldSortKey lower-cases the strings of a sort key (including inside
+// composite keys) so that they compare case-insensitively.
+func foldSortKey(key any) any {
+	switch k := key.(type) {
+	case string:
+		return strings.ToLower(k)
+	case []any:
+		folded := make([]any, len(k))
+		for i, v := range k {
+			folded[i] = foldSortKey(v)
+		}
+		return folded
+	}
+	return key
+}
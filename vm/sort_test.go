@@ -0,0 +1,129 @@
+package vm_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/vm"
+)
+
+func TestSortPipe(t *testing.T) {
+	tests := []vmTestCase{
+		{`[3,1,2] |sort: $item`, []any{1.0, 2.0, 3.0}},
+		{`[3,1,2] |sort("asc"): $item`, []any{1.0, 2.0, 3.0}},
+		{`[3,1,2] |sort("desc"): $item`, []any{3.0, 2.0, 1.0}},
+		{`["b","a","c"] |sort("desc"): $item`, []any{"c", "b", "a"}},
+		{`[true,false,true] |sort: $item`, []any{false, true, true}},
+		{`[] |sort: $item`, []any{}},
+
+		// Null placement is independent of direction; nulls go last by default.
+		{`[2,null,1] |sort: $item`, []any{1.0, 2.0, nil}},
+		{`[2,null,1] |sort("desc"): $item`, []any{2.0, 1.0, nil}},
+		{`[2,null,1] |sort("nullsFirst"): $item`, []any{nil, 1.0, 2.0}},
+		{`[2,null,1] |sort("desc", "nullsFirst"): $item`, []any{nil, 2.0, 1.0}},
+		{`[2,null,1] |sort("nullsFirst", "nullsLast"): $item`, []any{1.0, 2.0, nil}},
+
+		// NaN sorts after every number.
+		{`[2,NaN,1] |sort: $item`, []any{1.0, 2.0, "NaN"}},
+
+		// Composite keys compare lexicographically, a prefix first.
+		{`[{"a":2,"b":1},{"a":1,"b":2},{"a":1,"b":1}] |sort: [$item.a, $item.b]`,
+			[]any{map[string]any{"a": 1.0, "b": 1.0}, map[string]any{"a": 1.0, "b": 2.0}, map[string]any{"a": 2.0, "b": 1.0}}},
+		{`[[1,2],[1],[0,5]] |sort: $item`, []any{[]any{0.0, 5.0}, []any{1.0}, []any{1.0, 2.0}}},
+		{`[[1,2],[1],[0,5]] |sort("desc"): $item`, []any{[]any{1.0, 2.0}, []any{1.0}, []any{0.0, 5.0}}},
+		{`[[1,null],[1,0]] |sort: $item`, []any{[]any{1.0, 0.0}, []any{1.0, nil}}},
+
+		// Case-insensitive collation, including inside composite keys.
+		{`["b","A","a","B"] |sort: $item`, []any{"A", "B", "a", "b"}},
+		{`["b","A","a","B"] |sort("ci"): $item`, []any{"A", "a", "b", "B"}},
+		{`["b","A"] |sort("ci"): [$item]`, []any{"A", "b"}},
+
+		// Stability: equal keys keep input order.
+		{`[{"k":1,"v":"x"},{"k":0,"v":"y"},{"k":1,"v":"z"}] |sort("desc"): $item.k |map: $item.v`,
+			[]any{"x", "z", "y"}},
+	}
+	runVmTestsNaNAware(t, tests)
+}
+
+// runVmTestsNaNAware runs tests like runVmTests, except that an expected "NaN"
+// array element matches a NaN result.
+func runVmTestsNaNAware(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		out, err := runSort(tt.input, vm.LibContext{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if arr, ok := out.([]any); ok {
+			for i, v := range arr {
+				if f, ok := v.(float64); ok && f != f {
+					arr[i] = "NaN"
+				}
+			}
+		}
+		if err := testExpectedObject(t, tt.expected, out); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+	}
+}
+
+func TestSortPipeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1,"a"] |sort: $item`, "sort pipe cannot compare number key of element 0 with string key of element 1"},
+		{`[{}, {}] |sort: $item`, "sort pipe cannot compare object key of element 0 with object key of element 1"},
+		{`[[1,"x"],[1,2]] |sort: $item`, "sort pipe cannot compare string key of element 0 with number key of element 1"},
+		{`[1,2] |sort("up"): $item`, `sort pipe: unknown option or collator "up"`},
+		{`[1,2] |sort(1): $item`, "sort pipe options must be strings, got number"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+func TestSortPipeKeyError(t *testing.T) {
+	_, err := runSort(`[1, 2, true] |sort: $item`, vm.LibContext{})
+	var keyErr *vm.SortKeyError
+	if !errors.As(err, &keyErr) {
+		t.Fatalf("expected *vm.SortKeyError, got %T: %v", err, err)
+	}
+	if keyErr.Right != true || keyErr.RightIndex != 2 {
+		t.Fatalf("unexpected key error %+v", keyErr)
+	}
+}
+
+func TestSortPipeCollators(t *testing.T) {
+	// A collator that orders by length, then byte-wise.
+	byLength := func(a, b string) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return strings.Compare(a, b)
+	}
+	lib := vm.LibContext{Collators: vm.Collators{"length": byLength}}
+
+	out, err := runSort(`["ccc","a","bb","b"] |sort("length"): $item`, lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testExpectedObject(t, []any{"a", "b", "bb", "ccc"}, out); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = runSort(`["ccc","a","bb"] |sort("length", "desc"): $item`, lib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testExpectedObject(t, []any{"ccc", "bb", "a"}, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runSort(input string, lib vm.LibContext) (any, error) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+	lib.Functions = vm.Builtins
+	lib.PipeHandlers = vm.DefaultPipeHandlers
+	return vm.New(lib).Run(comp.ByteCode(), nil)
+}
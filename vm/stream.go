@@ -0,0 +1,391 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Stream is a pull-based sequence of values flowing between the stages of a
+// fused pipe chain (see runPipeChain).
+type Stream interface {
+	// Next returns the next value, or ok == false once the stream is exhausted.
+	Next() (value any, ok bool, err error)
+}
+
+// StreamingPipe is implemented by pipes that can run as a stage of a fused
+// chain. Stream wraps the previous stage's output and must pull from it only
+// as far as its own consumer pulls, so that a short-circuiting stage further
+// down (find, some, every, take, takeWhile) stops the whole chain early.
+// $index is the position of the element in the stage's own input.
+type StreamingPipe interface {
+	Stream(ctx PipeContext, input Stream) (Stream, error)
+}
+
+// StreamFunc adapts a function to StreamingPipe.
+type StreamFunc func(ctx PipeContext, input Stream) (Stream, error)
+
+func (f StreamFunc) Stream(ctx PipeContext, input Stream) (Stream, error) { return f(ctx, input) }
+
+// StreamingPipes is a registry mapping pipe names to streaming implementations.
+// A name registered here must also be registered as a PipeHandler (see
+// StreamingPipeHandler), which runs the stage when it cannot be fused.
+type StreamingPipes map[string]StreamingPipe
+
+// StreamingPipeHandler returns a PipeHandler that runs s over a whole array
+// (or range) input and collects its output, for dispatches outside a fused
+// chain.
+func StreamingPipeHandler(s StreamingPipe) PipeHandler {
+	return func(ctx PipeContext, input any) (any, error) {
+		seq, ok := asSequence(input)
+		if !ok {
+			return nil, fmt.Errorf("streaming pipe expects array input")
+		}
+		out, err := s.Stream(ctx, &sequenceStream{seq: seq})
+		if err != nil {
+			return nil, err
+		}
+		return CollectStream(out)
+	}
+}
+
+// CollectStream drains s into an array.
+func CollectStream(s Stream) ([]any, error) {
+	result := make([]any, 0)
+	for {
+		v, ok, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return result, nil
+		}
+		result = append(result, v)
+	}
+}
+
+// streamSink consumes a stream into the result of a terminal stage.
+type streamSink func(ctx PipeContext, input Stream) (any, error)
+
+// builtinStreams and builtinSinks index the streaming forms of the built-in
+// handlers by code pointer, so that they apply under any registered name but
+// not once a handler has been replaced. Like rangeAwarePipes, they are filled
+// in init because the handlers (indirectly) refer to them.
+var (
+	builtinStreams map[uintptr]StreamingPipe
+	builtinSinks   map[uintptr]streamSink
+)
+
+func init() {
+	builtinStreams = make(map[uintptr]StreamingPipe)
+	for _, b := range []struct {
+		handler PipeHandler
+		stream  StreamFunc
+	}{
+		{MapPipeHandler, mapStream},
+		{FilterPipeHandler, filterStream},
+		{FlatMapPipeHandler, flatMapStream},
+		{TakePipeHandler, takeStream},
+		{SkipPipeHandler, skipStream},
+		{TakeWhilePipeHandler, takeWhileStream},
+		{SkipWhilePipeHandler, skipWhileStream},
+		{DistinctByPipeHandler, distinctByStream},
+	} {
+		builtinStreams[reflect.ValueOf(b.handler).Pointer()] = b.stream
+	}
+	builtinSinks = make(map[uintptr]streamSink)
+	for _, b := range []struct {
+		handler PipeHandler
+		sink    streamSink
+	}{
+		{FindPipeHandler, findSink},
+		{SomePipeHandler, someSink},
+		{EveryPipeHandler, everySink},
+	} {
+		builtinSinks[reflect.ValueOf(b.handler).Pointer()] = b.sink
+	}
+}
+
+// sequenceStream streams the elements of an array or range.
+type sequenceStream struct {
+	seq sequence
+	i   int
+}
+
+func (s *sequenceStream) Next() (any, bool, error) {
+	if s.i >= s.seq.Len() {
+		return nil, false, nil
+	}
+	v := s.seq.At(s.i)
+	s.i++
+	return v, true, nil
+}
+
+// streamStage holds what every built-in stream stage needs: its context, its
+// input and the index of the next input element.
+type streamStage struct {
+	ctx     PipeContext
+	in      Stream
+	index   int
+	stopped bool // the predicate returned stop(): pull nothing more
+}
+
+// pull returns the next input element and its index.
+func (s *streamStage) pull() (any, int, bool, error) {
+	if s.stopped {
+		return nil, 0, false, nil
+	}
+	v, ok, err := s.in.Next()
+	if !ok || err != nil {
+		return nil, 0, false, err
+	}
+	i := s.index
+	s.index++
+	return v, i, true, nil
+}
+
+type mapStreamStage struct{ streamStage }
+
+func mapStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &mapStreamStage{streamStage{ctx: ctx, in: in}}, nil
+}
+
+func (s *mapStreamStage) Next() (any, bool, error) {
+	for {
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		res, ctl, err := s.ctx.EvalItemWithControl(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		s.stopped = ctl.stops()
+		if ctl.keeps() {
+			return res, true, nil
+		}
+	}
+}
+
+type filterStreamStage struct{ streamStage }
+
+func filterStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &filterStreamStage{streamStage{ctx: ctx, in: in}}, nil
+}
+
+func (s *filterStreamStage) Next() (any, bool, error) {
+	for {
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		keep, ctl, err := s.ctx.EvalItemWithControl(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		s.stopped = ctl.stops()
+		if b, ok := keep.(bool); ok && b && ctl.keeps() {
+			return v, true, nil
+		}
+	}
+}
+
+type flatMapStreamStage struct {
+	streamStage
+	pending []any
+}
+
+func flatMapStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &flatMapStreamStage{streamStage: streamStage{ctx: ctx, in: in}}, nil
+}
+
+func (s *flatMapStreamStage) Next() (any, bool, error) {
+	for len(s.pending) == 0 {
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		res, ctl, err := s.ctx.EvalItemWithControl(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		s.stopped = ctl.stops()
+		if !ctl.keeps() {
+			continue
+		}
+		arr, isArr := res.([]any)
+		if !isArr {
+			return res, true, nil
+		}
+		s.pending = arr
+	}
+	v := s.pending[0]
+	s.pending = s.pending[1:]
+	return v, true, nil
+}
+
+// countStreamStage implements take (limit elements) and skip (drop the first
+// skip elements), projecting the elements it passes on.
+type countStreamStage struct {
+	streamStage
+	proj  projector
+	skip  int
+	limit int // -1: unlimited
+}
+
+func takeStream(ctx PipeContext, in Stream) (Stream, error) {
+	n, err := pipeCount("take", ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countStreamStage{streamStage: streamStage{ctx: ctx, in: in}, proj: newProjector(ctx), limit: n}, nil
+}
+
+func skipStream(ctx PipeContext, in Stream) (Stream, error) {
+	n, err := pipeCount("skip", ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &countStreamStage{streamStage: streamStage{ctx: ctx, in: in}, proj: newProjector(ctx), skip: n, limit: -1}, nil
+}
+
+func (s *countStreamStage) Next() (any, bool, error) {
+	for {
+		if s.limit >= 0 && s.index >= s.limit {
+			return nil, false, nil // stop without pulling further
+		}
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		if i < s.skip {
+			continue
+		}
+		res, err := s.proj.project(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		return res, true, nil
+	}
+}
+
+// whileStreamStage implements takeWhile and skipWhile.
+type whileStreamStage struct {
+	streamStage
+	take bool // takeWhile; otherwise skipWhile
+	done bool // takeWhile: the condition failed; skipWhile: skipping is over
+}
+
+func takeWhileStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &whileStreamStage{streamStage: streamStage{ctx: ctx, in: in}, take: true}, nil
+}
+
+func skipWhileStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &whileStreamStage{streamStage: streamStage{ctx: ctx, in: in}}, nil
+}
+
+func (s *whileStreamStage) Next() (any, bool, error) {
+	if s.take && s.done {
+		return nil, false, nil
+	}
+	for {
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		if !s.take && s.done {
+			return v, true, nil
+		}
+		res, err := s.ctx.EvalItem(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		if b, ok := res.(bool); ok && b {
+			if s.take {
+				return v, true, nil
+			}
+			continue
+		}
+		s.done = true
+		if s.take {
+			return nil, false, nil
+		}
+		return v, true, nil
+	}
+}
+
+type distinctByStreamStage struct {
+	streamStage
+	proj projector
+	seen map[any]struct{}
+}
+
+func distinctByStream(ctx PipeContext, in Stream) (Stream, error) {
+	return &distinctByStreamStage{streamStage{ctx: ctx, in: in}, newProjector(ctx), make(map[any]struct{})}, nil
+}
+
+func (s *distinctByStreamStage) Next() (any, bool, error) {
+	for {
+		v, i, ok, err := s.pull()
+		if !ok {
+			return nil, false, err
+		}
+		key, err := s.proj.project(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		k := hashKey(key)
+		if _, dup := s.seen[k]; !dup {
+			s.seen[k] = struct{}{}
+			return v, true, nil
+		}
+	}
+}
+
+// firstMatch pulls from in until the predicate returns true for an element.
+func firstMatch(ctx PipeContext, in Stream) (any, bool, error) {
+	for i := 0; ; i++ {
+		v, ok, err := in.Next()
+		if !ok || err != nil {
+			return nil, false, err
+		}
+		res, err := ctx.EvalItem(v, i)
+		if err != nil {
+			return nil, false, err
+		}
+		if b, ok := res.(bool); ok && b {
+			return v, true, nil
+		}
+	}
+}
+
+func findSink(ctx PipeContext, in Stream) (any, error) {
+	v, _, err := firstMatch(ctx, in)
+	return v, err
+}
+
+func someSink(ctx PipeContext, in Stream) (any, error) {
+	_, found, err := firstMatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func everySink(ctx PipeContext, in Stream) (any, error) {
+	for i := 0; ; i++ {
+		v, ok, err := in.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return true, nil
+		}
+		res, err := ctx.EvalItem(v, i)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := res.(bool); !ok || !b {
+			return false, nil
+		}
+	}
+}
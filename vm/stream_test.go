@@ -0,0 +1,162 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/vm"
+)
+
+func TestPipeChain_Fused(t *testing.T) {
+	tests := []vmTestCase{
+		// fused chains produce the same results as stage-by-stage execution
+		{`[1, 2, 3, 4] |filter: $item > 1 |map: $item * 2`, []any{4.0, 6.0, 8.0}},
+		{`[1, 2, 3, 4] |map: $item * 2 |filter: $item > 4 |find: $item > 6`, 8.0},
+		{`[1, 2, 3] |map: $item * 2 |some: $item == 4`, true},
+		{`[1, 2, 3] |map: $item * 2 |every: $item > 2`, false},
+		{`[] |map: $item |every: false`, true},
+		{`[1, 2, 3] |filter: false |map: $item`, []any{}},
+		{`[[1, 2], [3]] |flatMap: $item |map: $item * 10`, []any{10.0, 20.0, 30.0}},
+		{`[1, 1, 2, 3, 3] |distinctBy: $item |map: $item * 2`, []any{2.0, 4.0, 6.0}},
+		{`[1, 2, 3, 4, 5] |skip(1): $item |take(2): $item * 10`, []any{20.0, 30.0}},
+		{`[1, 2, 5, 1] |takeWhile: $item < 3 |map: $item + 1`, []any{2.0, 3.0}},
+		{`[1, 2, 5, 1] |skipWhile: $item < 3 |map: $item + 1`, []any{6.0, 2.0}},
+
+		// $index is the position in each stage's own input
+		{`[10, 20, 30, 40] |filter: $item > 15 |map: $index`, []any{0.0, 1.0, 2.0}},
+		{`[10, 20, 30] |map: $index |filter: $index > 0`, []any{1.0, 2.0}},
+
+		// short-circuiting: later elements are never evaluated by earlier stages
+		{`[1, 2, "x"] |map: $item * 2 |find: $item > 1`, 2.0},
+		{`[1, 2, "x"] |map: $item * 2 |some: $item > 1`, true},
+		{`[1, 2, "x"] |map: $item * 2 |every: $item > 2`, false},
+		{`[1, 2, "x"] |map: $item * 2 |take(2): $item`, []any{2.0, 4.0}},
+		{`[1, 5, "x"] |map: $item |takeWhile: $item < 3`, []any{1.0}},
+		{`0..<1000000000 |map: $item * 2 |filter: $item % 3 == 0 |take(3): $item`, []any{0.0, 6.0, 12.0}},
+		{`0..<1000000000 |filter: $item > 5 |find: $item % 7 == 0`, 7.0},
+		{`1.. 1000000000 |map: $item * $item |some: $item > 50`, true},
+
+		// stages that cannot stream split the chain
+		{`[3, 1, 2] |map: $item * 2 |sort: $item |map: $item + 1`, []any{3.0, 5.0, 7.0}},
+		{`[1, 2, 3, 4] |filter: $item > 1 |map: $item * 2 |sum: $item`, 18.0},
+		{`[1, 2, 3] |map: $item * 2 |: len($last)`, 3.0},
+		{`{"a": 1, "b": 2} |map: $value * 10 |filter: $value > 10`, map[string]any{"b": 20.0}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPipeChain_Errors(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, "x"] |map: $item * 2 |filter: true`, "expected string, got float64"},
+		{`[1] |map: $item |take(-1): $item`, "take pipe count must be a non-negative integer, got -1"},
+	}
+	runVmErrorTests(t, tests)
+}
+
+// countingStream is a custom streaming pipe that passes its input through
+// unchanged and counts how many elements it pulled.
+type countingStream struct{ pulled *int }
+
+func (c countingStream) Stream(ctx vm.PipeContext, input vm.Stream) (vm.Stream, error) {
+	return countingIter{input, c.pulled}, nil
+}
+
+type countingIter struct {
+	in     vm.Stream
+	pulled *int
+}
+
+func (c countingIter) Next() (any, bool, error) {
+	v, ok, err := c.in.Next()
+	if ok {
+		*c.pulled++
+	}
+	return v, ok, err
+}
+
+func runChain(t *testing.T, input string, lib vm.LibContext) any {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("%s: compile error: %v", input, err)
+	}
+	lib.Functions = vm.Builtins
+	out, err := vm.New(lib).Run(comp.ByteCode(), nil)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return out
+}
+
+func TestPipeChain_CustomStreamingPipe(t *testing.T) {
+	pulled := 0
+	counter := countingStream{&pulled}
+	handlers := vm.PipeHandlers{"tap": vm.StreamingPipeHandler(counter)}
+	for name, h := range vm.DefaultPipeHandlers {
+		handlers[name] = h
+	}
+	lib := vm.LibContext{
+		PipeHandlers:   handlers,
+		StreamingPipes: vm.StreamingPipes{"tap": counter},
+	}
+
+	out := runChain(t, `0..<1000000 |tap: $item |take(3): $item`, lib)
+	if err := testExpectedObject(t, []any{0.0, 1.0, 2.0}, out); err != nil {
+		t.Fatal(err)
+	}
+	if pulled != 3 {
+		t.Fatalf("fused custom stage pulled %d elements, want 3", pulled)
+	}
+
+	// Outside a chain the same pipe runs through its PipeHandler.
+	pulled = 0
+	out = runChain(t, `[1, 2, 3] |tap: $item`, lib)
+	if err := testExpectedObject(t, []any{1.0, 2.0, 3.0}, out); err != nil {
+		t.Fatal(err)
+	}
+	if pulled != 3 {
+		t.Fatalf("unfused custom stage pulled %d elements, want 3", pulled)
+	}
+}
+
+func TestPipeChain_ReplacedHandlerIsNotFused(t *testing.T) {
+	calls := 0
+	handlers := vm.PipeHandlers{}
+	for name, h := range vm.DefaultPipeHandlers {
+		handlers[name] = h
+	}
+	handlers["map"] = func(ctx vm.PipeContext, input any) (any, error) {
+		calls++
+		return vm.MapPipeHandler(ctx, input)
+	}
+	out := runChain(t, `[1, 2, 3] |map: $item * 2 |find: $item > 2`, vm.LibContext{PipeHandlers: handlers})
+	if out != 4.0 || calls != 1 {
+		t.Fatalf("got %v with %d map calls, want 4 with 1 (materialized) call", out, calls)
+	}
+}
+
+func TestPipeChain_FusedStagesHaveOwnScope(t *testing.T) {
+	// A tracer runs the stages one at a time; fusion must not change the
+	// result, nor make one stage's alias visible in the next. (Reading an
+	// earlier stage's alias is a compile error.)
+	for _, input := range []string{
+		`[1, 2] |map as $a: $a * 10 |map as $b: $b + 1 |map as $c: $c * 2`,
+		`[1, 2] |map as $a: $a * 10 |filter as $a: $a > 10`,
+		`[[1], [2]] |map as $o: ($o |map: $o[0] + $item) |map as $p: $p[0]`,
+	} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("%s: compile error: %v", input, err)
+		}
+		run := func(tracer vm.Tracer) string {
+			machine := vm.New(vm.LibContext{Functions: vm.Builtins, PipeHandlers: vm.DefaultPipeHandlers})
+			machine.SetTracer(tracer)
+			out, err := machine.Run(comp.ByteCode(), nil)
+			return fmt.Sprint(out, err)
+		}
+		if fused, staged := run(nil), run(&logTracer{}); fused != staged {
+			t.Errorf("%s: fused %s, stage by stage %s", input, fused, staged)
+		}
+	}
+}
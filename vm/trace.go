@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+)
+
+// Tracer observes an evaluation: every instruction, function call and pipe
+// stage. A VM without a tracer does not call one, so tracing costs nothing
+// unless it is installed with SetTracer.
+//
+// The callbacks run on the evaluating goroutine, between instructions, and may
+// block: a debugger pauses the evaluation by not returning. To stop it, cancel
+// the context passed to SetContext; the VM checks it before the next
+// instruction. While a tracer is installed, pipe chains run stage by stage
+// instead of fused, and parallel pipes run sequentially, so that every stage
+// and predicate is reported.
+type Tracer interface {
+	// OnInstruction is called after an instruction has run. stack holds the
+	// values of the current frame, bottom first; when step.Source.Result is
+	// set, its top is the value of step.Source.Node. stack is only valid
+	// during the call.
+	OnInstruction(step Step, stack []any)
+	// OnCall is called when a function returns, with the error it failed with.
+	OnCall(name string, args []any, result any, err error)
+	// OnPipe is called when a pipe stage returns.
+	OnPipe(name string, input, output any, err error)
+}
+
+// ErrorTracer is a Tracer that is also told where an evaluation failed.
+type ErrorTracer interface {
+	Tracer
+	// OnError is called when the instruction of step fails with err, and
+	// again for the instruction of each enclosing frame (the OpPipe running a
+	// failed predicate) as the error unwinds.
+	OnError(step Step, err error)
+}
+
+// Step identifies an instruction reported to a Tracer.
+type Step struct {
+	IP int // offset of the instruction in its block
+	Op code.Opcode
+	// Depth is 0 in the main program, 1 in a pipe predicate or argument
+	// block, and one more for each pipe nested in a predicate.
+	Depth int
+	// Source is the source map entry of the instruction; its Node is nil for
+	// bytecode without a source map.
+	Source compiler.SourceEntry
+}
+
+// SetTracer installs t for the following runs, or removes the tracer when t
+// is nil. Safe to call on a VM borrowed from sync.Pool before each evaluation.
+func (vm *VM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
+
+// traceInstruction reports the instruction at ip of frame, which has just run.
+func (vm *VM) traceInstruction(frame *Frame, ip int, op code.Opcode) {
+	step := vm.step(frame, ip, op)
+	stack := make([]any, 0, vm.sp-frame.basePointer)
+	for i := frame.basePointer; i < vm.sp; i++ {
+		stack = append(stack, vm.stack[i].ToAny())
+	}
+	vm.tracer.OnInstruction(step, stack)
+}
+
+// step returns the Step of the instruction at ip of frame.
+func (vm *VM) step(frame *Frame, ip int, op code.Opcode) Step {
+	step := Step{IP: ip, Op: op, Depth: vm.framesIdx - 1}
+	step.Source, _ = frame.sourceMap.At(ip)
+	return step
+}
@@ -0,0 +1,168 @@
+package vm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
+	"github.com/maniartech/uexl/format"
+	"github.com/maniartech/uexl/parser"
+	"github.com/maniartech/uexl/vm"
+)
+
+// logTracer logs tracer events as text.
+type logTracer struct {
+	log    []string
+	onStep func(step vm.Step)
+}
+
+func (l *logTracer) OnInstruction(step vm.Step, stack []any) {
+	if l.onStep != nil {
+		l.onStep(step)
+	}
+	if step.Source.Result {
+		l.log = append(l.log, fmt.Sprintf("%d %s = %v", step.Depth, format.Node(step.Source.Node, nil), stack[len(stack)-1]))
+	}
+}
+
+func (l *logTracer) OnCall(name string, args []any, result any, err error) {
+	l.log = append(l.log, fmt.Sprintf("call %s%v = %v %v", name, args, result, err))
+}
+
+func (l *logTracer) OnPipe(name string, input, output any, err error) {
+	l.log = append(l.log, fmt.Sprintf("pipe %s %v = %v %v", name, input, output, err))
+}
+
+func runTraced(t *testing.T, input string, tracer vm.Tracer, ctx context.Context) (any, error) {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New(vm.LibContext{Functions: vm.Builtins, PipeHandlers: vm.DefaultPipeHandlers})
+	machine.SetContext(ctx)
+	machine.SetTracer(tracer)
+	return machine.Run(comp.ByteCode(), map[string]any{"x": 3.0})
+}
+
+func TestTracer(t *testing.T) {
+	tr := &logTracer{}
+	out, err := runTraced(t, `len(str(x)) + x`, tr, context.Background())
+	if err != nil || out != 4.0 {
+		t.Fatalf("got %v, %v", out, err)
+	}
+	want := []string{
+		"0 x = 3",
+		"call str[3] = 3 <nil>",
+		"0 str(x) = 3",
+		"call len[3] = 1 <nil>",
+		"0 len(str(x)) = 1",
+		"0 x = 3",
+		"0 len(str(x)) + x = 4",
+	}
+	if !reflect.DeepEqual(tr.log, want) {
+		t.Errorf("log:\n%q\nwant:\n%q", tr.log, want)
+	}
+}
+
+func TestTracer_PipeChain(t *testing.T) {
+	// Traced chains run stage by stage, so every stage is reported.
+	tr := &logTracer{}
+	out, err := runTraced(t, `[1, 2, 3] |filter: $item > 1 |map: $item * 2 |find: $item > 4`, tr, context.Background())
+	if err != nil || out != 6.0 {
+		t.Fatalf("got %v, %v", out, err)
+	}
+	var pipes []string
+	depth := 0
+	for _, l := range tr.log {
+		if l[:4] == "pipe" {
+			pipes = append(pipes, l)
+		}
+		if l[0] == '1' {
+			depth++
+		}
+	}
+	want := []string{"pipe filter [1 2 3] = [2 3] <nil>", "pipe map [2 3] = [4 6] <nil>", "pipe find [4 6] = 6 <nil>"}
+	if !reflect.DeepEqual(pipes, want) {
+		t.Errorf("pipes %q, want %q", pipes, want)
+	}
+	if depth == 0 {
+		t.Error("no predicate steps at depth 1")
+	}
+}
+
+func TestTracer_Cancel(t *testing.T) {
+	// A tracer stops the evaluation by cancelling its context.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	steps := 0
+	tr := &logTracer{onStep: func(step vm.Step) {
+		steps++
+		if step.Op == code.OpCallFunction {
+			cancel()
+		}
+	}}
+	_, err := runTraced(t, `len("ab") + x * 2`, tr, ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if steps != 2 {
+		t.Errorf("%d steps, want 2", steps)
+	}
+}
+
+// errorTracer logs the failing instructions.
+type errorTracer struct {
+	logTracer
+	errors []string
+}
+
+func (e *errorTracer) OnError(step vm.Step, err error) {
+	e.errors = append(e.errors, fmt.Sprintf("%d %s %T: %v", step.Depth, step.Op, step.Source.Node, err))
+}
+
+func TestErrorTracer(t *testing.T) {
+	tr := &errorTracer{}
+	_, err := runTraced(t, `[1, 0] |map: x / $item`, tr, context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := []string{
+		"1 OpDiv *parser.BinaryExpression: division by zero",
+		"0 OpPipe *parser.PipeExpression: division by zero",
+	}
+	if !reflect.DeepEqual(tr.errors, want) {
+		t.Errorf("errors:\n%q\nwant:\n%q", tr.errors, want)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`[1, 0] |map: x / $item`)); err != nil {
+		t.Fatal(err)
+	}
+	machine := vm.New(vm.LibContext{Functions: vm.Builtins, PipeHandlers: vm.DefaultPipeHandlers})
+	if _, err := machine.Run(comp.ByteCode(), map[string]any{"x": 3.0}); err == nil {
+		t.Fatal("expected an error")
+	}
+	entry, ok := machine.Failure()
+	if b, isBinary := entry.Node.(*parser.BinaryExpression); !ok || !isBinary || b.Operator != "/" {
+		t.Errorf("Failure() = %T %v, want the division", entry.Node, ok)
+	}
+
+	// A successful run clears the failure.
+	comp = compiler.New()
+	if err := comp.Compile(parse(`x / 2`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := machine.Run(comp.ByteCode(), map[string]any{"x": 3.0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := machine.Failure(); ok {
+		t.Error("Failure() reports a failure after a successful run")
+	}
+}
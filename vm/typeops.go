@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/maniartech/uexl/parser/constants"
+)
+
+// typeName returns the stable UExL type name of a Go value as reported by
+// typeof(): number, string, boolean, null, array or object. Host values of
+// other Go types map by kind (any numeric kind is a number, slices are arrays,
+// maps are objects); anything else is "unknown".
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return constants.TypeNameNull
+	case float64, int:
+		return constants.TypeNameNumber
+	case string:
+		return constants.TypeNameString
+	case bool:
+		return constants.TypeNameBoolean
+	case []any, *Range:
+		return constants.TypeNameArray
+	case map[string]any:
+		return constants.TypeNameObject
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return constants.TypeNameNumber
+	case reflect.Slice, reflect.Array:
+		return constants.TypeNameArray
+	case reflect.Map:
+		return constants.TypeNameObject
+	}
+	return "unknown"
+}
+
+// typeNameValue is the zero-alloc counterpart of typeName for stack values.
+func typeNameValue(v Value) string {
+	switch v.Typ {
+	case TypeFloat:
+		return constants.TypeNameNumber
+	case TypeString:
+		return constants.TypeNameString
+	case TypeBool:
+		return constants.TypeNameBoolean
+	case TypeNull:
+		return constants.TypeNameNull
+	default:
+		return typeName(v.AnyVal)
+	}
+}
+
+// convertValue implements `x as <type>`. Rules:
+//
+//	as number:  numbers unchanged; booleans 1/0; strings parsed as decimal
+//	            numbers after trimming whitespace ("NaN" and "Inf" accepted)
+//	as string:  strings unchanged; integral numbers without exponent or
+//	            fraction ("3", not "3e+00"); NaN/Inf/-Inf as their literals;
+//	            booleans "true"/"false"
+//	as boolean: booleans unchanged; numbers 0 -> false, others -> true;
+//	            strings "true"/"false" only
+//
+// Every other combination, including null, arrays and objects, is an error.
+func convertValue(v Value, target string) (Value, error) {
+	switch target {
+	case constants.TypeNameNumber:
+		switch v.Typ {
+		case TypeFloat:
+			return v, nil
+		case TypeBool:
+			if v.BoolVal {
+				return newFloatValue(1), nil
+			}
+			return newFloatValue(0), nil
+		case TypeString:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.StrVal), 64)
+			if err != nil {
+				return Value{}, fmt.Errorf("cannot convert string %q to number", v.StrVal)
+			}
+			return newFloatValue(f), nil
+		}
+		if f, ok := hostNumber(v); ok {
+			return newFloatValue(f), nil
+		}
+	case constants.TypeNameString:
+		switch v.Typ {
+		case TypeString:
+			return v, nil
+		case TypeFloat:
+			return newStringValue(formatNumber(v.FloatVal)), nil
+		case TypeBool:
+			return newStringValue(strconv.FormatBool(v.BoolVal)), nil
+		}
+		if f, ok := hostNumber(v); ok {
+			return newStringValue(formatNumber(f)), nil
+		}
+	case constants.TypeNameBoolean:
+		switch v.Typ {
+		case TypeBool:
+			return v, nil
+		case TypeFloat:
+			if math.IsNaN(v.FloatVal) {
+				return Value{}, fmt.Errorf("cannot convert NaN to boolean")
+			}
+			return newBoolValue(v.FloatVal != 0), nil
+		case TypeString:
+			switch v.StrVal {
+			case "true":
+				return newBoolValue(true), nil
+			case "false":
+				return newBoolValue(false), nil
+			}
+			return Value{}, fmt.Errorf("cannot convert string %q to boolean", v.StrVal)
+		}
+	default:
+		return Value{}, fmt.Errorf("unsupported conversion target %q", target)
+	}
+	return Value{}, fmt.Errorf("cannot convert %s to %s", typeNameValue(v), target)
+}
+
+// hostNumber extracts a float64 from host-provided numeric values of other Go kinds.
+func hostNumber(v Value) (float64, bool) {
+	if v.Typ != TypeAny || v.AnyVal == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v.AnyVal)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// formatNumber renders a number the way `as string` documents it.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1e21:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,92 @@
+package vm_test
+
+import "testing"
+
+func TestTypeofBuiltin(t *testing.T) {
+	tests := []vmTestCase{
+		{`typeof(1.5)`, "number"},
+		{`typeof("a")`, "string"},
+		{`typeof(true)`, "boolean"},
+		{`typeof(null)`, "null"},
+		{`typeof([1])`, "array"},
+		{`typeof({"a": 1})`, "object"},
+		{`typeof(missing)`, "null"},
+		{`typeof(n)`, "number"},
+		{`typeof(u)`, "number"},
+		{`typeof(strs)`, "array"},
+	}
+	runVmTests(t, tests, map[string]any{"n": 3, "u": uint8(4), "strs": []string{"x"}})
+}
+
+func TestTruthinessBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`isNullish(null)`, true},
+		{`isNullish(0)`, false},
+		{`isNullish("")`, false},
+		{`isTruthy(0)`, false},
+		{`isTruthy("x")`, true},
+		{`isTruthy([])`, false},
+		{`isFalsy({})`, true},
+		{`isFalsy(1)`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestIsOperator(t *testing.T) {
+	tests := []vmTestCase{
+		{`1 is number`, true},
+		{`"1" is number`, false},
+		{`"a" is string`, true},
+		{`false is boolean`, true},
+		{`null is null`, true},
+		{`[1] is array`, true},
+		{`{"a": 1} is object`, true},
+		{`[1] is object`, false},
+		{`1 + 2 is number`, true},
+		{`x is number && x > 1`, true},
+		{`x ?? "d" is string`, false},
+		{`[1, "a", null] |filter: $item is number`, []any{1.0}},
+		{`[1, "a"] |map: $item is string ? "s" : "n"`, []any{"n", "s"}},
+	}
+	runVmTests(t, tests, map[string]any{"x": 2.0})
+}
+
+func TestAsConversions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"42" as number`, 42.0},
+		{`" 1.5e2 " as number`, 150.0},
+		{`true as number`, 1.0},
+		{`3 as number`, 3.0},
+		{`3 as string`, "3"},
+		{`1000000 as string`, "1000000"},
+		{`0.25 as string`, "0.25"},
+		{`1e21 as string`, "1e+21"},
+		{`-Inf as string`, "-Inf"},
+		{`false as string`, "false"},
+		{`"s" as string`, "s"},
+		{`0 as boolean`, false},
+		{`2 as boolean`, true},
+		{`"true" as boolean`, true},
+		{`("1" as number) + 1`, 2.0},
+		{`1 + 2 as string == "3"`, true},
+		{`["1", "2"] |map: $item as number`, []any{1.0, 2.0}},
+		{`(null ?? 0) as number`, 0.0},
+	}
+	runVmTests(t, tests)
+}
+
+func TestAsConversionErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`"abc" as number`, `cannot convert string "abc" to number`},
+		{`"" as number`, `cannot convert string "" to number`},
+		{`null as number`, "cannot convert null to number"},
+		{`null as string`, "cannot convert null to string"},
+		{`null as boolean`, "cannot convert null to boolean"},
+		{`[] as boolean`, "cannot convert array to boolean"},
+		{`[1] as string`, "cannot convert array to string"},
+		{`{"a": 1} as number`, "cannot convert object to number"},
+		{`"yes" as boolean`, `cannot convert string "yes" to boolean`},
+		{`NaN as boolean`, "cannot convert NaN to boolean"},
+	}
+	runVmErrorTests(t, tests)
+}
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 
@@ -14,8 +15,9 @@ func (vm *VM) setBaseInstructions(bytecode *compiler.ByteCode, contextVarsValues
 	vm.systemVars = bytecode.SystemVars
 
 	// Pre-resolve context variables into a lookup slice for O(1) access
-	// Optimization: Only rebuild cache if context values pointer changed or cache size mismatches
-	// Compare map pointers using reflect to avoid rebuilding cache when same map is reused
+	// Optimization: Only rebuild cache if the context values map or the bytecode's
+	// variable list changed (a pooled VM may run different expressions with the same map).
+	// Compare map and slice pointers using reflect to avoid rebuilding cache when both are reused
 	var lastPtr, newPtr uintptr
 	if vm.lastContextValues != nil {
 		lastPtr = reflect.ValueOf(vm.lastContextValues).Pointer()
@@ -23,9 +25,11 @@ func (vm *VM) setBaseInstructions(bytecode *compiler.ByteCode, contextVarsValues
 	if contextVarsValues != nil {
 		newPtr = reflect.ValueOf(contextVarsValues).Pointer()
 	}
-	contextValuesChanged := lastPtr != newPtr || len(vm.contextVarCache) != len(vm.contextVars)
+	contextValuesChanged := lastPtr != newPtr || len(vm.contextVarCache) != len(vm.contextVars) ||
+		reflect.ValueOf(vm.lastContextVars).Pointer() != reflect.ValueOf(vm.contextVars).Pointer()
 	vm.contextVarsValues = contextVarsValues
 	vm.lastContextValues = contextVarsValues
+	vm.lastContextVars = vm.contextVars
 
 	if len(vm.contextVars) > 0 && contextValuesChanged {
 		if vm.contextVarCache == nil || cap(vm.contextVarCache) < len(vm.contextVars) {
@@ -57,9 +61,22 @@ func (vm *VM) setBaseInstructions(bytecode *compiler.ByteCode, contextVarsValues
 		vm.frames[0].ip = 0
 		vm.frames[0].basePointer = 0
 	}
+	vm.frames[0].sourceMap = bytecode.SourceMap
 
 	// Clear pipe scopes (preserve capacity)
 	vm.pipeScopes = vm.pipeScopes[:0]
+	vm.outerPipeScopes = vm.outerPipeScopes[:0]
+	vm.pipeFastScopeActive = false
+
+	// Size local slots for multi-statement programs (preserve capacity)
+	if bytecode.NumLocals > 0 {
+		if cap(vm.locals) < bytecode.NumLocals {
+			vm.locals = make([]Value, bytecode.NumLocals)
+		} else {
+			vm.locals = vm.locals[:bytecode.NumLocals]
+			clear(vm.locals)
+		}
+	}
 
 	// Clear alias vars only if non-empty (avoid iteration cost)
 	if len(vm.aliasVars) > 0 {
@@ -69,15 +86,22 @@ func (vm *VM) setBaseInstructions(bytecode *compiler.ByteCode, contextVarsValues
 	}
 }
 
-func (vm *VM) run() error {
+func (vm *VM) run() (err error) {
 	frame := vm.currentFrame()
+	ip := frame.ip
+	defer func() {
+		if err != nil {
+			vm.fail(frame, ip, err)
+		}
+	}()
 	for frame.ip < len(frame.instructions) {
+		ip = frame.ip
 		// Cooperative cancellation: check at every opcode boundary.
 		// context.Background().Err() is always nil — zero overhead when uncancelled.
 		if err := vm.ctx.Err(); err != nil {
 			return err
 		}
-		opcode := code.Opcode(frame.instructions[frame.ip])
+		opcode := code.Opcode(frame.instructions[ip])
 		switch opcode {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
@@ -116,23 +140,72 @@ func (vm *VM) run() error {
 			frame.ip += 3
 		case code.OpStore:
 			varIndex := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
-			value := vm.Pop()
+			// The aliased value stays on the stack as the input of the pipe
+			// that follows.
+			value := vm.Top()
 			aliasName := vm.systemVars[varIndex].(string)
-			if len(vm.pipeScopes) > 0 {
-				if vm.pipeScopes[0] == nil {
-					vm.pipeScopes[0] = make(map[string]any)
+			if top := len(vm.pipeScopes) - 1; top >= 0 {
+				// Inside a predicate: visible to the nested pipes only
+				if vm.pipeScopes[top] == nil {
+					vm.pipeScopes[top] = make(map[string]any)
 				}
-				vm.pipeScopes[0][aliasName] = value // Set in outermost scope
+				vm.pipeScopes[top][aliasName] = value
 			} else {
 				// creating a new pipe scope if none exists
 				vm.pipeScopes = append(vm.pipeScopes, map[string]any{aliasName: value})
 			}
 			frame.ip += 3
+		case code.OpSetLocal:
+			slot := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
+			value := vm.popValue()
+			if value.IsAny() && isControl(value.AnyVal) {
+				return errMisplacedControl
+			}
+			vm.locals[slot] = value
+			frame.ip += 3
+		case code.OpGetLocal:
+			slot := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
+			if err := vm.pushValue(vm.locals[slot]); err != nil {
+				return err
+			}
+			frame.ip += 3
+		case code.OpTypeIs:
+			nameIdx := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
+			name := vm.constants[nameIdx].StrVal
+			if err := vm.pushBool(typeNameValue(vm.popValue()) == name); err != nil {
+				return err
+			}
+			frame.ip += 3
+		case code.OpTypeAs:
+			nameIdx := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
+			converted, err := convertValue(vm.popValue(), vm.constants[nameIdx].StrVal)
+			if err != nil {
+				return err
+			}
+			if err := vm.pushValue(converted); err != nil {
+				return err
+			}
+			frame.ip += 3
+		case code.OpRange:
+			exclusive := frame.instructions[frame.ip+1] == 1
+			step := vm.popValue()
+			end, start := vm.pop2Values()
+			r, err := newRange(start, end, step, exclusive)
+			if err != nil {
+				return err
+			}
+			if err := vm.Push(r); err != nil {
+				return err
+			}
+			frame.ip += 2
 		case code.OpIdentifier:
 			identIndex := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
 			ident := vm.systemVars[identIndex].(string)
 			val, ok := vm.getPipeVar(ident)
 			if !ok {
+				if ident == "$parent" {
+					return fmt.Errorf("undefined pipe variable: $parent (it is the $item of the enclosing pipe, so it is only set in a pipe nested in another pipe's predicate)")
+				}
 				return fmt.Errorf("undefined pipe variable: %s", ident)
 			}
 			if err := vm.Push(val); err != nil {
@@ -202,9 +275,9 @@ func (vm *VM) run() error {
 			pos := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
 			if vm.sp > 0 && vm.stack[vm.sp-1].IsNull() {
 				frame.ip = int(pos)
-				continue
+			} else {
+				frame.ip += 3
 			}
-			frame.ip += 3
 		case code.OpPop:
 			_ = vm.popValue() // Discard top of stack without boxing
 			frame.ip += 1
@@ -225,8 +298,11 @@ func (vm *VM) run() error {
 			frame.ip += 1
 		case code.OpArray:
 			length := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
-			array := vm.buildArray(int(length))
-			err := vm.Push(array)
+			array, err := vm.buildArray(int(length))
+			if err != nil {
+				return err
+			}
+			err = vm.Push(array)
 			if err != nil {
 				return err
 			}
@@ -297,32 +373,8 @@ func (vm *VM) run() error {
 			}
 			frame.ip += 5
 		case code.OpPipe:
-			pipeTypeIdx := code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3])
-			aliasIdx := code.ReadUint16(frame.instructions[frame.ip+3 : frame.ip+5])
-			blockIdx := code.ReadUint16(frame.instructions[frame.ip+5 : frame.ip+7])
-			argsIdx := code.ReadUint16(frame.instructions[frame.ip+7 : frame.ip+9])
-
-			pipeTypeVal := vm.constants[pipeTypeIdx]
-			pipeType, _ := pipeTypeVal.AsString()
-			alias := vm.systemVars[aliasIdx].(string)
-			blk, _ := vm.constants[blockIdx].ToAny().(*compiler.InstructionBlock)
-
-			// Resolve compile-time args from constants pool; nil when sentinel 0xFFFF
-			var pipeArgs []any
-			if argsIdx != 0xFFFF {
-				pipeArgs, _ = vm.constants[argsIdx].ToAny().([]any)
-			}
-
 			input := vm.Pop()
-
-			handler, ok := vm.pipeHandlers[pipeType]
-			if !ok {
-				return fmt.Errorf("unknown pipe type: %s", pipeType)
-			}
-			pctx := &pipeContextImpl{vm: vm, block: blk, alias: alias, args: pipeArgs}
-			vm.pushPipeScope()
-			result, err := handler(pctx, input)
-			vm.popPipeScope()
+			result, err := vm.dispatchPipe(vm.decodePipe(frame.instructions[frame.ip:]), input)
 			if err != nil {
 				return err
 			}
@@ -330,6 +382,24 @@ func (vm *VM) run() error {
 				return err
 			}
 			frame.ip += 9
+		case code.OpPipeChain:
+			if vm.tracer != nil {
+				// Run the stages that follow one OpPipe at a time, so
+				// that each is reported.
+				frame.ip += 3
+				break
+			}
+			n := int(code.ReadUint16(frame.instructions[frame.ip+1 : frame.ip+3]))
+			stages := frame.instructions[frame.ip+3 : frame.ip+3+n*pipeInstructionLen]
+			input := vm.Pop()
+			result, err := vm.runPipeChain(stages, n, input)
+			if err != nil {
+				return err
+			}
+			if err := vm.Push(result); err != nil {
+				return err
+			}
+			frame.ip += 3 + n*pipeInstructionLen
 		case code.OpSafeModeOn:
 			vm.safeMode = true
 			frame.ip += 1
@@ -354,16 +424,45 @@ func (vm *VM) run() error {
 		default:
 			return fmt.Errorf("unknown opcode: %v at ip=%d", opcode, frame.ip)
 		}
-
+		if vm.tracer != nil {
+			vm.traceInstruction(frame, ip, opcode)
+		}
 	}
 	return nil
 }
 
 func (vm *VM) Run(bytecode *compiler.ByteCode, contextValues map[string]any) (any, error) {
 	vm.setBaseInstructions(bytecode, contextValues)
+	vm.failErr, vm.failure = nil, compiler.SourceEntry{}
 	err := vm.run()
 	if err != nil {
 		return nil, err
 	}
-	return vm.LastPoppedStackElem(), nil
+	vm.failErr = nil // any failure recorded was handled
+	result := vm.LastPoppedStackElem()
+	if isControl(result) {
+		return nil, errMisplacedControl
+	}
+	return vm.materialize(result)
+}
+
+// Failure returns the source map entry of the instruction that raised the
+// error of the last Run, the innermost one when the error unwound through
+// pipes. It reports false when that Run succeeded or failed outside an
+// instruction, for example while converting its result.
+func (vm *VM) Failure() (compiler.SourceEntry, bool) {
+	return vm.failure, vm.failErr != nil
+}
+
+// fail records the instruction at ip of frame as the source of err, unless
+// err is an error of an inner instruction unwinding through it, and reports
+// it to an ErrorTracer.
+func (vm *VM) fail(frame *Frame, ip int, err error) {
+	step := vm.step(frame, ip, code.Opcode(frame.instructions[ip]))
+	if vm.failErr == nil || !errors.Is(err, vm.failErr) {
+		vm.failErr, vm.failure = err, step.Source
+	}
+	if t, ok := vm.tracer.(ErrorTracer); ok {
+		t.OnError(step, err)
+	}
 }
@@ -3,6 +3,7 @@ package vm
 import (
 	"fmt"
 	"math"
+	"reflect"
 	"strings"
 
 	"github.com/maniartech/uexl/code"
@@ -361,19 +362,66 @@ func (vm *VM) executeComparisonOperation(operator code.Opcode, left, right any)
 			return fmt.Errorf("boolean comparison requires bool operands, got %T and %T", left, right)
 		}
 		return vm.executeBooleanComparisonOperation(operator, l, r)
+	case []any, *Range, map[string]any:
+		// Arrays (ranges included) and objects compare deeply, by equality only.
+		switch operator {
+		case code.OpEqual:
+			return vm.pushBoolValue(deepEqual(left, right))
+		case code.OpNotEqual:
+			return vm.pushBoolValue(!deepEqual(left, right))
+		default:
+			return fmt.Errorf("%s values can only be compared with == and !=", typeName(left))
+		}
 	default:
 		return fmt.Errorf("unsupported comparison for type: %T", left)
 	}
 }
 
-func (vm *VM) buildArray(length int) []any {
+// deepEqual reports whether a and b are equal UExL values: arrays and ranges
+// with the same elements are equal, and objects with the same entries.
+func deepEqual(a, b any) bool {
+	if as, ok := asSequence(a); ok {
+		bs, ok := asSequence(b)
+		if !ok || as.Len() != bs.Len() {
+			return false
+		}
+		for i := 0; i < as.Len(); i++ {
+			if !deepEqual(as.At(i), bs.At(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	if am, ok := a.(map[string]any); ok {
+		bm, ok := b.(map[string]any)
+		if !ok || len(am) != len(bm) {
+			return false
+		}
+		for k, av := range am {
+			if bv, ok := bm[k]; !ok || !deepEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (vm *VM) buildArray(length int) ([]any, error) {
 	startIndex := vm.sp - length
 	elements := make([]any, length)
 	for i := 0; i < length; i++ {
-		elements[i] = vm.stack[startIndex+i].ToAny()
+		elem, err := vm.materialize(vm.stack[startIndex+i].ToAny())
+		if err != nil {
+			return nil, err
+		}
+		if isControl(elem) {
+			return nil, errMisplacedControl
+		}
+		elements[i] = elem
 	}
 	vm.sp = startIndex
-	return elements
+	return elements, nil
 }
 
 func (vm *VM) buildObject(startIndex, endIndex int) (map[string]any, error) {
@@ -384,7 +432,14 @@ func (vm *VM) buildObject(startIndex, endIndex int) (map[string]any, error) {
 		if !ok {
 			return nil, fmt.Errorf("expected string key, got %T", keyVal)
 		}
-		object[key] = vm.stack[i+1].ToAny()
+		value, err := vm.materialize(vm.stack[i+1].ToAny())
+		if err != nil {
+			return nil, err
+		}
+		if isControl(value) {
+			return nil, errMisplacedControl
+		}
+		object[key] = value
 	}
 	vm.sp = startIndex
 	return object, nil
@@ -483,9 +538,19 @@ func (vm *VM) callFunction(funcIndex, numArgs uint16) error {
 		if vm.sp == 0 {
 			return fmt.Errorf("not enough arguments on stack for function %s", functionName)
 		}
-		args[int(numArgs)-1-i] = vm.Pop()
+		arg := vm.Pop()
+		if isControl(arg) {
+			return fmt.Errorf("error calling function %s: %w", functionName, errMisplacedControl)
+		}
+		args[int(numArgs)-1-i] = arg
+	}
+	if err := vm.materializeArgs(function, args); err != nil {
+		return fmt.Errorf("error calling function %s: %w", functionName, err)
 	}
 	functionResult, err := function(args...)
+	if vm.tracer != nil {
+		vm.tracer.OnCall(functionName, append([]any(nil), args...), functionResult, err)
+	}
 	if err != nil {
 		return fmt.Errorf("error calling function %s: %w", functionName, err)
 	}
@@ -495,6 +560,29 @@ func (vm *VM) callFunction(funcIndex, numArgs uint16) error {
 	return vm.Push(functionResult)
 }
 
+// materializeArgs expands range arguments in place unless fn is range-aware.
+func (vm *VM) materializeArgs(fn VMFunction, args []any) error {
+	for i, arg := range args {
+		if _, ok := arg.(*Range); !ok {
+			continue
+		}
+		if rangeAwareFunctions[reflect.ValueOf(fn).Pointer()] {
+			return nil
+		}
+		m, err := vm.materialize(arg)
+		if err != nil {
+			return err
+		}
+		args[i] = m
+	}
+	return nil
+}
+
+// IsTruthy reports whether val counts as true in &&, ||, ! and conditions.
+func IsTruthy(val any) bool {
+	return isTruthy(val)
+}
+
 func isTruthy(val any) bool {
 	switch v := val.(type) {
 	case bool:
@@ -507,6 +595,8 @@ func isTruthy(val any) bool {
 		return v != ""
 	case []any:
 		return len(v) > 0
+	case *Range:
+		return v.Count > 0
 	case map[string]any:
 		return len(v) > 0
 	default:
@@ -633,6 +633,27 @@ func TestPipeFunction(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// An omitted predicate is $item; the handler decides whether it accepts one.
+func TestPipeFunction_omittedPredicate(t *testing.T) {
+	runVmTests(t, []vmTestCase{
+		{"[1,2] |map:", []any{1.0, 2.0}},
+		{"[true,false,true] |filter:", []any{true, true}},
+		{"[3,1,2] |sort:", []any{1.0, 2.0, 3.0}},
+		{"[1,2,2,3] |unique: |map: $item * 2", []any{2.0, 4.0, 6.0}},
+		{"[false,true] |some:", true},
+		{"[1,2,3] |sum:", 6.0},
+		{`{"b": 1, "a": 2} |keys:`, []any{"a", "b"}},
+		{`{"b": 1, "a": 2} |values:`, []any{2.0, 1.0}},
+		{`{"a": 1} |entries:`, []any{[]any{"a", 1.0}}},
+	})
+	runVmErrorTests(t, []vmTestCase{
+		{"1 |:", "|: pipe requires a predicate"},
+		{"[1,2] |reduce:", "reduce pipe requires a predicate"},
+		{"[1,2] |window:", "window pipe requires a predicate"},
+		{"[1,2] |chunk(2)", "chunk pipe requires a predicate"},
+	})
+}
+
 func TestNullishOperator(t *testing.T) {
 	tests := []vmTestCase{
 		// Simple member with existing key whose value is null
@@ -813,3 +834,23 @@ func TestContextValues(t *testing.T) {
 
 	runVmTests(t, tests, contextValues)
 }
+
+// A reused VM must re-resolve context variables when a different expression
+// runs with the same variables map.
+func TestContextValues_ReusedVMAndMap(t *testing.T) {
+	machine := vm.New(vm.LibContext{Functions: vm.Builtins, PipeHandlers: vm.DefaultPipeHandlers})
+	vars := map[string]any{"a": 1.0, "b": 2.0}
+	for _, tt := range []vmTestCase{{"a", 1.0}, {"1 + 1", 2.0}, {"b", 2.0}, {"a", 1.0}} {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatal(err)
+		}
+		out, err := machine.Run(comp.ByteCode(), vars)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if err := testExpectedObject(t, tt.expected, out); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+	}
+}
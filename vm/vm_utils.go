@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/maniartech/uexl/code"
+	"github.com/maniartech/uexl/compiler"
 	"github.com/maniartech/uexl/parser"
 )
 
@@ -42,7 +43,14 @@ type PipeContext interface {
 	// Zero-allocation hot path — use for map, filter, find, some, every, sort, groupBy, flatMap.
 	EvalItem(item any, index int) (any, error)
 
-	// EvalWith runs the pipe predicate with arbitrary scope variables.
+	// EvalItemWithControl is EvalItem for handlers that can end early or drop
+	// elements: when the predicate returns stop(), stop(value) or skip(), ctl
+	// says so (and value carries stop's argument). EvalItem and EvalWith report
+	// such a result as an error instead.
+	EvalItemWithControl(item any, index int) (value any, ctl Control, err error)
+
+	// EvalWith runs the pipe predicate with arbitrary scope variables; the alias,
+	// if declared, is set to scopeVars["$item"] when present.
 	// Use for accumulation patterns: reduce ($acc), window ($window), chunk ($chunk).
 	// Allocate the scope map once outside the iteration loop and reuse it for performance.
 	EvalWith(scopeVars map[string]any) (any, error)
@@ -51,10 +59,17 @@ type PipeContext interface {
 	// "|map as $x:"). Returns empty string if no alias was declared.
 	Alias() string
 
-	// Args returns compile-time literal arguments declared in the pipe header,
-	// e.g. []any{float64(3)} for |window(3):. Returns nil when no args were provided.
+	// Args returns the arguments declared in the pipe header, e.g. []any{float64(3)}
+	// for |window(3):. Non-literal arguments (|window(size * 2):) are evaluated once
+	// per dispatch in the enclosing scope, before the handler runs. Returns nil when
+	// no args were provided.
 	Args() []any
 
+	// HasPredicate reports whether the pipe was given a predicate. An omitted
+	// one, as in `prices |sum:`, evaluates to $item; a handler that cannot use
+	// that, such as reduce, returns an error instead.
+	HasPredicate() bool
+
 	// Context returns the evaluation context, enabling cancellation and deadline checks.
 	Context() context.Context
 }
@@ -71,6 +86,26 @@ type PipeHandlers map[string]PipeHandler
 type LibContext struct {
 	Functions    VMFunctions
 	PipeHandlers PipeHandlers
+	// PipeArgSchemas declares the arguments of pipe handlers; runtime-evaluated
+	// pipe arguments are type-checked against them. Optional.
+	PipeArgSchemas PipeArgSchemas
+	// MaxRangeLength caps how many elements a range value may materialize into;
+	// 0 means DefaultMaxRangeLength.
+	MaxRangeLength int
+	// Collators are the named string collations selectable with |sort("name"):. Optional.
+	Collators Collators
+	// StreamingPipes lets custom pipes run lazily inside fused pipe chains; each
+	// name must also have a PipeHandler (see StreamingPipeHandler). Optional.
+	StreamingPipes StreamingPipes
+	// Workers supplies the VMs that |pmap: and |pfilter: run their chunks on; when
+	// nil, each chunk gets a fresh VM built from this LibContext. Optional.
+	Workers VMPool
+	// Parallelism caps the goroutines a parallel pipe splits its input across;
+	// 0 means runtime.GOMAXPROCS(0) and 1 runs parallel pipes sequentially.
+	Parallelism int
+	// SequentialFunctions names functions that are not safe to call concurrently;
+	// a parallel pipe whose predicate calls one runs sequentially. Optional.
+	SequentialFunctions map[string]bool
 }
 
 // Frame represents an execution context for a function call, containing the instructions to execute,
@@ -78,6 +113,26 @@ type Frame struct {
 	instructions code.Instructions
 	ip           int
 	basePointer  int
+	sourceMap    compiler.SourceMap // positions of instructions, for tracers; may be nil
+}
+
+// pipeFastScope holds the common pipe variables in fixed fields.
+type pipeFastScope struct {
+	item   any // $item - current element in iteration
+	index  int // $index - current index in iteration
+	acc    any // $acc - accumulator for reduce operations
+	window any // $window - current window in window operations
+	chunk  any // $chunk - current chunk in chunk operations
+	last   any // $last - last value in reduce operations
+	key    any // $key - current key when iterating an object
+	value  any // $value - current value when iterating an object
+}
+
+// outerPipeScope is the fast scope of an enclosing pipe, saved while a pipe
+// nested in its predicate runs and restored when that pipe returns.
+type outerPipeScope struct {
+	fast   pipeFastScope
+	nested bool // false for a pipe that is not inside another pipe's predicate
 }
 
 // VM represents the virtual machine that executes compiled code. It maintains the execution state,
@@ -90,23 +145,26 @@ type VM struct {
 	contextVarsValues map[string]any
 	contextVarCache   []Value        // Pre-resolved context var values for O(1) access
 	lastContextValues map[string]any // Cache the last context values pointer to detect changes
+	lastContextVars   []string       // Context var names the cache was built for
 	systemVars        []any
 	aliasVars         map[string]any
 	functionContext   VMFunctions
 	pipeHandlers      PipeHandlers     // Add pipe handlers registry
+	pipeArgSchemas    PipeArgSchemas   // schemas for runtime-evaluated pipe args; may be nil
 	pipeScopes        []map[string]any // Add scope stack for pipe variables
+	locals            []Value          // statement results of multi-statement programs
+	maxRangeLen       int              // largest range materialized into a []any
+	collators         Collators        // named string collations for the sort pipe; may be nil
+	streamingPipes    StreamingPipes   // custom streaming pipes for fused chains; may be nil
+	workers           VMPool           // worker VMs for parallel pipes; may be nil
+	parallelism       int              // goroutines per parallel pipe; 0 => GOMAXPROCS
+	sequentialFuncs   map[string]bool  // functions parallel pipes must not call concurrently
 
 	// Fast-path pipe scope - eliminates map overhead for common pipe variables
 	// Using direct field access instead of map[string]any reduces 83% overhead
-	pipeFastScope struct {
-		item   any // $item - current element in iteration
-		index  int // $index - current index in iteration
-		acc    any // $acc - accumulator for reduce operations
-		window any // $window - current window in window operations
-		chunk  any // $chunk - current chunk in chunk operations
-		last   any // $last - last value in reduce operations
-	}
-	pipeFastScopeActive bool // Flag indicating fast-path is active (reduces branch cost)
+	pipeFastScope       pipeFastScope
+	pipeFastScopeActive bool             // Flag indicating fast-path is active (reduces branch cost)
+	outerPipeScopes     []outerPipeScope // fast scopes of the enclosing pipes, one per pipe scope
 
 	stack     []Value
 	sp        int
@@ -114,6 +172,10 @@ type VM struct {
 	framesIdx int
 	safeMode  bool
 	ctx       context.Context // evaluation context; defaults to context.Background()
+	tracer    Tracer          // observes the evaluation; nil when not tracing
+
+	failErr error                // the error of the failed instruction of this Run, if any
+	failure compiler.SourceEntry // the source of that instruction
 }
 
 func New(libCtx LibContext) *VM {
@@ -124,10 +186,21 @@ func New(libCtx LibContext) *VM {
 		libCtx.Functions = make(VMFunctions)
 	}
 
+	if libCtx.MaxRangeLength <= 0 {
+		libCtx.MaxRangeLength = DefaultMaxRangeLength
+	}
+
 	return &VM{
 		ctx:             context.Background(),
+		maxRangeLen:     libCtx.MaxRangeLength,
 		functionContext: libCtx.Functions,
 		pipeHandlers:    libCtx.PipeHandlers,
+		pipeArgSchemas:  libCtx.PipeArgSchemas,
+		collators:       libCtx.Collators,
+		streamingPipes:  libCtx.StreamingPipes,
+		workers:         libCtx.Workers,
+		parallelism:     libCtx.Parallelism,
+		sequentialFuncs: libCtx.SequentialFunctions,
 		frames:          make([]*Frame, MaxFrames),
 		pipeScopes:      make([]map[string]any, 0),
 		stack:           make([]Value, StackSize),
@@ -136,6 +209,21 @@ func New(libCtx LibContext) *VM {
 
 }
 
+// libContext returns the LibContext the VM was built from.
+func (vm *VM) libContext() LibContext {
+	return LibContext{
+		Functions:           vm.functionContext,
+		PipeHandlers:        vm.pipeHandlers,
+		PipeArgSchemas:      vm.pipeArgSchemas,
+		MaxRangeLength:      vm.maxRangeLen,
+		Collators:           vm.collators,
+		StreamingPipes:      vm.streamingPipes,
+		Workers:             vm.workers,
+		Parallelism:         vm.parallelism,
+		SequentialFunctions: vm.sequentialFuncs,
+	}
+}
+
 // SetContext sets the evaluation context for this VM instance.
 // Must be called before Run. A nil ctx is normalized to context.Background().
 // Safe to call on a VM borrowed from sync.Pool before each evaluation.
@@ -265,7 +353,12 @@ func (vm *VM) pushBoolValue(b bool) error {
 	return vm.pushValue(Value{Typ: TypeBool, BoolVal: b})
 }
 
+// pushPipeScope opens the scope of a pipe. A pipe nested in another pipe's
+// predicate saves the outer $item, $index, ... so that popPipeScope can
+// restore them; until the nested pipe sets its own, they stay visible in it.
 func (vm *VM) pushPipeScope() {
+	nested := len(vm.outerPipeScopes) > 0
+	vm.outerPipeScopes = append(vm.outerPipeScopes, outerPipeScope{fast: vm.pipeFastScope, nested: nested})
 	// Lazy allocation: push nil scope, map created on demand in setPipeVar
 	vm.pipeScopes = append(vm.pipeScopes, nil)
 	// Activate fast-path for common pipe operations
@@ -276,6 +369,14 @@ func (vm *VM) popPipeScope() {
 	if len(vm.pipeScopes) > 0 {
 		vm.pipeScopes = vm.pipeScopes[:len(vm.pipeScopes)-1]
 	}
+	if n := len(vm.outerPipeScopes); n > 0 {
+		outer := vm.outerPipeScopes[n-1]
+		vm.outerPipeScopes = vm.outerPipeScopes[:n-1]
+		if outer.nested {
+			vm.pipeFastScope = outer.fast
+			return
+		}
+	}
 	// Deactivate fast-path when no pipe scopes remain
 	vm.pipeFastScopeActive = len(vm.pipeScopes) > 0
 }
@@ -302,6 +403,12 @@ func (vm *VM) setPipeVar(name string, value any) {
 		case "$last":
 			vm.pipeFastScope.last = value
 			return
+		case "$key":
+			vm.pipeFastScope.key = value
+			return
+		case "$value":
+			vm.pipeFastScope.value = value
+			return
 		}
 	}
 	// Fall back to map for custom variables (aliases, etc.)
@@ -330,6 +437,16 @@ func (vm *VM) getPipeVar(name string) (any, bool) {
 			return vm.pipeFastScope.chunk, true
 		case "$last":
 			return vm.pipeFastScope.last, true
+		case "$key":
+			return vm.pipeFastScope.key, true
+		case "$value":
+			return vm.pipeFastScope.value, true
+		case "$parent":
+			// $item of the pipe whose predicate contains this one
+			if n := len(vm.outerPipeScopes); n > 0 && vm.outerPipeScopes[n-1].nested {
+				return vm.outerPipeScopes[n-1].fast.item, true
+			}
+			return nil, false
 		}
 	}
 	// Fall back to map for custom variables (aliases, etc.)